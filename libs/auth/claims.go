@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// KindCustomer is the kind of the tokens issued to customers (the subject is the customer ID)
+	KindCustomer = "customer"
+
+	// KindService is the kind of the tokens issued to services (the subject is the name of the calling service)
+	KindService = "service"
+)
+
+// Claims are the claims of the tokens issued and verified by this package
+type Claims struct {
+	jwt.RegisteredClaims
+
+	// Kind is the kind of the subject (KindCustomer or KindService)
+	Kind string `json:"kind,omitempty"`
+
+	// Scope is the space separated list of the scopes granted to the subject (e.g. "orders:read orders:write")
+	Scope string `json:"scope,omitempty"`
+}
+
+// Scopes returns the scopes granted to the subject
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope returns true when the scope was granted to the subject
+func (c *Claims) HasScope(scope string) bool {
+	for _, granted := range c.Scopes() {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
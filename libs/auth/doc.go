@@ -0,0 +1,11 @@
+// Package auth provides the shared JWT authentication primitives, so that customer authentication and
+// service-to-service authentication use the same (hardened) code:
+//
+//   - Issuer signs tokens (e.g. for a customer after login, or for a service calling another service)
+//   - Verifier verifies tokens with the public keys of a KeyProvider (e.g. the JWKS of the issuer, so that its signing
+//     key can be rotated without redeploying the verifiers)
+//   - Middleware authenticates server requests (compatible with gorilla's mux.MiddlewareFunc)
+//   - Transport authenticates client requests (e.g. as the transport of smarthttp's Client) with a TokenSource
+//
+// Only asymmetric algorithms (RSA and ECDSA) are supported so that the verifiers never hold a key that can issue tokens.
+package auth
@@ -0,0 +1,5 @@
+module github.com/karelrenaldi/storemono/libs/auth
+
+go 1.16
+
+require github.com/golang-jwt/jwt/v4 v4.5.2
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const defaultTokenTTL = 15 * time.Minute
+
+// Issuer issues (signs) tokens
+type Issuer struct {
+	// Issuer is the "iss" claim of the tokens (e.g. "shop-service"); verifiers can require it (see Verifier.Issuer)
+	Issuer string
+
+	// Key is the key that signs the tokens (see SigningKey and JWKSHandler for key rotation)
+	Key SigningKey
+
+	// TTL is how long the tokens are valid (default: 15 minutes)
+	TTL time.Duration
+}
+
+// Issue signs a token with the claims.
+// The issuer, the issue time, a unique ID and (when not set) the expiry are added to the claims.
+func (i *Issuer) Issue(claims *Claims) (string, error) {
+	token, _, err := i.issue(claims)
+
+	return token, err
+}
+
+// IssueCustomer issues a token for the customer (see KindCustomer) to call the audience (e.g. "shop-api")
+func (i *Issuer) IssueCustomer(customerID, audience string, scopes ...string) (string, error) {
+	return i.Issue(newClaims(KindCustomer, customerID, audience, scopes))
+}
+
+// IssueService issues a token for the service (see KindService) to call the audience (e.g. "orders-service")
+func (i *Issuer) IssueService(service, audience string, scopes ...string) (string, error) {
+	return i.Issue(newClaims(KindService, service, audience, scopes))
+}
+
+// issue signs a token with the claims and returns it with its expiry
+func (i *Issuer) issue(claims *Claims) (string, time.Time, error) {
+	err := i.Key.validate()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+
+	claims.Issuer = i.Issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ID = newTokenID()
+
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(i.getTTL()))
+	}
+
+	token := jwt.NewWithClaims(i.Key.Method, claims)
+	token.Header["kid"] = i.Key.ID
+
+	signed, err := token.SignedString(i.Key.Key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, claims.ExpiresAt.Time, nil
+}
+
+func (i *Issuer) getTTL() time.Duration {
+	if i.TTL > 0 {
+		return i.TTL
+	}
+
+	return defaultTokenTTL
+}
+
+func newClaims(kind, subject, audience string, scopes []string) *Claims {
+	claims := &Claims{Kind: kind}
+	claims.Subject = subject
+
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+
+	for index, scope := range scopes {
+		if index > 0 {
+			claims.Scope += " "
+		}
+
+		claims.Scope += scope
+	}
+
+	return claims
+}
+
+// newTokenID returns a random ID for the "jti" claim
+func newTokenID() string {
+	id := make([]byte, 16)
+
+	// crypto/rand does not fail on the supported platforms
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefreshInterval    = time.Hour
+	defaultJWKSMinRefreshInterval = time.Minute
+	defaultJWKSTimeout            = 10 * time.Second
+)
+
+// ErrJWKS indicates that the JWK set could not be fetched (or parsed)
+var ErrJWKS = errors.New("unable to fetch JWK set")
+
+// JWK is a public key in the JSON Web Key format (RFC 7517); RSA and EC (P-256, P-384 and P-521) keys are supported
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// N and E are the modulus and exponent of an RSA key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Curve, X and Y are the curve and coordinates of an EC key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKSet is a set of public keys in the JSON Web Key format
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK returns the public key of the signing key as a JWK
+func NewJWK(key SigningKey) (JWK, error) {
+	err := key.validate()
+	if err != nil {
+		return JWK{}, err
+	}
+
+	out := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+	switch public := key.Key.Public().(type) {
+	case *rsa.PublicKey:
+		out.KeyType = "RSA"
+		out.N = encodeBigInt(public.N.Bytes())
+		out.E = encodeBigInt(big.NewInt(int64(public.E)).Bytes())
+
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+
+		out.KeyType = "EC"
+		out.Curve = public.Curve.Params().Name
+		out.X = encodeBigInt(public.X.FillBytes(make([]byte, size)))
+		out.Y = encodeBigInt(public.Y.FillBytes(make([]byte, size)))
+
+	default:
+		return JWK{}, fmt.Errorf("%w - key type %T", ErrUnsupportedKey, public)
+	}
+
+	return out, nil
+}
+
+// PublicKey returns the public key of the JWK
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w - invalid RSA exponent of key '%s'", ErrUnsupportedKey, k.KeyID)
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+
+		case "P-384":
+			curve = elliptic.P384()
+
+		case "P-521":
+			curve = elliptic.P521()
+
+		default:
+			return nil, fmt.Errorf("%w - curve '%s' of key '%s'", ErrUnsupportedKey, k.Curve, k.KeyID)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("%w - point of key '%s' is not on the curve", ErrUnsupportedKey, k.KeyID)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("%w - key type '%s' of key '%s'", ErrUnsupportedKey, k.KeyType, k.KeyID)
+	}
+}
+
+// JWKSHandler returns a handler that serves the public keys of the signing keys as a JWK set (e.g. on
+// /.well-known/jwks.json) for the JWKS of the verifiers.
+// To rotate the signing key, serve the new key alongside the current one until the verifiers have fetched it, then sign
+// with the new key and keep serving the previous key until the tokens it signed have expired.
+func JWKSHandler(keys ...SigningKey) (http.Handler, error) {
+	set := JWKSet{Keys: make([]JWK, 0, len(keys))}
+
+	for _, key := range keys {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			return nil, err
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	body, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
+		resp.Header().Set("Content-Type", "application/json")
+		resp.Header().Set("Cache-Control", "public, max-age=300")
+
+		_, _ = resp.Write(body)
+	}), nil
+}
+
+// JWKS is a KeyProvider that fetches the public keys from the JWK set of the issuer (see JWKSHandler).
+// The set is refreshed periodically and when a token is signed with an unknown key (i.e. the issuer has rotated its key);
+// when a refresh fails, the keys fetched previously are used.
+type JWKS struct {
+	// URL is the URL of the JWK set (e.g. "https://accounts.internal/.well-known/jwks.json")
+	URL string
+
+	// Client (optionally) is the HTTP client used to fetch the set (default: a client with a 10 second timeout)
+	Client *http.Client
+
+	// RefreshInterval is how long the set is used before it is fetched again (default: 1 hour)
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval is the minimum time between two fetches of the set, so that tokens with unknown keys cannot
+	// be used to flood the issuer (default: 1 minute)
+	MinRefreshInterval time.Duration
+
+	mutex   sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+
+	// serializes the fetches
+	refreshMutex sync.Mutex
+}
+
+// PublicKey implements KeyProvider
+func (j *JWKS) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	key, ok, fetched := j.get(keyID)
+
+	refreshDue := time.Since(fetched) >= j.getRefreshInterval()
+	if ok && !refreshDue {
+		return key, nil
+	}
+
+	if !ok && time.Since(fetched) < j.getMinRefreshInterval() {
+		return nil, fmt.Errorf("%w - '%s'", ErrUnknownKey, keyID)
+	}
+
+	err := j.refresh(ctx, fetched)
+	if err != nil && !ok {
+		return nil, err
+	}
+
+	key, ok, _ = j.get(keyID)
+	if !ok {
+		return nil, fmt.Errorf("%w - '%s'", ErrUnknownKey, keyID)
+	}
+
+	return key, nil
+}
+
+func (j *JWKS) get(keyID string) (crypto.PublicKey, bool, time.Time) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	key, ok := j.keys[keyID]
+
+	return key, ok, j.fetched
+}
+
+// refresh fetches the set unless it was fetched (by another caller) since the previous fetch
+func (j *JWKS) refresh(ctx context.Context, previous time.Time) error {
+	j.refreshMutex.Lock()
+	defer j.refreshMutex.Unlock()
+
+	j.mutex.RLock()
+	fetched := j.fetched
+	j.mutex.RUnlock()
+
+	if fetched.After(previous) {
+		return nil
+	}
+
+	keys, err := j.fetch(ctx)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// a failed fetch also waits for MinRefreshInterval (the previous keys are kept)
+	j.fetched = time.Now()
+
+	if err != nil {
+		return err
+	}
+
+	j.keys = keys
+
+	return nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrJWKS, err)
+	}
+
+	resp, err := j.getClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrJWKS, err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w - unexpected status code %d", ErrJWKS, resp.StatusCode)
+	}
+
+	var set JWKSet
+
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrJWKS, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// keys of unsupported types are skipped so that the issuer can publish them
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func (j *JWKS) getClient() *http.Client {
+	if j.Client != nil {
+		return j.Client
+	}
+
+	return &http.Client{Timeout: defaultJWKSTimeout}
+}
+
+func (j *JWKS) getRefreshInterval() time.Duration {
+	if j.RefreshInterval > 0 {
+		return j.RefreshInterval
+	}
+
+	return defaultJWKSRefreshInterval
+}
+
+func (j *JWKS) getMinRefreshInterval() time.Duration {
+	if j.MinRefreshInterval > 0 {
+		return j.MinRefreshInterval
+	}
+
+	return defaultJWKSMinRefreshInterval
+}
+
+func encodeBigInt(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("%w - invalid JWK parameter", ErrUnsupportedKey)
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves the public keys of the signing keys (which can be replaced, e.g. to rotate the keys) and counts the
+// fetches
+type jwksServer struct {
+	*httptest.Server
+
+	fetches int64
+
+	mutex   sync.Mutex
+	handler http.Handler
+	fail    bool
+}
+
+func newJWKSServer(t *testing.T, keys ...SigningKey) *jwksServer {
+	t.Helper()
+
+	server := &jwksServer{}
+	server.setKeys(t, keys...)
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&server.fetches, 1)
+
+		server.mutex.Lock()
+		handler, fail := server.handler, server.fail
+		server.mutex.Unlock()
+
+		if fail {
+			http.Error(resp, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		handler.ServeHTTP(resp, req)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *jwksServer) setKeys(t *testing.T, keys ...SigningKey) {
+	t.Helper()
+
+	handler, err := JWKSHandler(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mutex.Lock()
+	s.handler = handler
+	s.mutex.Unlock()
+}
+
+func (s *jwksServer) setFail(fail bool) {
+	s.mutex.Lock()
+	s.fail = fail
+	s.mutex.Unlock()
+}
+
+func (s *jwksServer) getFetches() int64 {
+	return atomic.LoadInt64(&s.fetches)
+}
+
+func TestJWK_PublicKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  SigningKey
+	}{
+		{name: "RSA", key: newRSAKey(t, "rsa-1")},
+		{name: "EC", key: newECKey(t, "ec-1")},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			jwk, err := NewJWK(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if jwk.KeyID != test.key.ID || jwk.Algorithm != test.key.Method.Alg() {
+				t.Errorf("unexpected JWK: %+v", jwk)
+			}
+
+			public, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(public, test.key.Key.Public()) {
+				t.Errorf("public key does not match the signing key")
+			}
+		})
+	}
+}
+
+func TestJWKS_PublicKey(t *testing.T) {
+	current := newRSAKey(t, "key-1")
+	next := newECKey(t, "key-2")
+
+	tests := []struct {
+		name string
+		// run uses the JWKS (of the server) and returns the expected number of fetches
+		run func(t *testing.T, server *jwksServer, jwks *JWKS) int64
+	}{
+		{
+			name: "known key is fetched once",
+			run: func(t *testing.T, _ *jwksServer, jwks *JWKS) int64 {
+				for i := 0; i < 3; i++ {
+					_, err := jwks.PublicKey(context.Background(), current.ID)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				return 1
+			},
+		},
+		{
+			name: "unknown key triggers a refresh (key rotation)",
+			run: func(t *testing.T, server *jwksServer, jwks *JWKS) int64 {
+				jwks.MinRefreshInterval = time.Millisecond
+
+				_, err := jwks.PublicKey(context.Background(), current.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				server.setKeys(t, current, next)
+				time.Sleep(2 * time.Millisecond)
+
+				_, err = jwks.PublicKey(context.Background(), next.ID)
+				if err != nil {
+					t.Fatalf("expected the rotated key after a refresh, got: %v", err)
+				}
+
+				return 2
+			},
+		},
+		{
+			name: "refreshes for unknown keys are throttled",
+			run: func(t *testing.T, _ *jwksServer, jwks *JWKS) int64 {
+				jwks.MinRefreshInterval = time.Hour
+
+				_, err := jwks.PublicKey(context.Background(), current.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i := 0; i < 10; i++ {
+					_, err = jwks.PublicKey(context.Background(), "unknown")
+					if !errors.Is(err, ErrUnknownKey) {
+						t.Fatalf("expected an error wrapping ErrUnknownKey, got: %v", err)
+					}
+				}
+
+				return 1
+			},
+		},
+		{
+			name: "previous keys are used when a refresh fails",
+			run: func(t *testing.T, server *jwksServer, jwks *JWKS) int64 {
+				jwks.RefreshInterval = time.Millisecond
+				jwks.MinRefreshInterval = time.Millisecond
+
+				_, err := jwks.PublicKey(context.Background(), current.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				server.setFail(true)
+				time.Sleep(2 * time.Millisecond)
+
+				_, err = jwks.PublicKey(context.Background(), current.ID)
+				if err != nil {
+					t.Fatalf("expected the previous key, got: %v", err)
+				}
+
+				return 2
+			},
+		},
+		{
+			name: "fetch failure without previous keys",
+			run: func(t *testing.T, server *jwksServer, jwks *JWKS) int64 {
+				server.setFail(true)
+
+				_, err := jwks.PublicKey(context.Background(), current.ID)
+				if !errors.Is(err, ErrJWKS) {
+					t.Fatalf("expected an error wrapping ErrJWKS, got: %v", err)
+				}
+
+				return 1
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			server := newJWKSServer(t, current)
+			jwks := &JWKS{URL: server.URL}
+
+			wantFetches := test.run(t, server, jwks)
+
+			if got := server.getFetches(); got != wantFetches {
+				t.Errorf("expected %d fetches, got %d", wantFetches, got)
+			}
+		})
+	}
+}
+
+func TestVerifier_JWKS(t *testing.T) {
+	key := newECKey(t, "key-1")
+	server := newJWKSServer(t, key)
+
+	verifier := &Verifier{Keys: &JWKS{URL: server.URL}, Issuer: testIssuer, Audience: testAudience}
+
+	_, err := verifier.Verify(context.Background(), sign(t, key.Method, key.ID, key.Key, validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	// ErrUnknownKey indicates that the key ID of a token is not known to the KeyProvider
+	ErrUnknownKey = errors.New("unknown key")
+
+	// ErrUnsupportedKey indicates that the key (or its algorithm) is not supported
+	ErrUnsupportedKey = errors.New("unsupported key")
+)
+
+// the algorithms accepted by default (see Verifier.Methods)
+var defaultMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// SigningKey is a private key that signs tokens
+type SigningKey struct {
+	// ID identifies the key (the "kid" header of the tokens) so that the verifiers can pick the matching public key, e.g.
+	// while the previous key is being rotated out
+	ID string
+
+	// Method is the signing algorithm (e.g. jwt.SigningMethodRS256 or jwt.SigningMethodES256)
+	Method jwt.SigningMethod
+
+	// Key is the private key (*rsa.PrivateKey or *ecdsa.PrivateKey)
+	Key crypto.Signer
+}
+
+func (k SigningKey) validate() error {
+	switch {
+	case k.ID == "":
+		return fmt.Errorf("%w - signing key ID is required", ErrUnsupportedKey)
+
+	case k.Method == nil || k.Key == nil:
+		return fmt.Errorf("%w - signing key method and key are required", ErrUnsupportedKey)
+	}
+
+	switch k.Key.(type) {
+	case *rsa.PrivateKey:
+		if _, ok := k.Method.(*jwt.SigningMethodRSA); ok {
+			return nil
+		}
+
+		if _, ok := k.Method.(*jwt.SigningMethodRSAPSS); ok {
+			return nil
+		}
+
+	case *ecdsa.PrivateKey:
+		if _, ok := k.Method.(*jwt.SigningMethodECDSA); ok {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w - key type does not match method '%s'", ErrUnsupportedKey, k.Method.Alg())
+}
+
+// KeyProvider provides the public keys that verify the tokens (see Verifier)
+type KeyProvider interface {
+	// PublicKey returns the public key with the ID (an error wrapping ErrUnknownKey when there is none)
+	PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error)
+}
+
+// StaticKeys is a KeyProvider of a fixed set of public keys (by ID)
+type StaticKeys map[string]crypto.PublicKey
+
+// PublicKey implements KeyProvider
+func (s StaticKeys) PublicKey(_ context.Context, keyID string) (crypto.PublicKey, error) {
+	key, ok := s[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w - '%s'", ErrUnknownKey, keyID)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrMissingToken indicates that the request has no bearer token
+var ErrMissingToken = errors.New("missing bearer token")
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of the context that carries the claims
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the authenticated request (see Middleware), nil when there are none
+func ClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+
+	return claims
+}
+
+// BearerToken returns the bearer token of the Authorization header of the request
+func BearerToken(req *http.Request) (string, error) {
+	header := req.Header.Get("Authorization")
+
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", ErrMissingToken
+	}
+
+	return strings.TrimSpace(header[len(prefix):]), nil
+}
+
+// Middleware returns a server middleware (compatible with gorilla's mux.MiddlewareFunc) that rejects requests without a
+// valid bearer token with 401 and a WWW-Authenticate header.
+// The claims of the token are available to the next handlers via ClaimsFromContext.
+func Middleware(verifier *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			token, err := BearerToken(req)
+			if err != nil {
+				unauthorized(resp, "")
+				return
+			}
+
+			claims, err := verifier.Verify(req.Context(), token)
+			if err != nil {
+				// the details of the error are not disclosed to the caller
+				unauthorized(resp, "invalid_token")
+				return
+			}
+
+			next.ServeHTTP(resp, req.WithContext(WithClaims(req.Context(), claims)))
+		})
+	}
+}
+
+// RequireScope returns a server middleware (compatible with gorilla's mux.MiddlewareFunc) that rejects requests whose
+// token was not granted the scope with 403.
+// It must be used after Middleware; requests that were not authenticated are rejected with 401.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			claims := ClaimsFromContext(req.Context())
+			if claims == nil {
+				unauthorized(resp, "")
+				return
+			}
+
+			if !claims.HasScope(scope) {
+				resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				http.Error(resp, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+				return
+			}
+
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+func unauthorized(resp http.ResponseWriter, code string) {
+	challenge := "Bearer"
+	if code != "" {
+		challenge += fmt.Sprintf(` error="%s"`, code)
+	}
+
+	resp.Header().Set("WWW-Authenticate", challenge)
+	http.Error(resp, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	key := newRSAKey(t, "key-1")
+	issuer := &Issuer{Issuer: testIssuer, Key: key}
+
+	verifier := &Verifier{
+		Keys:     StaticKeys{key.ID: key.Key.Public()},
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	}
+
+	issue := func(t *testing.T, audience string, scopes ...string) string {
+		token, err := issuer.IssueCustomer("customer-1", audience, scopes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	tests := []struct {
+		name string
+		// authorization is the Authorization header of the request (none when empty)
+		authorization  func(t *testing.T) string
+		scope          string
+		wantStatus     int
+		wantChallenge  string
+		wantNextCalled bool
+	}{
+		{
+			name:           "valid token",
+			authorization:  func(t *testing.T) string { return "Bearer " + issue(t, testAudience) },
+			wantStatus:     http.StatusOK,
+			wantNextCalled: true,
+		},
+		{
+			name:           "case-insensitive scheme",
+			authorization:  func(t *testing.T) string { return "bearer " + issue(t, testAudience) },
+			wantStatus:     http.StatusOK,
+			wantNextCalled: true,
+		},
+		{
+			name:          "missing token",
+			authorization: func(_ *testing.T) string { return "" },
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+		},
+		{
+			name:          "not a bearer token",
+			authorization: func(_ *testing.T) string { return "Basic dXNlcjpwYXNzd29yZA==" },
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+		},
+		{
+			name:          "invalid token",
+			authorization: func(_ *testing.T) string { return "Bearer not.a.token" },
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+		},
+		{
+			name:          "token for another audience",
+			authorization: func(t *testing.T) string { return "Bearer " + issue(t, "orders-service") },
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+		},
+		{
+			name:           "granted scope",
+			authorization:  func(t *testing.T) string { return "Bearer " + issue(t, testAudience, "orders:read", "orders:write") },
+			scope:          "orders:write",
+			wantStatus:     http.StatusOK,
+			wantNextCalled: true,
+		},
+		{
+			name:          "missing scope",
+			authorization: func(t *testing.T) string { return "Bearer " + issue(t, testAudience, "orders:read") },
+			scope:         "orders:write",
+			wantStatus:    http.StatusForbidden,
+			wantChallenge: `Bearer error="insufficient_scope", scope="orders:write"`,
+		},
+		{
+			name:          "scope without a token",
+			authorization: func(_ *testing.T) string { return "" },
+			scope:         "orders:write",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			nextCalled := false
+
+			var handler http.Handler = http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				nextCalled = true
+
+				if claims := ClaimsFromContext(req.Context()); claims == nil || claims.Subject != "customer-1" {
+					t.Errorf("unexpected claims: %+v", claims)
+				}
+
+				resp.WriteHeader(http.StatusOK)
+			})
+
+			if test.scope != "" {
+				handler = RequireScope(test.scope)(handler)
+			}
+
+			handler = Middleware(verifier)(handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if authorization := test.authorization(t); authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != test.wantStatus {
+				t.Errorf("expected status %d, got %d", test.wantStatus, resp.Code)
+			}
+
+			if got := resp.Header().Get("WWW-Authenticate"); got != test.wantChallenge {
+				t.Errorf("expected challenge %q, got %q", test.wantChallenge, got)
+			}
+
+			if nextCalled != test.wantNextCalled {
+				t.Errorf("expected next called: %t, got: %t", test.wantNextCalled, nextCalled)
+			}
+		})
+	}
+}
+
+func TestRequireScope_WithoutMiddleware(t *testing.T) {
+	handler := RequireScope("orders:read")(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		t.Error("next must not be called")
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if resp.Code != http.StatusUnauthorized || !strings.HasPrefix(resp.Header().Get("WWW-Authenticate"), "Bearer") {
+		t.Errorf("expected 401 with a bearer challenge, got %d %q", resp.Code, resp.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokens are renewed this long before they expire, so that they do not expire in flight
+const tokenRenewBefore = time.Minute
+
+// TokenSource provides the bearer tokens of the client requests (see Transport)
+type TokenSource interface {
+	// Token returns a valid token
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc is a function that implements TokenSource
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token implements TokenSource
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// NewServiceTokenSource returns a TokenSource that issues tokens for the service to call the audience (see
+// Issuer.IssueService); a token is reused until shortly before it expires.
+func NewServiceTokenSource(issuer *Issuer, service, audience string, scopes ...string) TokenSource {
+	return &serviceTokenSource{issuer: issuer, service: service, audience: audience, scopes: scopes}
+}
+
+type serviceTokenSource struct {
+	issuer   *Issuer
+	service  string
+	audience string
+	scopes   []string
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (s *serviceTokenSource) Token(_ context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && time.Until(s.expires) > tokenRenewBefore {
+		return s.token, nil
+	}
+
+	token, expires, err := s.issuer.issue(newClaims(KindService, s.service, s.audience, s.scopes))
+	if err != nil {
+		return "", err
+	}
+
+	s.token, s.expires = token, expires
+
+	return token, nil
+}
+
+// Transport is an http.RoundTripper that adds the bearer token of the Source to the requests, e.g. to authenticate the
+// requests of smarthttp's Client:
+//
+//	client := &smarthttp.Client{Client: &http.Client{Transport: &auth.Transport{Source: source}}}
+type Transport struct {
+	// Source provides the tokens
+	Source TokenSource
+
+	// Base (optionally) is the transport that sends the requests (default: http.DefaultTransport)
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return t.getBase().RoundTrip(req)
+}
+
+func (t *Transport) getBase() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+
+	return http.DefaultTransport
+}
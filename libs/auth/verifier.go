@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const defaultLeeway = 30 * time.Second
+
+var (
+	// ErrInvalidToken indicates that the token is malformed, has an invalid signature or does not have the required
+	// claims
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrExpiredToken indicates that the token has expired (or is not valid yet)
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Verifier verifies tokens
+type Verifier struct {
+	// Keys provides the public keys that verify the tokens (e.g. a JWKS or StaticKeys)
+	Keys KeyProvider
+
+	// Issuer (optionally) is the required "iss" claim
+	Issuer string
+
+	// Audience (optionally) is the required "aud" claim (e.g. the name of this service).
+	// Setting this is strongly recommended so that a token issued for another service cannot be replayed against this one.
+	Audience string
+
+	// Leeway is the allowed clock skew when checking the expiry and not before claims (default: 30 seconds)
+	Leeway time.Duration
+
+	// Methods (optionally) restricts the accepted signing algorithms (default: the RSA, RSA-PSS and ECDSA algorithms).
+	// Symmetric algorithms (HMAC) and "none" are never accepted.
+	Methods []string
+}
+
+// Verify verifies the token and returns its claims.
+// An error wrapping ErrInvalidToken or ErrExpiredToken is returned when the token is rejected.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+
+	// the time based claims are checked below (with the leeway)
+	parser := jwt.NewParser(jwt.WithValidMethods(v.getMethods()), jwt.WithoutClaimsValidation())
+
+	_, err := parser.ParseWithClaims(token, claims, func(parsed *jwt.Token) (interface{}, error) {
+		keyID, _ := parsed.Header["kid"].(string)
+		if keyID == "" {
+			return nil, fmt.Errorf("%w - token has no key ID", ErrUnknownKey)
+		}
+
+		return v.Keys.PublicKey(ctx, keyID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	leeway := v.getLeeway()
+
+	switch {
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w - token has no expiry", ErrInvalidToken)
+
+	case !claims.VerifyExpiresAt(now.Add(-leeway), true):
+		return nil, fmt.Errorf("%w - expired at %s", ErrExpiredToken, claims.ExpiresAt.Time)
+
+	case !claims.VerifyNotBefore(now.Add(leeway), false):
+		return nil, fmt.Errorf("%w - not valid before %s", ErrExpiredToken, claims.NotBefore.Time)
+
+	case v.Issuer != "" && !claims.VerifyIssuer(v.Issuer, true):
+		return nil, fmt.Errorf("%w - unexpected issuer '%s'", ErrInvalidToken, claims.RegisteredClaims.Issuer)
+
+	case v.Audience != "" && !claims.VerifyAudience(v.Audience, true):
+		return nil, fmt.Errorf("%w - token is not intended for '%s'", ErrInvalidToken, v.Audience)
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) getMethods() []string {
+	methods := v.Methods
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+
+	// only the asymmetric algorithms can be enabled
+	out := make([]string, 0, len(methods))
+
+	for _, method := range methods {
+		for _, supported := range defaultMethods {
+			if method == supported {
+				out = append(out, method)
+			}
+		}
+	}
+
+	return out
+}
+
+func (v *Verifier) getLeeway() time.Duration {
+	if v.Leeway > 0 {
+		return v.Leeway
+	}
+
+	return defaultLeeway
+}
@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testIssuer   = "accounts"
+	testAudience = "shop-api"
+)
+
+func newRSAKey(t *testing.T, id string) SigningKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SigningKey{ID: id, Method: jwt.SigningMethodRS256, Key: key}
+}
+
+func newECKey(t *testing.T, id string) SigningKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SigningKey{ID: id, Method: jwt.SigningMethodES256, Key: key}
+}
+
+// validClaims returns claims that are accepted by the verifier of the tests
+func validClaims() *Claims {
+	now := time.Now()
+
+	claims := &Claims{Kind: KindCustomer, Scope: "orders:read"}
+	claims.Issuer = testIssuer
+	claims.Subject = "customer-1"
+	claims.Audience = jwt.ClaimStrings{testAudience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Minute))
+
+	return claims
+}
+
+// sign signs the claims with the key (the "kid" header is omitted when keyID is empty)
+func sign(t *testing.T, method jwt.SigningMethod, keyID string, key interface{}, claims *Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	ecKey := newECKey(t, "ec-1")
+	otherKey := newRSAKey(t, "rsa-1")
+
+	verifier := &Verifier{
+		Keys: StaticKeys{
+			rsaKey.ID: rsaKey.Key.Public(),
+			ecKey.ID:  ecKey.Key.Public(),
+		},
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr error
+	}{
+		{
+			name: "valid RS256 token",
+			token: func(t *testing.T) string {
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, validClaims())
+			},
+		},
+		{
+			name: "valid ES256 token",
+			token: func(t *testing.T) string {
+				return sign(t, ecKey.Method, ecKey.ID, ecKey.Key, validClaims())
+			},
+		},
+		{
+			name: "issued by the issuer",
+			token: func(t *testing.T) string {
+				issuer := &Issuer{Issuer: testIssuer, Key: rsaKey}
+
+				token, err := issuer.IssueCustomer("customer-1", testAudience, "orders:read")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return token
+			},
+		},
+		{
+			name: "symmetric algorithm",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, rsaKey.ID, []byte("secret"), validClaims())
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "none algorithm",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, rsaKey.ID, jwt.UnsafeAllowNoneSignatureType, validClaims())
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "algorithm not matching the key",
+			token: func(t *testing.T) string {
+				// signed by the EC key but claims to be signed by the RSA key
+				return sign(t, ecKey.Method, rsaKey.ID, ecKey.Key, validClaims())
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "signed by another key",
+			token: func(t *testing.T) string {
+				return sign(t, otherKey.Method, otherKey.ID, otherKey.Key, validClaims())
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "missing key ID",
+			token: func(t *testing.T) string {
+				return sign(t, rsaKey.Method, "", rsaKey.Key, validClaims())
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "unknown key ID",
+			token: func(t *testing.T) string {
+				return sign(t, rsaKey.Method, "rsa-2", rsaKey.Key, validClaims())
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "missing expiry",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.ExpiresAt = nil
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name: "expired within the leeway",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-5 * time.Second))
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+		},
+		{
+			name: "not valid yet",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(2 * time.Hour))
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name: "issuer mismatch",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.Issuer = "someone-else"
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "audience mismatch",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.Audience = jwt.ClaimStrings{"orders-service"}
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "missing audience",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.Audience = nil
+
+				return sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "malformed",
+			token: func(_ *testing.T) string {
+				return "not.a.token"
+			},
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), test.token(t))
+
+			if test.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if claims.Subject != "customer-1" || !claims.HasScope("orders:read") {
+					t.Errorf("unexpected claims: %+v", claims)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("expected an error wrapping %q, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifier_Methods(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	ecKey := newECKey(t, "ec-1")
+
+	verifier := &Verifier{
+		Keys: StaticKeys{
+			rsaKey.ID: rsaKey.Key.Public(),
+			ecKey.ID:  ecKey.Key.Public(),
+		},
+		// HS256 cannot be enabled
+		Methods: []string{"ES256", "HS256"},
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "allowed method",
+			token: sign(t, ecKey.Method, ecKey.ID, ecKey.Key, validClaims()),
+		},
+		{
+			name:    "method not in the allowed methods",
+			token:   sign(t, rsaKey.Method, rsaKey.ID, rsaKey.Key, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "symmetric method in the allowed methods",
+			token:   sign(t, jwt.SigningMethodHS256, ecKey.ID, []byte("secret"), validClaims()),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), test.token)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("expected error: %t, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key is not in the cache (or has expired)
+	ErrNotFound = errors.New("not found in cache")
+)
+
+// Store is the interface implemented by all cache backends (and by Cache itself)
+type Store interface {
+	// Get returns the value for the key or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores the value for the key.  A TTL of zero means the entry does not expire (backends may still evict it).
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the key.  Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Cache adds singleflight loading, TTL jitter and instrumentation to a Store
+type Cache struct {
+	// Name is the unique name for this cache.
+	// This name is used to track errors, emit stats, etc.
+	Name string
+
+	// Store is the backend (e.g. NewLRU or RedisStore)
+	Store Store
+
+	// TTLJitter randomizes the TTL of each Set by up to the supplied fraction (e.g. 0.1 = +/- 10%), so that entries
+	// written at the same time do not all expire (and get reloaded) at the same time.  (default: no jitter)
+	TTLJitter float64
+
+	// Instrumentation allows reporting of cache hits, misses and errors
+	Instrumentation Instrumentation
+
+	group    singleflight.Group
+	initOnce sync.Once
+}
+
+// Get implements Store
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.initOnce.Do(c.doInitOnce)
+
+	value, err := c.Store.Get(ctx, key)
+
+	switch {
+	case err == nil:
+		c.Instrumentation.Hit(c.Name)
+
+	case errors.Is(err, ErrNotFound):
+		c.Instrumentation.Miss(c.Name)
+
+	default:
+		c.Instrumentation.Error(c.Name, "get", err)
+	}
+
+	return value, err
+}
+
+// Set implements Store (with TTL jitter applied)
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.initOnce.Do(c.doInitOnce)
+
+	err := c.Store.Set(ctx, key, value, c.jitter(ttl))
+	if err != nil {
+		c.Instrumentation.Error(c.Name, "set", err)
+	}
+
+	return err
+}
+
+// Delete implements Store
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	c.initOnce.Do(c.doInitOnce)
+
+	err := c.Store.Delete(ctx, key)
+	if err != nil {
+		c.Instrumentation.Error(c.Name, "delete", err)
+	}
+
+	return err
+}
+
+// GetOrLoad returns the cached value or calls the loader and caches its result.
+// Concurrent calls for the same key share a single call to the loader.
+// Errors from the backend are reported (via instrumentation) but do not prevent the loader from being used.
+func (c *Cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	value, err := c.Get(ctx, key)
+	if err == nil {
+		return value, nil
+	}
+
+	result, err, _ := c.group.Do(key, func() (interface{}, error) {
+		start := time.Now()
+
+		loaded, loadErr := loader(ctx)
+
+		c.Instrumentation.LoadDuration(c.Name, start, loadErr)
+
+		if loadErr != nil {
+			return nil, loadErr
+		}
+
+		// failing to cache the value should not fail the load
+		_ = c.Set(ctx, key, loaded, ttl)
+
+		return loaded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]byte), nil
+}
+
+func (c *Cache) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 || c.TTLJitter <= 0 {
+		return ttl
+	}
+
+	// a random value in the range [-jitter, +jitter)
+	delta := (rand.Float64()*2 - 1) * c.TTLJitter * float64(ttl) // nolint: gosec
+
+	jittered := ttl + time.Duration(delta)
+	if jittered <= 0 {
+		return ttl
+	}
+
+	return jittered
+}
+
+func (c *Cache) doInitOnce() {
+	if c.Instrumentation == nil {
+		c.Instrumentation = &noopInstrumentation{}
+	}
+}
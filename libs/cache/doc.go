@@ -0,0 +1,12 @@
+// Package cache provides a shared caching abstraction.
+//
+// All backends implement the Store interface (Get/Set/Delete of raw bytes with a TTL).  The Cache type wraps any Store and
+// adds GetOrLoad (with singleflight so that concurrent misses for the same key result in a single load), TTL jitter (so
+// that entries written together do not all expire together) and instrumentation.  As Cache also implements Store, it can
+// be used anywhere a Store is accepted.
+//
+// Two backends are provided: an in-memory LRU (NewLRU) and Redis (RedisStore).
+//
+// Store matches smarthttp.CacheStore, so RedisStore can back the smarthttp response cache (Cache.Store) and share
+// singleflight results (Singleflight.Store) between the pods of a service.
+package cache
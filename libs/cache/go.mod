@@ -0,0 +1,8 @@
+module github.com/karelrenaldi/storemono/libs/cache
+
+go 1.16
+
+require (
+	github.com/go-redis/redis/v8 v8.11.4
+	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
+)
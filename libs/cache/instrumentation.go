@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"time"
+)
+
+// Instrumentation allows users to generated stats or logs from cache events
+type Instrumentation interface {
+	// Hit is called when Get found the key
+	Hit(name string)
+
+	// Miss is called when Get did not find the key
+	Miss(name string)
+
+	// LoadDuration is the time taken by the loader supplied to GetOrLoad
+	LoadDuration(name string, start time.Time, err error)
+
+	// Error is called when the backend returns an error (op is one of get, set or delete)
+	Error(name, op string, err error)
+}
+
+type noopInstrumentation struct{}
+
+func (n *noopInstrumentation) Hit(_ string) {}
+
+func (n *noopInstrumentation) Miss(_ string) {}
+
+func (n *noopInstrumentation) LoadDuration(_ string, _ time.Time, _ error) {}
+
+func (n *noopInstrumentation) Error(_, _ string, _ error) {}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Store that evicts the least recently used entry when full.  It is safe for concurrent use.
+type LRU struct {
+	maxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRU returns an in-memory LRU Store that holds at most maxEntries entries
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// Get implements Store
+func (l *LRU) Get(_ context.Context, key string) ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		l.removeElement(element)
+
+		return nil, ErrNotFound
+	}
+
+	l.order.MoveToFront(element)
+
+	return entry.value, nil
+}
+
+// Set implements Store
+func (l *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if element, ok := l.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+
+		l.order.MoveToFront(element)
+
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for l.maxEntries > 0 && l.order.Len() > l.maxEntries {
+		l.removeElement(l.order.Back())
+	}
+
+	return nil
+}
+
+// Delete implements Store
+func (l *LRU) Delete(_ context.Context, key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		l.removeElement(element)
+	}
+
+	return nil
+}
+
+// Len returns the number of entries (including expired entries that have not yet been evicted)
+func (l *LRU) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.order.Len()
+}
+
+func (l *LRU) removeElement(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.entries, element.Value.(*lruEntry).key)
+}
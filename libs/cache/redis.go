@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore is a Store backed by Redis, allowing a cache to be shared by all instances of a service
+type RedisStore struct {
+	// Client is the Redis client (a *redis.Client, *redis.ClusterClient or *redis.Ring)
+	Client redis.UniversalClient
+
+	// Prefix is (optionally) prepended to all keys to avoid collisions with other users of the same Redis
+	Prefix string
+}
+
+// Get implements Store
+func (r *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.Client.Get(ctx, r.Prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+
+	return value, err
+}
+
+// Set implements Store
+func (r *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.Client.Set(ctx, r.Prefix+key, value, ttl).Err()
+}
+
+// Delete implements Store
+func (r *RedisStore) Delete(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, r.Prefix+key).Err()
+}
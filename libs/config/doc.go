@@ -0,0 +1,8 @@
+// Package config provides the common building blocks used by services to load their configuration from the environment.
+//
+// Besides plain environment variables, every lookup also supports Docker/Kubernetes style secret files.  For a variable named
+// DB_PASSWORD, the value can alternatively be supplied by setting DB_PASSWORD_FILE to the path of a mounted secret file.
+//
+// Settings that can change at runtime (e.g. log level or rate limits) can be observed with a Watcher, which polls a file,
+// Consul or etcd Source and delivers validated, typed change events to its subscribers.
+package config
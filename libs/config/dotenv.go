@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	// AppEnvKey is the environment variable that selects the environment profile
+	AppEnvKey = "APP_ENV"
+
+	defaultAppEnv = "development"
+
+	// the test profile never loads .env.local so that test runs are reproducible
+	testAppEnv = "test"
+)
+
+// AppEnv returns the selected environment profile (default: development)
+func AppEnv() string {
+	if env := os.Getenv(AppEnvKey); env != "" {
+		return env
+	}
+
+	return defaultAppEnv
+}
+
+// LoadEnvFiles loads the layered .env files from the supplied directory for the profile selected by APP_ENV.
+//
+// Files are applied with the following precedence (highest first); missing files are skipped:
+//
+//  1. variables already set in the environment (these are never overridden)
+//  2. .env.{APP_ENV}.local
+//  3. .env.local (not loaded when APP_ENV=test)
+//  4. .env.{APP_ENV}
+//  5. .env
+//
+// The `.local` files contain developer specific overrides and should not be committed.
+// The names of the files that were loaded are returned (in order of precedence).
+func LoadEnvFiles(dir string) ([]string, error) {
+	env := AppEnv()
+
+	candidates := []string{".env." + env + ".local"}
+	if env != testAppEnv {
+		candidates = append(candidates, ".env.local")
+	}
+	candidates = append(candidates, ".env."+env, ".env")
+
+	var files []string
+
+	for _, name := range candidates {
+		path := filepath.Join(dir, name)
+
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		files = append(files, path)
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	// godotenv.Load() never overrides a variable that is already set, so the first file to define a variable wins
+	return files, godotenv.Load(files...)
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// fileSuffix is appended to the variable name to find the path of the secret file
+	fileSuffix = "_FILE"
+
+	// maxSecretFileSize protects against accidentally pointing a variable at a large (non-secret) file
+	maxSecretFileSize = 64 * 1024
+)
+
+var (
+	// ErrAmbiguousEnv indicates that both the variable and its file variant were set
+	ErrAmbiguousEnv = errors.New("both the variable and its _FILE variant are set")
+
+	// ErrInsecureSecretFile indicates that the secret file can be modified by users other than its owner
+	ErrInsecureSecretFile = errors.New("secret file is writable by group or others")
+
+	// ErrInvalidSecretFile indicates that the secret file is not a regular file or is too large
+	ErrInvalidSecretFile = errors.New("secret file is not a regular file or is too large")
+)
+
+// Getenv retrieves the value of the environment variable named by the key.
+// When the variable is not set but KEY_FILE is, the value is read from that file instead (see LookupEnv).
+// It returns an empty string when neither is set.
+func Getenv(key string) (string, error) {
+	value, _, err := LookupEnv(key)
+
+	return value, err
+}
+
+// LookupEnv retrieves the value of the environment variable named by the key.
+//
+// When the variable itself is not set, but KEY_FILE is, the contents of the file it references are returned with the
+// surrounding whitespace (e.g. the trailing new line added by most editors) trimmed.
+// The file must be a regular file that is not writable by group or others.
+//
+// Setting both KEY and KEY_FILE is considered a mistake and will return ErrAmbiguousEnv.
+func LookupEnv(key string) (string, bool, error) {
+	value, valueOK := os.LookupEnv(key)
+	path, pathOK := os.LookupEnv(key + fileSuffix)
+
+	switch {
+	case valueOK && pathOK:
+		return "", false, fmt.Errorf("%w: '%s'", ErrAmbiguousEnv, key)
+
+	case pathOK:
+		value, err := readSecretFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read '%s%s': %w", key, fileSuffix, err)
+		}
+
+		return value, true, nil
+
+	default:
+		return value, valueOK, nil
+	}
+}
+
+func readSecretFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.Mode().IsRegular() || info.Size() > maxSecretFileSize {
+		return "", fmt.Errorf("%w: '%s'", ErrInvalidSecretFile, path)
+	}
+
+	if info.Mode().Perm()&0o022 != 0 {
+		return "", fmt.Errorf("%w: '%s' (mode %s)", ErrInsecureSecretFile, path, info.Mode().Perm())
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
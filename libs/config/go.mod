@@ -0,0 +1,5 @@
+module github.com/karelrenaldi/storemono/libs/config
+
+go 1.16
+
+require github.com/joho/godotenv v1.4.0
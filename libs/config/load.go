@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingRequired indicates that one or more required variables were not set
+	ErrMissingRequired = errors.New("missing required environment variables")
+
+	// ErrInvalidTarget indicates that Load was not called with a pointer to a struct
+	ErrInvalidTarget = errors.New("target must be a non-nil pointer to a struct")
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ByteSize is a size in bytes that is loaded from human friendly values like "10MB" (see ParseByteSize)
+type ByteSize int64
+
+// Load populates the exported fields of the struct pointed to by target from the environment using the following tags:
+//
+//	env:"NAME"        the environment variable (or secret file, see LookupEnv) to load; fields without this tag are skipped
+//	default:"VALUE"   the value used when the variable is not set or empty
+//	required:"true"   startup should be aborted when the variable is not set or empty
+//
+// Supported field types are string, bool, all int/uint/float types, time.Duration (see ParseDuration), ByteSize and
+// nested structs (which are loaded recursively).
+//
+// All fields are processed before returning, so that the returned error lists every missing or invalid variable at once.
+func Load(target interface{}) error {
+	return LoadWithPrefix("", target)
+}
+
+// LoadWithPrefix is Load with the prefix prepended to the names of the variables (e.g. with the prefix "PAYMENTS_", a
+// field tagged env:"TIMEOUT" is loaded from PAYMENTS_TIMEOUT), so that the same struct can configure several components.
+func LoadWithPrefix(prefix string, target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+
+	var missing, invalid []string
+
+	loadStruct(value.Elem(), prefix, &missing, &invalid)
+
+	switch {
+	case len(missing) > 0 && len(invalid) > 0:
+		return fmt.Errorf("%w: %s (invalid: %s)", ErrMissingRequired, strings.Join(missing, ", "), strings.Join(invalid, ", "))
+
+	case len(missing) > 0:
+		return fmt.Errorf("%w: %s", ErrMissingRequired, strings.Join(missing, ", "))
+
+	case len(invalid) > 0:
+		return fmt.Errorf("invalid environment variables: %s", strings.Join(invalid, ", "))
+
+	default:
+		return nil
+	}
+}
+
+func loadStruct(value reflect.Value, prefix string, missing, invalid *[]string) {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		fieldValue := value.Field(i)
+
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				loadStruct(fieldValue, prefix, missing, invalid)
+			}
+
+			continue
+		}
+
+		name = prefix + name
+
+		raw, err := Getenv(name)
+		if err != nil {
+			*invalid = append(*invalid, fmt.Sprintf("%s (%s)", name, err))
+			continue
+		}
+
+		if raw == "" {
+			if field.Tag.Get("required") == "true" {
+				*missing = append(*missing, name)
+				continue
+			}
+
+			raw = field.Tag.Get("default")
+			if raw == "" {
+				continue
+			}
+		}
+
+		err = setField(fieldValue, raw)
+		if err != nil {
+			*invalid = append(*invalid, fmt.Sprintf("%s (%s)", name, err))
+		}
+	}
+}
+
+// nolint: gocyclo
+func setField(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch {
+	case field.Type() == durationType:
+		value, err := ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(value))
+
+	case field.Type() == reflect.TypeOf(ByteSize(0)):
+		value, err := ParseByteSize(raw)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(value)
+
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+
+	case field.Kind() == reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(value)
+
+	case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(value)
+
+	case field.Kind() >= reflect.Uint && field.Kind() <= reflect.Uint64:
+		value, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(value)
+
+	case field.Kind() == reflect.Float32 || field.Kind() == reflect.Float64:
+		value, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(value)
+
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
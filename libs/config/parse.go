@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingUnit indicates that a duration or size was supplied without a unit (e.g. "500" instead of "500ms")
+var ErrMissingUnit = errors.New("a unit is required")
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// NOTE: order matters; longer suffixes must be checked before their shorter counterparts
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"TIB", 1 << 40},
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"TB", 1 << 40},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseDuration parses a human friendly duration like "500ms", "5s" or "1m30s" (see time.ParseDuration).
+// Unlike time.ParseDuration, a bare number other than zero is rejected with ErrMissingUnit rather than guessing the unit.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	if _, err := strconv.ParseFloat(value, 64); err == nil && value != "0" {
+		return 0, fmt.Errorf("%w (e.g. '%sms' or '%ss')", ErrMissingUnit, value, value)
+	}
+
+	return time.ParseDuration(value)
+}
+
+// ParseByteSize parses a human friendly size like "512B", "64KB", "10MB" or "1.5GiB" into a number of bytes.
+// KB/MB/GB/TB are treated as binary (1024 based) units, as is the convention for memory and payload limits.
+func ParseByteSize(value string) (int64, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(value))
+
+	for _, unit := range byteSizeUnits {
+		if !strings.HasSuffix(normalized, unit.suffix) {
+			continue
+		}
+
+		number := strings.TrimSpace(strings.TrimSuffix(normalized, unit.suffix))
+
+		size, err := strconv.ParseFloat(number, 64)
+		if err != nil || size < 0 {
+			return 0, fmt.Errorf("invalid size '%s'", value)
+		}
+
+		return int64(size * float64(unit.multiplier)), nil
+	}
+
+	if normalized == "0" {
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("%w (e.g. '%sB' or '%sMB')", ErrMissingUnit, value, value)
+}
+
+// GetDuration returns the duration from the environment variable named by key (see ParseDuration).
+// The default value is returned when the variable is not set or empty.  The returned error names the offending variable.
+func GetDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	raw, err := Getenv(key)
+	if err != nil || raw == "" {
+		return defaultValue, err
+	}
+
+	value, err := ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration in '%s': %w", key, err)
+	}
+
+	return value, nil
+}
+
+// GetByteSize returns the size in bytes from the environment variable named by key (see ParseByteSize).
+// The default value is returned when the variable is not set or empty.  The returned error names the offending variable.
+func GetByteSize(key string, defaultValue int64) (int64, error) {
+	raw, err := Getenv(key)
+	if err != nil || raw == "" {
+		return defaultValue, err
+	}
+
+	value, err := ParseByteSize(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size in '%s': %w", key, err)
+	}
+
+	return value, nil
+}
+
+// GetInt returns the integer from the environment variable named by key.
+// The default value is returned when the variable is not set or empty.  The returned error names the offending variable.
+func GetInt(key string, defaultValue int) (int, error) {
+	raw, err := Getenv(key)
+	if err != nil || raw == "" {
+		return defaultValue, err
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer in '%s': %w", key, err)
+	}
+
+	return value, nil
+}
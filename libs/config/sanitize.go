@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+)
+
+const maskedValue = "******"
+
+// MaskSecret masks the entire value.  Empty values remain empty so that a missing secret is still visible.
+func MaskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return maskedValue
+}
+
+// MaskDSN masks the password of a connection string in the format `user:password@host/db` (with or without a `scheme://`
+// prefix), leaving the user, host and options visible.
+func MaskDSN(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return dsn
+	}
+
+	start := strings.Index(dsn, "://")
+	if start < 0 || start > at {
+		start = 0
+	} else {
+		start += len("://")
+	}
+
+	colon := strings.Index(dsn[start:at], ":")
+	if colon < 0 {
+		return dsn
+	}
+
+	return dsn[:start+colon+1] + maskedValue + dsn[at:]
+}
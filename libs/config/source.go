@@ -0,0 +1,272 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Source provides a complete snapshot of the (flat) key/value settings from a configuration backend.
+// Implementations are polled by the Watcher and as such should be cheap and safe to call repeatedly.
+type Source interface {
+	// Load returns the current settings
+	Load(ctx context.Context) (map[string]string, error)
+}
+
+// FileSource reads settings from a local file (e.g. a mounted Kubernetes ConfigMap).
+// Files ending in `.json` must contain a single JSON object of scalar values; all other files are parsed as `KEY=VALUE` lines.
+// Empty lines and lines starting with `#` are ignored.
+type FileSource struct {
+	// Path is the location of the file
+	Path string
+}
+
+// Load implements Source
+func (f *FileSource) Load(_ context.Context) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(f.Path), ".json") {
+		return parseJSONSettings(contents)
+	}
+
+	return parseLineSettings(contents)
+}
+
+func parseJSONSettings(contents []byte) (map[string]string, error) {
+	raw := map[string]interface{}{}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(raw))
+
+	for key, value := range raw {
+		switch typed := value.(type) {
+		case string:
+			out[key] = typed
+
+		case json.Number, bool:
+			out[key] = fmt.Sprint(typed)
+
+		default:
+			return nil, fmt.Errorf("setting '%s' is not a scalar value", key)
+		}
+	}
+
+	return out, nil
+}
+
+func parseLineSettings(contents []byte) (map[string]string, error) {
+	out := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+		if idx < 1 {
+			return nil, fmt.Errorf("line %d is not in the format KEY=VALUE", lineNo)
+		}
+
+		out[strings.TrimSpace(line[:idx])] = strings.Trim(strings.TrimSpace(line[idx+1:]), `"'`)
+	}
+
+	return out, scanner.Err()
+}
+
+// ConsulSource reads all the keys below Prefix from the Consul KV store (using the HTTP API).
+// Keys are returned relative to the prefix.
+type ConsulSource struct {
+	// Address is the base URL of the Consul agent (default: http://127.0.0.1:8500)
+	Address string
+
+	// Prefix is the KV folder that contains the settings (e.g. `shop-service/`)
+	Prefix string
+
+	// Token is the (optional) ACL token
+	Token string
+
+	// Client is the (optional) HTTP client used to call Consul
+	Client *http.Client
+}
+
+// Load implements Source
+func (c *ConsulSource) Load(ctx context.Context) (map[string]string, error) {
+	address := c.Address
+	if address == "" {
+		address = "http://127.0.0.1:8500"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(address, "/")+"/v1/kv/"+escapePath(c.Prefix)+"?recurse=true", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+
+	var entries []struct {
+		Key   string
+		Value []byte
+	}
+
+	err = doJSON(c.Client, req, &entries, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(entries))
+
+	for _, entry := range entries {
+		key := strings.TrimPrefix(entry.Key, c.Prefix)
+		if key == "" || strings.HasSuffix(key, "/") {
+			// skip folders
+			continue
+		}
+
+		out[key] = string(entry.Value)
+	}
+
+	return out, nil
+}
+
+// escapePath escapes each segment of the path, so that nested prefixes (e.g. `shop/prod/`) keep their separators
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// EtcdSource reads all the keys below Prefix from etcd (using the v3 JSON gateway).
+// Keys are returned relative to the prefix.
+type EtcdSource struct {
+	// Address is the base URL of the etcd gateway (default: http://127.0.0.1:2379)
+	Address string
+
+	// Prefix is the key prefix that contains the settings (e.g. `/config/shop-service/`)
+	Prefix string
+
+	// Client is the (optional) HTTP client used to call etcd
+	Client *http.Client
+}
+
+// Load implements Source
+func (e *EtcdSource) Load(ctx context.Context) (map[string]string, error) {
+	address := e.Address
+	if address == "" {
+		address = "http://127.0.0.1:2379"
+	}
+
+	body, err := json.Marshal(map[string][]byte{
+		"key":       []byte(e.Prefix),
+		"range_end": prefixRangeEnd(e.Prefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(address, "/")+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Kvs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+
+	err = doJSON(e.Client, req, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(result.Kvs))
+
+	for _, kv := range result.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		out[strings.TrimPrefix(string(key), e.Prefix)] = string(value)
+	}
+
+	return out, nil
+}
+
+// prefixRangeEnd returns the etcd range end that matches all keys with the supplied prefix
+func prefixRangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	// the prefix is all 0xff; request all keys
+	return []byte{0}
+}
+
+// doJSON performs the request and decodes the JSON response into out.
+// Any of the emptyCodes are treated as a successful response without content.
+func doJSON(client *http.Client, req *http.Request, out interface{}, emptyCodes ...int) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	for _, code := range emptyCodes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response code %d from %s", resp.StatusCode, req.URL.Host)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultDebounce     = 500 * time.Millisecond
+)
+
+// ErrWatcherRunning indicates that Watch was called on a Watcher that is already running
+var ErrWatcherRunning = errors.New("the watcher is already running")
+
+// Decoder converts (and validates) the raw value of a setting into its typed form.
+// Returning an error will cause the entire change set to be rejected.
+type Decoder func(raw string) (interface{}, error)
+
+// ChangeEvent is delivered to subscribers when a watched setting changes
+type ChangeEvent struct {
+	// Key is the name of the setting
+	Key string
+
+	// Old is the previously applied value (nil before the first load or when the setting was added)
+	Old interface{}
+
+	// New is the decoded value (nil when the setting was removed)
+	New interface{}
+}
+
+// Watcher polls a Source and delivers typed change events to subscribers.
+//
+// Changes are debounced (a burst of edits results in a single update) and all subscribed settings are decoded before any
+// subscriber is called.  When any setting fails to decode the entire change set is rejected and the previous values remain.
+type Watcher struct {
+	// Source is the configuration backend to watch
+	Source Source
+
+	// PollInterval is how often the Source is loaded (default: 5 seconds)
+	PollInterval time.Duration
+
+	// Debounce is how long the settings must remain unchanged before they are applied (default: 500 ms)
+	Debounce time.Duration
+
+	// OnError is called (optional) when the source fails to load or a change set is rejected
+	OnError func(err error)
+
+	mutex         sync.Mutex
+	subscriptions map[string][]*subscription
+	applied       map[string]string
+	values        map[string]interface{}
+	running       bool
+}
+
+type subscription struct {
+	decoder  Decoder
+	callback func(event ChangeEvent)
+}
+
+// Subscribe registers a callback for changes to the setting named by key.
+// The callback is called once with the current value during the initial load of Watch and then on every (valid) change.
+// Callbacks are called synchronously from the Watch goroutine and should not block.
+func (w *Watcher) Subscribe(key string, decoder Decoder, callback func(event ChangeEvent)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.subscriptions == nil {
+		w.subscriptions = map[string][]*subscription{}
+	}
+
+	w.subscriptions[key] = append(w.subscriptions[key], &subscription{
+		decoder:  decoder,
+		callback: callback,
+	})
+}
+
+// Value returns the current (decoded) value of a subscribed setting
+func (w *Watcher) Value(key string) (interface{}, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	value, ok := w.values[key]
+
+	return value, ok
+}
+
+// Watch loads the Source and applies the settings, then continues to poll until the context is cancelled.
+// An error is returned if the initial load fails or is invalid, otherwise Watch blocks until the context is done.
+func (w *Watcher) Watch(ctx context.Context) error {
+	w.mutex.Lock()
+	if w.running {
+		w.mutex.Unlock()
+		return ErrWatcherRunning
+	}
+	w.running = true
+	w.mutex.Unlock()
+
+	defer func() {
+		w.mutex.Lock()
+		w.running = false
+		w.mutex.Unlock()
+	}()
+
+	settings, err := w.Source.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.apply(settings)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.getPollInterval())
+	defer ticker.Stop()
+
+	var pending, rejected map[string]string
+	var pendingSince time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+		}
+
+		settings, err := w.Source.Load(ctx)
+		if err != nil {
+			w.reportError(fmt.Errorf("failed to load settings: %w", err))
+			continue
+		}
+
+		if rejected != nil && equalSettings(settings, rejected) {
+			// do not report the same invalid change set repeatedly
+			continue
+		}
+
+		if !equalSettings(settings, pending) {
+			// (new) change detected; restart the debounce timer
+			pending = settings
+			pendingSince = time.Now()
+		}
+
+		if pending == nil || time.Since(pendingSince) < w.getDebounce() {
+			continue
+		}
+
+		rejected = nil
+
+		err = w.apply(pending)
+		if err != nil {
+			w.reportError(err)
+
+			rejected = pending
+		}
+
+		pending = nil
+	}
+}
+
+func (w *Watcher) apply(settings map[string]string) error {
+	w.mutex.Lock()
+
+	if equalSettings(settings, w.applied) && w.applied != nil {
+		w.mutex.Unlock()
+		return nil
+	}
+
+	// decode all changed settings before applying any
+	type delivery struct {
+		sub   *subscription
+		event ChangeEvent
+	}
+
+	var deliveries []delivery
+	var errs []string
+
+	newValues := make(map[string]interface{}, len(w.subscriptions))
+
+	for key, subs := range w.subscriptions {
+		raw, exists := settings[key]
+		oldRaw, oldExists := w.applied[key]
+
+		if w.applied != nil && exists == oldExists && raw == oldRaw {
+			if value, ok := w.values[key]; ok {
+				newValues[key] = value
+			}
+
+			continue
+		}
+
+		for i, sub := range subs {
+			event := ChangeEvent{Key: key, Old: w.values[key]}
+
+			if exists {
+				value, err := sub.decoder(raw)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("'%s': %s", key, err))
+					break
+				}
+
+				event.New = value
+
+				if i == 0 {
+					newValues[key] = value
+				}
+			}
+
+			deliveries = append(deliveries, delivery{sub: sub, event: event})
+		}
+	}
+
+	if len(errs) > 0 {
+		w.mutex.Unlock()
+		return fmt.Errorf("rejected settings change: %s", strings.Join(errs, ", "))
+	}
+
+	w.applied = settings
+	w.values = newValues
+	w.mutex.Unlock()
+
+	for _, d := range deliveries {
+		d.sub.callback(d.event)
+	}
+
+	return nil
+}
+
+func (w *Watcher) reportError(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+func (w *Watcher) getPollInterval() time.Duration {
+	if w.PollInterval > 0 {
+		return w.PollInterval
+	}
+
+	return defaultPollInterval
+}
+
+func (w *Watcher) getDebounce() time.Duration {
+	if w.Debounce > 0 {
+		return w.Debounce
+	}
+
+	return defaultDebounce
+}
+
+func equalSettings(a, b map[string]string) bool {
+	if len(a) != len(b) || (a == nil) != (b == nil) {
+		return false
+	}
+
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// StringDecoder returns the raw value
+func StringDecoder(raw string) (interface{}, error) {
+	return raw, nil
+}
+
+// IntDecoder decodes the value into an int
+func IntDecoder(raw string) (interface{}, error) {
+	return strconv.Atoi(strings.TrimSpace(raw))
+}
+
+// FloatDecoder decodes the value into a float64
+func FloatDecoder(raw string) (interface{}, error) {
+	return strconv.ParseFloat(strings.TrimSpace(raw), 64)
+}
+
+// BoolDecoder decodes the value into a bool
+func BoolDecoder(raw string) (interface{}, error) {
+	return strconv.ParseBool(strings.TrimSpace(raw))
+}
+
+// DurationDecoder decodes the value into a time.Duration (e.g. "500ms")
+func DurationDecoder(raw string) (interface{}, error) {
+	return time.ParseDuration(strings.TrimSpace(raw))
+}
+
+// OneOfDecoder accepts only the supplied (case-insensitive) values, e.g. log levels.  The value is returned in lower case.
+func OneOfDecoder(allowed ...string) Decoder {
+	return func(raw string) (interface{}, error) {
+		value := strings.ToLower(strings.TrimSpace(raw))
+
+		for _, candidate := range allowed {
+			if value == strings.ToLower(candidate) {
+				return value, nil
+			}
+		}
+
+		return nil, fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// Validated wraps the decoder with an additional validation of the decoded value (e.g. a range check)
+func Validated(decoder Decoder, validate func(value interface{}) error) Decoder {
+	return func(raw string) (interface{}, error) {
+		value, err := decoder(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validate(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return value, nil
+	}
+}
@@ -0,0 +1,92 @@
+package healthcheck
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrCircuitOpen indicates that the checked circuit breaker is open
+	ErrCircuitOpen = errors.New("circuit is open")
+
+	// ErrUnexpectedReply indicates that the dependency returned an unexpected response
+	ErrUnexpectedReply = errors.New("unexpected reply")
+)
+
+// Pinger is implemented by *sql.DB (and most other DB clients)
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// DBPing checks the DB by calling PingContext()
+func DBPing(db Pinger) Checker {
+	return CheckerFunc(db.PingContext)
+}
+
+// TCPDial checks that a TCP connection can be established to the address (host:port)
+func TCPDial(address string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	})
+}
+
+// RedisPing checks a Redis server by sending a PING command and expecting PONG.
+// Servers that require authentication will reply with an error, which is reported as unhealthy.
+func RedisPing(address string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		_, err = conn.Write([]byte("PING\r\n"))
+		if err != nil {
+			return err
+		}
+
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(reply) != "+PONG" {
+			return fmt.Errorf("%w: %s", ErrUnexpectedReply, strings.TrimSpace(reply))
+		}
+
+		return nil
+	})
+}
+
+// CircuitStater is implemented by *smarthttp.Client
+type CircuitStater interface {
+	IsCircuitOpen() bool
+}
+
+// CircuitBreaker checks that the circuit breaker of an upstream client is not open.
+// An open circuit typically indicates a failing upstream, so this check is usually registered as NonCritical.
+func CircuitBreaker(circuit CircuitStater) Checker {
+	return CheckerFunc(func(_ context.Context) error {
+		if circuit.IsCircuitOpen() {
+			return ErrCircuitOpen
+		}
+
+		return nil
+	})
+}
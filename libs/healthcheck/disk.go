@@ -0,0 +1,26 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrLowDiskSpace indicates that the available disk space is below the configured minimum
+var ErrLowDiskSpace = errors.New("low disk space")
+
+// DiskSpace checks that the file system containing path has at least minFreeBytes available
+func DiskSpace(path string, minFreeBytes uint64) Checker {
+	return CheckerFunc(func(_ context.Context) error {
+		available, err := availableDiskSpace(path)
+		if err != nil {
+			return err
+		}
+
+		if available < minFreeBytes {
+			return fmt.Errorf("%w: %d bytes available on '%s' (minimum %d)", ErrLowDiskSpace, available, path, minFreeBytes)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package healthcheck
+
+import (
+	"syscall"
+)
+
+func availableDiskSpace(path string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	// nolint: unconvert // field types differ between platforms
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
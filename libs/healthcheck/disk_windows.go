@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package healthcheck
+
+import (
+	"errors"
+)
+
+func availableDiskSpace(_ string) (uint64, error) {
+	return 0, errors.New("disk space check is not supported on windows")
+}
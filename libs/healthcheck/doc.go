@@ -0,0 +1,10 @@
+// Package healthcheck provides a reusable health framework for services.
+//
+// Named checkers (DB ping, Redis, circuit breaker state, disk space, etc) are registered with a Health instance, which
+// runs them concurrently with individual timeouts and caches their results.  The results are exposed via standard
+// handlers:
+//
+//	/live   - the process is running (never runs checks; a failure here means "restart me")
+//	/ready  - all critical checks pass (a failure here means "stop sending me traffic")
+//	/health - detailed JSON report of every check
+package healthcheck
@@ -0,0 +1,3 @@
+module github.com/karelrenaldi/storemono/libs/healthcheck
+
+go 1.16
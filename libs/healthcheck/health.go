@@ -0,0 +1,247 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout  = 1 * time.Second
+	defaultCacheTTL = 1 * time.Second
+)
+
+// ErrTimeout indicates that the check did not complete within its timeout
+var ErrTimeout = errors.New("health check timed out")
+
+// Checker checks the health of a single dependency
+type Checker interface {
+	// Check returns nil when the dependency is healthy.
+	// Implementations must respect the cancellation of the supplied context.
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc allows the use of ordinary functions as a Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check implements Checker
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Config defines the (optional) settings for a registered check
+type Config struct {
+	// Timeout is the maximum duration of a single check (default: 1 second)
+	Timeout time.Duration
+
+	// CacheTTL is how long a result is reused before the check is run again (default: 1 second).
+	// This protects dependencies from aggressive probes.
+	CacheTTL time.Duration
+
+	// NonCritical checks are reported by the detailed health handler but do not affect readiness
+	NonCritical bool
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name      string        `json:"name"`
+	Healthy   bool          `json:"healthy"`
+	Critical  bool          `json:"critical"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"durationNs"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Health holds the registered checks.  The zero value is ready to use.
+type Health struct {
+	mutex  sync.RWMutex
+	checks map[string]*check
+}
+
+type check struct {
+	name    string
+	checker Checker
+	config  Config
+
+	mutex  sync.Mutex
+	result *Result
+}
+
+// Register adds a named check.  Registering a name a second time replaces the previous check.
+func (h *Health) Register(name string, checker Checker, config Config) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.checks == nil {
+		h.checks = map[string]*check{}
+	}
+
+	h.checks[name] = &check{
+		name:    name,
+		checker: checker,
+		config:  config,
+	}
+}
+
+// Run runs all checks (or reuses their cached results) concurrently and returns the results sorted by name.
+// The second return value is true when all critical checks are healthy.
+func (h *Health) Run(ctx context.Context) ([]Result, bool) {
+	h.mutex.RLock()
+	checks := make([]*check, 0, len(h.checks))
+	for _, c := range h.checks {
+		checks = append(checks, c)
+	}
+	h.mutex.RUnlock()
+
+	results := make([]Result, len(checks))
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(checks))
+
+	for i, c := range checks {
+		go func(i int, c *check) {
+			defer wg.Done()
+
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	ready := true
+
+	for _, result := range results {
+		if result.Critical && !result.Healthy {
+			ready = false
+		}
+	}
+
+	return results, ready
+}
+
+func (c *check) run(parent context.Context) Result {
+	// concurrent callers wait for (and share) the in-progress check
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.result != nil && time.Since(c.result.CheckedAt) < c.getCacheTTL() {
+		return *c.result
+	}
+
+	ctx, cancel := context.WithTimeout(parent, c.getTimeout())
+	defer cancel()
+
+	start := time.Now()
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("health check panicked: %v", r)
+			}
+		}()
+
+		errCh <- c.checker.Check(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ErrTimeout
+
+		if parent.Err() != nil {
+			err = parent.Err()
+		}
+	}
+
+	result := &Result{
+		Name:      c.name,
+		Healthy:   err == nil,
+		Critical:  !c.config.NonCritical,
+		Duration:  time.Since(start),
+		CheckedAt: time.Now(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	// a check interrupted by the caller (e.g. a probe that gave up) says nothing about the dependency, so it is not cached
+	if parent.Err() == nil {
+		c.result = result
+	}
+
+	return *result
+}
+
+func (c *check) getTimeout() time.Duration {
+	if c.config.Timeout > 0 {
+		return c.config.Timeout
+	}
+
+	return defaultTimeout
+}
+
+func (c *check) getCacheTTL() time.Duration {
+	if c.config.CacheTTL > 0 {
+		return c.config.CacheTTL
+	}
+
+	return defaultCacheTTL
+}
+
+// LiveHandler responds with 200 while the process is able to serve requests.  It does not run any checks.
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
+		_, _ = resp.Write([]byte(`OK`))
+	})
+}
+
+// ReadyHandler responds with 200 when all critical checks are healthy and 503 otherwise
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		_, ready := h.Run(req.Context())
+		if !ready {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = resp.Write([]byte(`NOT READY`))
+
+			return
+		}
+
+		_, _ = resp.Write([]byte(`OK`))
+	})
+}
+
+// HealthHandler responds with a JSON report of all checks.
+// The status code is 200 when all critical checks are healthy and 503 otherwise.
+func (h *Health) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		results, ready := h.Run(req.Context())
+
+		resp.Header().Set("Content-Type", "application/json")
+
+		if !ready {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_ = json.NewEncoder(resp).Encode(struct {
+			Healthy bool     `json:"healthy"`
+			Checks  []Result `json:"checks"`
+		}{
+			Healthy: ready,
+			Checks:  results,
+		})
+	})
+}
@@ -0,0 +1,289 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/corsc/go-commons/resilience/retry"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultBaseRetryDelay = 100 * time.Millisecond
+	defaultMaxRetryDelay  = 5 * time.Second
+
+	// delay before fetching again after a fetch error
+	fetchErrorDelay = 1 * time.Second
+
+	// Header keys added to dead-lettered messages
+	HeaderDeadLetterError = "x-dead-letter-error"
+	HeaderDeadLetterTopic = "x-dead-letter-topic"
+)
+
+var (
+	// ErrConsumerRunning indicates that Run was called on a Consumer that is already running
+	ErrConsumerRunning = errors.New("the consumer is already running")
+
+	// ErrPermanent can be wrapped by handlers to indicate that retrying the message cannot succeed
+	// (e.g. the payload cannot be decoded).  Such messages are dead-lettered immediately.
+	ErrPermanent = errors.New("permanent failure")
+)
+
+// Handler processes a single message.  Returning an error will cause the message to be retried.
+// As delivery is at-least-once, handlers must be idempotent.
+type Handler func(ctx context.Context, msg Message) error
+
+// Retries defines the per-message retry configuration
+type Retries struct {
+	// MaxAttempts is the maximum number of attempts (including the first) before the message is dead-lettered. (default: 3)
+	MaxAttempts int
+
+	// BaseDelay is the base amount of time between attempts (default: 100 ms)
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum possible delay (default: 5 seconds)
+	MaxDelay time.Duration
+}
+
+// Consumer consumes messages from a Subscription, retries failed messages and dead-letters messages that cannot be processed
+type Consumer struct {
+	// Name is the unique name for this consumer.
+	// This name is used to track errors, emit stats, etc.
+	Name string
+
+	// Subscription is the source of messages (e.g. NewKafkaSubscription)
+	Subscription Subscription
+
+	// Handler processes each message
+	Handler Handler
+
+	// Retries defines the (optional) retry configuration for failed messages
+	Retries *Retries
+
+	// DeadLetter is the (optional) producer used to publish messages that could not be processed.
+	// When not supplied, failed messages are committed (i.e. dropped) after their retries are exhausted.
+	DeadLetter Producer
+
+	// DeadLetterTopic is the topic failed messages are published to (default: the message's topic + ".dlq")
+	DeadLetterTopic string
+
+	// Instrumentation allows reporting and logging of internal events and statistics
+	Instrumentation Instrumentation
+
+	initOnce sync.Once
+	retrier  *retry.Client
+
+	mutex   sync.Mutex
+	running bool
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+// Run fetches and processes messages until the context is done or Close is called.
+// Messages are processed one at a time, in order, and committed only once they have been handled or dead-lettered.
+func (c *Consumer) Run(ctx context.Context) error {
+	c.initOnce.Do(c.doInitOnce)
+
+	fetchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	c.mutex.Lock()
+	if c.running {
+		c.mutex.Unlock()
+		return ErrConsumerRunning
+	}
+	c.running = true
+	c.stop = stop
+	c.done = make(chan struct{})
+	done := c.done
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.running = false
+		close(done)
+		c.mutex.Unlock()
+	}()
+
+	for {
+		msg, err := c.Subscription.Fetch(fetchCtx)
+		if err != nil {
+			if fetchCtx.Err() != nil {
+				// shutting down
+				return nil
+			}
+
+			c.Instrumentation.FetchErr(err)
+
+			select {
+			case <-time.After(fetchErrorDelay):
+				continue
+
+			case <-fetchCtx.Done():
+				return nil
+			}
+		}
+
+		// the message is processed with the Run context, so that Close() allows it to complete
+		err = c.process(ctx, msg)
+		if err != nil {
+			// the message was neither handled nor dead-lettered; stop so that it is redelivered (to this or another member)
+			return err
+		}
+	}
+}
+
+// Close stops fetching new messages and waits (bounded by the context) for the message in progress to complete.
+func (c *Consumer) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	if !c.running {
+		c.mutex.Unlock()
+		return c.Subscription.Close()
+	}
+
+	c.stop()
+	done := c.done
+	c.mutex.Unlock()
+
+	select {
+	case <-done:
+		return c.Subscription.Close()
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Consumer) process(ctx context.Context, msg Message) error {
+	attempt := 0
+	var lastErr error
+
+	err := c.retrier.Do(ctx, "", func() error {
+		attempt++
+		start := time.Now()
+
+		err := c.Handler(ctx, msg)
+		lastErr = err
+
+		c.Instrumentation.HandlerDuration(start, msg.Topic, attempt, err)
+
+		if err != nil && !errors.Is(err, ErrPermanent) && attempt < c.retrier.MaxAttempts {
+			c.Instrumentation.Retry(msg.Topic, attempt, err)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		if ctx.Err() != nil {
+			// shutting down; do not commit so that the message is redelivered
+			return ctx.Err()
+		}
+
+		// the retrier returns its own error when the attempts are exceeded; report the cause instead
+		if lastErr != nil {
+			err = lastErr
+		}
+
+		err = c.deadLetter(ctx, msg, err)
+		if err != nil {
+			return fmt.Errorf("failed to dead-letter message: %w", err)
+		}
+	}
+
+	err = c.Subscription.Commit(ctx, msg)
+	if err != nil {
+		// the message will be redelivered, which is acceptable under at-least-once semantics
+		c.Instrumentation.CommitErr(msg.Topic, err)
+	}
+
+	return nil
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, cause error) error {
+	c.Instrumentation.DeadLettered(msg.Topic, cause)
+
+	if c.DeadLetter == nil {
+		return nil
+	}
+
+	topic := c.DeadLetterTopic
+	if topic == "" {
+		topic = msg.Topic + ".dlq"
+	}
+
+	headers := make(map[string]string, len(msg.Headers)+2)
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+
+	headers[HeaderDeadLetterError] = cause.Error()
+	headers[HeaderDeadLetterTopic] = msg.Topic
+
+	return c.DeadLetter.Publish(ctx, Message{
+		Topic:   topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+func (c *Consumer) doInitOnce() {
+	if c.Instrumentation == nil {
+		c.Instrumentation = &noopInstrumentation{}
+	}
+
+	if c.Name == "" {
+		c.Instrumentation.InitWarning("name was not supplied.  Use of unique and informative names is strongly recommended")
+
+		c.Name = fmt.Sprintf("queue-consumer-%d", time.Now().UnixNano())
+	}
+
+	c.Instrumentation.Init(c.Name)
+
+	if c.Retries == nil {
+		c.Instrumentation.InitWarning("no retries have been configured.  Using default retry settings")
+
+		c.Retries = &Retries{}
+	}
+
+	if c.DeadLetter == nil {
+		c.Instrumentation.InitWarning("no dead-letter producer has been configured.  Failed messages will be dropped")
+	}
+
+	c.retrier = &retry.Client{
+		MaxAttempts: c.Retries.getMaxAttempts(),
+		BaseDelay:   c.Retries.getBaseDelay(),
+		MaxDelay:    c.Retries.getMaxDelay(),
+		CanRetry: func(err error) bool {
+			return !errors.Is(err, ErrPermanent)
+		},
+	}
+}
+
+func (r *Retries) getMaxAttempts() int {
+	if r.MaxAttempts > 0 {
+		return r.MaxAttempts
+	}
+
+	return defaultMaxAttempts
+}
+
+func (r *Retries) getBaseDelay() time.Duration {
+	if r.BaseDelay > 0 {
+		return r.BaseDelay
+	}
+
+	return defaultBaseRetryDelay
+}
+
+func (r *Retries) getMaxDelay() time.Duration {
+	if r.MaxDelay > 0 {
+		return r.MaxDelay
+	}
+
+	return defaultMaxRetryDelay
+}
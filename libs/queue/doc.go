@@ -0,0 +1,7 @@
+// Package queue provides producers and consumers for message brokers (Kafka, and an in-memory broker for tests) with
+// consistent delivery semantics across services.
+//
+// Consumers provide at-least-once delivery: a message is only committed after the handler succeeds or after the message
+// has been published to the dead-letter topic.  Failed messages are retried with exponential backoff before being
+// dead-lettered.
+package queue
@@ -0,0 +1,8 @@
+module github.com/karelrenaldi/storemono/libs/queue
+
+go 1.16
+
+require (
+	github.com/corsc/go-commons v1.1.0
+	github.com/segmentio/kafka-go v0.4.38
+)
@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"time"
+)
+
+// Instrumentation allows users to generated stats or logs from queue events
+type Instrumentation interface {
+	// Init is called once during initialization
+	Init(name string)
+
+	// InitWarning is called during init for warnings
+	InitWarning(message string)
+
+	// HandlerDuration is the time taken by a single call to the handler (err is the result of the handler)
+	HandlerDuration(start time.Time, topic string, attempt int, err error)
+
+	// Retry is called when the handler failed and the message will be retried
+	Retry(topic string, attempt int, err error)
+
+	// DeadLettered is called when a message has exhausted its retries and was sent to the dead-letter topic
+	DeadLettered(topic string, err error)
+
+	// CommitErr is called when committing a processed message failed (the message will be redelivered)
+	CommitErr(topic string, err error)
+
+	// FetchErr is called when fetching the next message failed
+	FetchErr(err error)
+}
+
+type noopInstrumentation struct{}
+
+func (n *noopInstrumentation) Init(_ string) {}
+
+func (n *noopInstrumentation) InitWarning(_ string) {}
+
+func (n *noopInstrumentation) HandlerDuration(_ time.Time, _ string, _ int, _ error) {}
+
+func (n *noopInstrumentation) Retry(_ string, _ int, _ error) {}
+
+func (n *noopInstrumentation) DeadLettered(_ string, _ error) {}
+
+func (n *noopInstrumentation) CommitErr(_ string, _ error) {}
+
+func (n *noopInstrumentation) FetchErr(_ error) {}
@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaConfig defines the connection to a Kafka cluster
+type KafkaConfig struct {
+	// Brokers is the list of broker addresses (host:port)
+	Brokers []string
+
+	// ClientID identifies this service to the brokers (optional)
+	ClientID string
+}
+
+// KafkaProducer is a Producer backed by Kafka
+type KafkaProducer struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaProducer returns a producer that publishes to the supplied cluster.
+// Messages must have their Topic set.  Publish waits for all in-sync replicas to acknowledge each message.
+func NewKafkaProducer(cfg KafkaConfig) *KafkaProducer {
+	return &KafkaProducer{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport: &kafka.Transport{
+				ClientID: cfg.ClientID,
+			},
+		},
+	}
+}
+
+// Publish implements Producer
+func (p *KafkaProducer) Publish(ctx context.Context, msgs ...Message) error {
+	kafkaMsgs := make([]kafka.Message, len(msgs))
+
+	for i, msg := range msgs {
+		kafkaMsgs[i] = kafka.Message{
+			Topic:   msg.Topic,
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: toKafkaHeaders(msg.Headers),
+			Time:    msg.Time,
+		}
+	}
+
+	return p.writer.WriteMessages(ctx, kafkaMsgs...)
+}
+
+// Close implements Producer
+func (p *KafkaProducer) Close() error {
+	return p.writer.Close()
+}
+
+// KafkaSubscription is a Subscription backed by a Kafka consumer group
+type KafkaSubscription struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaSubscription joins the consumer group (groupID) for the supplied topics.
+// Offsets are committed explicitly (see Subscription.Commit) so that delivery is at-least-once.
+func NewKafkaSubscription(cfg KafkaConfig, groupID string, topics ...string) *KafkaSubscription {
+	return &KafkaSubscription{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     cfg.Brokers,
+			GroupID:     groupID,
+			GroupTopics: topics,
+			Dialer: &kafka.Dialer{
+				ClientID: cfg.ClientID,
+				Timeout:  10 * time.Second,
+			},
+			// disable auto-commit
+			CommitInterval: 0,
+		}),
+	}
+}
+
+// Fetch implements Subscription
+func (s *KafkaSubscription) Fetch(ctx context.Context) (Message, error) {
+	msg, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Topic:     msg.Topic,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   fromKafkaHeaders(msg.Headers),
+		Time:      msg.Time,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}, nil
+}
+
+// Commit implements Subscription
+func (s *KafkaSubscription) Commit(ctx context.Context, msg Message) error {
+	return s.reader.CommitMessages(ctx, kafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
+}
+
+// Close implements Subscription
+func (s *KafkaSubscription) Close() error {
+	return s.reader.Close()
+}
+
+func toKafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	out := make([]kafka.Header, 0, len(headers))
+	for key, value := range headers {
+		out = append(out, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	return out
+}
+
+func fromKafkaHeaders(headers []kafka.Header) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(headers))
+	for _, header := range headers {
+		out[header.Key] = string(header.Value)
+	}
+
+	return out
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed indicates that the producer or subscription has been closed
+var ErrClosed = errors.New("closed")
+
+// MemoryBroker is an in-memory broker intended for tests.
+// Each topic is a single partition; every subscription receives every message published after it was created and
+// committed messages are recorded so that tests can assert on them.
+type MemoryBroker struct {
+	mutex         sync.Mutex
+	subscriptions map[string][]*MemorySubscription
+	published     []Message
+}
+
+// Producer returns a Producer that publishes to this broker
+func (b *MemoryBroker) Producer() Producer {
+	return &memoryProducer{broker: b}
+}
+
+// Subscribe returns a Subscription for the supplied topics
+func (b *MemoryBroker) Subscribe(topics ...string) *MemorySubscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscriptions == nil {
+		b.subscriptions = map[string][]*MemorySubscription{}
+	}
+
+	sub := &MemorySubscription{
+		messages: make(chan Message, 1024),
+		closed:   make(chan struct{}),
+	}
+
+	for _, topic := range topics {
+		b.subscriptions[topic] = append(b.subscriptions[topic], sub)
+	}
+
+	return sub
+}
+
+// Published returns all the messages published to the broker (in order)
+func (b *MemoryBroker) Published() []Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]Message(nil), b.published...)
+}
+
+func (b *MemoryBroker) publish(msg Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	msg.Offset = int64(len(b.published))
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	b.published = append(b.published, msg)
+
+	for _, sub := range b.subscriptions[msg.Topic] {
+		sub.messages <- msg
+	}
+}
+
+type memoryProducer struct {
+	broker *MemoryBroker
+}
+
+// Publish implements Producer
+func (p *memoryProducer) Publish(ctx context.Context, msgs ...Message) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	for _, msg := range msgs {
+		p.broker.publish(msg)
+	}
+
+	return nil
+}
+
+// Close implements Producer
+func (p *memoryProducer) Close() error {
+	return nil
+}
+
+// MemorySubscription is the Subscription returned by MemoryBroker.Subscribe
+type MemorySubscription struct {
+	messages chan Message
+	closed   chan struct{}
+
+	mutex     sync.Mutex
+	committed []Message
+	closeOnce sync.Once
+}
+
+// Fetch implements Subscription
+func (s *MemorySubscription) Fetch(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-s.messages:
+		return msg, nil
+
+	case <-s.closed:
+		return Message{}, ErrClosed
+
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// Commit implements Subscription
+func (s *MemorySubscription) Commit(_ context.Context, msg Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.committed = append(s.committed, msg)
+
+	return nil
+}
+
+// Committed returns the messages committed by this subscription (in order)
+func (s *MemorySubscription) Committed() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Message(nil), s.committed...)
+}
+
+// Close implements Subscription
+func (s *MemorySubscription) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Message is a single message sent to or received from a topic
+type Message struct {
+	// Topic is the destination (when publishing) or the source (when consuming)
+	Topic string
+
+	// Key is used for partitioning; messages with the same key are delivered in order
+	Key []byte
+
+	// Value is the payload
+	Value []byte
+
+	// Headers are the (optional) message headers
+	Headers map[string]string
+
+	// Time is when the message was produced (set by the broker when consuming)
+	Time time.Time
+
+	// Partition and Offset are set by the broker when consuming (and are used to commit the message)
+	Partition int
+	Offset    int64
+}
+
+// Producer publishes messages
+type Producer interface {
+	// Publish sends the messages and returns once the broker has acknowledged them
+	Publish(ctx context.Context, msgs ...Message) error
+
+	// Close flushes any pending messages and releases the resources of the producer
+	Close() error
+}
+
+// Subscription is the consuming side of a broker, typically a member of a consumer group
+type Subscription interface {
+	// Fetch blocks until the next message is available or the context is done
+	Fetch(ctx context.Context) (Message, error)
+
+	// Commit marks the message (and all prior messages of the same partition) as processed
+	Commit(ctx context.Context, msg Message) error
+
+	// Close leaves the consumer group and releases the resources of the subscription
+	Close() error
+}
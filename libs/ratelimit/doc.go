@@ -0,0 +1,10 @@
+// Package ratelimit provides the shared rate limiting primitives.
+//
+// Two algorithms are provided, each with an in-memory (per instance) and a Redis (shared by all instances) backend:
+//
+//   - Token bucket: allows bursts up to Burst and a sustained Rate (NewTokenBucket / RedisTokenBucket)
+//   - Sliding window: allows at most Limit requests in any Window (NewSlidingWindow / RedisSlidingWindow)
+//
+// All limiters implement Limiter, which can be used on the server side via Middleware or on the client side by
+// smarthttp's RateLimit.
+package ratelimit
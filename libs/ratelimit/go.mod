@@ -0,0 +1,5 @@
+module github.com/karelrenaldi/storemono/libs/ratelimit
+
+go 1.16
+
+require github.com/go-redis/redis/v8 v8.11.4
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLimitExceeded indicates that the request was rejected by the limiter
+var ErrLimitExceeded = errors.New("rate limit exceeded")
+
+// Result is the outcome of a single Allow call
+type Result struct {
+	// Allowed is true when the request may proceed
+	Allowed bool
+
+	// Remaining is the (approximate) number of requests that would currently be allowed
+	Remaining int
+
+	// RetryAfter is the (approximate) time until a request would be allowed (zero when Allowed)
+	RetryAfter time.Duration
+}
+
+// Limiter is implemented by all the limiters in this package
+type Limiter interface {
+	// Allow reports whether a request for the key may proceed now (and consumes capacity if it may)
+	Allow(ctx context.Context, key string) (Result, error)
+
+	// Wait blocks until a request for the key may proceed or the context is done
+	Wait(ctx context.Context, key string) error
+}
+
+// wait implements Limiter.Wait on top of Limiter.Allow
+func wait(ctx context.Context, limiter Limiter, key string) error {
+	for {
+		result, err := limiter.Allow(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if result.Allowed {
+			return nil
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < result.RetryAfter {
+			// fail fast rather than waiting for a slot we can never use
+			return ErrLimitExceeded
+		}
+
+		timer := time.NewTimer(result.RetryAfter)
+
+		select {
+		case <-timer.C:
+			// try again
+
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
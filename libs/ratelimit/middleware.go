@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// KeyFunc extracts the rate limiting key (e.g. client IP, user ID or API key) from the request
+type KeyFunc func(req *http.Request) string
+
+// RemoteIPKey uses the IP address of the remote peer as the key.
+// NOTE: when running behind a load balancer, a KeyFunc that inspects the forwarding headers should be used instead.
+func RemoteIPKey(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// Middleware returns a server middleware (compatible with gorilla's mux.MiddlewareFunc) that rejects requests exceeding
+// the limit with 429 and a Retry-After header.
+// When the limiter fails (e.g. Redis is unavailable) the request is allowed; rate limiting fails open.
+func Middleware(limiter Limiter, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			result, err := limiter.Allow(req.Context(), keyFunc(req))
+			if err != nil {
+				next.ServeHTTP(resp, req)
+				return
+			}
+
+			resp.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+			if !result.Allowed {
+				resp.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				http.Error(resp, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+				return
+			}
+
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NOTE: both scripts use the time of the calling instance; instances are expected to have (NTP) synchronized clocks.
+
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+
+return {allowed, math.floor(tokens), retry}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+
+local estimate = previous * (1 - elapsed / window) + current
+if estimate >= limit then
+	return {0, 0, current, previous}
+end
+
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], window * 2)
+
+return {1, math.floor(limit - estimate - 1), current, previous}
+`)
+
+// RedisTokenBucket is a token bucket limiter whose state is stored in Redis and shared by all instances
+type RedisTokenBucket struct {
+	// Client is the Redis client (a *redis.Client, *redis.ClusterClient or *redis.Ring)
+	Client redis.UniversalClient
+
+	// Prefix is (optionally) prepended to all keys to avoid collisions with other users of the same Redis
+	Prefix string
+
+	// Rate is the sustained rate (requests per second)
+	Rate float64
+
+	// Burst is the maximum number of requests allowed at once
+	Burst int
+}
+
+// Allow implements Limiter
+func (r *RedisTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	values, err := tokenBucketScript.Run(ctx, r.Client, []string{r.Prefix + key},
+		strconv.FormatFloat(r.Rate, 'f', -1, 64), r.Burst, time.Now().UnixNano()/int64(time.Millisecond)).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// Wait implements Limiter
+func (r *RedisTokenBucket) Wait(ctx context.Context, key string) error {
+	return wait(ctx, r, key)
+}
+
+// RedisSlidingWindow is a sliding window limiter whose state is stored in Redis and shared by all instances
+type RedisSlidingWindow struct {
+	// Client is the Redis client (a *redis.Client, *redis.ClusterClient or *redis.Ring)
+	Client redis.UniversalClient
+
+	// Prefix is (optionally) prepended to all keys to avoid collisions with other users of the same Redis
+	Prefix string
+
+	// Limit is the maximum number of requests in any Window
+	Limit int
+
+	// Window is the duration of the window
+	Window time.Duration
+}
+
+// Allow implements Limiter
+func (r *RedisSlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now()
+	windowMs := r.Window.Milliseconds()
+	currentStart := now.Truncate(r.Window)
+	index := currentStart.UnixNano() / int64(r.Window)
+	elapsed := now.Sub(currentStart)
+
+	// the hash tag keeps both keys on the same cluster node
+	base := "{" + r.Prefix + key + "}:"
+	keys := []string{base + strconv.FormatInt(index, 10), base + strconv.FormatInt(index-1, 10)}
+
+	values, err := slidingWindowScript.Run(ctx, r.Client, keys, r.Limit, windowMs, elapsed.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   values[0] == 1,
+		Remaining: int(values[1]),
+	}
+
+	if !result.Allowed {
+		result.RetryAfter = slidingRetryAfter(int(values[3]), int(values[2]), r.Limit, elapsed, r.Window)
+	}
+
+	return result, nil
+}
+
+// Wait implements Limiter
+func (r *RedisSlidingWindow) Wait(ctx context.Context, key string) error {
+	return wait(ctx, r, key)
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SlidingWindow is an in-memory sliding window limiter.  It is safe for concurrent use.
+//
+// The window is approximated by weighting the count of the previous fixed window by how much of it still overlaps the
+// sliding window, which requires constant memory per key.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+
+	mutex   sync.Mutex
+	windows map[string]*windowState
+	calls   int
+}
+
+type windowState struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// NewSlidingWindow returns a limiter that allows at most limit requests in any window
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		limit:   limit,
+		window:  window,
+		windows: map[string]*windowState{},
+	}
+}
+
+// Allow implements Limiter
+func (s *SlidingWindow) Allow(_ context.Context, key string) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	s.sweep(now)
+
+	state, ok := s.windows[key]
+	if !ok {
+		state = &windowState{start: now.Truncate(s.window)}
+		s.windows[key] = state
+	}
+
+	// advance the fixed windows
+	currentStart := now.Truncate(s.window)
+	switch elapsedWindows := int(currentStart.Sub(state.start) / s.window); {
+	case elapsedWindows == 1:
+		state.previous = state.current
+		state.current = 0
+		state.start = currentStart
+
+	case elapsedWindows > 1:
+		state.previous = 0
+		state.current = 0
+		state.start = currentStart
+	}
+
+	elapsed := now.Sub(state.start)
+	estimate := slidingEstimate(state.previous, state.current, elapsed, s.window)
+
+	if estimate >= float64(s.limit) {
+		return Result{
+			RetryAfter: slidingRetryAfter(state.previous, state.current, s.limit, elapsed, s.window),
+		}, nil
+	}
+
+	state.current++
+
+	return Result{
+		Allowed:   true,
+		Remaining: int(float64(s.limit) - estimate - 1),
+	}, nil
+}
+
+// Wait implements Limiter
+func (s *SlidingWindow) Wait(ctx context.Context, key string) error {
+	return wait(ctx, s, key)
+}
+
+// sweep removes keys that have not been used for two windows (they are equivalent to a new key)
+func (s *SlidingWindow) sweep(now time.Time) {
+	s.calls++
+	if s.calls%sweepInterval != 0 {
+		return
+	}
+
+	for key, state := range s.windows {
+		if now.Sub(state.start) > 2*s.window {
+			delete(s.windows, key)
+		}
+	}
+}
+
+func slidingEstimate(previous, current int, elapsed, window time.Duration) float64 {
+	weight := 1 - float64(elapsed)/float64(window)
+
+	return float64(previous)*weight + float64(current)
+}
+
+// slidingRetryAfter approximates the time until the estimate drops below the limit
+func slidingRetryAfter(previous, current, limit int, elapsed, window time.Duration) time.Duration {
+	untilNextWindow := window - elapsed
+
+	if current >= limit || previous == 0 {
+		return untilNextWindow
+	}
+
+	// previous * (1 - (elapsed + wait)/window) + current < limit
+	retryAfter := time.Duration((1-float64(limit-current)/float64(previous))*float64(window)) - elapsed + time.Millisecond
+	if retryAfter <= 0 || retryAfter > untilNextWindow {
+		return untilNextWindow
+	}
+
+	return retryAfter
+}
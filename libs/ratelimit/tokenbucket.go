@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweep the in-memory state for idle keys every N calls
+const sweepInterval = 1024
+
+// TokenBucket is an in-memory token bucket limiter.  It is safe for concurrent use.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a limiter that allows a sustained rate (requests per second) with bursts of up to burst requests
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow implements Limiter
+func (t *TokenBucket) Allow(_ context.Context, key string) (Result, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+
+	t.sweep(now)
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[key] = b
+	}
+
+	b.tokens = math.Min(t.burst, b.tokens+now.Sub(b.last).Seconds()*t.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return Result{
+			RetryAfter: time.Duration((1 - b.tokens) / t.rate * float64(time.Second)),
+		}, nil
+	}
+
+	b.tokens--
+
+	return Result{
+		Allowed:   true,
+		Remaining: int(b.tokens),
+	}, nil
+}
+
+// Wait implements Limiter
+func (t *TokenBucket) Wait(ctx context.Context, key string) error {
+	return wait(ctx, t, key)
+}
+
+// sweep removes buckets that have been idle long enough to be full again (they are equivalent to a new bucket)
+func (t *TokenBucket) sweep(now time.Time) {
+	t.calls++
+	if t.calls%sweepInterval != 0 {
+		return
+	}
+
+	refill := time.Duration(t.burst / t.rate * float64(time.Second))
+
+	for key, b := range t.buckets {
+		if now.Sub(b.last) > refill {
+			delete(t.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package smartgrpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// This is the default deadline applied to calls when the context does not contain one
+	defaultTimeout = 3 * time.Second
+)
+
+// Client holds the configuration for the interceptors applied to gRPC calls.
+// As with smarthttp.Client, it is strongly recommended that a single instance is created per upstream and shared.
+type Client struct {
+	// Name is the unique name for this client.
+	// This name is used to track errors, emit stats, etc.
+	// It is recommended to use an identifiable name link the service being called.
+	Name string
+
+	// Timeout is the deadline applied to calls when the context does not already contain a deadline.
+	// Existing (e.g. inbound request) deadlines are always propagated as-is.
+	Timeout time.Duration
+
+	// Instrumentation allows reporting and logging of internal events and statistics
+	Instrumentation Instrumentation
+
+	// CircuitBreaker defines the (optional) circuit breaker configuration for this client.
+	CircuitBreaker CircuitBreaker
+
+	// Retries defines the (optional) retry configuration for this client.
+	Retries *Retries
+
+	// Singleflight defines the (optional) single-flight configuration for this client.
+	Singleflight *Singleflight
+
+	initOnce sync.Once
+}
+
+// DialOptions returns the options required to add this client's interceptors to a grpc.ClientConn
+func (c *Client) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(c.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(c.StreamClientInterceptor()),
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor that applies the deadline, singleflight, circuit breaker and retries
+// (in that order) to unary calls.
+func (c *Client) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	c.initOnce.Do(c.doInitOnce)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+
+		defer c.Instrumentation.CallDuration(start, method)
+
+		ctx, cancel := c.withDeadline(ctx)
+		defer cancel()
+
+		// base call
+		doCallFunc := func(ctx context.Context, call *unaryCall) error {
+			attemptStart := time.Now()
+
+			err := invoker(ctx, call.method, call.req, call.reply, cc, opts...)
+
+			c.Instrumentation.BaseCallDuration(attemptStart, status.Code(err), call.method)
+
+			return err
+		}
+
+		// add middleware (note: be wary of the ordering here)
+
+		// retries are inside the circuit; this means the circuit only see complete failure
+		doCallFunc = c.Retries.addMiddleware(doCallFunc)
+		doCallFunc = (&c.CircuitBreaker).addMiddleware(doCallFunc)
+
+		// singleflight is last so that it does not see or interact with the retries
+		doCallFunc = c.Singleflight.addMiddleware(doCallFunc)
+
+		return doCallFunc(ctx, &unaryCall{method: method, req: req, reply: reply})
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that applies the deadline and circuit breaker to establishing streams.
+// Streams are never retried or deduplicated as the messages cannot be safely replayed.
+func (c *Client) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	c.initOnce.Do(c.doInitOnce)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var stream grpc.ClientStream
+
+		doCallFunc := func(ctx context.Context, call *unaryCall) error {
+			var err error
+
+			stream, err = streamer(ctx, desc, cc, call.method, opts...)
+
+			return err
+		}
+
+		doCallFunc = (&c.CircuitBreaker).addMiddleware(doCallFunc)
+
+		err := doCallFunc(ctx, &unaryCall{method: method})
+
+		return stream, err
+	}
+}
+
+// withDeadline applies the default timeout when the context does not contain a deadline
+func (c *Client) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+func (c *Client) doInitOnce() {
+	if c.Instrumentation == nil {
+		c.Instrumentation = &noopInstrumentation{}
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+
+	if c.Name == "" {
+		c.Instrumentation.InitWarning("name was not supplied.  Use of unique and informative names is strongly recommended")
+
+		c.Name = fmt.Sprintf("smart-grpc-%d", time.Now().UnixNano())
+	}
+
+	c.Instrumentation.Init(c.Name)
+
+	(&c.CircuitBreaker).doInitOnce(c.Instrumentation, c.Name)
+
+	if c.Retries != nil {
+		c.Retries.doInitOnce(c.Instrumentation)
+	}
+
+	if c.Singleflight != nil {
+		c.Singleflight.doInitOnce(c.Instrumentation)
+	}
+}
+
+// unaryCall holds the parameters of a single call as it passes through the middleware
+type unaryCall struct {
+	method string
+	req    interface{}
+	reply  interface{}
+}
+
+type callClosure func(ctx context.Context, call *unaryCall) error
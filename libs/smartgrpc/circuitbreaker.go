@@ -0,0 +1,151 @@
+package smartgrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultErrorThreshold = 80
+
+	minErrorThreshold = 50
+)
+
+var (
+	defaultMaxConcurrentRequests = hystrix.DefaultMaxConcurrent
+
+	// see `getTimeout()` for more details
+	defaultCircuitBreakerTimeout = 1 * time.Hour
+
+	// ErrCircuitIsOpen indicates that the circuit is open and any available fallback should be used.
+	// The error returned to callers has the status code Unavailable and wraps this error.
+	ErrCircuitIsOpen = errors.New("the circuit is open")
+
+	// ErrCircuitMaxConcurrencyReached indicates that there are more concurrent calls than configured going through
+	// the circuit.  The error returned to callers has the status code ResourceExhausted and wraps this error.
+	ErrCircuitMaxConcurrencyReached = errors.New("the circuit's max concurrency is reached")
+)
+
+// CircuitBreaker defines the circuit breaker configuration
+type CircuitBreaker struct {
+	// Default value is 80 (cannot be set below 50)
+	ErrorPercentThreshold int
+
+	// Default value is 10 (setting above 100 is not advisable)
+	MaxConcurrentRequests int
+
+	name            string
+	instrumentation Instrumentation
+}
+
+// circuitError is returned to callers when the circuit rejects a call.
+// It carries a gRPC status (for callers that inspect codes) and wraps the package level sentinel.
+type circuitError struct {
+	code codes.Code
+	err  error
+}
+
+func (e *circuitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *circuitError) Unwrap() error {
+	return e.err
+}
+
+// GRPCStatus allows status.Code() and status.FromError() to extract the status code
+func (e *circuitError) GRPCStatus() *status.Status {
+	return status.New(e.code, e.err.Error())
+}
+
+func (b *CircuitBreaker) getTimeout() int {
+	// Set a timeout that is so long that all other timeouts will trigger first
+	// We are essentially disabling this timeout
+	return int(defaultCircuitBreakerTimeout.Milliseconds())
+}
+
+func (b *CircuitBreaker) getMaxConcurrent() int {
+	if b.MaxConcurrentRequests > 0 {
+		return b.MaxConcurrentRequests
+	}
+
+	b.instrumentation.InitWarning("using default 'max concurrent requests' setting for circuit breaker")
+
+	return defaultMaxConcurrentRequests
+}
+
+func (b *CircuitBreaker) getErrorPercent() int {
+	if b.ErrorPercentThreshold > minErrorThreshold {
+		return b.ErrorPercentThreshold
+	}
+
+	b.instrumentation.InitWarning("using default 'error threshold' setting for circuit breaker")
+
+	return defaultErrorThreshold
+}
+
+func (b *CircuitBreaker) buildMiddleware(doFunc callClosure) callClosure {
+	return func(ctx context.Context, call *unaryCall) error {
+		var callErr error
+
+		err := hystrix.Do(b.name, func() error {
+			callErr = doFunc(ctx, call)
+
+			return b.outErrorBasedOnStatusCode(call, callErr)
+		}, nil)
+
+		switch err {
+		case hystrix.ErrCircuitOpen:
+			b.instrumentation.CBCircuitOpen(call.method)
+			return &circuitError{code: codes.Unavailable, err: ErrCircuitIsOpen}
+
+		case hystrix.ErrMaxConcurrency:
+			return &circuitError{code: codes.ResourceExhausted, err: ErrCircuitMaxConcurrencyReached}
+
+		default:
+			return callErr
+		}
+	}
+}
+
+// outErrorBasedOnStatusCode returns an error only for status codes that indicate a failing upstream
+func (b *CircuitBreaker) outErrorBasedOnStatusCode(call *unaryCall, err error) error {
+	code := status.Code(err)
+
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown,
+		codes.Unimplemented, codes.DataLoss:
+		// these status codes should be tracked by the circuit breaker
+		b.instrumentation.CBTrackedCode(call.method, code)
+
+		return err
+
+	default:
+		// do not track these status codes (they are success codes or user errors)
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) addMiddleware(doFunc callClosure) callClosure {
+	if b == nil {
+		return doFunc
+	}
+
+	return b.buildMiddleware(doFunc)
+}
+
+func (b *CircuitBreaker) doInitOnce(instrumentation Instrumentation, name string) {
+	b.name = name
+	b.instrumentation = instrumentation
+
+	hystrix.ConfigureCommand(b.name, hystrix.CommandConfig{
+		Timeout:               b.getTimeout(),
+		MaxConcurrentRequests: b.getMaxConcurrent(),
+		ErrorPercentThreshold: b.getErrorPercent(),
+	})
+}
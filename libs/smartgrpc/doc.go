@@ -0,0 +1,6 @@
+// Package smartgrpc provides the same resilience features as smarthttp (retries, circuit breaker, singleflight and
+// instrumentation) for gRPC clients.  The features are implemented as client interceptors so that they can be added to any
+// grpc.ClientConn with Client.DialOptions().
+//
+// Team: #commons-http @corey.scott
+package smartgrpc
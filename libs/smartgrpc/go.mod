@@ -0,0 +1,11 @@
+module github.com/karelrenaldi/storemono/libs/smartgrpc
+
+go 1.14
+
+require (
+	github.com/afex/hystrix-go v0.0.0-20180502004556-fa1af6a1f4f5
+	github.com/corsc/go-commons v1.1.0
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
+	google.golang.org/grpc v1.46.2
+	google.golang.org/protobuf v1.28.0
+)
@@ -0,0 +1,57 @@
+package smartgrpc
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Instrumentation allows users to generated stats or logs from Smart gRPC events
+type Instrumentation interface {
+	// Init is called once during initialization
+	Init(name string)
+
+	// InitWarning is called during init for warnings
+	InitWarning(message string)
+
+	// CallDuration is the total time taken to complete the call (includes retries)
+	CallDuration(start time.Time, method string)
+
+	// BaseCallDuration is the time taken to make a single call to the upstream
+	BaseCallDuration(start time.Time, code codes.Code, method string)
+
+	// CBCircuitOpen is called when the circuit breaker circuit is open
+	CBCircuitOpen(method string)
+
+	// CBTrackedCode is called when the status code is tracked by the circuit breaker as an error
+	CBTrackedCode(method string, code codes.Code)
+
+	// RetryNonRetriable is called when a non-retriable status code has been returned
+	RetryNonRetriable(method string, code codes.Code)
+
+	// RetryRetriable is called when a retriable status code has been returned
+	RetryRetriable(method string, code codes.Code)
+
+	// SingleflightErr is called when singleflight returns an error
+	SingleflightErr(method string, err error)
+}
+
+type noopInstrumentation struct{}
+
+func (n *noopInstrumentation) Init(_ string) {}
+
+func (n *noopInstrumentation) InitWarning(_ string) {}
+
+func (n *noopInstrumentation) CallDuration(_ time.Time, _ string) {}
+
+func (n *noopInstrumentation) BaseCallDuration(_ time.Time, _ codes.Code, _ string) {}
+
+func (n *noopInstrumentation) CBCircuitOpen(_ string) {}
+
+func (n *noopInstrumentation) CBTrackedCode(_ string, _ codes.Code) {}
+
+func (n *noopInstrumentation) RetryNonRetriable(_ string, _ codes.Code) {}
+
+func (n *noopInstrumentation) RetryRetriable(_ string, _ codes.Code) {}
+
+func (n *noopInstrumentation) SingleflightErr(_ string, _ error) {}
@@ -0,0 +1,181 @@
+package smartgrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/corsc/go-commons/resilience/retry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultBaseRetryDelay = 10 * time.Millisecond
+	defaultMaxRetryDelay  = 1 * time.Second
+)
+
+var (
+	// This indicates that we CANNOT retry this call due to the status code
+	// This error should not be surfaced callers of this package.
+	errRetryImpossible = errors.New("cannot retry due to gRPC status code")
+
+	// This indicates that we CAN retry this call due to the status code
+	// This error should not be surfaced callers of this package.
+	errRetryAllowed = errors.New("according to the gRPC status we can retry the call")
+)
+
+// Retries defines the retry configuration
+type Retries struct {
+	// MaxAttempts is the maximum number of retry attempts before giving up. (default: 3)
+	MaxAttempts int
+
+	// BaseDelay is the base amount of time between attempts (default: 10 ms)
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum possible delay (default: 1 second)
+	MaxDelay time.Duration
+
+	// PerAttemptTimeout is the (optional) deadline of each individual attempt.
+	// When not set, each attempt may use the entire remaining deadline of the call.
+	PerAttemptTimeout time.Duration
+
+	retrier *retry.Client
+
+	instrumentation Instrumentation
+}
+
+func (r *Retries) getMaxAttempts() int {
+	if r.MaxAttempts > 0 {
+		return r.MaxAttempts
+	}
+
+	r.instrumentation.InitWarning("using default 'max attempts' setting for retries")
+
+	return defaultMaxAttempts
+}
+
+func (r *Retries) getBaseDelay() time.Duration {
+	if r.BaseDelay > 0 {
+		return r.BaseDelay
+	}
+
+	r.instrumentation.InitWarning("using default 'base retry delay' setting for retries")
+
+	return defaultBaseRetryDelay
+}
+
+func (r *Retries) getMaxDelay() time.Duration {
+	if r.MaxDelay > 0 {
+		return r.MaxDelay
+	}
+
+	r.instrumentation.InitWarning("using default 'max retry delay' setting for retries")
+
+	return defaultMaxRetryDelay
+}
+
+func (r *Retries) buildMiddleware(doFunc callClosure) callClosure {
+	return func(ctx context.Context, call *unaryCall) error {
+		var innerErr error
+
+		// each attempt uses its own reply so that an abandoned attempt (e.g. after the context is done) cannot write into
+		// the caller's reply after we have returned
+		reply, isProto := call.reply.(proto.Message)
+		var successReply proto.Message
+
+		err := r.retrier.Do(ctx, "", func() error {
+			attemptCtx := ctx
+
+			if r.PerAttemptTimeout > 0 {
+				var cancel context.CancelFunc
+
+				attemptCtx, cancel = context.WithTimeout(ctx, r.PerAttemptTimeout)
+				defer cancel()
+			}
+
+			attemptCall := call
+			if isProto {
+				attemptCall = &unaryCall{method: call.method, req: call.req, reply: reply.ProtoReflect().New().Interface()}
+			}
+
+			innerErr = doFunc(attemptCtx, attemptCall)
+			if innerErr == nil {
+				successReply, _ = attemptCall.reply.(proto.Message)
+
+				return nil
+			}
+
+			code := status.Code(innerErr)
+
+			switch code {
+			case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+				r.instrumentation.RetryRetriable(call.method, code)
+
+				return errRetryAllowed
+
+			case codes.DeadlineExceeded:
+				if ctx.Err() == nil {
+					// only the attempt timed out; the call still has time remaining
+					r.instrumentation.RetryRetriable(call.method, code)
+
+					return errRetryAllowed
+				}
+
+				r.instrumentation.RetryNonRetriable(call.method, code)
+
+				return errRetryImpossible
+
+			default:
+				r.instrumentation.RetryNonRetriable(call.method, code)
+
+				return errRetryImpossible
+			}
+		})
+
+		switch {
+		case err == nil:
+			if isProto {
+				proto.Merge(reply, successReply)
+			}
+
+			return nil
+
+		case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+			return status.FromContextError(err).Err()
+
+		case errors.Is(err, errRetryImpossible), errors.Is(err, errRetryAllowed), errors.Is(err, retry.ErrAttemptsExceeded):
+			return innerErr
+
+		default:
+			return err
+		}
+	}
+}
+
+func (r *Retries) addMiddleware(doFunc callClosure) callClosure {
+	if r == nil {
+		return doFunc
+	}
+
+	return r.buildMiddleware(doFunc)
+}
+
+func (r *Retries) doInitOnce(instrumentation Instrumentation) {
+	if r == nil {
+		return
+	}
+
+	r.instrumentation = instrumentation
+
+	r.retrier = &retry.Client{
+		MaxAttempts: r.getMaxAttempts(),
+		BaseDelay:   r.getBaseDelay(),
+		MaxDelay:    r.getMaxDelay(),
+		CanRetry: func(err error) bool {
+			return errors.Is(err, errRetryAllowed)
+		},
+	}
+}
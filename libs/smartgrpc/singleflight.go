@@ -0,0 +1,122 @@
+package smartgrpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/proto"
+)
+
+// errUnsupportedMessage indicates that the request or reply is not a protobuf message and cannot be deduplicated
+var errUnsupportedMessage = errors.New("singleflight requires protobuf messages")
+
+// Singleflight defines the Singleflight configuration.
+// Only unary calls for methods accepted by IsRead are deduplicated; concurrent identical calls share a single upstream call.
+type Singleflight struct {
+	// IsRead returns true for (full) methods that are safe to deduplicate (e.g. "/catalog.Catalog/GetProduct").
+	// If none is provided then DefaultIsRead is used.
+	IsRead func(method string) bool
+
+	group *singleflight.Group
+
+	instrumentation Instrumentation
+}
+
+type sfResult struct {
+	reply proto.Message
+	err   error
+}
+
+func (s *Singleflight) buildMiddleware(doFunc callClosure) callClosure {
+	return func(ctx context.Context, call *unaryCall) error {
+		if !s.IsRead(call.method) {
+			return doFunc(ctx, call)
+		}
+
+		key, err := generateKey(call)
+		if err != nil {
+			s.instrumentation.SingleflightErr(call.method, err)
+
+			return doFunc(ctx, call)
+		}
+
+		result, _, shared := s.group.Do(key, func() (interface{}, error) {
+			err := doFunc(ctx, call)
+
+			return &sfResult{reply: call.reply.(proto.Message), err: err}, nil
+		})
+
+		out := result.(*sfResult)
+		if !shared || out.reply == call.reply {
+			return out.err
+		}
+
+		// copy the leader's reply into this caller's reply
+		reply := call.reply.(proto.Message)
+		proto.Reset(reply)
+		proto.Merge(reply, out.reply)
+
+		return out.err
+	}
+}
+
+func generateKey(call *unaryCall) (string, error) {
+	req, reqOK := call.req.(proto.Message)
+	_, replyOK := call.reply.(proto.Message)
+
+	if !reqOK || !replyOK {
+		return "", errUnsupportedMessage
+	}
+
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	builder := strings.Builder{}
+
+	_, _ = builder.WriteString(call.method)
+	_, _ = builder.Write([]byte(`||`))
+	_, _ = builder.Write(payload)
+
+	return builder.String(), nil
+}
+
+func (s *Singleflight) addMiddleware(doFunc callClosure) callClosure {
+	if s == nil {
+		return doFunc
+	}
+
+	return s.buildMiddleware(doFunc)
+}
+
+func (s *Singleflight) doInitOnce(instrumentation Instrumentation) {
+	if s == nil {
+		instrumentation.InitWarning("no single flight has been configured.  Use is strongly recommended for all read requests")
+
+		return
+	}
+
+	s.instrumentation = instrumentation
+
+	s.group = &singleflight.Group{}
+
+	if s.IsRead == nil {
+		s.IsRead = DefaultIsRead
+	}
+}
+
+// DefaultIsRead treats methods whose name starts with Get, List, Search or Find as reads.
+func DefaultIsRead(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+
+	for _, prefix := range []string{"Get", "List", "Search", "Find"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,274 @@
+package smarthttp
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LimitAlgorithm selects how AdaptiveConcurrency adjusts the concurrency limit
+type LimitAlgorithm int
+
+const (
+	// AIMD increases the limit by one after each successful request while the limit is being used and multiplies it by
+	// the BackoffRatio when a request fails
+	AIMD LimitAlgorithm = iota
+
+	// Gradient adjusts the limit by the ratio of the long term latency and the latest latency so that the limit shrinks
+	// as soon as the upstream starts queueing (i.e. latency increases), before it starts failing
+	Gradient
+)
+
+const (
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveMaxLimit     = 200
+	defaultAdaptiveBackoffRatio = 0.9
+	defaultAdaptiveLowHeadroom  = 0.2
+
+	// gradient settings (see Netflix's concurrency-limits Gradient2Limit)
+	gradientTolerance = 1.5
+	gradientSmoothing = 0.2
+	gradientLongRTT   = 0.05
+)
+
+// ErrConcurrencyLimitExceeded indicates that the request was rejected by the adaptive concurrency limit
+var ErrConcurrencyLimitExceeded = errors.New("adaptive concurrency limit exceeded")
+
+// AdaptiveConcurrency defines the adaptive concurrency limiting configuration.
+// Instead of a static limit, the number of requests in flight is adjusted based on the latency and errors observed, so
+// that the limit follows the capacity of the upstream.
+//
+// Requests are admitted by priority (see WithPriority): PriorityLow requests are rejected once the requests in flight
+// reach the limit less the LowPriorityHeadroom, so that the rest of the limit is left to the other requests (e.g. the
+// analytics requests are rejected before the checkout requests).
+type AdaptiveConcurrency struct {
+	// Algorithm is the algorithm used to adjust the limit (default: AIMD)
+	Algorithm LimitAlgorithm
+
+	// InitialLimit is the limit used before any requests have been observed (default: 20)
+	InitialLimit int
+
+	// MinLimit is the lowest the limit can go (default: 1)
+	MinLimit int
+
+	// MaxLimit is the highest the limit can go (default: 200)
+	MaxLimit int
+
+	// BackoffRatio is the ratio the limit is multiplied by when a request fails (default: 0.9)
+	BackoffRatio float64
+
+	// LowPriorityHeadroom is the fraction of the limit that PriorityLow requests cannot use (default: 0.2)
+	LowPriorityHeadroom float64
+
+	mutex    sync.Mutex
+	limit    float64
+	inFlight int
+	longRTT  float64
+
+	minLimit        float64
+	maxLimit        float64
+	backoffRatio    float64
+	lowHeadroom     float64
+	instrumentation Instrumentation
+}
+
+func (a *AdaptiveConcurrency) getInitialLimit() int {
+	if a.InitialLimit > 0 {
+		return a.InitialLimit
+	}
+
+	a.instrumentation.InitWarning("using default 'initial limit' setting for adaptive concurrency")
+
+	return defaultAdaptiveInitialLimit
+}
+
+func (a *AdaptiveConcurrency) getMinLimit() int {
+	if a.MinLimit > 0 {
+		return a.MinLimit
+	}
+
+	a.instrumentation.InitWarning("using default 'min limit' setting for adaptive concurrency")
+
+	return defaultAdaptiveMinLimit
+}
+
+func (a *AdaptiveConcurrency) getMaxLimit() int {
+	if a.MaxLimit > 0 {
+		return a.MaxLimit
+	}
+
+	a.instrumentation.InitWarning("using default 'max limit' setting for adaptive concurrency")
+
+	return defaultAdaptiveMaxLimit
+}
+
+func (a *AdaptiveConcurrency) getBackoffRatio() float64 {
+	if a.BackoffRatio > 0 && a.BackoffRatio < 1 {
+		return a.BackoffRatio
+	}
+
+	a.instrumentation.InitWarning("using default 'backoff ratio' setting for adaptive concurrency")
+
+	return defaultAdaptiveBackoffRatio
+}
+
+func (a *AdaptiveConcurrency) getLowPriorityHeadroom() float64 {
+	if a.LowPriorityHeadroom > 0 && a.LowPriorityHeadroom < 1 {
+		return a.LowPriorityHeadroom
+	}
+
+	a.instrumentation.InitWarning("using default 'low priority headroom' setting for adaptive concurrency")
+
+	return defaultAdaptiveLowHeadroom
+}
+
+func (a *AdaptiveConcurrency) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		if !a.acquire(priorityOf(req)) {
+			a.instrumentation.ConcurrencyLimitRejected(req)
+
+			return nil, ErrConcurrencyLimitExceeded
+		}
+
+		start := time.Now()
+
+		resp, err := doFunc(req)
+
+		a.release(time.Since(start), isOverloaded(req, resp, err))
+
+		return resp, err
+	}
+}
+
+// acquire takes a slot for a request of the priority when the limit (less the headroom for low priority) allows it
+func (a *AdaptiveConcurrency) acquire(priority Priority) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	limit := int(a.limit)
+	if priority <= PriorityLow {
+		limit = int(a.limit * (1 - a.lowHeadroom))
+	}
+
+	if a.inFlight >= limit {
+		return false
+	}
+
+	a.inFlight++
+
+	return true
+}
+
+// release records the outcome of a request and adjusts the limit
+func (a *AdaptiveConcurrency) release(rtt time.Duration, overloaded bool) {
+	a.mutex.Lock()
+
+	inFlight := a.inFlight
+	a.inFlight--
+
+	previous := int(a.limit)
+
+	var limit float64
+
+	switch {
+	case overloaded:
+		limit = a.limit * a.backoffRatio
+
+	case a.Algorithm == Gradient:
+		limit = a.gradientLimit(float64(rtt))
+
+	case inFlight*2 >= int(a.limit):
+		// only grow the limit when it is actually being used
+		limit = a.limit + 1
+
+	default:
+		limit = a.limit
+	}
+
+	a.limit = math.Max(a.minLimit, math.Min(a.maxLimit, limit))
+
+	current := int(a.limit)
+	a.mutex.Unlock()
+
+	if current != previous {
+		a.instrumentation.ConcurrencyLimitChanged(current)
+	}
+}
+
+// gradientLimit calculates the new limit from the latency of the latest request (must be called with the lock held)
+func (a *AdaptiveConcurrency) gradientLimit(rtt float64) float64 {
+	if a.longRTT == 0 {
+		a.longRTT = rtt
+	} else {
+		a.longRTT = a.longRTT*(1-gradientLongRTT) + rtt*gradientLongRTT
+	}
+
+	if rtt <= 0 {
+		return a.limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*a.longRTT/rtt))
+	queueSize := math.Sqrt(a.limit)
+
+	limit := a.limit*gradient + queueSize
+
+	return a.limit*(1-gradientSmoothing) + limit*gradientSmoothing
+}
+
+// isOverloaded returns true when the result indicates that the upstream is overloaded
+func isOverloaded(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// errors caused by the caller do not indicate overload
+		return req.Context().Err() == nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func (a *AdaptiveConcurrency) addMiddleware(doFunc requestClosure) requestClosure {
+	if a == nil {
+		return doFunc
+	}
+
+	return a.buildMiddleware(doFunc)
+}
+
+func (a *AdaptiveConcurrency) doInitOnce(instrumentation Instrumentation) {
+	if a == nil {
+		return
+	}
+
+	a.instrumentation = instrumentation
+
+	a.minLimit = float64(a.getMinLimit())
+	a.maxLimit = float64(a.getMaxLimit())
+	a.backoffRatio = a.getBackoffRatio()
+	a.lowHeadroom = a.getLowPriorityHeadroom()
+	a.limit = math.Max(a.minLimit, math.Min(a.maxLimit, float64(a.getInitialLimit())))
+}
+
+// clone returns a copy of the configuration (with its own limit) for a variant of the client (see Client.Clone)
+func (a *AdaptiveConcurrency) clone() *AdaptiveConcurrency {
+	if a == nil {
+		return nil
+	}
+
+	return &AdaptiveConcurrency{
+		Algorithm:    a.Algorithm,
+		InitialLimit: a.InitialLimit,
+		MinLimit:     a.MinLimit,
+		MaxLimit:     a.MaxLimit,
+		BackoffRatio: a.BackoffRatio,
+
+		LowPriorityHeadroom: a.LowPriorityHeadroom,
+	}
+}
@@ -0,0 +1,258 @@
+package smarthttp
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitNotFound indicates that no client has registered a circuit with the supplied name
+var ErrCircuitNotFound = errors.New("circuit not found")
+
+// the number of one second buckets used to calculate the error percentage of a circuit (matches hystrix)
+const circuitStatsBuckets = 10
+
+// circuitRegistry holds the engine of every circuit that has been initialized in this process
+var circuitRegistry = struct {
+	sync.RWMutex
+	engines map[string]CircuitBreakerEngine
+}{
+	engines: map[string]CircuitBreakerEngine{},
+}
+
+// CircuitStats is a snapshot of the state and statistics of a circuit
+type CircuitStats struct {
+	// Name is the name of the circuit (i.e. the client name)
+	Name string `json:"name"`
+
+	// State is the current state of the circuit
+	State State `json:"state"`
+
+	// Forced is true when the state has been set by ForceOpen or ForceClose
+	Forced bool `json:"forced"`
+
+	// ErrorPercent is the percentage of failed calls in the last 10 seconds
+	ErrorPercent int `json:"errorPercent"`
+
+	// Requests and Errors are the number of calls (and failed calls) in the last 10 seconds
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+
+	// ConcurrentRequests is the number of calls currently in flight
+	ConcurrentRequests int `json:"concurrentRequests"`
+
+	// MaxConcurrentRequests is the configured maximum number of concurrent calls
+	MaxConcurrentRequests int `json:"maxConcurrentRequests"`
+
+	// ErrorPercentThreshold, RequestVolumeThreshold and SleepWindow are the configured thresholds of the circuit (see
+	// CircuitBreaker), e.g. to watch a circuit approach its thresholds before it opens
+	ErrorPercentThreshold  int           `json:"errorPercentThreshold"`
+	RequestVolumeThreshold int           `json:"requestVolumeThreshold"`
+	SleepWindow            time.Duration `json:"sleepWindow"`
+}
+
+// CircuitAdmin allows the circuits of all clients in this process to be inspected and manually overridden.
+// This is intended for operators during incidents (e.g. exposed via an internal admin endpoint).
+type CircuitAdmin struct{}
+
+// Circuits returns a snapshot of every registered circuit (sorted by name)
+func (a *CircuitAdmin) Circuits() []CircuitStats {
+	circuitRegistry.RLock()
+	defer circuitRegistry.RUnlock()
+
+	out := make([]CircuitStats, 0, len(circuitRegistry.engines))
+
+	for name, engine := range circuitRegistry.engines {
+		out = append(out, engine.Stats(name))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// Circuit returns a snapshot of the named circuit
+func (a *CircuitAdmin) Circuit(name string) (CircuitStats, error) {
+	engine, err := getRegisteredEngine(name)
+	if err != nil {
+		return CircuitStats{}, err
+	}
+
+	return engine.Stats(name), nil
+}
+
+// ForceOpen opens the named circuit (rejecting all calls) until ForceClose or Reset is called
+func (a *CircuitAdmin) ForceOpen(name string) error {
+	engine, err := getRegisteredEngine(name)
+	if err != nil {
+		return err
+	}
+
+	engine.ForceOpen(name)
+
+	return nil
+}
+
+// ForceClose closes the named circuit (allowing all calls, regardless of errors) until ForceOpen or Reset is called
+func (a *CircuitAdmin) ForceClose(name string) error {
+	engine, err := getRegisteredEngine(name)
+	if err != nil {
+		return err
+	}
+
+	engine.ForceClose(name)
+
+	return nil
+}
+
+// Reset removes any forced state and returns the named circuit to closed with no recorded errors
+func (a *CircuitAdmin) Reset(name string) error {
+	engine, err := getRegisteredEngine(name)
+	if err != nil {
+		return err
+	}
+
+	engine.Reset(name)
+
+	return nil
+}
+
+func registerCircuit(name string, engine CircuitBreakerEngine) {
+	circuitRegistry.Lock()
+	defer circuitRegistry.Unlock()
+
+	circuitRegistry.engines[name] = engine
+}
+
+func getRegisteredEngine(name string) (CircuitBreakerEngine, error) {
+	circuitRegistry.RLock()
+	defer circuitRegistry.RUnlock()
+
+	engine, ok := circuitRegistry.engines[name]
+	if !ok {
+		return nil, ErrCircuitNotFound
+	}
+
+	return engine, nil
+}
+
+// circuitOverride is the manually forced state of a circuit
+type circuitOverride int32
+
+const (
+	overrideNone circuitOverride = iota
+	overrideOpen
+	overrideClosed
+)
+
+// circuitCounters tracks the statistics of a circuit independently of the engine
+type circuitCounters struct {
+	override int32
+	inFlight int64
+
+	mutex   sync.Mutex
+	buckets [circuitStatsBuckets]circuitBucket
+}
+
+type circuitBucket struct {
+	second   int64
+	requests int
+	errors   int
+}
+
+func (c *circuitCounters) getOverride() circuitOverride {
+	return circuitOverride(atomic.LoadInt32(&c.override))
+}
+
+func (c *circuitCounters) setOverride(override circuitOverride) {
+	atomic.StoreInt32(&c.override, int32(override))
+}
+
+// call tracks the concurrency of fn
+func (c *circuitCounters) call(fn func() error) error {
+	atomic.AddInt64(&c.inFlight, 1)
+	defer atomic.AddInt64(&c.inFlight, -1)
+
+	return fn()
+}
+
+// record tracks the result of a call (calls the caller gave up on are not tracked)
+func (c *circuitCounters) record(err error) {
+	if isCallerGaveUp(err) {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bucket := &c.buckets[now%circuitStatsBuckets]
+	if bucket.second != now {
+		*bucket = circuitBucket{second: now}
+	}
+
+	bucket.requests++
+
+	if err != nil {
+		bucket.errors++
+	}
+}
+
+// counts returns the number of calls (and failed calls) in the last 10 seconds
+func (c *circuitCounters) counts() (requests, errs int) {
+	now := time.Now().Unix()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, bucket := range c.buckets {
+		if now-bucket.second < circuitStatsBuckets {
+			requests += bucket.requests
+			errs += bucket.errors
+		}
+	}
+
+	return requests, errs
+}
+
+// stats returns a snapshot of the circuit in the state with the settings
+func (c *circuitCounters) stats(name string, state State, settings CircuitBreakerSettings) CircuitStats {
+	requests, errs := c.counts()
+
+	errorPercent := 0
+	if requests > 0 {
+		errorPercent = errs * 100 / requests
+	}
+
+	return CircuitStats{
+		Name:                   name,
+		State:                  state,
+		Forced:                 c.getOverride() != overrideNone,
+		ErrorPercent:           errorPercent,
+		Requests:               requests,
+		Errors:                 errs,
+		ConcurrentRequests:     c.concurrent(),
+		MaxConcurrentRequests:  settings.MaxConcurrentRequests,
+		ErrorPercentThreshold:  settings.ErrorPercentThreshold,
+		RequestVolumeThreshold: settings.RequestVolumeThreshold,
+		SleepWindow:            settings.SleepWindow,
+	}
+}
+
+func (c *circuitCounters) concurrent() int {
+	return int(atomic.LoadInt64(&c.inFlight))
+}
+
+func (c *circuitCounters) reset() {
+	c.setOverride(overrideNone)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.buckets = [circuitStatsBuckets]circuitBucket{}
+}
@@ -0,0 +1,106 @@
+package smarthttp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchmarkTransport responds without a network; every failEvery-th attempt fails with a 503 (0: never)
+type benchmarkTransport struct {
+	failEvery int64
+	attempts  int64
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *benchmarkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		// the request body is read to the end (like the real transport) so that it can be replayed
+		_, _ = io.Copy(ioutil.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+
+	statusCode := http.StatusOK
+
+	attempt := atomic.AddInt64(&t.attempts, 1)
+	if t.failEvery > 0 && attempt%t.failEvery == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		Request:    req,
+	}, nil
+}
+
+func newBenchmarkClient(name string, transport http.RoundTripper, retries *Retries) *Client {
+	return &Client{
+		Name:    name,
+		Client:  &http.Client{Transport: transport},
+		Retries: retries,
+		CircuitBreaker: CircuitBreaker{
+			Engine: &GoBreakerEngine{},
+		},
+	}
+}
+
+func benchmarkRetries() *Retries {
+	return &Retries{
+		MaxAttempts: 3,
+		BaseDelay:   time.Nanosecond,
+		MaxDelay:    time.Nanosecond,
+	}
+}
+
+func benchmarkDo(b *testing.B, client *Client, method string, body []byte) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest(method, "http://localhost/benchmark", ioutil.NopCloser(bytes.NewReader(body)))
+		if body == nil {
+			req.Body = nil
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+}
+
+func BenchmarkDo(b *testing.B) {
+	b.Run("without-retries", func(b *testing.B) {
+		client := newBenchmarkClient("benchmark-do", &benchmarkTransport{}, nil)
+
+		benchmarkDo(b, client, http.MethodGet, nil)
+	})
+
+	b.Run("with-retries", func(b *testing.B) {
+		// every other attempt fails, so each request is retried once
+		client := newBenchmarkClient("benchmark-do-retries", &benchmarkTransport{failEvery: 2}, benchmarkRetries())
+
+		benchmarkDo(b, client, http.MethodGet, nil)
+	})
+
+	for _, size := range benchmarkBodySizes {
+		data := bytes.Repeat([]byte("x"), size)
+
+		b.Run("body-replay/"+strconv.Itoa(size), func(b *testing.B) {
+			// every other attempt fails, so each body is recorded and replayed once
+			client := newBenchmarkClient("benchmark-do-replay-"+strconv.Itoa(size), &benchmarkTransport{failEvery: 2},
+				benchmarkRetries())
+
+			benchmarkDo(b, client, http.MethodPut, data)
+		})
+	}
+}
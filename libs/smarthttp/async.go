@@ -0,0 +1,295 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAsyncQueueSize = 100
+	defaultAsyncWorkers   = 10
+)
+
+var (
+	// ErrAsyncQueueFull indicates that an asynchronous request was rejected (or dropped) because the queue is full
+	ErrAsyncQueueFull = errors.New("async queue is full")
+
+	// ErrAsyncNotConfigured indicates that DoAsync was called on a client without Async
+	ErrAsyncNotConfigured = errors.New("async is not configured")
+)
+
+// OverflowPolicy defines what happens to an asynchronous request when the queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowReject rejects the request: DoAsync returns ErrAsyncQueueFull
+	OverflowReject OverflowPolicy = iota
+
+	// OverflowBlock waits for room in the queue (or for the context of the request to be done)
+	OverflowBlock
+
+	// OverflowDropOldest drops the oldest queued request (its callback receives ErrAsyncQueueFull) to make room
+	OverflowDropOldest
+)
+
+// AsyncCallback receives the result of an asynchronous request (see Client.DoAsync).
+// The callback must close the body of the response.
+type AsyncCallback func(resp *http.Response, err error)
+
+// AsyncResult is the result of an asynchronous request (see Client.DoAsyncChan).
+// The receiver must close the body of the response.
+type AsyncResult struct {
+	// Response is the response (nil when Err is set)
+	Response *http.Response
+
+	// Err is the error returned by Do (or ErrAsyncQueueFull when the request was dropped)
+	Err error
+}
+
+// Async defines the configuration of the asynchronous requests (see Client.DoAsync).
+// The requests are queued and sent (using Do) by a pool of workers, so that the caller (e.g. a request handler that
+// publishes a webhook) is not blocked.  Closing the client stops the queue and waits for the queued requests.
+type Async struct {
+	// QueueSize is the maximum number of queued requests (default: 100)
+	QueueSize int
+
+	// Workers is the number of requests that are sent concurrently (default: 10)
+	Workers int
+
+	// Overflow defines what happens when the queue is full (default: OverflowReject)
+	Overflow OverflowPolicy
+
+	instrumentation Instrumentation
+	queue           chan *asyncRequest
+	workers         sync.WaitGroup
+
+	// enqueuing tracks the requests being queued; the queue is closed once they are done (so that they never send to a
+	// closed queue), while done stops those that wait for room in the queue
+	enqueuing sync.WaitGroup
+	done      chan struct{}
+
+	mutex  sync.RWMutex
+	closed bool
+}
+
+type asyncRequest struct {
+	req      *http.Request
+	callback AsyncCallback
+	queued   time.Time
+}
+
+// DoAsync queues the request and returns immediately; the result is passed to the (optional) callback, which is called
+// from a worker.  When callback is nil the body of the response is discarded.
+// An error is returned when the request cannot be queued (e.g. ErrAsyncQueueFull or ErrClientClosed).
+//
+// Note: the request is sent after DoAsync returns, so its context must outlive the caller (e.g. not the context of an
+// incoming request that is cancelled once the handler returns).
+func (c *Client) DoAsync(req *http.Request, callback AsyncCallback) error {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	if c.Async == nil {
+		return ErrAsyncNotConfigured
+	}
+
+	if callback == nil {
+		callback = func(resp *http.Response, _ error) {
+			discardResponse(resp)
+		}
+	}
+
+	return c.Async.enqueue(&asyncRequest{req: req, callback: callback, queued: time.Now()})
+}
+
+// DoAsyncChan queues the request (see DoAsync) and returns a channel that receives its result
+func (c *Client) DoAsyncChan(req *http.Request) (<-chan AsyncResult, error) {
+	results := make(chan AsyncResult, 1)
+
+	err := c.DoAsync(req, func(resp *http.Response, err error) {
+		results <- AsyncResult{Response: resp, Err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// enqueue queues the request according to the overflow policy
+func (a *Async) enqueue(item *asyncRequest) error {
+	a.mutex.RLock()
+
+	if a.closed {
+		a.mutex.RUnlock()
+
+		return ErrClientClosed
+	}
+
+	a.enqueuing.Add(1)
+	a.mutex.RUnlock()
+
+	defer a.enqueuing.Done()
+
+	for {
+		select {
+		case a.queue <- item:
+			return nil
+
+		default:
+			// the queue is full
+		}
+
+		switch a.Overflow {
+		case OverflowBlock:
+			select {
+			case a.queue <- item:
+				return nil
+
+			case <-item.req.Context().Done():
+				return item.req.Context().Err()
+
+			case <-a.done:
+				return ErrClientClosed
+			}
+
+		case OverflowDropOldest:
+			select {
+			case oldest := <-a.queue:
+				a.instrumentation.AsyncRejected(oldest.req)
+				oldest.callback(nil, ErrAsyncQueueFull)
+
+			default:
+				// a worker took the oldest request
+			}
+
+		default:
+			a.instrumentation.AsyncRejected(item.req)
+
+			return ErrAsyncQueueFull
+		}
+	}
+}
+
+// work sends the queued requests until the queue is closed
+func (a *Async) work(doFunc requestClosure) {
+	defer a.workers.Done()
+
+	for item := range a.queue {
+		a.instrumentation.AsyncQueued(item.req, time.Since(item.queued))
+
+		item.callback(doFunc(item.req))
+	}
+}
+
+// close stops the queue and waits for the queued requests to be sent (or the context to be done)
+func (a *Async) close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+
+	a.mutex.Lock()
+
+	if !a.closed {
+		a.closed = true
+		close(a.done)
+
+		go func() {
+			a.enqueuing.Wait()
+			close(a.queue)
+		}()
+	}
+
+	a.mutex.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queueDepth returns the number of queued requests (see Client.Stats)
+func (a *Async) queueDepth() int {
+	if a == nil {
+		return 0
+	}
+
+	return len(a.queue)
+}
+
+func (a *Async) validate() error {
+	switch {
+	case a.QueueSize < 0 || a.Workers < 0:
+		return errors.New("async queue size and workers cannot be negative")
+
+	case a.Overflow < OverflowReject || a.Overflow > OverflowDropOldest:
+		return errors.New("invalid async overflow policy")
+	}
+
+	return nil
+}
+
+func (a *Async) getQueueSize() int {
+	if a.QueueSize > 0 {
+		return a.QueueSize
+	}
+
+	a.instrumentation.InitWarning("using default 'queue size' setting for async")
+
+	return defaultAsyncQueueSize
+}
+
+func (a *Async) getWorkers() int {
+	if a.Workers > 0 {
+		return a.Workers
+	}
+
+	a.instrumentation.InitWarning("using default 'workers' setting for async")
+
+	return defaultAsyncWorkers
+}
+
+// doInitOnce starts the workers, which send the requests with doFunc (i.e. Client.Do)
+func (a *Async) doInitOnce(instrumentation Instrumentation, doFunc requestClosure) {
+	if a == nil {
+		return
+	}
+
+	a.instrumentation = instrumentation
+
+	a.queue = make(chan *asyncRequest, a.getQueueSize())
+	a.done = make(chan struct{})
+
+	workers := a.getWorkers()
+
+	a.workers.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go a.work(doFunc)
+	}
+}
+
+// clone returns a copy of the configuration (with its own queue and workers) for a variant of the client (see
+// Client.Clone)
+func (a *Async) clone() *Async {
+	if a == nil {
+		return nil
+	}
+
+	return &Async{
+		QueueSize: a.QueueSize,
+		Workers:   a.Workers,
+		Overflow:  a.Overflow,
+	}
+}
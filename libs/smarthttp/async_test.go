@@ -0,0 +1,88 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAsync_CloseWhileBlocked(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	client := &Client{
+		Name: "async-close",
+		Client: &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+			started <- struct{}{}
+			<-release
+
+			return nil, errors.New("released")
+		})},
+		Async:          &Async{QueueSize: 1, Workers: 1, Overflow: OverflowBlock},
+		CircuitBreaker: CircuitBreaker{Engine: &GoBreakerEngine{}},
+	}
+
+	results := make(chan error, 2)
+
+	doAsync := func() error {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return client.DoAsync(req, func(_ *http.Response, err error) {
+			results <- err
+		})
+	}
+
+	// the worker is busy with the first request and the second fills the queue
+	if err := doAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+
+	if err := doAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := make(chan error, 1)
+
+	go func() {
+		blocked <- doAsync()
+	}()
+
+	// let the third request wait for room in the queue
+	time.Sleep(10 * time.Millisecond)
+
+	// close honours its context while the worker is busy and a request waits for room in the queue
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := client.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the close to time out, got: %v", err)
+	}
+
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, ErrClientClosed) {
+			t.Errorf("expected the blocked request to fail with ErrClientClosed, got: %v", err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("expected the blocked request to be stopped by the close")
+	}
+
+	// the queued requests are still sent
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-results:
+		case <-time.After(time.Second):
+			t.Fatal("expected the queued requests to be sent")
+		}
+	}
+}
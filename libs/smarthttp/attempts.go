@@ -0,0 +1,60 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AttemptsError is returned when a request made with retries enabled has failed.
+// It reports how many attempts were made before giving up.
+type AttemptsError struct {
+	// Attempts is the number of attempts made (including the first)
+	Attempts int
+
+	// StatusCode is the HTTP status code of the last attempt that received a response (0 when none did)
+	StatusCode int
+
+	// Err is the error returned by the last attempt
+	Err error
+}
+
+// Error implements error
+func (e *AttemptsError) Error() string {
+	return fmt.Sprintf("%s (attempts: %d)", e.Err, e.Attempts)
+}
+
+// Unwrap returns the underlying error
+func (e *AttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// AttemptsFromContext returns the (one based) number of the attempt that the context belongs to.
+// The context of the request attached to a response (i.e. http.Response.Request) therefore reports the total number of
+// attempts taken.  Returns 0 when the request was not made with retries enabled.
+func AttemptsFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(ctxKeyAttempt).(int)
+
+	return attempt
+}
+
+// AttemptsOf returns the number of attempts taken to produce the response or error.
+// Returns 0 when the request was not made with retries enabled.
+func AttemptsOf(resp *http.Response, err error) int {
+	var attemptsErr *AttemptsError
+	if errors.As(err, &attemptsErr) {
+		return attemptsErr.Attempts
+	}
+
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+
+	return AttemptsFromContext(resp.Request.Context())
+}
+
+// withAttempt returns a copy of the request that records the attempt number in its context
+func withAttempt(req *http.Request, attempt int) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), ctxKeyAttempt, attempt))
+}
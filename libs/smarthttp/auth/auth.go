@@ -0,0 +1,108 @@
+// Package auth provides authentication middleware for smarthttp clients.
+//
+// Middleware adds the bearer token supplied by a TokenSource to every request (including retries):
+//
+//	client.Use(auth.Middleware(&auth.ClientCredentials{
+//		TokenURL:     "https://auth.example.com/oauth2/token",
+//		ClientID:     "my-service",
+//		ClientSecret: secret,
+//	}))
+//
+// JWT mints short-lived tokens of the internal auth standard (see libs/auth), signed with a private key or a KMS
+// callback:
+//
+//	client.Use(auth.Middleware(&auth.JWT{
+//		KeyID:    "my-service-1",
+//		Issuer:   "my-service",
+//		Subject:  "my-service",
+//		Audience: "orders",
+//		KeyFile:  "/etc/keys/jwt.pem",
+//	}))
+//
+// HMACSigner signs each attempt with a shared secret (see smarthttp.Client.Signer):
+//
+//	client.Signer = &auth.HMACSigner{KeyID: "my-service", Secret: secret}
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+// Token is an access token
+type Token struct {
+	// AccessToken is the token that authorizes the requests
+	AccessToken string
+
+	// TokenType is the type of the token (default: Bearer)
+	TokenType string
+
+	// Expiry is the time the token expires (zero when the token does not expire)
+	Expiry time.Time
+}
+
+// Type returns the type of the token (as used in the Authorization header)
+func (t *Token) Type() string {
+	if t.TokenType == "" {
+		return "Bearer"
+	}
+
+	return t.TokenType
+}
+
+// Valid returns true when the token has not expired (and will not expire within the delta)
+func (t *Token) Valid(delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry)
+}
+
+// TokenSource supplies tokens.
+// Implementations must be safe for concurrent use and should cache the token until it (nearly) expires.
+type TokenSource interface {
+	// Token returns a valid token
+	Token(ctx context.Context) (*Token, error)
+}
+
+// Invalidator is (optionally) implemented by a TokenSource whose cached token can be invalidated (e.g. when the upstream
+// rejects it before it expires)
+type Invalidator interface {
+	// Invalidate discards the cached token so that the next call to Token fetches a new one
+	Invalidate()
+}
+
+// Middleware returns smarthttp middleware that sets the Authorization header of each request to the token supplied by
+// the source.  Requests that already carry an Authorization header are not changed.
+// When the upstream responds with 401 Unauthorized, the cached token is invalidated (when the source supports it).
+func Middleware(source TokenSource) smarthttp.Middleware {
+	return func(next smarthttp.RoundTripFunc) smarthttp.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" {
+				return next(req)
+			}
+
+			token, err := source.Token(req.Context())
+			if err != nil {
+				return nil, err
+			}
+
+			// copy the request so that the caller's headers are not modified
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+
+			resp, err := next(req)
+			if err == nil && resp.StatusCode == http.StatusUnauthorized {
+				if invalidator, ok := source.(Invalidator); ok {
+					invalidator.Invalidate()
+				}
+			}
+
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// tokenCache caches a token until it (nearly) expires; concurrent refreshes are coalesced into a single fetch
+type tokenCache struct {
+	group singleflight.Group
+
+	mutex sync.RWMutex
+	token *Token
+}
+
+// get returns the cached token when it is valid (for at least delta), otherwise fetches a new one
+func (c *tokenCache) get(ctx context.Context, delta time.Duration, fetch func(ctx context.Context) (*Token, error)) (*Token, error) {
+	c.mutex.RLock()
+	token := c.token
+	c.mutex.RUnlock()
+
+	if token.Valid(delta) {
+		return token, nil
+	}
+
+	result, err, _ := c.group.Do("token", func() (interface{}, error) {
+		// the refresh should not be cancelled because the first caller gave up
+		token, err := fetch(detach(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		c.mutex.Lock()
+		c.token = token
+		c.mutex.Unlock()
+
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Token), nil
+}
+
+// invalidate discards the cached token
+func (c *tokenCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.token = nil
+}
+
+// detachedContext keeps the values (but not the deadline or cancellation) of the parent context
+type detachedContext struct {
+	context.Context
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return &detachedContext{Context: context.Background(), parent: ctx}
+}
+
+// Value implements context.Context
+func (d *detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
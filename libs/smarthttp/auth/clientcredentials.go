@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+const (
+	// tokens are refreshed this long before they expire
+	defaultExpiryDelta = 10 * time.Second
+
+	// the timeout of the default token client
+	defaultTokenTimeout = 10 * time.Second
+)
+
+// ErrTokenRequest indicates that the token could not be fetched from the token endpoint
+var ErrTokenRequest = errors.New("unable to fetch token")
+
+// ClientCredentials is a TokenSource that fetches tokens using the OAuth2 client credentials grant (RFC 6749 section 4.4).
+// Tokens are cached until shortly before they expire; concurrent refreshes are coalesced into a single token request.
+type ClientCredentials struct {
+	// TokenURL is the URL of the token endpoint
+	TokenURL string
+
+	// ClientID and ClientSecret are the credentials of the client
+	ClientID     string
+	ClientSecret string
+
+	// Scopes (optionally) are the scopes requested
+	Scopes []string
+
+	// EndpointParams (optionally) are additional parameters sent to the token endpoint (e.g. "audience")
+	EndpointParams url.Values
+
+	// CredentialsInBody sends the credentials as form parameters rather than using HTTP Basic authentication (the default)
+	CredentialsInBody bool
+
+	// ExpiryDelta is how long before expiry a token is refreshed (default: 10 seconds)
+	ExpiryDelta time.Duration
+
+	// Client (optionally) is the client used to call the token endpoint (default: a client with a 10 second timeout)
+	Client *smarthttp.Client
+
+	initOnce sync.Once
+	cache    tokenCache
+}
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Token implements TokenSource
+func (c *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	c.initOnce.Do(c.doInitOnce)
+
+	return c.cache.get(ctx, c.ExpiryDelta, c.fetch)
+}
+
+// Invalidate implements Invalidator
+func (c *ClientCredentials) Invalidate() {
+	c.cache.invalidate()
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (*Token, error) {
+	params := url.Values{}
+	for key, values := range c.EndpointParams {
+		params[key] = values
+	}
+
+	params.Set("grant_type", "client_credentials")
+
+	if len(c.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	if c.CredentialsInBody {
+		params.Set("client_id", c.ClientID)
+		params.Set("client_secret", c.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrTokenRequest, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if !c.CredentialsInBody {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	start := time.Now()
+
+	resp := &tokenResponse{}
+
+	err = c.Client.DoJSON(req, resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrTokenRequest, err)
+	}
+
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("%w - response did not contain an access token", ErrTokenRequest)
+	}
+
+	token := &Token{AccessToken: resp.AccessToken, TokenType: resp.TokenType}
+
+	if resp.ExpiresIn > 0 {
+		// measured from the start of the request so that the token does not outlive the upstream's view of it
+		token.Expiry = start.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func (c *ClientCredentials) doInitOnce() {
+	if c.ExpiryDelta == 0 {
+		c.ExpiryDelta = defaultExpiryDelta
+	}
+
+	if c.Client == nil {
+		c.Client = &smarthttp.Client{
+			Name:    "oauth2-client-credentials",
+			Timeout: defaultTokenTimeout,
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHMACTimestampHeader = "X-Timestamp"
+	defaultHMACNonceHeader     = "X-Nonce"
+	defaultHMACBodyHashHeader  = "X-Content-SHA256"
+	defaultHMACAlgorithm       = "HMAC-SHA256"
+)
+
+// HMACSigner is a smarthttp.Signer (see Client.Signer) that signs requests with HMAC-SHA256.
+//
+// The timestamp (unix seconds), a random nonce and the (hex encoded) SHA-256 of the body are added as headers and the
+// signature is sent in the Authorization header:
+//
+//	Authorization: HMAC-SHA256 KeyId=<key id>,SignedHeaders=<headers>,Signature=<base64 signature>
+//
+// The signature covers the following lines (joined by "\n"): the method, the path and query, the timestamp, the nonce,
+// the body hash and then "<lowercase header name>:<value>" for each of the SignedHeaders.
+type HMACSigner struct {
+	// KeyID identifies the key to the upstream
+	KeyID string
+
+	// Secret is the shared secret
+	Secret []byte
+
+	// SignedHeaders (optionally) are additional headers covered by the signature (e.g. Host or Content-Type)
+	SignedHeaders []string
+
+	// TimestampHeader, NonceHeader and BodyHashHeader (optionally) override the names of the headers
+	// (default: X-Timestamp, X-Nonce and X-Content-SHA256)
+	TimestampHeader string
+	NonceHeader     string
+	BodyHashHeader  string
+
+	// Now (optionally) returns the current time (used for testing)
+	Now func() time.Time
+
+	// used for testing only
+	nonce func() string
+}
+
+// Sign implements smarthttp.Signer
+func (s *HMACSigner) Sign(req *http.Request) error {
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	nonce := s.getNonce()
+
+	req.Header.Set(headerOrDefault(s.TimestampHeader, defaultHMACTimestampHeader), timestamp)
+	req.Header.Set(headerOrDefault(s.NonceHeader, defaultHMACNonceHeader), nonce)
+	req.Header.Set(headerOrDefault(s.BodyHashHeader, defaultHMACBodyHashHeader), bodyHash)
+
+	lines := []string{req.Method, req.URL.RequestURI(), timestamp, nonce, bodyHash}
+
+	signedHeaders := make([]string, 0, len(s.SignedHeaders))
+
+	for _, header := range s.SignedHeaders {
+		name := strings.ToLower(header)
+		signedHeaders = append(signedHeaders, name)
+
+		value := req.Header.Get(header)
+		if name == "host" {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		}
+
+		lines = append(lines, name+":"+strings.TrimSpace(value))
+	}
+
+	mac := hmac.New(sha256.New, s.Secret)
+	_, _ = mac.Write([]byte(strings.Join(lines, "\n")))
+
+	req.Header.Set("Authorization", defaultHMACAlgorithm+
+		" KeyId="+s.KeyID+
+		",SignedHeaders="+strings.Join(signedHeaders, ";")+
+		",Signature="+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+func (s *HMACSigner) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+
+	return time.Now()
+}
+
+func (s *HMACSigner) getNonce() string {
+	if s.nonce != nil {
+		return s.nonce()
+	}
+
+	return newNonce()
+}
+
+func headerOrDefault(header, defaultHeader string) string {
+	if header != "" {
+		return header
+	}
+
+	return defaultHeader
+}
+
+// hashBody returns the (hex encoded) SHA-256 of the request body, leaving the body intact
+func hashBody(req *http.Request) (string, error) {
+	hash := sha256.New()
+
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		// empty body
+
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.Copy(hash, body)
+		_ = body.Close()
+
+		if err != nil {
+			return "", err
+		}
+
+	default:
+		body, err := ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return "", err
+		}
+
+		_, _ = hash.Write(body)
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newNonce returns a random nonce
+func newNonce() string {
+	var b [16]byte
+
+	_, _ = rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
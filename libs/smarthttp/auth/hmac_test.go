@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACSigner_Sign(t *testing.T) {
+	newSigner := func(signedHeaders ...string) *HMACSigner {
+		return &HMACSigner{
+			KeyID:         "partner-1",
+			Secret:        []byte("partner-secret"),
+			SignedHeaders: signedHeaders,
+			Now: func() time.Time {
+				return time.Unix(1700000000, 0)
+			},
+			nonce: func() string {
+				return "0123456789abcdef0123456789abcdef"
+			},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		signer            *HMACSigner
+		method            string
+		url               string
+		body              string
+		contentType       string
+		wantBodyHash      string
+		wantAuthorization string
+	}{
+		{
+			name:         "without body",
+			signer:       newSigner(),
+			method:       http.MethodGet,
+			url:          "https://api.partner.example/v1/orders/42",
+			wantBodyHash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			wantAuthorization: "HMAC-SHA256 KeyId=partner-1,SignedHeaders=," +
+				"Signature=qgFnuetvsVfhN4ltOaDSJamQxWo2oZhyKrUbIIZEzEM=",
+		},
+		{
+			name:         "with body, query and signed headers",
+			signer:       newSigner("Content-Type", "Host"),
+			method:       http.MethodPost,
+			url:          "https://api.partner.example/v1/orders?expand=items",
+			body:         `{"amount":100}`,
+			contentType:  "application/json",
+			wantBodyHash: "4d4bbe59c6aad22442cde199a6a8a5f034405fcd78fb5a81c24ef249de1c45f1",
+			wantAuthorization: "HMAC-SHA256 KeyId=partner-1,SignedHeaders=content-type;host," +
+				"Signature=XtcBZ5/7VeaTU8/U6770QqlmGA8dRr597upmXSHs3C0=",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.body != "" {
+				// a body without GetBody is buffered by the signer
+				req.Body = ioutil.NopCloser(strings.NewReader(test.body))
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			err = test.signer.Sign(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedHeaders := map[string]string{
+				"X-Timestamp":      "1700000000",
+				"X-Nonce":          "0123456789abcdef0123456789abcdef",
+				"X-Content-SHA256": test.wantBodyHash,
+				"Authorization":    test.wantAuthorization,
+			}
+
+			for header, want := range expectedHeaders {
+				if got := req.Header.Get(header); got != want {
+					t.Errorf("expected %s %q, got %q", header, want, got)
+				}
+			}
+
+			if test.body != "" {
+				body, _ := ioutil.ReadAll(req.Body)
+				if string(body) != test.body {
+					t.Errorf("expected the body to be intact, got %q", body)
+				}
+			}
+		})
+	}
+}
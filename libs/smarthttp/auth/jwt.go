@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// the default lifetime of the minted tokens
+	defaultJWTTTL = 5 * time.Minute
+
+	// JWT signing algorithms (the asymmetric algorithms accepted by the verifiers of libs/auth)
+	AlgorithmRS256 = "RS256"
+	AlgorithmPS256 = "PS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmES384 = "ES384"
+	AlgorithmES512 = "ES512"
+
+	// the kind of the subject of the minted tokens (KindService of libs/auth)
+	jwtKindService = "service"
+)
+
+// ErrJWT indicates that a JWT could not be minted (e.g. the key could not be loaded)
+var ErrJWT = errors.New("unable to mint JWT")
+
+// the ES algorithm of the ECDSA keys (by the bit size of their curve)
+var curveAlgorithms = map[int]string{
+	256: AlgorithmES256,
+	384: AlgorithmES384,
+	521: AlgorithmES512,
+}
+
+// JWT is a TokenSource that mints short-lived JWTs for service-to-service authentication.
+// The tokens follow the internal auth standard (the claims of libs/auth), so they are accepted by its Verifier.
+// Tokens are cached and a new token is minted when less than a fifth of the TTL (or ExpiryDelta) remains.
+//
+// The key is (in order of precedence) the Sign callback (e.g. to sign with a KMS), Key or KeyFile.
+type JWT struct {
+	// Algorithm is the signing algorithm: RS256, PS256, ES256, ES384 or ES512 (default: the ES algorithm of the curve of
+	// an ECDSA key, otherwise RS256).  The key must match the algorithm, including the curve of an ECDSA key.
+	Algorithm string
+
+	// KeyID is sent as the "kid" header (required, the verifiers pick the public key by its ID)
+	KeyID string
+
+	// Issuer, Subject and Audience (optionally) are the "iss", "sub" and "aud" claims
+	Issuer   string
+	Subject  string
+	Audience string
+
+	// Scopes (optionally) are the scopes requested by the service (the "scope" claim)
+	Scopes []string
+
+	// TTL is the lifetime of a token (default: 5 minutes)
+	TTL time.Duration
+
+	// ExpiryDelta is how long before expiry a new token is minted (default: a fifth of the TTL)
+	ExpiryDelta time.Duration
+
+	// Sign (optionally) signs the JWT signing input (e.g. using a KMS) and returns the signature.
+	// For the ES algorithms the signature must be in the JWS format (i.e. r and s concatenated, not ASN.1).
+	Sign func(ctx context.Context, signingInput []byte) ([]byte, error)
+
+	// Key (optionally) is the private key (*rsa.PrivateKey for RS256 and PS256 or *ecdsa.PrivateKey for the ES algorithms)
+	Key crypto.PrivateKey
+
+	// KeyFile (optionally) is the path of the PEM encoded private key
+	KeyFile string
+
+	initOnce sync.Once
+	initErr  error
+	method   jwt.SigningMethod
+	cache    tokenCache
+}
+
+// jwtClaims are the claims of the internal auth standard (the Claims of libs/auth)
+type jwtClaims struct {
+	jwt.RegisteredClaims
+
+	Kind  string `json:"kind,omitempty"`
+	Scope string `json:"scope,omitempty"`
+}
+
+// Token implements TokenSource
+func (j *JWT) Token(ctx context.Context) (*Token, error) {
+	j.initOnce.Do(j.doInitOnce)
+
+	if j.initErr != nil {
+		return nil, j.initErr
+	}
+
+	return j.cache.get(ctx, j.ExpiryDelta, j.mint)
+}
+
+// Invalidate implements Invalidator
+func (j *JWT) Invalidate() {
+	j.cache.invalidate()
+}
+
+func (j *JWT) mint(ctx context.Context) (*Token, error) {
+	now := time.Now()
+	expiry := now.Add(j.TTL)
+
+	claims := &jwtClaims{Kind: jwtKindService, Scope: strings.Join(j.Scopes, " ")}
+	claims.Issuer = j.Issuer
+	claims.Subject = j.Subject
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(expiry)
+	claims.ID = newNonce()
+
+	if j.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{j.Audience}
+	}
+
+	method, key := j.method, interface{}(j.Key)
+
+	if j.Sign != nil {
+		method = &callbackMethod{SigningMethod: j.method}
+		key = signFunc(func(signingInput []byte) ([]byte, error) {
+			return j.Sign(ctx, signingInput)
+		})
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = j.KeyID
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrJWT, err)
+	}
+
+	return &Token{
+		AccessToken: signed,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
+
+func (j *JWT) doInitOnce() {
+	if j.TTL == 0 {
+		j.TTL = defaultJWTTTL
+	}
+
+	if j.ExpiryDelta == 0 {
+		j.ExpiryDelta = j.TTL / 5
+	}
+
+	if j.KeyID == "" {
+		j.initErr = fmt.Errorf("%w - key ID is required", ErrJWT)
+
+		return
+	}
+
+	if j.Sign == nil && j.Key == nil {
+		if j.KeyFile == "" {
+			j.initErr = fmt.Errorf("%w - no key was supplied", ErrJWT)
+
+			return
+		}
+
+		j.initErr = j.loadKeyFile()
+		if j.initErr != nil {
+			return
+		}
+	}
+
+	j.method, j.initErr = j.getMethod()
+}
+
+// getMethod returns the signing method of the algorithm, after checking that the key matches it
+func (j *JWT) getMethod() (jwt.SigningMethod, error) {
+	algorithm := j.Algorithm
+	if algorithm == "" {
+		algorithm = AlgorithmRS256
+
+		if key, ok := j.Key.(*ecdsa.PrivateKey); ok && j.Sign == nil {
+			algorithm, ok = curveAlgorithms[key.Curve.Params().BitSize]
+			if !ok {
+				return nil, fmt.Errorf("%w - unsupported curve '%s'", ErrJWT, key.Curve.Params().Name)
+			}
+		}
+	}
+
+	switch method := jwt.GetSigningMethod(algorithm).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := j.Key.(*rsa.PrivateKey); ok || j.Sign != nil {
+			return method, nil
+		}
+
+	case *jwt.SigningMethodECDSA:
+		if j.Sign != nil {
+			return method, nil
+		}
+
+		if key, ok := j.Key.(*ecdsa.PrivateKey); ok && key.Curve.Params().BitSize == method.CurveBits {
+			return method, nil
+		}
+
+	default:
+		// shared secrets (HS256) and unsigned tokens are not accepted by the verifiers
+		return nil, fmt.Errorf("%w - unsupported algorithm '%s'", ErrJWT, algorithm)
+	}
+
+	return nil, fmt.Errorf("%w - key does not match algorithm '%s'", ErrJWT, algorithm)
+}
+
+func (j *JWT) loadKeyFile() error {
+	data, err := ioutil.ReadFile(j.KeyFile)
+	if err != nil {
+		return fmt.Errorf("%w - unable to read key file: %s", ErrJWT, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%w - key file '%s' is not PEM encoded", ErrJWT, j.KeyFile)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		j.Key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	case "EC PRIVATE KEY":
+		j.Key, err = x509.ParseECPrivateKey(block.Bytes)
+
+	default:
+		j.Key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w - unable to parse key file: %s", ErrJWT, err)
+	}
+
+	return nil
+}
+
+// signFunc signs the signing input with the Sign callback (the key of callbackMethod)
+type signFunc func(signingInput []byte) ([]byte, error)
+
+// callbackMethod is a jwt.SigningMethod that signs with a signFunc (see JWT.Sign)
+type callbackMethod struct {
+	jwt.SigningMethod
+}
+
+// Sign implements jwt.SigningMethod
+func (m *callbackMethod) Sign(signingString string, key interface{}) (string, error) {
+	sign, ok := key.(signFunc)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	signature, err := sign([]byte(signingString))
+	if err != nil {
+		return "", err
+	}
+
+	// JWS uses the fixed size concatenation of r and s (RFC 7518 section 3.4)
+	if method, ok := m.SigningMethod.(*jwt.SigningMethodECDSA); ok && len(signature) != 2*method.KeySize {
+		return "", fmt.Errorf("%s signature must be %d bytes (r and s concatenated), got %d", m.Alg(), 2*method.KeySize,
+			len(signature))
+	}
+
+	return jwt.EncodeSegment(signature), nil
+}
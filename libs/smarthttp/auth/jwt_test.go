@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJWT_Token(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p256Key := newJWTECKey(t, elliptic.P256())
+	p384Key := newJWTECKey(t, elliptic.P384())
+
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	keyFile := filepath.Join(dir, "jwt.pem")
+
+	der, err := x509.MarshalECPrivateKey(p256Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		jwt           *JWT
+		wantAlgorithm string
+		// wantKey is the public key that verifies the token (nil when minting fails)
+		wantKey crypto.PublicKey
+	}{
+		{
+			name:          "RSA key",
+			jwt:           &JWT{Key: rsaKey},
+			wantAlgorithm: AlgorithmRS256,
+			wantKey:       &rsaKey.PublicKey,
+		},
+		{
+			name:          "RSA key with PS256",
+			jwt:           &JWT{Algorithm: AlgorithmPS256, Key: rsaKey},
+			wantAlgorithm: AlgorithmPS256,
+			wantKey:       &rsaKey.PublicKey,
+		},
+		{
+			name:          "algorithm of the curve of the key",
+			jwt:           &JWT{Key: p384Key},
+			wantAlgorithm: AlgorithmES384,
+			wantKey:       &p384Key.PublicKey,
+		},
+		{
+			name:          "key file",
+			jwt:           &JWT{Algorithm: AlgorithmES256, KeyFile: keyFile},
+			wantAlgorithm: AlgorithmES256,
+			wantKey:       &p256Key.PublicKey,
+		},
+		{
+			name: "KMS callback",
+			// signs like a KMS would (the JWS signature of an ES256 key)
+			jwt: &JWT{Algorithm: AlgorithmES256, Sign: func(_ context.Context, signingInput []byte) ([]byte, error) {
+				signature, err := jwt.SigningMethodES256.Sign(string(signingInput), p256Key)
+				if err != nil {
+					return nil, err
+				}
+
+				return jwt.DecodeSegment(signature)
+			}},
+			wantAlgorithm: AlgorithmES256,
+			wantKey:       &p256Key.PublicKey,
+		},
+		{
+			name: "ASN.1 signature of the KMS callback",
+			jwt: &JWT{Algorithm: AlgorithmES256, Sign: func(_ context.Context, signingInput []byte) ([]byte, error) {
+				hash := sha256.Sum256(signingInput)
+
+				r, s, err := ecdsa.Sign(rand.Reader, p256Key, hash[:])
+				if err != nil {
+					return nil, err
+				}
+
+				return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+			}},
+		},
+		{
+			name: "curve does not match the algorithm",
+			jwt:  &JWT{Algorithm: AlgorithmES256, Key: p384Key},
+		},
+		{
+			name: "key type does not match the algorithm",
+			jwt:  &JWT{Algorithm: AlgorithmES256, Key: rsaKey},
+		},
+		{
+			name: "shared secret algorithm",
+			jwt:  &JWT{Algorithm: "HS256", Key: rsaKey},
+		},
+		{
+			name: "no key",
+			jwt:  &JWT{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			test.jwt.KeyID = "key-1"
+			test.jwt.Issuer = "shop-service"
+			test.jwt.Subject = "shop-service"
+			test.jwt.Audience = "orders-service"
+			test.jwt.Scopes = []string{"orders:read", "orders:write"}
+
+			token, err := test.jwt.Token(context.Background())
+
+			if test.wantKey == nil {
+				if !errors.Is(err, ErrJWT) {
+					t.Fatalf("expected an error wrapping ErrJWT, got: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := &jwtClaims{}
+
+			parsed, err := jwt.ParseWithClaims(token.AccessToken, claims, func(_ *jwt.Token) (interface{}, error) {
+				return test.wantKey, nil
+			})
+			if err != nil {
+				t.Fatalf("expected a valid token, got: %v", err)
+			}
+
+			if parsed.Method.Alg() != test.wantAlgorithm || parsed.Header["kid"] != "key-1" {
+				t.Errorf("unexpected header: %v", parsed.Header)
+			}
+
+			if claims.Kind != jwtKindService || claims.Scope != "orders:read orders:write" ||
+				claims.Issuer != "shop-service" || claims.Subject != "shop-service" ||
+				!claims.VerifyAudience("orders-service", true) || claims.ID == "" {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+
+			if claims.ExpiresAt == nil || !claims.ExpiresAt.Time.Equal(token.Expiry.Truncate(1e9)) {
+				t.Errorf("expected the expiry %s, got %v", token.Expiry, claims.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestJWT_TokenWithoutKeyID(t *testing.T) {
+	source := &JWT{Key: newJWTECKey(t, elliptic.P256())}
+
+	_, err := source.Token(context.Background())
+	if !errors.Is(err, ErrJWT) {
+		t.Fatalf("expected an error wrapping ErrJWT, got: %v", err)
+	}
+}
+
+func newJWTECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
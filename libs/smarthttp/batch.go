@@ -0,0 +1,206 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const defaultBatchConcurrency = 10
+
+// ErrBatchCancelled indicates that a request of a batch was not sent (or was cancelled) because another request of the
+// batch failed (see BatchOptions.FailFast)
+var ErrBatchCancelled = errors.New("batch cancelled")
+
+// BatchOptions defines how DoBatch sends the requests
+type BatchOptions struct {
+	// Concurrency is the maximum number of requests that are sent concurrently (default: 10)
+	Concurrency int
+
+	// FailFast stops the batch at the first failed request: the requests that have not been sent are not sent and the
+	// in-flight requests are cancelled.  Otherwise all the requests are sent and all the errors are collected.
+	FailFast bool
+}
+
+// BatchResult is the result of a request of a batch
+type BatchResult struct {
+	// Response is the response (nil when Err is set)
+	Response *http.Response
+
+	// Err is the error returned by Do (or ErrBatchCancelled)
+	Err error
+}
+
+// BatchError is returned by DoBatch when requests of the batch fail (without FailFast)
+type BatchError struct {
+	// Errors are the errors of the failed requests (by index)
+	Errors map[int]error
+
+	first int
+}
+
+// Error implements error
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d batch request(s) failed, the first (#%d): %s", len(e.Errors), e.first, e.Errors[e.first])
+}
+
+// Unwrap returns the error of the first failed request (so that e.g. errors.Is(err, ErrCircuitIsOpen) can be used)
+func (e *BatchError) Unwrap() error {
+	return e.Errors[e.first]
+}
+
+// DoBatch performs the requests (using Do, so each request goes through the circuit, the rate limiter, the retries etc.)
+// sending at most opts.Concurrency requests concurrently.  The results are returned in the order of the requests.
+//
+// The requests are sent with ctx (rather than their own context), so cancelling ctx cancels the batch.  An error is
+// returned when any request fails: with FailFast, it is the error of the first failed request; otherwise it is a
+// *BatchError.  Non-2xx responses are not errors.
+//
+// Note: the caller must close the body of every response, including when an error is returned.
+func (c *Client) DoBatch(ctx context.Context, reqs []*http.Request, opts *BatchOptions) ([]BatchResult, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	batch := &batch{
+		results:  make([]BatchResult, len(reqs)),
+		cancels:  make(map[int]context.CancelFunc, concurrency),
+		failFast: opts.FailFast,
+	}
+
+	semaphore := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for index, req := range reqs {
+		select {
+		case semaphore <- struct{}{}:
+
+		case <-ctx.Done():
+			batch.finish(index, nil, ctx.Err())
+
+			continue
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+
+		if !batch.start(index, cancel) {
+			cancel()
+			<-semaphore
+
+			batch.finish(index, nil, ErrBatchCancelled)
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(index int, req *http.Request) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			resp, err := c.Do(req.WithContext(reqCtx))
+			if err != nil {
+				cancel()
+			} else {
+				// the context is cancelled once the body has been read
+				resp = releaseOnClose(resp, cancel)
+			}
+
+			batch.finish(index, resp, err)
+		}(index, req)
+	}
+
+	wg.Wait()
+
+	return batch.results, batch.err()
+}
+
+// batch tracks the requests of DoBatch
+type batch struct {
+	failFast bool
+
+	mutex   sync.Mutex
+	results []BatchResult
+	cancels map[int]context.CancelFunc
+	failed  bool
+	first   int
+}
+
+// start records that the request is being sent; false is returned when the batch has failed (with FailFast)
+func (b *batch) start(index int, cancel context.CancelFunc) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failed && b.failFast {
+		return false
+	}
+
+	b.cancels[index] = cancel
+
+	return true
+}
+
+// finish records the result of the request (cancelling the in-flight requests when the first request fails with
+// FailFast)
+func (b *batch) finish(index int, resp *http.Response, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.cancels, index)
+
+	if err == nil {
+		b.results[index].Response = resp
+
+		return
+	}
+
+	if b.failed && b.failFast {
+		// the request was cancelled by the failure of another request
+		b.results[index].Err = ErrBatchCancelled
+
+		return
+	}
+
+	b.results[index].Err = err
+
+	if !b.failed || index < b.first {
+		b.first = index
+	}
+
+	if !b.failed && b.failFast {
+		for _, cancel := range b.cancels {
+			cancel()
+		}
+	}
+
+	b.failed = true
+}
+
+func (b *batch) err() error {
+	if !b.failed {
+		return nil
+	}
+
+	if b.failFast {
+		return b.results[b.first].Err
+	}
+
+	errs := make(map[int]error)
+
+	for index, result := range b.results {
+		if result.Err != nil {
+			errs[index] = result.Err
+		}
+	}
+
+	return &BatchError{Errors: errs, first: b.first}
+}
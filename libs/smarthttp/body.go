@@ -0,0 +1,205 @@
+package smarthttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// replayableBody allows the body of a request to be sent again by a retry.
+// Requests that supply GetBody are replayed using it.  Otherwise, the body is recorded (up to a limit) as it is sent by the
+// first attempt, so that requests that are not retried do not pay for buffering in advance.  The recording is kept in
+// a pooled buffer that is recycled once the request is done (see release).
+type replayableBody struct {
+	getBody  func() (io.ReadCloser, error)
+	recorder *bodyRecorder
+}
+
+func newReplayableBody(req *http.Request, maxBufferSize int64) *replayableBody {
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		return &replayableBody{}
+
+	case req.GetBody != nil:
+		return &replayableBody{getBody: req.GetBody}
+
+	default:
+		return &replayableBody{
+			recorder: &bodyRecorder{
+				body:     req.Body,
+				limit:    maxBufferSize,
+				sizeHint: sizeHint(req.ContentLength, maxBufferSize),
+			},
+		}
+	}
+}
+
+// first returns the request for the first attempt
+func (b *replayableBody) first(req *http.Request) *http.Request {
+	if b.recorder == nil {
+		return req
+	}
+
+	attemptReq := req.Clone(req.Context())
+	attemptReq.Body = b.recorder
+
+	return attemptReq
+}
+
+// canReplay returns whether the body can be sent again
+func (b *replayableBody) canReplay() bool {
+	return b.recorder == nil || b.recorder.canReplay()
+}
+
+// replay returns a copy of the request for a subsequent attempt
+func (b *replayableBody) replay(req *http.Request) (*http.Request, error) {
+	attemptReq := req.Clone(req.Context())
+
+	switch {
+	case b.getBody != nil:
+		body, err := b.getBody()
+		if err != nil {
+			return nil, err
+		}
+
+		attemptReq.Body = body
+
+	case b.recorder != nil:
+		attemptReq.Body = b.recorder.replay()
+	}
+
+	return attemptReq, nil
+}
+
+// release recycles the recording once the bodies of all the attempts have been closed; the request must not be
+// replayed afterwards
+func (b *replayableBody) release() {
+	if b.recorder != nil {
+		b.recorder.release()
+	}
+}
+
+// bodyRecorder records the body as it is read, until the limit is exceeded.
+// Note: the transport may read and close the body after RoundTrip has returned, hence the lock.
+type bodyRecorder struct {
+	body     io.ReadCloser
+	limit    int64
+	sizeHint int64
+
+	mutex    sync.Mutex
+	buffer   *bytes.Buffer
+	eof      bool
+	overflow bool
+
+	// the number of replayed bodies that have not been closed (they read the buffer)
+	readers  int
+	released bool
+}
+
+// Read implements io.Reader
+func (r *bodyRecorder) Read(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n, err := r.body.Read(p)
+
+	if !r.overflow && n > 0 {
+		if r.buffer == nil {
+			r.buffer = getBuffer(r.sizeHint)
+		}
+
+		if int64(r.buffer.Len()+n) > r.limit {
+			// nothing has been replayed yet (only complete recordings are replayed), so the buffer is not being read
+			r.overflow = true
+			putBuffer(r.buffer)
+			r.buffer = nil
+		} else {
+			r.buffer = growBuffer(r.buffer, n)
+			_, _ = r.buffer.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		r.eof = true
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *bodyRecorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.body.Close()
+}
+
+func (r *bodyRecorder) canReplay() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// only a complete recording can be replayed: the remainder of a partially sent body may still be read (or closed) by
+	// the transport of the previous attempt
+	return !r.overflow && r.eof
+}
+
+// replay returns a body consisting of the recorded bytes (the recording must be complete, see canReplay)
+func (r *bodyRecorder) replay() io.ReadCloser {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var recorded []byte
+	if r.buffer != nil {
+		recorded = r.buffer.Bytes()
+	}
+
+	r.readers++
+
+	return &replayedBody{Reader: bytes.NewReader(recorded), recorder: r}
+}
+
+// release recycles the buffer once the replayed bodies have been closed
+func (r *bodyRecorder) release() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.released = true
+	r.recycle()
+}
+
+// recycle returns the buffer to the pool when it is no longer needed (must be called with the lock held)
+func (r *bodyRecorder) recycle() {
+	if !r.released || r.readers > 0 || r.buffer == nil {
+		return
+	}
+
+	putBuffer(r.buffer)
+	r.buffer = nil
+
+	// the first attempt may still be reading the body; it must not record into the recycled buffer
+	r.overflow = true
+}
+
+// replayedBody is a body replayed from the recording
+type replayedBody struct {
+	io.Reader
+
+	recorder *bodyRecorder
+	closed   bool
+}
+
+// Close implements io.Closer
+func (b *replayedBody) Close() error {
+	b.recorder.mutex.Lock()
+
+	if !b.closed {
+		b.closed = true
+		b.recorder.readers--
+		b.recorder.recycle()
+	}
+
+	b.recorder.mutex.Unlock()
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package smarthttp
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// the capacities of the pooled buffers (1 KB to 1 MB); larger buffers are not pooled so that a few large bodies do not
+// keep their memory alive
+var bufferClasses = [...]int{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// bufferPools holds a pool of buffers for each class
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// getBuffer returns an empty buffer with a capacity of at least sizeHint (rounded up to its class)
+func getBuffer(sizeHint int64) *bytes.Buffer {
+	for i, class := range bufferClasses {
+		if sizeHint > int64(class) {
+			continue
+		}
+
+		if buffer, ok := bufferPools[i].Get().(*bytes.Buffer); ok {
+			return buffer
+		}
+
+		return bytes.NewBuffer(make([]byte, 0, class))
+	}
+
+	return bytes.NewBuffer(make([]byte, 0, sizeHint))
+}
+
+// putBuffer returns the buffer to the pool of the largest class it can hold (the buffer must no longer be used)
+func putBuffer(buffer *bytes.Buffer) {
+	capacity := buffer.Cap()
+	if capacity > 2*bufferClasses[len(bufferClasses)-1] {
+		return
+	}
+
+	for i := len(bufferClasses) - 1; i >= 0; i-- {
+		if capacity >= bufferClasses[i] {
+			buffer.Reset()
+			bufferPools[i].Put(buffer)
+
+			return
+		}
+	}
+}
+
+// growBuffer returns a buffer (from the pool) with the contents of the buffer and room for n more bytes; the buffer is
+// returned to the pool when it is replaced
+func growBuffer(buffer *bytes.Buffer, n int) *bytes.Buffer {
+	if buffer.Cap()-buffer.Len() >= n {
+		return buffer
+	}
+
+	// at least double the capacity so that large buffers (beyond the classes) are not copied for each write
+	size := buffer.Len() + n
+	if size < 2*buffer.Cap() {
+		size = 2 * buffer.Cap()
+	}
+
+	grown := getBuffer(int64(size))
+	_, _ = grown.Write(buffer.Bytes())
+
+	putBuffer(buffer)
+
+	return grown
+}
+
+// readAll reads the reader (like ioutil.ReadAll) into a pooled buffer and returns a copy of exactly the bytes read, so
+// that the buffer does not have to grow as it is read; sizeHint is the expected size (e.g. the Content-Length, or
+// -1 when it is unknown)
+func readAll(reader io.Reader, sizeHint int64) ([]byte, error) {
+	if sizeHint < 0 {
+		sizeHint = 0
+	}
+
+	// bytes.Buffer.ReadFrom grows the buffer unless it has bytes.MinRead bytes free
+	buffer := getBuffer(sizeHint + bytes.MinRead)
+	defer putBuffer(buffer)
+
+	_, err := buffer.ReadFrom(reader)
+
+	body := make([]byte, buffer.Len())
+	copy(body, buffer.Bytes())
+
+	return body, err
+}
+
+// sizeHint returns the expected size of a body of the content length (-1 when unknown) that is read up to the limit
+func sizeHint(contentLength, limit int64) int64 {
+	if contentLength < 0 {
+		return 0
+	}
+
+	if contentLength > limit {
+		return limit
+	}
+
+	return contentLength
+}
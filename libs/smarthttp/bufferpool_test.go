@@ -0,0 +1,61 @@
+package smarthttp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+var benchmarkBodySizes = []int{1 << 10, 16 << 10, 256 << 10}
+
+func BenchmarkReadAll(b *testing.B) {
+	for _, size := range benchmarkBodySizes {
+		data := bytes.Repeat([]byte("x"), size)
+
+		b.Run("ioutil/"+strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, _ = ioutil.ReadAll(bytes.NewReader(data))
+			}
+		})
+
+		b.Run("pooled/"+strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, _ = readAll(bytes.NewReader(data), int64(size))
+			}
+		})
+	}
+}
+
+func BenchmarkReplayableBody(b *testing.B) {
+	for _, size := range benchmarkBodySizes {
+		data := bytes.Repeat([]byte("x"), size)
+
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				req, _ := http.NewRequest(http.MethodPost, "http://localhost/", ioutil.NopCloser(bytes.NewReader(data)))
+
+				body := newReplayableBody(req, 1<<20)
+
+				// the first attempt fails and the second attempt is sent from the recording
+				attemptReq := body.first(req)
+				_, _ = io.Copy(ioutil.Discard, attemptReq.Body)
+				_ = attemptReq.Body.Close()
+
+				attemptReq, _ = body.replay(req)
+				_, _ = io.Copy(ioutil.Discard, attemptReq.Body)
+				_ = attemptReq.Body.Close()
+
+				body.release()
+			}
+		})
+	}
+}
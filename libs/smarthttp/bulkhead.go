@@ -0,0 +1,273 @@
+package smarthttp
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBulkheadMaxConcurrent = 10
+	defaultBulkheadQueueTimeout  = 100 * time.Millisecond
+)
+
+// ErrBulkheadFull indicates that the request was rejected because the client has too many requests in flight
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// Bulkhead defines the bulkhead (concurrency limiting) configuration.
+// Unlike CircuitBreaker.MaxConcurrentRequests, the bulkhead works without a circuit breaker and requests rejected by it are
+// not tracked by the circuit.
+//
+// Queued requests are admitted by priority (see WithPriority), in order of arrival within a priority, so that e.g.
+// checkout requests are not stuck behind analytics requests.  When the queue is full, a request evicts the queued
+// request with the lowest priority (which is rejected) if that priority is lower than its own.
+type Bulkhead struct {
+	// MaxConcurrent is the maximum number of requests in flight (default: 10)
+	MaxConcurrent int
+
+	// MaxQueue is the maximum number of requests waiting for a slot; requests beyond this are rejected immediately.
+	// Default value is 0 (requests are never queued)
+	MaxQueue int
+
+	// QueueTimeout is the maximum time a request waits in the queue for a slot (default: 100 ms)
+	QueueTimeout time.Duration
+
+	mutex    sync.Mutex
+	inFlight int
+	waiters  []*bulkheadWaiter
+
+	maxConcurrent   int
+	maxQueue        int
+	queueTimeout    time.Duration
+	instrumentation Instrumentation
+}
+
+// bulkheadWaiter is a request waiting for a slot
+type bulkheadWaiter struct {
+	priority Priority
+
+	// admitted receives true when the waiter is handed a slot and false when it is evicted from the queue
+	admitted chan bool
+}
+
+func (b *Bulkhead) getMaxConcurrent() int {
+	if b.MaxConcurrent > 0 {
+		return b.MaxConcurrent
+	}
+
+	b.instrumentation.InitWarning("using default 'max concurrent' setting for bulkhead")
+
+	return defaultBulkheadMaxConcurrent
+}
+
+func (b *Bulkhead) getQueueTimeout() time.Duration {
+	if b.QueueTimeout > 0 {
+		return b.QueueTimeout
+	}
+
+	if b.MaxQueue > 0 {
+		b.instrumentation.InitWarning("using default 'queue timeout' setting for bulkhead")
+	}
+
+	return defaultBulkheadQueueTimeout
+}
+
+func (b *Bulkhead) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		err := b.acquire(req)
+		if err != nil {
+			return nil, err
+		}
+
+		defer b.release()
+
+		return doFunc(req)
+	}
+}
+
+// acquire waits (if allowed) for a free slot
+func (b *Bulkhead) acquire(req *http.Request) error {
+	waiter, err := b.enqueue(priorityOf(req))
+	if err != nil {
+		b.instrumentation.BulkheadRejected(req)
+
+		return err
+	}
+
+	if waiter == nil {
+		return nil
+	}
+
+	start := time.Now()
+
+	timer := time.NewTimer(b.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case admitted := <-waiter.admitted:
+		if !admitted {
+			b.instrumentation.BulkheadRejected(req)
+
+			return ErrBulkheadFull
+		}
+
+		b.instrumentation.BulkheadQueued(req, time.Since(start))
+
+		return nil
+
+	case <-timer.C:
+		if b.dequeue(waiter) {
+			b.instrumentation.BulkheadRejected(req)
+
+			return ErrBulkheadFull
+		}
+
+	case <-req.Context().Done():
+		if b.dequeue(waiter) {
+			return req.Context().Err()
+		}
+	}
+
+	// the waiter was handed a slot (or evicted) just as it gave up
+	admitted := <-waiter.admitted
+
+	switch {
+	case admitted && req.Context().Err() == nil:
+		b.instrumentation.BulkheadQueued(req, time.Since(start))
+
+		return nil
+
+	case admitted:
+		b.release()
+
+		return req.Context().Err()
+
+	case req.Context().Err() != nil:
+		return req.Context().Err()
+
+	default:
+		b.instrumentation.BulkheadRejected(req)
+
+		return ErrBulkheadFull
+	}
+}
+
+// enqueue takes a free slot (returning a nil waiter) or queues a waiter for one (if allowed)
+func (b *Bulkhead) enqueue(priority Priority) (*bulkheadWaiter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.inFlight < b.maxConcurrent {
+		b.inFlight++
+
+		return nil, nil
+	}
+
+	if b.maxQueue == 0 {
+		return nil, ErrBulkheadFull
+	}
+
+	if len(b.waiters) >= b.maxQueue {
+		// the waiters are ordered by priority, so the last one has the lowest priority
+		last := b.waiters[len(b.waiters)-1]
+		if last.priority >= priority {
+			return nil, ErrBulkheadFull
+		}
+
+		b.waiters = b.waiters[:len(b.waiters)-1]
+		last.admitted <- false
+	}
+
+	waiter := &bulkheadWaiter{priority: priority, admitted: make(chan bool, 1)}
+
+	// queue behind the waiters with the same (or a higher) priority
+	i := len(b.waiters)
+	for i > 0 && b.waiters[i-1].priority < priority {
+		i--
+	}
+
+	b.waiters = append(b.waiters, nil)
+	copy(b.waiters[i+1:], b.waiters[i:])
+	b.waiters[i] = waiter
+
+	return waiter, nil
+}
+
+// dequeue removes the waiter from the queue; it returns false when the waiter is no longer queued (i.e. it was handed a
+// slot or evicted)
+func (b *Bulkhead) dequeue(waiter *bulkheadWaiter) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for i, queued := range b.waiters {
+		if queued == waiter {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// release hands the slot to the first waiter (if any) or frees it
+func (b *Bulkhead) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.waiters) == 0 {
+		b.inFlight--
+
+		return
+	}
+
+	waiter := b.waiters[0]
+	b.waiters = b.waiters[1:]
+	waiter.admitted <- true
+}
+
+// queueDepth returns the number of requests waiting for a slot (see Client.Stats)
+func (b *Bulkhead) queueDepth() int {
+	if b == nil {
+		return 0
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.waiters)
+}
+
+func (b *Bulkhead) addMiddleware(doFunc requestClosure) requestClosure {
+	if b == nil {
+		return doFunc
+	}
+
+	return b.buildMiddleware(doFunc)
+}
+
+func (b *Bulkhead) doInitOnce(instrumentation Instrumentation) {
+	if b == nil {
+		return
+	}
+
+	b.instrumentation = instrumentation
+
+	b.maxConcurrent = b.getMaxConcurrent()
+	b.maxQueue = b.MaxQueue
+	b.queueTimeout = b.getQueueTimeout()
+}
+
+// clone returns a copy of the configuration (with its own slots and queue) for a variant of the client (see Client.Clone)
+func (b *Bulkhead) clone() *Bulkhead {
+	if b == nil {
+		return nil
+	}
+
+	return &Bulkhead{
+		MaxConcurrent: b.MaxConcurrent,
+		MaxQueue:      b.MaxQueue,
+		QueueTimeout:  b.QueueTimeout,
+	}
+}
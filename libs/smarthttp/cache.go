@@ -0,0 +1,637 @@
+package smarthttp
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCacheMaxEntries = 1000
+
+// errCacheMiss is returned by the in-memory store when the key is not found
+var errCacheMiss = errors.New("cache miss")
+
+// CacheStore is the storage backend of the response cache.
+// It matches the Store interface of libs/cache so that any of its backends can be used.
+type CacheStore interface {
+	// Get returns the value for the key; any error (including not found) is treated as a miss
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores the value for the key.  A TTL of zero means the entry does not expire (backends may still evict it).
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the key
+	Delete(ctx context.Context, key string) error
+}
+
+// Cache defines the HTTP response cache configuration.
+// GET responses are cached according to their Cache-Control (or Expires) headers and revalidated with
+// If-None-Match/If-Modified-Since once stale.  Responses that vary (see the Vary header) are only returned to requests
+// with matching headers.  The cache acts as a shared cache; responses marked private and responses to requests with an
+// Authorization header (unless marked public) are not stored.
+type Cache struct {
+	// Store is the storage backend (default: an in-memory LRU of 1000 responses)
+	Store CacheStore
+
+	// KeyGenerator will generate the cache "key" from the request.
+	// If none is provided then DefaultSFKeyGenerator is used.
+	KeyGenerator func(req *http.Request) string
+
+	// MaxBodySize is the maximum size of a response body that will be cached (default: 1 MB)
+	MaxBodySize int64
+
+	// StaleWhileRevalidate (optionally) allows a stale response to be returned for this long after it expires, while it is
+	// revalidated in the background.  The stale-while-revalidate Cache-Control directive of a response takes precedence.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError (optionally) allows a stale response to be returned for this long after it expires when the upstream
+	// fails (i.e. returns an error, including an open circuit, or a 5xx response).
+	// The stale-if-error Cache-Control directive of a response takes precedence.
+	StaleIfError time.Duration
+
+	refreshing sync.Map
+	hits       int64
+	misses     int64
+
+	actualKeyGenerator func(req *http.Request) string
+	maxBodySize        int64
+	instrumentation    Instrumentation
+}
+
+// cacheEntry is a cached response (as stored in the CacheStore)
+type cacheEntry struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Expires    time.Time   `json:"expires"`
+
+	// StaleWhileRevalidate and StaleIfError are how long the entry can be used after it expires
+	StaleWhileRevalidate time.Duration `json:"swr,omitempty"`
+	StaleIfError         time.Duration `json:"sie,omitempty"`
+
+	// VaryHeaders are the values of the request headers named by the Vary response header
+	VaryHeaders map[string]string `json:"vary,omitempty"`
+}
+
+func (c *Cache) getMaxBodySize() int64 {
+	if c.MaxBodySize > 0 {
+		return c.MaxBodySize
+	}
+
+	c.instrumentation.InitWarning("using default 'max body size' setting for cache")
+
+	return defaultMaxBufferSize
+}
+
+//nolint:bodyclose
+func (c *Cache) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet || hasCacheDirective(req.Header, "no-store") {
+			return doFunc(req)
+		}
+
+		key := c.actualKeyGenerator(req)
+
+		entry := c.load(req, key)
+		if entry == nil {
+			c.miss(req)
+
+			resp, err := doFunc(req)
+			if err != nil {
+				return resp, err
+			}
+
+			return c.store(req, key, resp)
+		}
+
+		noCache := hasCacheDirective(req.Header, "no-cache")
+
+		if !noCache && entry.usableFor(0) {
+			c.hit(req)
+
+			return entry.response(req), nil
+		}
+
+		if !noCache && entry.usableFor(entry.StaleWhileRevalidate) {
+			c.hit(req)
+
+			c.refresh(req, key, entry, doFunc)
+
+			return entry.response(req), nil
+		}
+
+		resp, err := c.revalidate(req, key, entry, doFunc)
+		if isUpstreamFailure(resp, err) && entry.usableFor(entry.StaleIfError) && req.Context().Err() == nil {
+			discardResponse(resp)
+
+			c.hit(req)
+
+			return entry.response(req), nil
+		}
+
+		return resp, err
+	}
+}
+
+// refresh revalidates the entry in the background (at most once at a time per key)
+func (c *Cache) refresh(req *http.Request, key string, entry *cacheEntry, doFunc requestClosure) {
+	_, inProgress := c.refreshing.LoadOrStore(key, struct{}{})
+	if inProgress {
+		return
+	}
+
+	// the refresh must not be cancelled with the caller's request
+	refreshReq := req.Clone(context.Background())
+
+	go func() {
+		defer c.refreshing.Delete(key)
+
+		resp, err := c.revalidate(refreshReq, key, entry, doFunc)
+		if err == nil {
+			discardResponse(resp)
+		}
+	}()
+}
+
+// usableFor returns whether the entry can be used, allowing for the supplied staleness
+func (e *cacheEntry) usableFor(staleness time.Duration) bool {
+	return time.Now().Before(e.Expires.Add(staleness))
+}
+
+// isUpstreamFailure returns whether the result indicates that the upstream is failing
+func isUpstreamFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// hit counts (and reports) a request served from the cache
+func (c *Cache) hit(req *http.Request) {
+	atomic.AddInt64(&c.hits, 1)
+
+	c.instrumentation.CacheHit(req)
+}
+
+// miss counts (and reports) a request that could not be served from the cache
+func (c *Cache) miss(req *http.Request) {
+	atomic.AddInt64(&c.misses, 1)
+
+	c.instrumentation.CacheMiss(req)
+}
+
+// stats returns a snapshot of the hit rate of the cache (see Client.Stats)
+func (c *Cache) stats() *CacheStats {
+	if c == nil {
+		return nil
+	}
+
+	hits := atomic.LoadInt64(&c.hits)
+	misses := atomic.LoadInt64(&c.misses)
+
+	return &CacheStats{Hits: hits, Misses: misses, HitRate: ratio(hits, hits+misses)}
+}
+
+// revalidate asks the upstream whether the stale entry can still be used
+func (c *Cache) revalidate(req *http.Request, key string, entry *cacheEntry, doFunc requestClosure) (*http.Response, error) {
+	etag := entry.Header.Get("ETag")
+	lastModified := entry.Header.Get("Last-Modified")
+
+	if etag == "" && lastModified == "" {
+		c.miss(req)
+
+		resp, err := doFunc(req)
+		if err != nil {
+			return resp, err
+		}
+
+		return c.store(req, key, resp)
+	}
+
+	conditionalReq := req.Clone(req.Context())
+
+	if etag != "" && conditionalReq.Header.Get("If-None-Match") == "" {
+		conditionalReq.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified != "" && conditionalReq.Header.Get("If-Modified-Since") == "" {
+		conditionalReq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := doFunc(conditionalReq)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		c.miss(req)
+
+		return c.store(req, key, resp)
+	}
+
+	discardResponse(resp)
+
+	c.hit(req)
+
+	// the 304 carries the updated freshness of the entry (the entry is copied as it may be in use by other requests)
+	updated := *entry
+	updated.Header = entry.Header.Clone()
+
+	for _, header := range []string{"Cache-Control", "Date", "Expires", "ETag", "Last-Modified"} {
+		if value := resp.Header.Get(header); value != "" {
+			updated.Header.Set(header, value)
+		}
+	}
+
+	updated.Expires = time.Now().Add(freshnessLifetime(updated.Header))
+	updated.StaleWhileRevalidate = c.staleLifetime(updated.Header, "stale-while-revalidate", c.StaleWhileRevalidate)
+	updated.StaleIfError = c.staleLifetime(updated.Header, "stale-if-error", c.StaleIfError)
+	entry = &updated
+
+	c.save(req, key, entry)
+
+	return entry.response(req), nil
+}
+
+// load returns the cached entry for the request (if any)
+func (c *Cache) load(req *http.Request, key string) *cacheEntry {
+	data, err := c.Store.Get(req.Context(), key)
+	if err != nil || data == nil {
+		return nil
+	}
+
+	entry := &cacheEntry{}
+
+	err = json.Unmarshal(data, entry)
+	if err != nil {
+		return nil
+	}
+
+	for header, value := range entry.VaryHeaders {
+		if req.Header.Get(header) != value {
+			return nil
+		}
+	}
+
+	return entry
+}
+
+// store caches the response (when allowed) and returns a response the caller can consume
+func (c *Cache) store(req *http.Request, key string, resp *http.Response) (*http.Response, error) {
+	if !isCacheable(req, resp) {
+		return resp, nil
+	}
+
+	limit := c.maxBodySize + 1
+
+	body, err := readAll(io.LimitReader(resp.Body, limit), sizeHint(resp.ContentLength, limit))
+	if err != nil {
+		_ = resp.Body.Close()
+
+		return nil, err
+	}
+
+	if int64(len(body)) > c.maxBodySize {
+		// too large to cache; return the body we have read along with the remainder
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+
+		return resp, nil
+	}
+
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry := &cacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		Expires:    time.Now().Add(freshnessLifetime(resp.Header)),
+
+		StaleWhileRevalidate: c.staleLifetime(resp.Header, "stale-while-revalidate", c.StaleWhileRevalidate),
+		StaleIfError:         c.staleLifetime(resp.Header, "stale-if-error", c.StaleIfError),
+	}
+
+	for _, header := range varyHeaders(resp.Header) {
+		if entry.VaryHeaders == nil {
+			entry.VaryHeaders = map[string]string{}
+		}
+
+		entry.VaryHeaders[header] = req.Header.Get(header)
+	}
+
+	c.save(req, key, entry)
+
+	return resp, nil
+}
+
+func (c *Cache) save(req *http.Request, key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	// failing to cache the response should not fail the request
+	_ = c.Store.Set(req.Context(), key, data, 0)
+}
+
+// response builds a response from the entry
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(time.Since(entryDate(e.Header)).Seconds())))
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// isCacheable returns whether the response may be stored by a shared cache
+func isCacheable(req *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMultipleChoices, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+		// cacheable by default
+
+	default:
+		return false
+	}
+
+	if hasCacheDirective(resp.Header, "no-store") || hasCacheDirective(resp.Header, "private") {
+		return false
+	}
+
+	if req.Header.Get("Authorization") != "" && !hasCacheDirective(resp.Header, "public") {
+		return false
+	}
+
+	for _, header := range varyHeaders(resp.Header) {
+		if header == "*" {
+			return false
+		}
+	}
+
+	// without freshness information the response can only be stored when it can be revalidated
+	_, hasMaxAge := cacheDirective(resp.Header, "max-age")
+
+	return hasMaxAge || resp.Header.Get("Expires") != "" || resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// freshnessLifetime returns how long the response is fresh for (zero means it must be revalidated before use)
+func freshnessLifetime(header http.Header) time.Duration {
+	if hasCacheDirective(header, "no-cache") {
+		return 0
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := cacheDirective(header, directive); ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+
+			return time.Duration(seconds)*time.Second - currentAge(header)
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		date, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+
+		return date.Sub(entryDate(header))
+	}
+
+	return 0
+}
+
+// staleLifetime returns how long a response can be used after it expires according to the directive (or the default)
+func (c *Cache) staleLifetime(header http.Header, directive string, defaultValue time.Duration) time.Duration {
+	value, ok := cacheDirective(header, directive)
+	if !ok {
+		return defaultValue
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return defaultValue
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// currentAge returns the age of the response reported by the upstream (or a cache in between)
+func currentAge(header http.Header) time.Duration {
+	age, err := strconv.Atoi(header.Get("Age"))
+	if err != nil || age < 0 {
+		return 0
+	}
+
+	return time.Duration(age) * time.Second
+}
+
+func entryDate(header http.Header) time.Time {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return time.Now()
+	}
+
+	return date
+}
+
+// varyHeaders returns the (canonical) names of the headers listed in the Vary header
+func varyHeaders(header http.Header) []string {
+	var out []string
+
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				out = append(out, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	return out
+}
+
+// cacheDirective returns the value of a Cache-Control directive
+func cacheDirective(header http.Header, directive string) (string, bool) {
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name := strings.TrimSpace(part)
+			argument := ""
+
+			if index := strings.IndexByte(name, '='); index >= 0 {
+				argument = strings.Trim(strings.TrimSpace(name[index+1:]), `"`)
+				name = strings.TrimSpace(name[:index])
+			}
+
+			if strings.EqualFold(name, directive) {
+				return argument, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func hasCacheDirective(header http.Header, directive string) bool {
+	_, ok := cacheDirective(header, directive)
+
+	return ok
+}
+
+func (c *Cache) addMiddleware(doFunc requestClosure) requestClosure {
+	if c == nil {
+		return doFunc
+	}
+
+	return c.buildMiddleware(doFunc)
+}
+
+func (c *Cache) doInitOnce(instrumentation Instrumentation) {
+	if c == nil {
+		return
+	}
+
+	c.instrumentation = instrumentation
+
+	c.maxBodySize = c.getMaxBodySize()
+
+	if c.Store == nil {
+		c.instrumentation.InitWarning("using default in-memory store for cache")
+
+		c.Store = NewLRUCacheStore(defaultCacheMaxEntries)
+	}
+
+	if c.KeyGenerator != nil {
+		c.actualKeyGenerator = c.KeyGenerator
+	} else {
+		c.actualKeyGenerator = DefaultSFKeyGenerator
+	}
+}
+
+// NewLRUCacheStore returns an in-memory CacheStore that holds up to maxEntries values (least recently used are evicted)
+func NewLRUCacheStore(maxEntries int) CacheStore {
+	return &lruCacheStore{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+type lruCacheStore struct {
+	maxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruCacheItem struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Get implements CacheStore
+func (l *lruCacheStore) Get(_ context.Context, key string) ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, errCacheMiss
+	}
+
+	item := element.Value.(*lruCacheItem)
+	if !item.expires.IsZero() && time.Now().After(item.expires) {
+		l.remove(element)
+
+		return nil, errCacheMiss
+	}
+
+	l.order.MoveToFront(element)
+
+	return item.value, nil
+}
+
+// Set implements CacheStore
+func (l *lruCacheStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	item := &lruCacheItem{key: key, value: value}
+	if ttl > 0 {
+		item.expires = time.Now().Add(ttl)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		element.Value = item
+		l.order.MoveToFront(element)
+
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(item)
+
+	for l.maxEntries > 0 && l.order.Len() > l.maxEntries {
+		l.remove(l.order.Back())
+	}
+
+	return nil
+}
+
+// Delete implements CacheStore
+func (l *lruCacheStore) Delete(_ context.Context, key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		l.remove(element)
+	}
+
+	return nil
+}
+
+func (l *lruCacheStore) remove(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.entries, element.Value.(*lruCacheItem).key)
+}
+
+// clone returns a copy of the configuration (sharing the store) for a variant of the client (see Client.Clone)
+func (c *Cache) clone() *Cache {
+	if c == nil {
+		return nil
+	}
+
+	return &Cache{
+		Store:                c.Store,
+		KeyGenerator:         c.KeyGenerator,
+		MaxBodySize:          c.MaxBodySize,
+		StaleWhileRevalidate: c.StaleWhileRevalidate,
+		StaleIfError:         c.StaleIfError,
+	}
+}
@@ -0,0 +1,231 @@
+package smarthttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultChaosEnvVar     = "SMARTHTTP_CHAOS"
+	defaultChaosStatusCode = http.StatusServiceUnavailable
+)
+
+// ErrChaos indicates that the error was injected by Chaos
+var ErrChaos = errors.New("fault injected by chaos")
+
+// Chaos defines the fault injection configuration, which is used to verify that the retries, circuit breaker and
+// fallbacks of a client behave as intended when the upstream fails.
+// Faults are only injected when Chaos is enabled, i.e. when Enabled is set or the environment variable is true (e.g.
+// SMARTHTTP_CHAOS=1), so the configuration can be shipped to every environment and only switched on where wanted.
+//
+// Each attempt is subjected to each fault independently (at its rate).  Faults are injected inside the retries and the
+// circuit breaker (so that they see them) but outside the base request (so they are not reported as base requests).
+type Chaos struct {
+	// Enabled injects the faults regardless of the environment variable
+	Enabled bool
+
+	// EnvVar (optionally) is the environment variable that enables the faults when it is true (default: SMARTHTTP_CHAOS)
+	EnvVar string
+
+	// LatencyRate is the fraction (0 to 1) of the attempts that are delayed by Latency
+	LatencyRate float64
+	Latency     time.Duration
+
+	// ErrorRate is the fraction of the attempts that fail with a connection error (that wraps ErrConnection and ErrChaos)
+	// without being sent
+	ErrorRate float64
+
+	// StatusRate is the fraction of the attempts that receive a StatusCode response (default: 503) without being sent
+	StatusRate float64
+	StatusCode int
+
+	// TruncateRate is the fraction of the attempts whose response body is cut short (reading it fails with
+	// io.ErrUnexpectedEOF halfway through, or straight away when the length of the body is unknown)
+	TruncateRate float64
+
+	enabled bool
+}
+
+// chaosError is an injected connection error
+type chaosError struct{}
+
+// Error implements error
+func (e *chaosError) Error() string {
+	return ErrConnection.Error() + " (" + ErrChaos.Error() + ")"
+}
+
+// Is supports errors.Is for ErrConnection and ErrChaos
+func (e *chaosError) Is(target error) bool {
+	return target == ErrConnection || target == ErrChaos
+}
+
+func (c *Chaos) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		if chaosRoll(c.LatencyRate) {
+			timer := time.NewTimer(c.Latency)
+
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+
+				return nil, req.Context().Err()
+			}
+		}
+
+		if chaosRoll(c.ErrorRate) {
+			return nil, &chaosError{}
+		}
+
+		if chaosRoll(c.StatusRate) {
+			return c.newResponse(req), nil
+		}
+
+		resp, err := doFunc(req)
+		if err != nil || !chaosRoll(c.TruncateRate) {
+			return resp, err
+		}
+
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: resp.ContentLength / 2}
+
+		return resp, nil
+	}
+}
+
+// newResponse returns an injected error response
+func (c *Chaos) newResponse(req *http.Request) *http.Response {
+	statusCode := c.getStatusCode()
+	body := []byte(ErrChaos.Error())
+
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// chaosRoll returns true with the probability of the rate
+func chaosRoll(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate // nolint: gosec
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF once the remaining bytes have been read
+type truncatedBody struct {
+	io.ReadCloser
+
+	remaining int64
+}
+
+// Read implements io.Reader
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (c *Chaos) getStatusCode() int {
+	if c.StatusCode > 0 {
+		return c.StatusCode
+	}
+
+	return defaultChaosStatusCode
+}
+
+func (c *Chaos) getEnvVar() string {
+	if c.EnvVar != "" {
+		return c.EnvVar
+	}
+
+	return defaultChaosEnvVar
+}
+
+func (c *Chaos) validate() error {
+	rates := []struct {
+		name string
+		rate float64
+	}{
+		{"latency", c.LatencyRate}, {"error", c.ErrorRate}, {"status", c.StatusRate}, {"truncate", c.TruncateRate},
+	}
+
+	for _, rate := range rates {
+		if rate.rate < 0 || rate.rate > 1 {
+			return fmt.Errorf("chaos %s rate must be between 0 and 1", rate.name)
+		}
+	}
+
+	if c.Latency < 0 {
+		return errors.New("chaos latency cannot be negative")
+	}
+
+	if c.StatusCode != 0 && (c.StatusCode < http.StatusBadRequest || c.StatusCode > 599) {
+		return errors.New("chaos status code must be an error (4xx or 5xx)")
+	}
+
+	return nil
+}
+
+func (c *Chaos) addMiddleware(doFunc requestClosure) requestClosure {
+	if c == nil || !c.enabled {
+		return doFunc
+	}
+
+	return c.buildMiddleware(doFunc)
+}
+
+func (c *Chaos) doInitOnce(instrumentation Instrumentation) {
+	if c == nil {
+		return
+	}
+
+	enabled, _ := strconv.ParseBool(os.Getenv(c.getEnvVar()))
+	c.enabled = c.Enabled || enabled
+
+	if c.enabled {
+		instrumentation.InitWarning("chaos is enabled, faults will be injected into the requests")
+	}
+}
+
+// clone returns a copy of the configuration for a variant of the client (see Client.Clone)
+func (c *Chaos) clone() *Chaos {
+	if c == nil {
+		return nil
+	}
+
+	return &Chaos{
+		Enabled:      c.Enabled,
+		EnvVar:       c.EnvVar,
+		LatencyRate:  c.LatencyRate,
+		Latency:      c.Latency,
+		ErrorRate:    c.ErrorRate,
+		StatusRate:   c.StatusRate,
+		StatusCode:   c.StatusCode,
+		TruncateRate: c.TruncateRate,
+	}
+}
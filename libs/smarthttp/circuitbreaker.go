@@ -1,6 +1,7 @@
 package smarthttp
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
@@ -17,6 +18,10 @@ const (
 var (
 	defaultMaxConcurrentRequests = hystrix.DefaultMaxConcurrent
 
+	defaultSleepWindow = time.Duration(hystrix.DefaultSleepWindow) * time.Millisecond
+
+	defaultRequestVolumeThreshold = hystrix.DefaultVolumeThreshold
+
 	// see `getTimeout()` for more details
 	defaultCircuitBreakerTimeout = 1 * time.Hour
 
@@ -42,6 +47,22 @@ type CircuitBreaker struct {
 	// Default value is 10 (setting above 100 is not advisable)
 	MaxConcurrentRequests int
 
+	// SleepWindow is how long the circuit stays open before a request is allowed through to test whether the upstream
+	// has recovered.  Default value is 5 seconds
+	SleepWindow time.Duration
+
+	// IgnoreCallerDeadline excludes requests that failed because the caller's context deadline expired from the error
+	// rate (requests cancelled by the caller are always excluded).
+	// Enable this when callers set tight deadlines that say little about the health of the upstream.
+	IgnoreCallerDeadline bool
+
+	// RequestVolumeThreshold is the minimum number of requests (in the rolling 10 second window) before the error
+	// percentage can open the circuit.  Lower values suit low-traffic clients.  Default value is 20
+	RequestVolumeThreshold int
+
+	// Engine is the circuit breaker implementation (default: HystrixEngine)
+	Engine CircuitBreakerEngine
+
 	name            string
 	instrumentation Instrumentation
 
@@ -50,10 +71,17 @@ type CircuitBreaker struct {
 	totalTrackedErrors int
 }
 
-func (b *CircuitBreaker) getTimeout() int {
+// IsCircuitOpen returns true when the circuit for this client is currently open (i.e. requests are being rejected)
+func (c *Client) IsCircuitOpen() bool {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	return c.CircuitBreaker.Engine.IsOpen(c.Name)
+}
+
+func (b *CircuitBreaker) getTimeout() time.Duration {
 	// Set a timeout that is so long that all other timeouts will trigger first
 	// We are essentially disabling this timeout
-	return int(defaultCircuitBreakerTimeout.Milliseconds())
+	return defaultCircuitBreakerTimeout
 }
 
 func (b *CircuitBreaker) getMaxConcurrent() int {
@@ -67,7 +95,7 @@ func (b *CircuitBreaker) getMaxConcurrent() int {
 }
 
 func (b *CircuitBreaker) getErrorPercent() int {
-	if b.ErrorPercentThreshold > minErrorThreshold {
+	if b.ErrorPercentThreshold >= minErrorThreshold {
 		return b.ErrorPercentThreshold
 	}
 
@@ -76,33 +104,58 @@ func (b *CircuitBreaker) getErrorPercent() int {
 	return defaultErrorThreshold
 }
 
+func (b *CircuitBreaker) getSleepWindow() time.Duration {
+	if b.SleepWindow > 0 {
+		return b.SleepWindow
+	}
+
+	b.instrumentation.InitWarning("using default 'sleep window' setting for circuit breaker")
+
+	return defaultSleepWindow
+}
+
+func (b *CircuitBreaker) getRequestVolumeThreshold() int {
+	if b.RequestVolumeThreshold > 0 {
+		return b.RequestVolumeThreshold
+	}
+
+	b.instrumentation.InitWarning("using default 'request volume threshold' setting for circuit breaker")
+
+	return defaultRequestVolumeThreshold
+}
+
 //nolint:bodyclose
 func (b *CircuitBreaker) buildMiddleware(doFunc requestClosure) requestClosure {
 	return func(req *http.Request) (*http.Response, error) {
 		var resp *http.Response
+		var callerErr error
 
-		err := hystrix.Do(b.name, func() error {
+		err := b.Engine.Do(b.name, func() error {
 			var innerErr error
 
 			resp, innerErr = doFunc(req)
 			if innerErr != nil {
+				if b.isCallerErr(req, innerErr) {
+					// the caller gave up; this says nothing about the health of the upstream (see CircuitBreakerEngine.Do)
+					callerErr = innerErr
+					return req.Context().Err()
+				}
+
 				return innerErr
 			}
 
 			return b.outErrorBasedOnResponseCode(req, resp)
-		}, nil)
+		})
+
+		if callerErr != nil {
+			return resp, callerErr
+		}
 
 		switch err {
-		case hystrix.ErrCircuitOpen:
+		case ErrCircuitIsOpen:
 			b.instrumentation.CBCircuitOpen(req)
 			return resp, ErrCircuitIsOpen
 
-		case hystrix.ErrMaxConcurrency:
-			return resp, ErrCircuitMaxConcurrencyReached
-
-		case hystrix.ErrTimeout:
-			return resp, ErrCircuitTimeout
-
 		case nil, errTrackableStatusCodeError:
 			return resp, nil
 
@@ -112,6 +165,22 @@ func (b *CircuitBreaker) buildMiddleware(doFunc requestClosure) requestClosure {
 	}
 }
 
+// isCallerErr returns true when the request failed because the caller's context was cancelled (or expired)
+func (b *CircuitBreaker) isCallerErr(req *http.Request, err error) bool {
+	ctxErr := req.Context().Err()
+
+	switch {
+	case ctxErr == context.Canceled:
+		return errors.Is(err, context.Canceled)
+
+	case ctxErr == context.DeadlineExceeded && b.IgnoreCallerDeadline:
+		return true
+
+	default:
+		return false
+	}
+}
+
 func (b *CircuitBreaker) outErrorBasedOnResponseCode(req *http.Request, resp *http.Response) error {
 	// process HTTP response codes (and throw errors that we should track)
 	switch resp.StatusCode {
@@ -141,6 +210,18 @@ func (b *CircuitBreaker) outErrorBasedOnResponseCode(req *http.Request, resp *ht
 	}
 }
 
+// settings returns the (resolved) settings of the circuit
+func (b *CircuitBreaker) settings() CircuitBreakerSettings {
+	return CircuitBreakerSettings{
+		Timeout:                b.getTimeout(),
+		MaxConcurrentRequests:  b.getMaxConcurrent(),
+		ErrorPercentThreshold:  b.getErrorPercent(),
+		SleepWindow:            b.getSleepWindow(),
+		RequestVolumeThreshold: b.getRequestVolumeThreshold(),
+		OnStateChange:          b.instrumentation.CBStateChange,
+	}
+}
+
 func (b *CircuitBreaker) addMiddleware(doFunc requestClosure) requestClosure {
 	if b == nil {
 		return doFunc
@@ -159,11 +240,13 @@ func (b *CircuitBreaker) doInitOnce(instrumentation Instrumentation, name string
 	b.name = name
 	b.instrumentation = instrumentation
 
-	hystrix.ConfigureCommand(b.name, hystrix.CommandConfig{
-		Timeout:               b.getTimeout(),
-		MaxConcurrentRequests: b.getMaxConcurrent(),
-		ErrorPercentThreshold: b.getErrorPercent(),
-	})
+	if b.Engine == nil {
+		b.Engine = &HystrixEngine{}
+	}
+
+	b.Engine.Configure(b.name, b.settings())
+
+	registerCircuit(b.name, b.Engine)
 
 	if b.trackError == nil {
 		b.trackError = func(_ *CircuitBreaker) {
@@ -171,3 +254,15 @@ func (b *CircuitBreaker) doInitOnce(instrumentation Instrumentation, name string
 		}
 	}
 }
+
+// clone returns a copy of the configuration (sharing the engine) for a variant of the client (see Client.Clone)
+func (b *CircuitBreaker) clone() CircuitBreaker {
+	return CircuitBreaker{
+		ErrorPercentThreshold:  b.ErrorPercentThreshold,
+		MaxConcurrentRequests:  b.MaxConcurrentRequests,
+		SleepWindow:            b.SleepWindow,
+		IgnoreCallerDeadline:   b.IgnoreCallerDeadline,
+		RequestVolumeThreshold: b.RequestVolumeThreshold,
+		Engine:                 b.Engine,
+	}
+}
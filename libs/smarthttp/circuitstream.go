@@ -0,0 +1,168 @@
+package smarthttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the default interval of the circuit stream (see CircuitAdmin.StreamHandler)
+const defaultCircuitStreamInterval = time.Second
+
+// hystrixCommandMetrics is a circuit in the format of the Hystrix metrics stream (the fields read by the Hystrix
+// dashboard); the metrics this package does not track (e.g. latencies and fallbacks) are reported as zero
+type hystrixCommandMetrics struct {
+	Type           string `json:"type"`
+	Name           string `json:"name"`
+	Group          string `json:"group"`
+	CurrentTime    int64  `json:"currentTime"`
+	ReportingHosts int    `json:"reportingHosts"`
+
+	IsCircuitBreakerOpen bool `json:"isCircuitBreakerOpen"`
+	ErrorPercentage      int  `json:"errorPercentage"`
+	ErrorCount           int  `json:"errorCount"`
+	RequestCount         int  `json:"requestCount"`
+
+	RollingCountSuccess            int `json:"rollingCountSuccess"`
+	RollingCountFailure            int `json:"rollingCountFailure"`
+	RollingCountShortCircuited     int `json:"rollingCountShortCircuited"`
+	RollingCountTimeout            int `json:"rollingCountTimeout"`
+	RollingCountSemaphoreRejected  int `json:"rollingCountSemaphoreRejected"`
+	RollingCountThreadPoolRejected int `json:"rollingCountThreadPoolRejected"`
+	RollingCountFallbackSuccess    int `json:"rollingCountFallbackSuccess"`
+	RollingCountFallbackFailure    int `json:"rollingCountFallbackFailure"`
+
+	CurrentConcurrentExecutionCount int `json:"currentConcurrentExecutionCount"`
+
+	LatencyExecuteMean int            `json:"latencyExecute_mean"`
+	LatencyExecute     map[string]int `json:"latencyExecute"`
+	LatencyTotalMean   int            `json:"latencyTotal_mean"`
+	LatencyTotal       map[string]int `json:"latencyTotal"`
+
+	PropertyRequestVolumeThreshold int    `json:"propertyValue_circuitBreakerRequestVolumeThreshold"`
+	PropertySleepWindow            int64  `json:"propertyValue_circuitBreakerSleepWindowInMilliseconds"`
+	PropertyErrorThreshold         int    `json:"propertyValue_circuitBreakerErrorThresholdPercentage"`
+	PropertyForceOpen              bool   `json:"propertyValue_circuitBreakerForceOpen"`
+	PropertyForceClosed            bool   `json:"propertyValue_circuitBreakerForceClosed"`
+	PropertyEnabled                bool   `json:"propertyValue_circuitBreakerEnabled"`
+	PropertyIsolationStrategy      string `json:"propertyValue_executionIsolationStrategy"`
+	PropertyMaxConcurrentRequests  int    `json:"propertyValue_executionIsolationSemaphoreMaxConcurrentRequests"`
+	PropertyRollingWindow          int    `json:"propertyValue_metricsRollingStatisticalWindowInMilliseconds"`
+}
+
+// StreamHandler returns a handler that streams the statistics of every circuit (see Circuits) as server-sent events in
+// the format of the Hystrix metrics stream, so that the circuits can be watched as they approach their thresholds (e.g.
+// with the Hystrix dashboard):
+//
+//	mux.Handle("/debug/hystrix.stream", (&smarthttp.CircuitAdmin{}).StreamHandler())
+//
+// The circuits are sent every second (or every "delay" milliseconds when the query parameter is supplied) until the
+// request is cancelled.
+func (a *CircuitAdmin) StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+			return
+		}
+
+		interval := defaultCircuitStreamInterval
+
+		if delay, err := strconv.Atoi(req.URL.Query().Get("delay")); err == nil && delay > 0 {
+			interval = time.Duration(delay) * time.Millisecond
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
+		w.Header().Set("Connection", "keep-alive")
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			err := a.writeStream(w)
+			if err != nil {
+				return
+			}
+
+			flusher.Flush()
+
+			select {
+			case <-ticker.C:
+				// send the next snapshot
+
+			case <-req.Context().Done():
+				return
+			}
+		}
+	})
+}
+
+// writeStream writes a snapshot of the circuits as server-sent events (a ping when there are no circuits, so that the
+// connection is kept alive)
+func (a *CircuitAdmin) writeStream(w http.ResponseWriter) error {
+	circuits := a.Circuits()
+
+	if len(circuits) == 0 {
+		_, err := w.Write([]byte("ping: \n\n"))
+
+		return err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	for _, circuit := range circuits {
+		data, err := json.Marshal(newHystrixCommandMetrics(circuit, now))
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append(append([]byte("data: "), data...), '\n', '\n'))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newHystrixCommandMetrics converts the statistics of the circuit to the Hystrix format
+func newHystrixCommandMetrics(circuit CircuitStats, now int64) *hystrixCommandMetrics {
+	return &hystrixCommandMetrics{
+		Type:           "HystrixCommand",
+		Name:           circuit.Name,
+		Group:          circuit.Name,
+		CurrentTime:    now,
+		ReportingHosts: 1,
+
+		IsCircuitBreakerOpen: circuit.State == StateOpen,
+		ErrorPercentage:      circuit.ErrorPercent,
+		ErrorCount:           circuit.Errors,
+		RequestCount:         circuit.Requests,
+
+		RollingCountSuccess: circuit.Requests - circuit.Errors,
+		RollingCountFailure: circuit.Errors,
+
+		CurrentConcurrentExecutionCount: circuit.ConcurrentRequests,
+
+		LatencyExecute: hystrixZeroLatencies(),
+		LatencyTotal:   hystrixZeroLatencies(),
+
+		PropertyRequestVolumeThreshold: circuit.RequestVolumeThreshold,
+		PropertySleepWindow:            circuit.SleepWindow.Milliseconds(),
+		PropertyErrorThreshold:         circuit.ErrorPercentThreshold,
+		PropertyForceOpen:              circuit.Forced && circuit.State == StateOpen,
+		PropertyForceClosed:            circuit.Forced && circuit.State == StateClosed,
+		PropertyEnabled:                true,
+		PropertyIsolationStrategy:      "SEMAPHORE",
+		PropertyMaxConcurrentRequests:  circuit.MaxConcurrentRequests,
+		PropertyRollingWindow:          circuitStatsBuckets * int(time.Second/time.Millisecond),
+	}
+}
+
+// hystrixZeroLatencies returns the latency percentiles read by the Hystrix dashboard (latencies are not tracked)
+func hystrixZeroLatencies() map[string]int {
+	return map[string]int{"0": 0, "25": 0, "50": 0, "75": 0, "90": 0, "95": 0, "99": 0, "99.5": 0, "100": 0}
+}
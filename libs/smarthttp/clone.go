@@ -0,0 +1,98 @@
+package smarthttp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Clone returns a new client (a variant of this client) with the (optional) options applied, e.g. a "slow endpoints"
+// variant with a longer timeout:
+//
+//	slow, err := client.Clone(smarthttp.WithName(client.Name+"-slow"), smarthttp.WithTimeout(30*time.Second))
+//
+// The variant shares the transport (and therefore the connection pool) and the cookie jar of this client, so the
+// transport settings (e.g. ConnectTimeout, MaxConnsPerHost, TLS, ProxyURL and HTTP2) cannot be changed by the options.
+// The configuration (e.g. Retries, Hedging and Bulkhead) is copied so that the variant has its own state, except the
+// stores, limiters and circuit breaker engine which are shared (e.g. a RateLimit applies to both clients).
+// The circuit breaker tracks each client by name; a variant with the same name shares the circuit of this client.
+//
+// As with NewClient, the configuration is validated and an error (wrapping ErrInvalidConfig) is returned when it is
+// invalid.
+func (c *Client) Clone(opts ...Option) (*Client, error) {
+	httpClient := c.getClient()
+
+	// the runtime configuration may be changed concurrently (see UpdateConfig)
+	c.configMutex.RLock()
+	breaker := c.CircuitBreaker.clone()
+	retries := c.Retries.clone()
+	rateLimit := c.RateLimit.clone()
+	c.configMutex.RUnlock()
+
+	clone := &Client{
+		Name:                  c.Name,
+		Timeout:               c.Timeout,
+		ConnectTimeout:        c.ConnectTimeout,
+		MinimumRemaining:      c.MinimumRemaining,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		ExpectContinueTimeout: c.ExpectContinueTimeout,
+		MaxResponseBytes:      c.MaxResponseBytes,
+		DefaultHeaders:        c.DefaultHeaders.Clone(),
+		UserAgent:             c.UserAgent,
+		RequestID:             c.RequestID,
+		Propagation:           c.Propagation,
+		TLS:                   c.TLS,
+		ProxyURL:              c.ProxyURL,
+		DialOverride:          c.DialOverride,
+		DNSCache:              c.DNSCache,
+		HostGuard:             c.HostGuard.clone(),
+		EnableCookieJar:       c.EnableCookieJar,
+		CookieJar:             httpClient.Jar,
+		Redirect:              c.Redirect,
+		HTTP2:                 c.HTTP2,
+		Compression:           c.Compression,
+		Debug:                 c.Debug,
+		Signer:                c.Signer,
+		ValidateResponse:      c.ValidateResponse,
+		Instrumentation:       c.Instrumentation,
+		CircuitBreaker:        breaker,
+		Retries:               retries,
+		LoadBalancer:          c.LoadBalancer.clone(),
+		Failover:              c.Failover.clone(),
+		Hedging:               c.Hedging.clone(),
+		Singleflight:          c.Singleflight.clone(),
+		RateLimit:             rateLimit,
+		Bulkhead:              c.Bulkhead.clone(),
+		AdaptiveConcurrency:   c.AdaptiveConcurrency.clone(),
+		Cache:                 c.Cache.clone(),
+		Async:                 c.Async.clone(),
+		Outbox:                c.Outbox.clone(),
+		Webhook:               c.Webhook.clone(),
+		LoadShedder:           c.LoadShedder.clone(),
+		PoolMetrics:           c.PoolMetrics,
+		Chaos:                 c.Chaos.clone(),
+		middleware:            append([]Middleware(nil), c.middleware...),
+	}
+
+	clone.transport = httpClient.Transport
+	if clone.transport == nil {
+		clone.transport = http.DefaultTransport
+	}
+
+	for _, opt := range opts {
+		opt(clone)
+	}
+
+	err := clone.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	clone.clientInitOnce.Do(clone.doInitOnce)
+
+	return clone, nil
+}
@@ -0,0 +1,104 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClientClosed indicates that the request was rejected because the client has been closed (see Client.Close)
+var ErrClientClosed = errors.New("client closed")
+
+// Flusher is (optionally) implemented by Instrumentation that buffers events (e.g. a statsd client); Flush is called
+// when the client is closed
+type Flusher interface {
+	Flush() error
+}
+
+// lifecycle tracks the in-flight requests so that the client can be closed gracefully
+type lifecycle struct {
+	mutex    sync.Mutex
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// begin records the start of a request; an error is returned when the client has been closed
+func (l *lifecycle) begin() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return ErrClientClosed
+	}
+
+	l.inFlight.Add(1)
+
+	return nil
+}
+
+// end records the end of a request
+func (l *lifecycle) end() {
+	l.inFlight.Done()
+}
+
+// close stops new requests and returns a channel that is closed once the in-flight requests have completed
+func (l *lifecycle) close() <-chan struct{} {
+	l.mutex.Lock()
+	l.closed = true
+	l.mutex.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		l.inFlight.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+// Close gracefully shuts down the client (e.g. during a rolling restart).
+// The queued asynchronous requests (see DoAsync) are sent first and the outbox stops sending messages (the messages
+// being sent are completed and the others stay in the store), then new requests are rejected (with an error wrapping
+// ErrClientClosed) and Close waits for the in-flight requests to complete (or the context to be done, in which case
+// the context's error is returned).  The instrumentation is then
+// flushed (when it implements Flusher), the load balancer stops refreshing its targets, the pool metrics stop being
+// reported, the client is removed from the StatsHandler and the idle connections of the underlying HTTP client are
+// closed.
+//
+// Note: a request is in-flight until Do returns; reading the body of the response is not tracked.
+func (c *Client) Close(ctx context.Context) error {
+	instrumentation := c.getInstrumentation()
+
+	err := c.Async.close(ctx)
+
+	outboxErr := c.Outbox.close(ctx)
+	if err == nil {
+		err = outboxErr
+	}
+
+	select {
+	case <-c.lifecycle.close():
+		// all in-flight requests have completed
+
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if flusher, ok := instrumentation.(Flusher); ok {
+		flushErr := flusher.Flush()
+		if err == nil {
+			err = flushErr
+		}
+	}
+
+	c.LoadBalancer.close()
+
+	c.PoolMetrics.close()
+
+	unregisterStats(c)
+
+	c.getClient().CloseIdleConnections()
+
+	return err
+}
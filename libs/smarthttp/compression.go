@@ -0,0 +1,220 @@
+package smarthttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// the Accept-Encoding sent when Compression is configured and the request does not set its own
+const defaultAcceptEncoding = "gzip, deflate, br"
+
+// ErrCompression indicates that the request body could not be compressed or the response body could not be decompressed
+var ErrCompression = errors.New("compression error")
+
+// Compression defines the request and response compression configuration.
+//
+// Responses encoded with gzip, deflate or br are decompressed (and the Content-Encoding and Content-Length headers
+// removed), including when the request set its own Accept-Encoding header (in which case the standard transport leaves
+// the response compressed).
+//
+// Request bodies larger than RequestThreshold are gzip compressed (with Content-Encoding: gzip).  The compressed body is
+// held in memory so that it can be sent again by retries.
+type Compression struct {
+	// RequestThreshold is the size (in bytes) above which request bodies are compressed (default: 0, request bodies are
+	// never compressed)
+	RequestThreshold int64
+
+	// Level is the gzip compression level of request bodies (default: gzip.DefaultCompression)
+	Level int
+}
+
+// compressRequest returns the request with the body compressed (when it is larger than the threshold).
+// The request is copied (rather than modified) when required.
+func (c *Compression) compressRequest(req *http.Request) (*http.Request, error) {
+	if c == nil || c.RequestThreshold <= 0 || req.Body == nil || req.Body == http.NoBody ||
+		req.Header.Get("Content-Encoding") != "" {
+		return req, nil
+	}
+
+	// bodies of a known size below the threshold are left alone without reading them
+	if req.ContentLength > 0 && req.ContentLength <= c.RequestThreshold {
+		return req, nil
+	}
+
+	body, err := c.readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrCompression, err)
+	}
+
+	req = req.Clone(req.Context())
+
+	if int64(len(body)) <= c.RequestThreshold {
+		setRequestBody(req, body)
+
+		return req, nil
+	}
+
+	buffer := &bytes.Buffer{}
+
+	writer, err := gzip.NewWriterLevel(buffer, c.Level)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrCompression, err)
+	}
+
+	_, _ = writer.Write(body)
+
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrCompression, err)
+	}
+
+	setRequestBody(req, buffer.Bytes())
+	req.Header.Set("Content-Encoding", "gzip")
+
+	return req, nil
+}
+
+// readBody reads the whole body (via GetBody when supplied so that the original body is not consumed)
+func (c *Compression) readBody(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		defer func() {
+			_ = req.Body.Close()
+		}()
+
+		return ioutil.ReadAll(req.Body)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = body.Close()
+	}()
+
+	return ioutil.ReadAll(body)
+}
+
+func setRequestBody(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+func (c *Compression) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept-Encoding") == "" {
+			req = req.Clone(req.Context())
+			req.Header.Set("Accept-Encoding", defaultAcceptEncoding)
+		}
+
+		resp, err := doFunc(req)
+		if err != nil || resp == nil || resp.Body == nil || req.Method == http.MethodHead {
+			return resp, err
+		}
+
+		return c.decompress(resp), nil
+	}
+}
+
+// decompress replaces the body of the response with a decompressing reader (when it is encoded)
+func (c *Compression) decompress(resp *http.Response) *http.Response {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	var body io.ReadCloser
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		body = &gzipReader{body: resp.Body}
+
+	case "deflate":
+		body = &decompressReader{Reader: flate.NewReader(resp.Body), body: resp.Body}
+
+	case "br":
+		body = &decompressReader{Reader: brotli.NewReader(resp.Body), body: resp.Body}
+
+	default:
+		return resp
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return resp
+}
+
+// decompressReader reads the decompressed body and closes the underlying (compressed) body
+type decompressReader struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+// Close implements io.Closer
+func (r *decompressReader) Close() error {
+	if closer, ok := r.Reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+
+	return r.body.Close()
+}
+
+// gzipReader lazily creates the gzip reader (which reads the gzip header) on the first read
+type gzipReader struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+	err    error
+}
+
+// Read implements io.Reader
+func (r *gzipReader) Read(p []byte) (int, error) {
+	if r.reader == nil && r.err == nil {
+		r.reader, r.err = gzip.NewReader(r.body)
+		if r.err != nil {
+			r.err = fmt.Errorf("%w - %s", ErrCompression, r.err)
+		}
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return r.reader.Read(p)
+}
+
+// Close implements io.Closer
+func (r *gzipReader) Close() error {
+	return r.body.Close()
+}
+
+func (c *Compression) addMiddleware(doFunc requestClosure) requestClosure {
+	if c == nil {
+		return doFunc
+	}
+
+	return c.buildMiddleware(doFunc)
+}
+
+func (c *Compression) doInitOnce() {
+	if c == nil {
+		return
+	}
+
+	if c.Level == 0 {
+		c.Level = gzip.DefaultCompression
+	}
+}
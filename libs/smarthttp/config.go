@@ -0,0 +1,213 @@
+package smarthttp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	libconfig "github.com/karelrenaldi/storemono/libs/config"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the declarative configuration of a client (e.g. one upstream of a Registry).
+// Fields that are not set use the package defaults; retries and the circuit breaker thresholds are only configured when
+// at least one of their fields is set.
+//
+// The env tags are the names of the environment variables read by LoadEnv (after the prefix) and the yaml tags the keys
+// read by FromYAML (durations are written as Go durations, e.g. "250ms").
+type Config struct {
+	// Timeout is the total timeout of a request (see Client.Timeout)
+	Timeout time.Duration `env:"TIMEOUT" yaml:"timeout"`
+
+	// ConnectTimeout is the timeout of the connection phase of a request (see Client.ConnectTimeout)
+	ConnectTimeout time.Duration `env:"CONNECT_TIMEOUT" yaml:"connect_timeout"`
+
+	// MaxConnsPerHost limits the total number of connections per host (see Client.MaxConnsPerHost)
+	MaxConnsPerHost int `env:"MAX_CONNS_PER_HOST" yaml:"max_conns_per_host"`
+
+	// RetryMaxAttempts, RetryBaseDelay and RetryMaxDelay configure the retries (see Retries)
+	RetryMaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" yaml:"retry_max_attempts"`
+	RetryBaseDelay   time.Duration `env:"RETRY_BASE_DELAY" yaml:"retry_base_delay"`
+	RetryMaxDelay    time.Duration `env:"RETRY_MAX_DELAY" yaml:"retry_max_delay"`
+
+	// CBErrorPercentThreshold, CBMaxConcurrentRequests, CBSleepWindow and CBRequestVolumeThreshold configure the circuit
+	// breaker (see CircuitBreaker)
+	CBErrorPercentThreshold  int           `env:"CB_ERROR_PERCENT_THRESHOLD" yaml:"cb_error_percent_threshold"`
+	CBMaxConcurrentRequests  int           `env:"CB_MAX_CONCURRENT_REQUESTS" yaml:"cb_max_concurrent_requests"`
+	CBSleepWindow            time.Duration `env:"CB_SLEEP_WINDOW" yaml:"cb_sleep_window"`
+	CBRequestVolumeThreshold int           `env:"CB_REQUEST_VOLUME_THRESHOLD" yaml:"cb_request_volume_threshold"`
+}
+
+// FromEnv builds a client (see NewClientFromConfig) configured by the environment variables with the prefix (e.g.
+// with the prefix "PAYMENTS_", the timeout is read from PAYMENTS_TIMEOUT).  See the env tags of Config for the names.
+func FromEnv(name string, prefix string, opts ...Option) (*Client, error) {
+	cfg := Config{}
+
+	err := cfg.LoadEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientFromConfig(name, cfg, opts...)
+}
+
+// FromYAML builds a client (see NewClientFromConfig) configured by the YAML document.  See the yaml tags of Config for
+// the keys; unknown keys are rejected (so that typos are not silently ignored).
+func FromYAML(name string, data []byte, opts ...Option) (*Client, error) {
+	cfg := Config{}
+
+	err := yaml.UnmarshalStrict(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	return NewClientFromConfig(name, cfg, opts...)
+}
+
+// NewClientFromConfig builds a client (see NewClient) once the configuration has been validated (see Config.Validate).
+// The (optional) options are applied before the configuration, whose fields that are set take precedence (see
+// Config.Options).
+func NewClientFromConfig(name string, cfg Config, opts ...Option) (*Client, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(name, append(append([]Option{}, opts...), cfg.Options()...)...)
+}
+
+// LoadEnv overrides the fields of the configuration with the environment variables (with the prefix) that are set, so
+// that the caller's defaults are kept for the others.  The variables are read by libs/config (so *_FILE variants and
+// human friendly durations are supported).  An error (wrapping ErrInvalidConfig) is returned when a value cannot be
+// parsed.
+func (cfg *Config) LoadEnv(prefix string) error {
+	err := libconfig.LoadWithPrefix(prefix, cfg)
+	if err != nil {
+		return fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	return nil
+}
+
+// Validate checks the configuration, including the checks across fields that involve the package defaults (e.g. a
+// ConnectTimeout that is not less than the default Timeout).  An error (wrapping ErrInvalidConfig) is returned when it
+// is invalid.
+func (cfg Config) Validate() error {
+	err := cfg.validate()
+	if err != nil {
+		return fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	return nil
+}
+
+func (cfg Config) validate() error {
+	timeout := durationOrDefault(cfg.Timeout, defaultTimeout)
+	connectTimeout := durationOrDefault(cfg.ConnectTimeout, defaultConnectTimeout)
+	baseDelay := durationOrDefault(cfg.RetryBaseDelay, defaultBaseRetryDelay)
+	maxDelay := durationOrDefault(cfg.RetryMaxDelay, defaultMaxRetryDelay)
+
+	switch {
+	case cfg.Timeout < 0 || cfg.ConnectTimeout < 0:
+		return errors.New("timeouts cannot be negative")
+
+	case connectTimeout >= timeout:
+		return fmt.Errorf("connect timeout (%s) must be less than timeout (%s)", connectTimeout, timeout)
+
+	case cfg.MaxConnsPerHost < 0:
+		return errors.New("max conns per host cannot be negative")
+
+	case cfg.RetryMaxAttempts < 0:
+		return errors.New("retry max attempts cannot be negative")
+
+	case cfg.RetryBaseDelay < 0 || cfg.RetryMaxDelay < 0:
+		return errors.New("retry delays cannot be negative")
+
+	case baseDelay > maxDelay:
+		return fmt.Errorf("retry base delay (%s) cannot be greater than retry max delay (%s)", baseDelay, maxDelay)
+
+	case cfg.CBErrorPercentThreshold < 0 || cfg.CBErrorPercentThreshold > 100:
+		return errors.New("circuit breaker error percent threshold must be between 0 and 100")
+
+	case cfg.CBErrorPercentThreshold > 0 && cfg.CBErrorPercentThreshold < minErrorThreshold:
+		return fmt.Errorf("circuit breaker error percent threshold cannot be set below %d", minErrorThreshold)
+
+	case cfg.CBMaxConcurrentRequests < 0 || cfg.CBRequestVolumeThreshold < 0 || cfg.CBSleepWindow < 0:
+		return errors.New("circuit breaker settings cannot be negative")
+	}
+
+	return nil
+}
+
+func durationOrDefault(value time.Duration, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+
+	return defaultValue
+}
+
+// Options returns the options that apply the configuration (see NewClient).
+// Only the fields that are set are applied, so that the settings of options applied earlier (e.g. those passed to
+// NewClientFromConfig) are kept for the others.
+func (cfg Config) Options() []Option {
+	var out []Option
+
+	if cfg.Timeout != 0 {
+		out = append(out, WithTimeout(cfg.Timeout))
+	}
+
+	if cfg.ConnectTimeout != 0 {
+		out = append(out, WithConnectTimeout(cfg.ConnectTimeout))
+	}
+
+	if cfg.MaxConnsPerHost != 0 {
+		out = append(out, func(c *Client) {
+			c.MaxConnsPerHost = cfg.MaxConnsPerHost
+		})
+	}
+
+	if cfg.RetryMaxAttempts != 0 || cfg.RetryBaseDelay != 0 || cfg.RetryMaxDelay != 0 {
+		out = append(out, func(c *Client) {
+			// a copy, so that the retries passed to an earlier option are not modified
+			retries := c.Retries.clone()
+			if retries == nil {
+				retries = &Retries{}
+			}
+
+			if cfg.RetryMaxAttempts != 0 {
+				retries.MaxAttempts = cfg.RetryMaxAttempts
+			}
+
+			if cfg.RetryBaseDelay != 0 {
+				retries.BaseDelay = cfg.RetryBaseDelay
+			}
+
+			if cfg.RetryMaxDelay != 0 {
+				retries.MaxDelay = cfg.RetryMaxDelay
+			}
+
+			c.Retries = retries
+		})
+	}
+
+	out = append(out, func(c *Client) {
+		if cfg.CBErrorPercentThreshold != 0 {
+			c.CircuitBreaker.ErrorPercentThreshold = cfg.CBErrorPercentThreshold
+		}
+
+		if cfg.CBMaxConcurrentRequests != 0 {
+			c.CircuitBreaker.MaxConcurrentRequests = cfg.CBMaxConcurrentRequests
+		}
+
+		if cfg.CBSleepWindow != 0 {
+			c.CircuitBreaker.SleepWindow = cfg.CBSleepWindow
+		}
+
+		if cfg.CBRequestVolumeThreshold != 0 {
+			c.CircuitBreaker.RequestVolumeThreshold = cfg.CBRequestVolumeThreshold
+		}
+	})
+
+	return out
+}
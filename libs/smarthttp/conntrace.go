@@ -0,0 +1,119 @@
+package smarthttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnTrace describes the connection phases of a single request (see Instrumentation.BaseDoConnTrace).
+// Phases that did not occur (e.g. DNS, Connect and TLSHandshake when a connection was reused) are zero.
+type ConnTrace struct {
+	// DNS is the time taken to resolve the host
+	DNS time.Duration
+
+	// Connect is the time taken to establish the TCP connection
+	Connect time.Duration
+
+	// TLSHandshake is the time taken to complete the TLS handshake
+	TLSHandshake time.Duration
+
+	// TimeToFirstByte is the time from the start of the request until the first byte of the response was received
+	TimeToFirstByte time.Duration
+
+	// Reused indicates that an existing (pooled) connection was used
+	Reused bool
+
+	// Protocol is the negotiated protocol (e.g. "HTTP/1.1" or "HTTP/2.0"); empty when no response was received
+	Protocol string
+}
+
+// connTracer collects a ConnTrace using net/http/httptrace.
+// Note: the hooks may be called from other goroutines (e.g. while dialing) and even after the request has completed.
+type connTracer struct {
+	start time.Time
+
+	mutex        sync.Mutex
+	trace        ConnTrace
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+}
+
+// withConnTracer returns a copy of the request that traces its connection phases
+func withConnTracer(req *http.Request) (*http.Request, *connTracer) {
+	tracer := &connTracer{start: time.Now()}
+
+	clientTrace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			tracer.update(func(trace *ConnTrace) {
+				trace.Reused = info.Reused
+			})
+		},
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			tracer.mark(&tracer.dnsStart)
+		},
+		DNSDone: func(_ httptrace.DNSDoneInfo) {
+			tracer.since(&tracer.dnsStart, func(trace *ConnTrace, elapsed time.Duration) {
+				trace.DNS = elapsed
+			})
+		},
+		ConnectStart: func(_, _ string) {
+			tracer.mark(&tracer.connectStart)
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			tracer.since(&tracer.connectStart, func(trace *ConnTrace, elapsed time.Duration) {
+				trace.Connect = elapsed
+			})
+		},
+		TLSHandshakeStart: func() {
+			tracer.mark(&tracer.tlsStart)
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, _ error) {
+			tracer.since(&tracer.tlsStart, func(trace *ConnTrace, elapsed time.Duration) {
+				trace.TLSHandshake = elapsed
+			})
+		},
+		GotFirstResponseByte: func() {
+			tracer.since(&tracer.start, func(trace *ConnTrace, elapsed time.Duration) {
+				trace.TimeToFirstByte = elapsed
+			})
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace)), tracer
+}
+
+func (t *connTracer) mark(start *time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	*start = time.Now()
+}
+
+// since records the time elapsed since the start of a phase (the start is read under the lock)
+func (t *connTracer) since(start *time.Time, record func(trace *ConnTrace, elapsed time.Duration)) {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	record(&t.trace, now.Sub(*start))
+}
+
+func (t *connTracer) update(record func(trace *ConnTrace)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	record(&t.trace)
+}
+
+// result returns the phases traced so far
+func (t *connTracer) result() ConnTrace {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.trace
+}
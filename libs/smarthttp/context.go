@@ -0,0 +1,100 @@
+package smarthttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type ctxKey int
+
+const (
+	ctxKeyRetryPolicy ctxKey = iota
+	ctxKeyNonIdempotentRetries
+	ctxKeyIdempotencyKey
+	ctxKeyAttempt
+	ctxKeyRequestID
+	ctxKeyInboundHeaders
+	ctxKeyDebug
+	ctxKeyFailover
+	ctxKeyPathTemplate
+	ctxKeyPriority
+	ctxKeyCall
+)
+
+// WithRetryPolicy returns a copy of the context that overrides the client's retry configuration for requests made with it.
+// Fields that are not set fall back to the package defaults (not to the client's configuration).
+// Passing nil disables retries for the request (e.g. for a non-idempotent endpoint).
+func WithRetryPolicy(ctx context.Context, retries *Retries) context.Context {
+	return context.WithValue(ctx, ctxKeyRetryPolicy, retries)
+}
+
+// WithNonIdempotentRetries returns a copy of the context that allows requests made with it to be retried even when their
+// method is not idempotent (see Retries.IdempotentMethodsOnly).  Only use this when the upstream is known to deduplicate
+// the request (e.g. by means of an idempotency key).
+func WithNonIdempotentRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyNonIdempotentRetries, true)
+}
+
+func nonIdempotentRetriesAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(ctxKeyNonIdempotentRetries).(bool)
+
+	return allowed
+}
+
+// retriesFor returns the retry configuration for the request; a policy supplied via WithRetryPolicy takes precedence
+func (c *Client) retriesFor(req *http.Request) *Retries {
+	value := req.Context().Value(ctxKeyRetryPolicy)
+	if value == nil {
+		return c.getRetries()
+	}
+
+	override, _ := value.(*Retries)
+	if override == nil {
+		return nil
+	}
+
+	override = override.forRequest(c.getInstrumentation())
+	override.minimumRemaining = c.MinimumRemaining
+
+	return override
+}
+
+// withFailover marks the request as sent to the failover secondary (so that the load balancer does not change its host)
+func withFailover(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyFailover, true)
+}
+
+func isFailover(ctx context.Context) bool {
+	failover, _ := ctx.Value(ctxKeyFailover).(bool)
+
+	return failover
+}
+
+// call is the state of a call to Client.Do that is used by the (prebuilt) middleware chain
+type call struct {
+	start       time.Time
+	endpointTag string
+}
+
+// withCall returns a copy of the request that carries the state of the call
+func withCall(req *http.Request, start time.Time, endpointTag string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), ctxKeyCall, &call{start: start, endpointTag: endpointTag}))
+}
+
+// callFromContext returns the state of the call (empty when the request was not made by Client.Do)
+func callFromContext(ctx context.Context) *call {
+	state, ok := ctx.Value(ctxKeyCall).(*call)
+	if !ok {
+		return &call{}
+	}
+
+	return state
+}
+
+// addRetries wraps the function with the retries of each request (see retriesFor)
+func (c *Client) addRetries(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		return c.retriesFor(req).do(doFunc, req)
+	}
+}
@@ -0,0 +1,323 @@
+package smarthttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// the default key of the cookies saved by CacheCookieStore
+	defaultCookieStoreKey = "smarthttp:cookies"
+
+	// the maximum time to load or save the cookies
+	cookieStoreTimeout = 5 * time.Second
+)
+
+// CookieStore persists the cookies of a CookieJar (e.g. so that sessions survive restarts or are shared between the
+// pods of a service)
+type CookieStore interface {
+	// Load returns the saved cookies (nil when none have been saved)
+	Load(ctx context.Context) ([]byte, error)
+
+	// Save saves the cookies
+	Save(ctx context.Context, data []byte) error
+}
+
+// CookieJar is an in-memory http.CookieJar (see net/http/cookiejar) that (optionally) persists its cookies to a
+// CookieStore.  Session cookies (i.e. cookies without an expiry) are persisted along with the others.
+// The cookies are saved in the background (so that a slow store does not delay the requests); the changes made while
+// a save is in progress are saved together once it completes.
+type CookieJar struct {
+	jar   *cookiejar.Jar
+	store CookieStore
+
+	mutex   sync.Mutex
+	cookies map[string]storedCookie
+
+	// saving indicates that the cookies are being saved and changed that they have changed since the save started
+	saving  bool
+	changed bool
+}
+
+// storedCookie is a cookie (and the URL that set it) as saved to the CookieStore
+type storedCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// NewCookieJar returns a CookieJar that persists its cookies to the (optional) store.
+// Cookies previously saved to the store are loaded.
+func NewCookieJar(store CookieStore) (*CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &CookieJar{
+		jar:     jar,
+		store:   store,
+		cookies: map[string]storedCookie{},
+	}
+
+	if store == nil {
+		return out, nil
+	}
+
+	err = out.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// SetCookies implements http.CookieJar
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	if j.store == nil {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.record(u, cookies)
+
+	if j.saving {
+		j.changed = true
+
+		return
+	}
+
+	j.saving = true
+
+	go j.save()
+}
+
+// record records the cookies so that they can be saved (the caller must hold the mutex)
+func (j *CookieJar) record(u *url.URL, cookies []*http.Cookie) {
+	now := time.Now()
+	origin := u.Scheme + "://" + u.Host
+
+	for _, cookie := range cookies {
+		key := origin + "|" + cookie.Domain + "|" + cookie.Path + "|" + cookie.Name
+
+		stored := *cookie
+		stored.Raw = ""
+		stored.Unparsed = nil
+
+		// MaxAge is relative to the time the cookie was set
+		if stored.MaxAge > 0 {
+			stored.Expires = now.Add(time.Duration(stored.MaxAge) * time.Second)
+			stored.MaxAge = 0
+		}
+
+		if stored.MaxAge < 0 || (!stored.Expires.IsZero() && stored.Expires.Before(now)) {
+			delete(j.cookies, key)
+
+			continue
+		}
+
+		j.cookies[key] = storedCookie{URL: origin + u.EscapedPath(), Cookie: &stored}
+	}
+}
+
+// Cookies implements http.CookieJar
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// save persists the cookies until they no longer change
+func (j *CookieJar) save() {
+	for {
+		j.mutex.Lock()
+		data, err := j.marshal()
+		j.changed = false
+		j.mutex.Unlock()
+
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), cookieStoreTimeout)
+
+			// failing to persist the cookies should not fail the requests
+			_ = j.store.Save(ctx, data)
+
+			cancel()
+		}
+
+		j.mutex.Lock()
+
+		if !j.changed {
+			j.saving = false
+			j.mutex.Unlock()
+
+			return
+		}
+
+		j.mutex.Unlock()
+	}
+}
+
+// marshal returns the saved form of the cookies (the caller must hold the mutex)
+func (j *CookieJar) marshal() ([]byte, error) {
+	now := time.Now()
+
+	cookies := make([]storedCookie, 0, len(j.cookies))
+
+	for key, stored := range j.cookies {
+		if !stored.Cookie.Expires.IsZero() && stored.Cookie.Expires.Before(now) {
+			delete(j.cookies, key)
+
+			continue
+		}
+
+		cookies = append(cookies, stored)
+	}
+
+	return json.Marshal(cookies)
+}
+
+func (j *CookieJar) load() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cookieStoreTimeout)
+	defer cancel()
+
+	data, err := j.store.Load(ctx)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var cookies []storedCookie
+
+	err = json.Unmarshal(data, &cookies)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, stored := range cookies {
+		if stored.Cookie == nil || (!stored.Cookie.Expires.IsZero() && stored.Cookie.Expires.Before(now)) {
+			continue
+		}
+
+		u, err := url.Parse(stored.URL)
+		if err != nil {
+			continue
+		}
+
+		j.jar.SetCookies(u, []*http.Cookie{stored.Cookie})
+		j.record(u, []*http.Cookie{stored.Cookie})
+	}
+
+	return nil
+}
+
+// FileCookieStore is a CookieStore that saves the cookies to a file
+type FileCookieStore struct {
+	// Path is the path of the file
+	Path string
+}
+
+// Load implements CookieStore
+func (s *FileCookieStore) Load(_ context.Context) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// Save implements CookieStore
+func (s *FileCookieStore) Save(_ context.Context, data []byte) error {
+	// write to a temporary file and rename so that a partially written file is never loaded
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// CacheCookieStore is a CookieStore that saves the cookies to a CacheStore (e.g. the Redis store from libs/cache, so
+// that the cookies are shared between the pods of a service)
+type CacheCookieStore struct {
+	// Store is the cache store
+	Store CacheStore
+
+	// Key is the key the cookies are saved under (default: "smarthttp:cookies")
+	Key string
+
+	// NotFound is the error the Store returns when the key is not found, e.g. cache.ErrNotFound of libs/cache (default:
+	// the error of NewLRUCacheStore).  Other errors fail the load.
+	NotFound error
+}
+
+// Load implements CookieStore
+func (s *CacheCookieStore) Load(ctx context.Context) ([]byte, error) {
+	data, err := s.Store.Get(ctx, s.getKey())
+	if errors.Is(err, s.getNotFound()) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// Save implements CookieStore
+func (s *CacheCookieStore) Save(ctx context.Context, data []byte) error {
+	return s.Store.Set(ctx, s.getKey(), data, 0)
+}
+
+func (s *CacheCookieStore) getKey() string {
+	if s.Key != "" {
+		return s.Key
+	}
+
+	return defaultCookieStoreKey
+}
+
+func (s *CacheCookieStore) getNotFound() error {
+	if s.NotFound != nil {
+		return s.NotFound
+	}
+
+	return errCacheMiss
+}
+
+// buildCookieJar returns the cookie jar of the default HTTP client (when enabled)
+func (c *Client) buildCookieJar() http.CookieJar {
+	if c.CookieJar != nil {
+		return c.CookieJar
+	}
+
+	if !c.EnableCookieJar {
+		return nil
+	}
+
+	// cannot fail without a store
+	jar, _ := NewCookieJar(nil)
+
+	return jar
+}
@@ -0,0 +1,138 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingCookieStore blocks the saves until released and keeps the last saved cookies
+type blockingCookieStore struct {
+	release chan struct{}
+
+	mutex sync.Mutex
+	saves int
+	data  []byte
+}
+
+func (b *blockingCookieStore) Load(_ context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+func (b *blockingCookieStore) Save(_ context.Context, data []byte) error {
+	<-b.release
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.saves++
+	b.data = data
+
+	return nil
+}
+
+func (b *blockingCookieStore) get() (int, string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.saves, string(b.data)
+}
+
+func TestCookieJar_SetCookies(t *testing.T) {
+	store := &blockingCookieStore{release: make(chan struct{})}
+
+	jar, err := NewCookieJar(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("https://api.example.com/")
+
+	// the saves do not block the requests (the first save is in progress, the others are saved together after it)
+	for _, name := range []string{"first", "second", "third"} {
+		jar.SetCookies(u, []*http.Cookie{{Name: name, Value: "value"}})
+	}
+
+	if len(jar.Cookies(u)) != 3 {
+		t.Errorf("expected 3 cookies, got %v", jar.Cookies(u))
+	}
+
+	close(store.release)
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		saves, data := store.get()
+		if strings.Contains(data, `"first"`) && strings.Contains(data, `"third"`) {
+			// the changes made during the first save are saved together
+			if saves > 2 {
+				t.Errorf("expected at most 2 saves, got %d", saves)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all the cookies to be saved, got: %s", data)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCacheCookieStore_Load(t *testing.T) {
+	errUnavailable := errors.New("store unavailable")
+
+	tests := []struct {
+		name    string
+		store   *CacheCookieStore
+		wantErr error
+	}{
+		{
+			name:  "not found",
+			store: &CacheCookieStore{Store: NewLRUCacheStore(1)},
+		},
+		{
+			name:  "custom not found",
+			store: &CacheCookieStore{Store: &errCacheStore{err: errUnavailable}, NotFound: errUnavailable},
+		},
+		{
+			name:    "store error",
+			store:   &CacheCookieStore{Store: &errCacheStore{err: errUnavailable}},
+			wantErr: errUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewCookieJar(test.store)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("expected error %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+// errCacheStore fails every operation with the error
+type errCacheStore struct {
+	err error
+}
+
+func (e *errCacheStore) Get(_ context.Context, _ string) ([]byte, error) {
+	return nil, e.err
+}
+
+func (e *errCacheStore) Set(_ context.Context, _ string, _ []byte, _ time.Duration) error {
+	return e.err
+}
+
+func (e *errCacheStore) Delete(_ context.Context, _ string) error {
+	return e.err
+}
@@ -0,0 +1,32 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDeadlineTooShort indicates that the request was not attempted (or retried) because the time remaining before the
+// deadline of its context is less than Client.MinimumRemaining
+var ErrDeadlineTooShort = errors.New("remaining deadline too short")
+
+// checkDeadline returns an error (wrapping ErrDeadlineTooShort) when the context has a deadline and less than minimum
+// will remain after waiting for the delay
+func checkDeadline(ctx context.Context, minimum, delay time.Duration) error {
+	if minimum <= 0 {
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	remaining := time.Until(deadline) - delay
+	if remaining < minimum {
+		return fmt.Errorf("%w - %s remaining (minimum: %s)", ErrDeadlineTooShort, remaining, minimum)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package smarthttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// the default maximum size of the request and response bodies included in a dump
+	defaultDebugMaxBodySize = 64 << 10
+
+	// the value that replaces redacted headers
+	redacted = "[REDACTED]"
+)
+
+// the headers that are always redacted from dumps
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// Debug defines the request/response debug dumping configuration.
+// When enabled (for all requests by setting Client.Debug or for a single request with WithDebug), each attempt is
+// reported to Instrumentation.DebugDump.
+// Sensitive headers (Authorization, Proxy-Authorization, Cookie, Set-Cookie and X-Api-Key) are always redacted.
+//
+// Note: dumps may contain personal or sensitive data (particularly when Bodies is set); this is intended for debugging
+// (e.g. in staging) and should not be left enabled in production.
+type Debug struct {
+	// Bodies includes the request and response bodies in the dumps (up to MaxBodySize)
+	Bodies bool
+
+	// MaxBodySize is the maximum number of bytes of each body included in a dump (default: 64 KB)
+	MaxBodySize int64
+
+	// RedactHeaders (optionally) lists additional headers to redact
+	RedactHeaders []string
+}
+
+// Dump is a dump of a single attempt (request and response) reported to Instrumentation.DebugDump
+type Dump struct {
+	// Method and URL of the request (the password of the URL, if any, is redacted)
+	Method string
+	URL    string
+
+	// RequestHeader is the (redacted) headers of the request
+	RequestHeader http.Header
+
+	// RequestBody is the request body (when Debug.Bodies is set), truncated to Debug.MaxBodySize
+	RequestBody []byte
+
+	// StatusCode is the status code of the response (0 when no response was received)
+	StatusCode int
+
+	// ResponseHeader is the (redacted) headers of the response
+	ResponseHeader http.Header
+
+	// ResponseBody is the response body (when Debug.Bodies is set), truncated to Debug.MaxBodySize
+	ResponseBody []byte
+
+	// Duration is the time taken by the attempt (until the response headers were received)
+	Duration time.Duration
+
+	// Err is the error returned by the attempt (if any)
+	Err error
+}
+
+// WithDebug returns a copy of the context that enables debug dumping for requests made with it.
+// The client's Debug configuration is used when set (otherwise headers only are dumped).
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyDebug, true)
+}
+
+func debugEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(ctxKeyDebug).(bool)
+
+	return enabled
+}
+
+// addDebug wraps the function with the debug dumping (when enabled for the client or the request)
+func (c *Client) addDebug(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		debug := c.Debug
+		if debug == nil {
+			if !debugEnabled(req.Context()) {
+				return doFunc(req)
+			}
+
+			debug = &Debug{}
+		}
+
+		return debug.dump(doFunc, req, c.getInstrumentation(), callFromContext(req.Context()).endpointTag)
+	}
+}
+
+//nolint:bodyclose
+func (d *Debug) dump(doFunc requestClosure, req *http.Request, instrumentation Instrumentation,
+	endpointTag string) (*http.Response, error) {
+	maxBodySize := d.getMaxBodySize()
+
+	var recorder *debugRecorder
+
+	if d.Bodies && req.Body != nil && req.Body != http.NoBody {
+		// record the body as it is sent (so that it is not read twice)
+		recorder = &debugRecorder{body: req.Body, limit: maxBodySize}
+
+		req = req.Clone(req.Context())
+		req.Body = recorder
+	}
+
+	start := time.Now()
+
+	resp, err := doFunc(req)
+
+	out := Dump{
+		Method:        req.Method,
+		URL:           redactURL(req.URL),
+		RequestHeader: d.redact(req.Header),
+		Duration:      time.Since(start),
+		Err:           err,
+	}
+
+	if recorder != nil {
+		out.RequestBody = recorder.bytes()
+	}
+
+	if resp != nil {
+		out.StatusCode = resp.StatusCode
+		out.ResponseHeader = d.redact(resp.Header)
+
+		if d.Bodies && resp.Body != nil && resp.Body != http.NoBody {
+			out.ResponseBody = peekBody(resp, maxBodySize)
+		}
+	}
+
+	instrumentation.DebugDump(out, endpointTag)
+
+	return resp, err
+}
+
+func (d *Debug) getMaxBodySize() int64 {
+	if d.MaxBodySize > 0 {
+		return d.MaxBodySize
+	}
+
+	return defaultDebugMaxBodySize
+}
+
+// redact returns a copy of the headers with the sensitive headers redacted
+func (d *Debug) redact(header http.Header) http.Header {
+	out := header.Clone()
+
+	for _, headers := range [][]string{defaultRedactedHeaders, d.RedactHeaders} {
+		for _, name := range headers {
+			if out.Get(name) != "" {
+				out.Set(name, redacted)
+			}
+		}
+	}
+
+	return out
+}
+
+// redactURL returns the URL with the password (if any) redacted
+func redactURL(u *url.URL) string {
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+
+	out := *u
+	out.User = url.UserPassword(u.User.Username(), "xxxxx")
+
+	return out.String()
+}
+
+// peekBody returns (up to limit bytes of) the body of the response, leaving the body intact
+func peekBody(resp *http.Response, limit int64) []byte {
+	peeked, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+
+	// return the body we have read along with the remainder (and the error, if any)
+	var remainder io.Reader = resp.Body
+	if err != nil {
+		remainder = &errReader{err: err}
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(bytes.NewReader(peeked), remainder),
+		Closer: resp.Body,
+	}
+
+	return peeked
+}
+
+// debugRecorder records (up to limit bytes of) the body as it is read.
+// The transport may still be sending the body when the response is received, so access is guarded by the mutex.
+type debugRecorder struct {
+	body  io.ReadCloser
+	limit int64
+
+	mutex    sync.Mutex
+	recorded bytes.Buffer
+}
+
+// Read implements io.Reader
+func (r *debugRecorder) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if remaining := r.limit - int64(r.recorded.Len()); remaining > 0 {
+		if int64(n) < remaining {
+			remaining = int64(n)
+		}
+
+		_, _ = r.recorded.Write(p[:remaining])
+	}
+
+	return n, err
+}
+
+func (r *debugRecorder) bytes() []byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]byte(nil), r.recorded.Bytes()...)
+}
+
+// Close implements io.Closer
+func (r *debugRecorder) Close() error {
+	return r.body.Close()
+}
+
+// errReader returns the error on every read
+type errReader struct {
+	err error
+}
+
+// Read implements io.Reader
+func (r *errReader) Read(_ []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,65 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// DialOverride overrides the network and address dialed by the default transport, e.g. to send the requests to a local
+// sidecar over a unix domain socket.  The requests are otherwise unchanged: the URL (e.g. "http://sidecar/v1/flags")
+// still sets the path, the Host header and the TLS server name.
+type DialOverride struct {
+	// Network is the network that is dialed, e.g. "unix" (default: "tcp")
+	Network string
+
+	// Address is the address that is dialed instead of the host of the URL, e.g. "/var/run/sidecar.sock"
+	Address string
+
+	// Dial (optionally) dials the network and address instead of net.Dialer (e.g. for a custom network).
+	// The context has the connect timeout of the client.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// wrapDialContext returns a DialContext that dials the override (rather than the address of the request)
+func (d *DialOverride) wrapDialContext(dialContext dialContextFunc, connectTimeout time.Duration) dialContextFunc {
+	network := d.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	if d.Dial == nil {
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialContext(ctx, network, d.Address)
+		}
+	}
+
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		dialCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+		defer cancel()
+
+		conn, err := d.Dial(dialCtx, network, d.Address)
+		if err != nil {
+			if netError, ok := err.(net.Error); ok && netError.Timeout() {
+				return nil, newDialError(ErrConnectTimeout, err)
+			}
+
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return nil, newDialError(ErrConnectTimeout, err)
+			}
+
+			return nil, newDialError(ErrConnection, err)
+		}
+
+		return conn, nil
+	}
+}
+
+func (d *DialOverride) validate() error {
+	if d.Address == "" {
+		return errors.New("dial override address cannot be empty")
+	}
+
+	return nil
+}
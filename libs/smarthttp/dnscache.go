@@ -0,0 +1,214 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultDNSCacheTTL         = 30 * time.Second
+	defaultDNSCacheMinTTL      = 1 * time.Second
+	defaultDNSCacheMaxTTL      = 5 * time.Minute
+	defaultDNSCacheNegativeTTL = 5 * time.Second
+)
+
+// DNSResolver resolves the addresses of a host for the DNSCache
+type DNSResolver interface {
+	// LookupHost returns the addresses of the host and how long they can be cached (0 uses DNSCache.TTL)
+	LookupHost(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+}
+
+// DNSCache defines the DNS cache of the default transport.
+// The addresses of each host are cached (for TTL, clamped to MinTTL and MaxTTL) and failed lookups are cached for
+// NegativeTTL, so that each pod only looks up each host occasionally (rather than for each new connection).  Concurrent
+// lookups of the same host are combined.  Each lookup is reported to Instrumentation.DNSLookup.
+//
+// When a connection to the first address fails, the other addresses are tried in turn.
+type DNSCache struct {
+	// Resolver (optionally) resolves the hosts (default: net.DefaultResolver, which does not return TTLs)
+	Resolver DNSResolver
+
+	// TTL is how long addresses are cached when the resolver does not return a TTL (default: 30s)
+	TTL time.Duration
+
+	// MinTTL and MaxTTL clamp the TTLs (default: 1s and 5m)
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// NegativeTTL is how long failed lookups are cached (default: 5s)
+	NegativeTTL time.Duration
+
+	initOnce        sync.Once
+	instrumentation Instrumentation
+
+	mutex   sync.RWMutex
+	entries map[string]dnsCacheEntry
+	group   singleflight.Group
+}
+
+type dnsCacheEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+// defaultDNSResolver resolves the hosts with net.DefaultResolver
+type defaultDNSResolver struct{}
+
+// LookupHost implements DNSResolver
+func (r *defaultDNSResolver) LookupHost(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+
+	return ips, 0, nil
+}
+
+// lookup returns the (cached) addresses of the host
+func (d *DNSCache) lookup(host string) ([]net.IP, error) {
+	start := time.Now()
+
+	d.mutex.RLock()
+	entry, ok := d.entries[host]
+	d.mutex.RUnlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		d.instrumentation.DNSLookup(host, time.Since(start), true, entry.err)
+
+		return entry.ips, entry.err
+	}
+
+	result, _, _ := d.group.Do(host, func() (interface{}, error) {
+		// the lookup is shared by the concurrent callers, so it is not cancelled by the context of this caller
+		lookupCtx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+
+		ips, ttl, err := d.getResolver().LookupHost(lookupCtx, host)
+		if err == nil && len(ips) == 0 {
+			err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		entry := dnsCacheEntry{ips: ips, err: err, expires: time.Now().Add(d.ttl(ttl, err))}
+
+		d.mutex.Lock()
+		d.entries[host] = entry
+		d.mutex.Unlock()
+
+		return entry, nil
+	})
+
+	entry = result.(dnsCacheEntry)
+
+	d.instrumentation.DNSLookup(host, time.Since(start), false, entry.err)
+
+	return entry.ips, entry.err
+}
+
+// ttl returns how long the result of a lookup is cached
+func (d *DNSCache) ttl(ttl time.Duration, err error) time.Duration {
+	if err != nil {
+		return d.NegativeTTL
+	}
+
+	if ttl <= 0 {
+		ttl = d.TTL
+	}
+
+	switch {
+	case ttl < d.MinTTL:
+		return d.MinTTL
+
+	case ttl > d.MaxTTL:
+		return d.MaxTTL
+
+	default:
+		return ttl
+	}
+}
+
+func (d *DNSCache) getResolver() DNSResolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+
+	return &defaultDNSResolver{}
+}
+
+// wrapDialContext resolves the host of the address using the cache and dials each of its addresses in turn
+func (d *DNSCache) wrapDialContext(dialContext dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialContext(ctx, network, addr)
+		}
+
+		ips, err := d.lookup(host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			var conn net.Conn
+
+			conn, err = dialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
+
+func (d *DNSCache) validate() error {
+	switch {
+	case d.TTL < 0 || d.MinTTL < 0 || d.MaxTTL < 0 || d.NegativeTTL < 0:
+		return errors.New("DNS cache TTLs cannot be negative")
+
+	case d.MaxTTL > 0 && d.MinTTL > d.MaxTTL:
+		return errors.New("DNS cache min TTL cannot be greater than max TTL")
+	}
+
+	return nil
+}
+
+// doInitOnce is called when the default transport is built; a cache shared by several clients (e.g. variants created
+// with Client.Clone) is initialized once and reports to the instrumentation of the first client
+func (d *DNSCache) doInitOnce(instrumentation Instrumentation) {
+	d.initOnce.Do(func() {
+		d.init(instrumentation)
+	})
+}
+
+func (d *DNSCache) init(instrumentation Instrumentation) {
+	d.instrumentation = instrumentation
+
+	d.entries = map[string]dnsCacheEntry{}
+
+	if d.TTL <= 0 {
+		d.TTL = defaultDNSCacheTTL
+	}
+
+	if d.MinTTL <= 0 {
+		d.MinTTL = defaultDNSCacheMinTTL
+	}
+
+	if d.MaxTTL <= 0 {
+		d.MaxTTL = defaultDNSCacheMaxTTL
+	}
+
+	if d.NegativeTTL <= 0 {
+		d.NegativeTTL = defaultDNSCacheNegativeTTL
+	}
+}
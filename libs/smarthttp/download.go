@@ -0,0 +1,264 @@
+package smarthttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDownloadMaxResumes  = 5
+	defaultDownloadResumeDelay = 1 * time.Second
+	maxDownloadResumeDelay     = 30 * time.Second
+)
+
+var (
+	// ErrChecksumMismatch indicates that the downloaded content does not match the expected checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrDownloadChanged indicates that the content changed while a download was being resumed
+	ErrDownloadChanged = errors.New("content changed during download")
+)
+
+// DownloadOptions defines how Download fetches the content
+type DownloadOptions struct {
+	// MaxResumes is the number of times the download is resumed after the transfer fails (default: 5)
+	MaxResumes int
+
+	// SHA256 (optionally) is the expected (hex encoded) SHA-256 checksum of the content
+	SHA256 string
+
+	// Progress (optionally) is called after each write with the number of bytes written so far and the total size of
+	// the content (-1 when it is unknown)
+	Progress func(written, total int64)
+}
+
+// Download streams the content of the URL to w and returns the number of bytes written.
+//
+// Each request is sent with Do (so failures to get a response are retried, see Retries).  When the transfer of the body
+// fails, the download is resumed (up to opts.MaxResumes times) from where it stopped with a Range request, guarded by
+// If-Range so that a changed file is detected (ErrDownloadChanged).  Servers that do not support ranges send the whole
+// content again, in which case the bytes already written are skipped.
+//
+// Note: on error, w holds a partial download.
+func (c *Client) Download(ctx context.Context, url string, w io.Writer, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+
+	maxResumes := opts.MaxResumes
+	if maxResumes <= 0 {
+		maxResumes = defaultDownloadMaxResumes
+	}
+
+	d := &download{
+		client: c,
+		url:    url,
+		opts:   opts,
+		hash:   sha256.New(),
+		total:  -1,
+	}
+
+	// the backoff of the retries is reused between resumes
+	backoff := &Retries{baseDelay: defaultDownloadResumeDelay, maxDelay: maxDownloadResumeDelay}
+
+	for resumes := 0; ; resumes++ {
+		done, err := d.fetch(ctx, w)
+		if done || err == nil {
+			if err == nil {
+				err = d.verify()
+			}
+
+			return d.written, err
+		}
+
+		if resumes >= maxResumes || ctx.Err() != nil {
+			return d.written, err
+		}
+
+		timer := time.NewTimer(backoff.backoff(resumes))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return d.written, err
+		}
+	}
+}
+
+// download tracks the progress of Download
+type download struct {
+	client    *Client
+	url       string
+	opts      *DownloadOptions
+	hash      hash.Hash
+	written   int64
+	total     int64
+	validator string
+}
+
+// fetch requests (the rest of) the content and copies it to w.  done is true when the error is final (i.e. the download
+// cannot be resumed).
+func (d *download) fetch(ctx context.Context, w io.Writer) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return true, err
+	}
+
+	// ranges apply to the encoded content, so the content is not compressed
+	req.Header.Set("Accept-Encoding", "identity")
+
+	if d.written > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(d.written, 10)+"-")
+
+		if d.validator != "" {
+			req.Header.Set("If-Range", d.validator)
+		}
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer discardResponse(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && d.written > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != d.written {
+			return true, fmt.Errorf("%w - unexpected Content-Range '%s'", ErrDownloadChanged,
+				resp.Header.Get("Content-Range"))
+		}
+
+		d.total = total
+
+	case resp.StatusCode == http.StatusOK:
+		if d.written > 0 {
+			if d.validator != "" && d.validator != validatorOf(resp) {
+				return true, ErrDownloadChanged
+			}
+
+			// the range was ignored; skip the bytes that have already been written
+			_, err = io.CopyN(ioutil.Discard, resp.Body, d.written)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		d.total = resp.ContentLength
+		d.validator = validatorOf(resp)
+
+	default:
+		return true, newAPIError(resp)
+	}
+
+	writer := &downloadWriter{download: d, w: w}
+
+	_, err = io.Copy(writer, resp.Body)
+
+	switch {
+	case writer.err != nil:
+		// writing failed (rather than the transfer)
+		return true, writer.err
+
+	case err != nil:
+		return false, err
+
+	case d.total >= 0 && d.written < d.total:
+		return false, io.ErrUnexpectedEOF
+
+	default:
+		return true, nil
+	}
+}
+
+// verify checks the checksum of the content
+func (d *download) verify() error {
+	if d.opts.SHA256 == "" {
+		return nil
+	}
+
+	sum := hex.EncodeToString(d.hash.Sum(nil))
+	if !strings.EqualFold(sum, d.opts.SHA256) {
+		return fmt.Errorf("%w - expected %s, got %s", ErrChecksumMismatch, d.opts.SHA256, sum)
+	}
+
+	return nil
+}
+
+// downloadWriter writes to the destination, hashing the content and reporting the progress
+type downloadWriter struct {
+	download *download
+	w        io.Writer
+	err      error
+}
+
+// Write implements io.Writer
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+
+	d := w.download
+	_, _ = d.hash.Write(p[:n])
+	d.written += int64(n)
+
+	if d.opts.Progress != nil {
+		d.opts.Progress(d.written, d.total)
+	}
+
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+// validatorOf returns the validator used by If-Range (the strong ETag or else the Last-Modified date)
+func validatorOf(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange parses "bytes <start>-<end>/<total>" (the total is -1 when it is "*")
+func parseContentRange(header string) (int64, int64, bool) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	bounds := strings.SplitN(parts[0], "-", 2)
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	if parts[1] == "*" {
+		return start, -1, true
+	}
+
+	total, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, total, true
+}
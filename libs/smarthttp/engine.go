@@ -0,0 +1,317 @@
+package smarthttp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+// CircuitBreakerEngine is the circuit breaker implementation used by CircuitBreaker.
+// This allows the underlying library to be replaced without changing the users of this package.
+type CircuitBreakerEngine interface {
+	// Configure is called during initialization for each circuit.
+	// It is called again with the new settings when the configuration is changed at runtime (see Client.UpdateConfig);
+	// the state of the circuit should be kept where possible.
+	Configure(name string, settings CircuitBreakerSettings)
+
+	// Do calls fn within the named circuit.
+	// When the circuit rejects the call it must return ErrCircuitIsOpen, ErrCircuitMaxConcurrencyReached or
+	// ErrCircuitTimeout; errors returned by fn are returned unchanged.
+	// When fn returns context.Canceled or context.DeadlineExceeded the caller gave up on the call: it must not be
+	// recorded as a success (nor, where the implementation allows, as a failure).
+	Do(name string, fn func() error) error
+
+	// IsOpen returns true when the named circuit is currently rejecting calls
+	IsOpen(name string) bool
+
+	// Stats returns a snapshot of the named circuit
+	Stats(name string) CircuitStats
+
+	// ForceOpen rejects all calls through the named circuit until ForceClose or Reset is called
+	ForceOpen(name string)
+
+	// ForceClose allows all calls through the named circuit until ForceOpen or Reset is called
+	ForceClose(name string)
+
+	// Reset removes any forced state and returns the named circuit to closed with no recorded errors
+	Reset(name string)
+}
+
+// CircuitBreakerSettings is the (resolved) configuration of a circuit that is passed to the CircuitBreakerEngine
+type CircuitBreakerSettings struct {
+	// Timeout is the maximum duration of a call
+	Timeout time.Duration
+
+	// MaxConcurrentRequests is the maximum number of concurrent calls
+	MaxConcurrentRequests int
+
+	// ErrorPercentThreshold is the percentage of failed calls that opens the circuit
+	ErrorPercentThreshold int
+
+	// SleepWindow is how long the circuit stays open before a call is allowed through to test the upstream
+	SleepWindow time.Duration
+
+	// RequestVolumeThreshold is the minimum number of calls before the error percentage is considered
+	RequestVolumeThreshold int
+
+	// OnStateChange (optionally) is called when the state of the circuit changes
+	OnStateChange func(name string, from, to State)
+}
+
+// State is the state of a circuit
+type State int
+
+const (
+	// StateClosed indicates that calls are allowed through the circuit
+	StateClosed State = iota
+
+	// StateHalfOpen indicates that a limited number of calls are allowed through the circuit to test the upstream
+	StateHalfOpen
+
+	// StateOpen indicates that calls are being rejected by the circuit
+	StateOpen
+)
+
+// String implements fmt.Stringer
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+
+	case StateHalfOpen:
+		return "half-open"
+
+	case StateOpen:
+		return "open"
+
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler (e.g. so that the state is reported by name by StatsHandler)
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// HystrixEngine is the CircuitBreakerEngine backed by github.com/afex/hystrix-go (default)
+type HystrixEngine struct {
+	mutex    sync.Mutex
+	circuits map[string]*hystrixCircuit
+}
+
+// hystrixCircuit tracks the state of a circuit; hystrix does not report state changes so they are inferred from the calls
+type hystrixCircuit struct {
+	circuitCounters
+
+	mutex    sync.Mutex
+	state    State
+	settings CircuitBreakerSettings
+}
+
+// Configure implements CircuitBreakerEngine.
+// When the circuit is reconfigured its state is kept; its max concurrent requests cannot be changed (hystrix sizes the
+// pool of a circuit once), see Client.UpdateConfig.
+func (h *HystrixEngine) Configure(name string, settings CircuitBreakerSettings) {
+	hystrix.ConfigureCommand(name, hystrix.CommandConfig{
+		Timeout:                int(settings.Timeout.Milliseconds()),
+		MaxConcurrentRequests:  settings.MaxConcurrentRequests,
+		ErrorPercentThreshold:  settings.ErrorPercentThreshold,
+		SleepWindow:            int(settings.SleepWindow.Milliseconds()),
+		RequestVolumeThreshold: settings.RequestVolumeThreshold,
+	})
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.circuits == nil {
+		h.circuits = map[string]*hystrixCircuit{}
+	}
+
+	// hystrix keeps the state of the circuit when it is reconfigured; so do we
+	if circuit, ok := h.circuits[name]; ok {
+		circuit.mutex.Lock()
+		circuit.settings = settings
+		circuit.mutex.Unlock()
+
+		return
+	}
+
+	h.circuits[name] = &hystrixCircuit{
+		state:    StateClosed,
+		settings: settings,
+	}
+}
+
+// Do implements CircuitBreakerEngine
+func (h *HystrixEngine) Do(name string, fn func() error) error {
+	circuit := h.getCircuit(name)
+
+	switch circuit.getOverride() {
+	case overrideOpen:
+		return ErrCircuitIsOpen
+
+	case overrideClosed:
+		err := circuit.call(fn)
+		circuit.record(err)
+
+		return err
+	}
+
+	// hystrix records context.Canceled and context.DeadlineExceeded as neither a success nor a failure
+	err := hystrix.Do(name, func() error {
+		// hystrix only lets calls through an open circuit to test whether it can be closed
+		circuit.transition(name, StateOpen, StateHalfOpen)
+
+		return circuit.call(fn)
+	}, nil)
+
+	circuit.record(err)
+
+	if circuit.getOverride() == overrideNone {
+		if h.IsOpen(name) {
+			circuit.set(name, StateOpen)
+		} else {
+			circuit.set(name, StateClosed)
+		}
+	}
+
+	switch err {
+	case hystrix.ErrCircuitOpen:
+		return ErrCircuitIsOpen
+
+	case hystrix.ErrMaxConcurrency:
+		return ErrCircuitMaxConcurrencyReached
+
+	case hystrix.ErrTimeout:
+		return ErrCircuitTimeout
+
+	default:
+		return err
+	}
+}
+
+// IsOpen implements CircuitBreakerEngine
+func (h *HystrixEngine) IsOpen(name string) bool {
+	switch h.getCircuit(name).getOverride() {
+	case overrideOpen:
+		return true
+
+	case overrideClosed:
+		return false
+	}
+
+	circuit, _, err := hystrix.GetCircuit(name)
+	if err != nil {
+		return false
+	}
+
+	return circuit.IsOpen()
+}
+
+// Stats implements CircuitBreakerEngine
+func (h *HystrixEngine) Stats(name string) CircuitStats {
+	circuit := h.getCircuit(name)
+
+	circuit.mutex.Lock()
+	state := circuit.state
+	settings := circuit.settings
+	circuit.mutex.Unlock()
+
+	return circuit.stats(name, state, settings)
+}
+
+// ForceOpen implements CircuitBreakerEngine
+func (h *HystrixEngine) ForceOpen(name string) {
+	circuit := h.getCircuit(name)
+
+	circuit.setOverride(overrideOpen)
+	circuit.set(name, StateOpen)
+}
+
+// ForceClose implements CircuitBreakerEngine
+func (h *HystrixEngine) ForceClose(name string) {
+	circuit := h.getCircuit(name)
+
+	circuit.setOverride(overrideClosed)
+	circuit.set(name, StateClosed)
+}
+
+// Reset implements CircuitBreakerEngine
+func (h *HystrixEngine) Reset(name string) {
+	circuit := h.getCircuit(name)
+
+	circuit.reset()
+
+	// hystrix closes an open circuit (and clears its metrics) when it sees a success
+	hystrixCircuit, _, err := hystrix.GetCircuit(name)
+	if err == nil && hystrixCircuit.IsOpen() {
+		_ = hystrixCircuit.ReportEvent([]string{"success"}, time.Now(), 0)
+	}
+
+	circuit.set(name, StateClosed)
+}
+
+func (h *HystrixEngine) getCircuit(name string) *hystrixCircuit {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	circuit, ok := h.circuits[name]
+	if !ok {
+		// not configured; track the state without reporting it
+		circuit = &hystrixCircuit{}
+
+		if h.circuits == nil {
+			h.circuits = map[string]*hystrixCircuit{}
+		}
+
+		h.circuits[name] = circuit
+	}
+
+	return circuit
+}
+
+// transition changes the state only when the circuit is currently in the from state
+func (c *hystrixCircuit) transition(name string, from, to State) {
+	c.mutex.Lock()
+
+	if c.state != from {
+		c.mutex.Unlock()
+
+		return
+	}
+
+	c.state = to
+	c.mutex.Unlock()
+
+	c.notify(name, from, to)
+}
+
+func (c *hystrixCircuit) set(name string, to State) {
+	c.mutex.Lock()
+
+	from := c.state
+	c.state = to
+	c.mutex.Unlock()
+
+	if from != to {
+		c.notify(name, from, to)
+	}
+}
+
+func (c *hystrixCircuit) notify(name string, from, to State) {
+	c.mutex.Lock()
+	onStateChange := c.settings.OnStateChange
+	c.mutex.Unlock()
+
+	if onStateChange != nil {
+		onStateChange(name, from, to)
+	}
+}
+
+// isCallerGaveUp returns true when fn reported that the caller gave up on the call (see CircuitBreakerEngine.Do)
+func isCallerGaveUp(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
@@ -0,0 +1,305 @@
+package smarthttp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// the length of the rolling window in which calls are counted (matches hystrix)
+const goBreakerInterval = 10 * time.Second
+
+// GoBreakerEngine is the CircuitBreakerEngine backed by github.com/sony/gobreaker
+type GoBreakerEngine struct {
+	mutex    sync.RWMutex
+	circuits map[string]*goBreakerCircuit
+}
+
+type goBreakerCircuit struct {
+	circuitCounters
+
+	name string
+
+	// guards settings, semaphore and breaker (which are replaced when the circuit is reconfigured)
+	configMutex sync.RWMutex
+	settings    CircuitBreakerSettings
+	semaphore   chan struct{}
+	breaker     *gobreaker.TwoStepCircuitBreaker
+}
+
+// Configure implements CircuitBreakerEngine.
+// When the circuit is reconfigured its state is kept, unless the sleep window changes (gobreaker cannot change the
+// timeout of an existing breaker so the circuit is replaced with a new, closed, circuit).
+func (g *GoBreakerEngine) Configure(name string, settings CircuitBreakerSettings) {
+	if circuit := g.getCircuit(name); circuit != nil {
+		circuit.reconfigure(settings)
+
+		return
+	}
+
+	circuit := &goBreakerCircuit{
+		name:      name,
+		settings:  settings,
+		semaphore: make(chan struct{}, settings.MaxConcurrentRequests),
+	}
+
+	circuit.breaker = circuit.newBreaker()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.circuits == nil {
+		g.circuits = map[string]*goBreakerCircuit{}
+	}
+
+	g.circuits[name] = circuit
+}
+
+// Do implements CircuitBreakerEngine
+func (g *GoBreakerEngine) Do(name string, fn func() error) error {
+	circuit := g.getCircuit(name)
+	if circuit == nil {
+		return fn()
+	}
+
+	switch circuit.getOverride() {
+	case overrideOpen:
+		return ErrCircuitIsOpen
+
+	case overrideClosed:
+		err := circuit.call(fn)
+		circuit.record(err)
+
+		return err
+	}
+
+	err := circuit.do(fn)
+	circuit.record(err)
+
+	return err
+}
+
+func (c *goBreakerCircuit) do(fn func() error) error {
+	c.configMutex.RLock()
+	semaphore := c.semaphore
+	c.configMutex.RUnlock()
+
+	select {
+	case semaphore <- struct{}{}:
+		defer func() {
+			<-semaphore
+		}()
+
+	default:
+		return ErrCircuitMaxConcurrencyReached
+	}
+
+	breaker := c.getBreaker()
+
+	// the outcome is reported separately so that calls the caller gave up on can be left out
+	done, err := breaker.Allow()
+	if err != nil {
+		// gobreaker.ErrOpenState or gobreaker.ErrTooManyRequests (half-open)
+		return ErrCircuitIsOpen
+	}
+
+	err = c.callWithTimeout(fn)
+
+	switch {
+	case !isCallerGaveUp(err):
+		done(err == nil)
+
+	case breaker.State() == gobreaker.StateHalfOpen:
+		// gobreaker has no neutral outcome and a half-open circuit waits for the outcome of the call it allowed; an
+		// abandoned test must not close the circuit, so it is reported as a failure
+		done(false)
+
+	default:
+		// not reported; the call only counts towards the request volume of the current interval
+	}
+
+	return err
+}
+
+// IsOpen implements CircuitBreakerEngine
+func (g *GoBreakerEngine) IsOpen(name string) bool {
+	circuit := g.getCircuit(name)
+	if circuit == nil {
+		return false
+	}
+
+	return circuit.state() == StateOpen
+}
+
+// Stats implements CircuitBreakerEngine
+func (g *GoBreakerEngine) Stats(name string) CircuitStats {
+	circuit := g.getCircuit(name)
+	if circuit == nil {
+		return CircuitStats{Name: name}
+	}
+
+	return circuit.stats(name, circuit.state(), circuit.getSettings())
+}
+
+// ForceOpen implements CircuitBreakerEngine
+func (g *GoBreakerEngine) ForceOpen(name string) {
+	circuit := g.getCircuit(name)
+	if circuit == nil {
+		return
+	}
+
+	from := circuit.state()
+	circuit.setOverride(overrideOpen)
+	circuit.notify(from, StateOpen)
+}
+
+// ForceClose implements CircuitBreakerEngine
+func (g *GoBreakerEngine) ForceClose(name string) {
+	circuit := g.getCircuit(name)
+	if circuit == nil {
+		return
+	}
+
+	from := circuit.state()
+	circuit.setOverride(overrideClosed)
+	circuit.notify(from, StateClosed)
+}
+
+// Reset implements CircuitBreakerEngine
+func (g *GoBreakerEngine) Reset(name string) {
+	circuit := g.getCircuit(name)
+	if circuit == nil {
+		return
+	}
+
+	from := circuit.state()
+
+	circuit.reset()
+
+	// gobreaker cannot be reset; replace it with a new (closed) breaker
+	circuit.configMutex.Lock()
+	circuit.breaker = circuit.newBreaker()
+	circuit.configMutex.Unlock()
+
+	circuit.notify(from, StateClosed)
+}
+
+func (g *GoBreakerEngine) getCircuit(name string) *goBreakerCircuit {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.circuits[name]
+}
+
+// reconfigure applies new settings to the circuit (keeping its state where possible)
+func (c *goBreakerCircuit) reconfigure(settings CircuitBreakerSettings) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+
+	previous := c.settings
+	c.settings = settings
+
+	if settings.MaxConcurrentRequests != previous.MaxConcurrentRequests {
+		// requests in-flight release the slot of the semaphore they acquired
+		c.semaphore = make(chan struct{}, settings.MaxConcurrentRequests)
+	}
+
+	if settings.SleepWindow != previous.SleepWindow {
+		c.breaker = c.newBreaker()
+	}
+}
+
+// newBreaker returns a new breaker (the caller must hold the configMutex or be the only user of the circuit)
+func (c *goBreakerCircuit) newBreaker() *gobreaker.TwoStepCircuitBreaker {
+	return gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:     c.name,
+		Interval: goBreakerInterval,
+		Timeout:  c.settings.SleepWindow,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			// the thresholds are read on each call so that they can be changed without losing the state of the breaker
+			settings := c.getSettings()
+
+			if counts.Requests < uint32(settings.RequestVolumeThreshold) {
+				return false
+			}
+
+			return counts.TotalFailures*100 >= counts.Requests*uint32(settings.ErrorPercentThreshold)
+		},
+		OnStateChange: func(_ string, from, to gobreaker.State) {
+			if c.getOverride() == overrideNone {
+				c.notify(fromGoBreakerState(from), fromGoBreakerState(to))
+			}
+		},
+	})
+}
+
+func (c *goBreakerCircuit) getBreaker() *gobreaker.TwoStepCircuitBreaker {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	return c.breaker
+}
+
+func (c *goBreakerCircuit) getSettings() CircuitBreakerSettings {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	return c.settings
+}
+
+// state returns the current state of the circuit (including any forced state)
+func (c *goBreakerCircuit) state() State {
+	switch c.getOverride() {
+	case overrideOpen:
+		return StateOpen
+
+	case overrideClosed:
+		return StateClosed
+
+	default:
+		return fromGoBreakerState(c.getBreaker().State())
+	}
+}
+
+func (c *goBreakerCircuit) notify(from, to State) {
+	onStateChange := c.getSettings().OnStateChange
+
+	if from != to && onStateChange != nil {
+		onStateChange(c.name, from, to)
+	}
+}
+
+// callWithTimeout enforces the circuit timeout (like hystrix, the call is abandoned rather than cancelled)
+func (c *goBreakerCircuit) callWithTimeout(fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.getSettings().Timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- c.call(fn)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+
+	case <-ctx.Done():
+		return ErrCircuitTimeout
+	}
+}
+
+func fromGoBreakerState(state gobreaker.State) State {
+	switch state {
+	case gobreaker.StateOpen:
+		return StateOpen
+
+	case gobreaker.StateHalfOpen:
+		return StateHalfOpen
+
+	default:
+		return StateClosed
+	}
+}
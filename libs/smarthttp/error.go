@@ -0,0 +1,159 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Error is the error returned by Client.Do (and the helpers built on it) when a request fails.
+// It carries the details of the request that are useful when logging or deciding how to handle the failure; the cause
+// can be inspected with errors.Is/errors.As (e.g. errors.Is(err, ErrTimeout)).
+type Error struct {
+	// Endpoint is the endpoint tag of the request (i.e. method and sanitized path)
+	Endpoint string
+
+	// Attempts is the number of attempts made (1 when retries are disabled)
+	Attempts int
+
+	// StatusCode is the HTTP status code of the last response received (0 when no response was received)
+	StatusCode int
+
+	// CircuitOpen is true when the request was rejected by an open circuit
+	CircuitOpen bool
+
+	// Elapsed is the total time taken by the request (including retries)
+	Elapsed time.Duration
+
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s failed after %d attempt(s) in %s: %s", e.Endpoint, e.Attempts, e.Elapsed, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(endpointTag string, start time.Time, resp *http.Response, err error) *Error {
+	out := &Error{
+		Endpoint:    endpointTag,
+		Attempts:    1,
+		CircuitOpen: errors.Is(err, ErrCircuitIsOpen),
+		Elapsed:     time.Since(start),
+		Err:         err,
+	}
+
+	var attemptsErr *AttemptsError
+	if errors.As(err, &attemptsErr) {
+		out.Attempts = attemptsErr.Attempts
+		out.StatusCode = attemptsErr.StatusCode
+	}
+
+	if resp != nil {
+		out.StatusCode = resp.StatusCode
+	}
+
+	return out
+}
+
+// IsTimeout returns true when the error (or any error it wraps) is a timeout; this includes connection timeouts, request
+// timeouts and expired context deadlines.
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrConnectTimeout) || errors.Is(err, ErrCircuitTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsCircuitOpen returns true when the error (or any error it wraps) indicates that the request was rejected by an open
+// circuit
+func IsCircuitOpen(err error) bool {
+	return errors.Is(err, ErrCircuitIsOpen)
+}
+
+// IsCanceled returns true when the error (or any error it wraps) indicates that the caller cancelled the request
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// IsRetryable returns true when the error indicates a transient failure that is likely to succeed when tried again
+// later (e.g. an open circuit, client-side throttling, a 408/429/5xx response or an error of one of the default
+// Retries.RetriableErrorClasses, i.e. a timeout or a connection reset).
+// Requests cancelled by the caller are not retryable.  Use Client.IsRetryable for the error classes configured for a
+// client.
+func IsRetryable(err error) bool {
+	return isRetryable(err, defaultRetriableClassSet)
+}
+
+// IsRetryable returns true when the error indicates a transient failure (see IsRetryable) using the error classes that
+// are retried by the client (see Retries.RetriableErrorClasses)
+func (c *Client) IsRetryable(err error) bool {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	classes := defaultRetriableClassSet
+	if retries := c.getRetries(); retries != nil {
+		classes = retries.retriableClasses
+	}
+
+	return isRetryable(err, classes)
+}
+
+// isRetryable returns true when the error indicates a transient failure; errors are classified with ClassifyError (as
+// they are by the retries)
+func isRetryable(err error, classes map[ErrorClass]struct{}) bool {
+	switch {
+	case err == nil, IsCanceled(err):
+		return false
+
+	case IsCircuitOpen(err), isRetriableResponseError(err),
+		errors.Is(err, ErrCircuitTimeout),
+		errors.Is(err, ErrCircuitMaxConcurrencyReached),
+		errors.Is(err, ErrBulkheadFull),
+		errors.Is(err, ErrConcurrencyLimitExceeded),
+		errors.Is(err, ErrRateLimited):
+		return true
+	}
+
+	if _, retriable := classes[ClassifyError(err)]; retriable {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatusCode(apiErr.StatusCode)
+	}
+
+	var smartErr *Error
+	if errors.As(err, &smartErr) && smartErr.StatusCode != 0 {
+		return isRetryableStatusCode(smartErr.StatusCode)
+	}
+
+	return false
+}
+
+func isRetryableStatusCode(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+
+	default:
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrorClass is the class of the error of a request (see ClassifyError), e.g. to bucket the durations of the failed
+// requests (see Instrumentation.BaseDoErrDuration)
+type ErrorClass string
+
+const (
+	// ErrorClassNone is the class of a nil error
+	ErrorClassNone ErrorClass = ""
+
+	// ErrorClassConnectTimeout is the class of the errors caused by a connection that could not be established in time
+	ErrorClassConnectTimeout ErrorClass = "connect_timeout"
+
+	// ErrorClassReadTimeout is the class of the other timeouts (e.g. waiting for the response or reading it)
+	ErrorClassReadTimeout ErrorClass = "read_timeout"
+
+	// ErrorClassCanceled is the class of the errors caused by the caller cancelling the request
+	ErrorClassCanceled ErrorClass = "canceled"
+
+	// ErrorClassConnect is the class of the errors caused by a connection that could not be established
+	ErrorClassConnect ErrorClass = "connect"
+
+	// ErrorClassDNSTemporary is the class of the temporary DNS failures (e.g. a DNS server that failed or timed out), which
+	// are likely to succeed when tried again
+	ErrorClassDNSTemporary ErrorClass = "dns_temporary"
+
+	// ErrorClassDNS is the class of the other DNS failures (e.g. a host that does not exist)
+	ErrorClassDNS ErrorClass = "dns"
+
+	// ErrorClassProxy is the class of the errors caused by a connection through the proxy (see Client.ProxyURL) that
+	// could not be established, e.g. an unreachable proxy or a proxy that refused the CONNECT (or SOCKS) request
+	ErrorClassProxy ErrorClass = "proxy"
+
+	// ErrorClassInvalidResponse is the class of the errors caused by a response that was rejected by
+	// Client.ValidateResponse
+	ErrorClassInvalidResponse ErrorClass = "invalid_response"
+
+	// ErrorClassReset is the class of the errors caused by a connection that was reset or closed by the upstream (or a
+	// load balancer in front of it) before the response was received, i.e. ECONNRESET, EPIPE (broken pipe), an
+	// unexpected EOF and an EOF returned by the transport
+	ErrorClassReset ErrorClass = "reset"
+
+	// ErrorClassOther is the class of the other errors
+	ErrorClassOther ErrorClass = "other"
+)
+
+// ClassifyError returns the class of the error
+func ClassifyError(err error) ErrorClass {
+	var (
+		netErr net.Error
+		dnsErr *net.DNSError
+	)
+
+	switch {
+	case err == nil:
+		return ErrorClassNone
+
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+
+	case isProxyError(err):
+		return ErrorClassProxy
+
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTemporary || dnsErr.IsTimeout {
+			return ErrorClassDNSTemporary
+		}
+
+		return ErrorClassDNS
+
+	case errors.Is(err, ErrConnectTimeout):
+		return ErrorClassConnectTimeout
+
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassReadTimeout
+
+	case errors.Is(err, ErrConnection):
+		return ErrorClassConnect
+
+	case isResetError(err):
+		return ErrorClassReset
+
+	case errors.Is(err, ErrInvalidResponse):
+		return ErrorClassInvalidResponse
+
+	default:
+		return ErrorClassOther
+	}
+}
+
+// isProxyError returns true when the error (or any error it wraps) was returned by http.Transport (or the SOCKS
+// dialer) for a connection through a proxy that could not be established
+func isProxyError(err error) bool {
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) && (opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks "))
+}
+
+// isResetError returns true when the error (or any error it wraps) indicates that the connection was reset or closed
+// by the other side.
+// io.EOF is only a reset when it was returned by the transport (i.e. wrapped by a *url.Error or *net.OpError); a bare
+// io.EOF is the normal end of a body.
+func isResetError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var (
+		urlErr *url.Error
+		opErr  *net.OpError
+	)
+
+	return errors.Is(err, io.EOF) && (errors.As(err, &urlErr) || errors.As(err, &opErr))
+}
+
+// StatusClass returns the class of the status code (e.g. "2xx" or "5xx"), or "" when it is not a valid status code
+// (e.g. 0 when no response was received)
+func StatusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return ""
+	}
+
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// dialError is an error of the dialer (ErrConnectTimeout or ErrConnection) that keeps its cause (e.g. a *net.DNSError)
+// so that it can be classified (see ClassifyError)
+type dialError struct {
+	kind error
+	err  error
+}
+
+// newDialError returns an error that wraps the kind (ErrConnectTimeout or ErrConnection) and the cause
+func newDialError(kind, err error) error {
+	return &dialError{kind: kind, err: err}
+}
+
+// Error implements error
+func (e *dialError) Error() string {
+	return e.kind.Error() + " " + e.err.Error()
+}
+
+// Is supports errors.Is for the kind of the error
+func (e *dialError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unwrap supports errors.Is and errors.As for the cause of the error
+func (e *dialError) Unwrap() error {
+	return e.err
+}
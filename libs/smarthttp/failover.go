@@ -0,0 +1,212 @@
+package smarthttp
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailoverConnectionErrors = 5
+	defaultFailoverDuration         = 30 * time.Second
+
+	// the reasons passed to Instrumentation.FailoverSent
+	failoverReasonCircuitOpen      = "circuitOpen"
+	failoverReasonConnectionErrors = "connectionErrors"
+)
+
+// Failover defines the failover configuration: requests are sent to a secondary URL (e.g. a read replica or another
+// region) when the primary cannot be used, i.e.:
+//
+//   - when the circuit of the client is open, or
+//   - once ConnectionErrors consecutive requests have failed to connect to the primary, in which case requests are sent
+//     to the secondary for Duration before the primary is tried again.
+//
+// The scheme and host of the request URL are replaced with those of the URL (and its path, if any, is prepended to the
+// path of the request).  Requests sent to the secondary are retried (see Retries) but are not tracked by the circuit.
+type Failover struct {
+	// URL is the base URL of the secondary, e.g. "https://payments.eu-west-1.example.com"
+	URL string
+
+	// ConnectionErrors is the number of consecutive connection errors that fails over to the secondary (default: 5)
+	ConnectionErrors int
+
+	// Duration is how long requests are sent to the secondary after the connection errors (default: 30s)
+	Duration time.Duration
+
+	secondary        *url.URL
+	connectionErrors int
+	duration         time.Duration
+	instrumentation  Instrumentation
+
+	mutex             sync.Mutex
+	consecutiveErrors int
+	failoverUntil     time.Time
+}
+
+// buildMiddleware returns the middleware that fails over; secondary is the request chain (without the circuit) used to
+// send requests to the secondary
+func (f *Failover) buildMiddleware(doFunc requestClosure, secondary requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		if f.active() {
+			return f.send(secondary, req, failoverReasonConnectionErrors)
+		}
+
+		resp, err := doFunc(req)
+
+		switch {
+		case errors.Is(err, ErrCircuitIsOpen):
+			return f.send(secondary, req, failoverReasonCircuitOpen)
+
+		case errors.Is(err, ErrConnection) || errors.Is(err, ErrConnectTimeout):
+			// the request was not received by the primary so it can be sent to the secondary
+			if f.recordConnectionError() && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+				return f.send(secondary, req, failoverReasonConnectionErrors)
+			}
+
+		case err == nil:
+			f.recordSuccess()
+		}
+
+		return resp, err
+	}
+}
+
+// send sends the request to the secondary
+func (f *Failover) send(doFunc requestClosure, req *http.Request, reason string) (*http.Response, error) {
+	req = req.Clone(withFailover(req.Context()))
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = body
+	}
+
+	req.URL.Scheme = f.secondary.Scheme
+	req.URL.Host = f.secondary.Host
+	req.Host = f.secondary.Host
+
+	if prefix := strings.TrimSuffix(f.secondary.Path, "/"); prefix != "" {
+		req.URL.Path = prefix + req.URL.Path
+
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = strings.TrimSuffix(f.secondary.EscapedPath(), "/") + req.URL.RawPath
+		}
+	}
+
+	f.instrumentation.FailoverSent(req, reason)
+
+	return doFunc(req)
+}
+
+// active returns true while requests are failed over because of connection errors
+func (f *Failover) active() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return time.Now().Before(f.failoverUntil)
+}
+
+// recordConnectionError records a connection error and returns true when the threshold is reached
+func (f *Failover) recordConnectionError() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.consecutiveErrors++
+
+	if f.consecutiveErrors < f.connectionErrors {
+		return false
+	}
+
+	f.consecutiveErrors = 0
+	f.failoverUntil = time.Now().Add(f.duration)
+
+	return true
+}
+
+func (f *Failover) recordSuccess() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.consecutiveErrors = 0
+}
+
+func (f *Failover) validate() error {
+	parsed, err := url.Parse(f.URL)
+
+	switch {
+	case err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https"):
+		return errors.New("failover URL must be an absolute http or https URL")
+
+	case f.ConnectionErrors < 0 || f.Duration < 0:
+		return errors.New("failover connection errors and duration cannot be negative")
+	}
+
+	return nil
+}
+
+func (f *Failover) getConnectionErrors() int {
+	if f.ConnectionErrors > 0 {
+		return f.ConnectionErrors
+	}
+
+	f.instrumentation.InitWarning("using default 'connection errors' setting for failover")
+
+	return defaultFailoverConnectionErrors
+}
+
+func (f *Failover) getDuration() time.Duration {
+	if f.Duration > 0 {
+		return f.Duration
+	}
+
+	f.instrumentation.InitWarning("using default 'duration' setting for failover")
+
+	return defaultFailoverDuration
+}
+
+func (f *Failover) addMiddleware(doFunc requestClosure, secondary requestClosure) requestClosure {
+	if f == nil || f.secondary == nil {
+		return doFunc
+	}
+
+	return f.buildMiddleware(doFunc, secondary)
+}
+
+func (f *Failover) doInitOnce(instrumentation Instrumentation) {
+	if f == nil {
+		return
+	}
+
+	f.instrumentation = instrumentation
+
+	secondary, err := url.Parse(f.URL)
+	if err != nil || secondary.Host == "" {
+		instrumentation.InitWarning("invalid failover URL.  Failover is disabled")
+
+		return
+	}
+
+	f.secondary = secondary
+	f.connectionErrors = f.getConnectionErrors()
+	f.duration = f.getDuration()
+}
+
+// clone returns a copy of the configuration (without the state) for a variant of the client (see Client.Clone)
+func (f *Failover) clone() *Failover {
+	if f == nil {
+		return nil
+	}
+
+	return &Failover{
+		URL:              f.URL,
+		ConnectionErrors: f.ConnectionErrors,
+		Duration:         f.Duration,
+	}
+}
@@ -4,9 +4,16 @@ go 1.14
 
 require (
 	github.com/afex/hystrix-go v0.0.0-20180502004556-fa1af6a1f4f5
-	github.com/corsc/go-commons v1.1.0
+	github.com/andybalholm/brotli v1.0.4
+	github.com/golang-jwt/jwt/v4 v4.5.2
+	github.com/karelrenaldi/storemono/libs/config v0.0.0
 	github.com/kr/pretty v0.1.0 // indirect
+	github.com/sony/gobreaker v0.5.0
 	github.com/stretchr/testify v1.5.1 // indirect
+	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
+
+replace github.com/karelrenaldi/storemono/libs/config v0.0.0 => ../config
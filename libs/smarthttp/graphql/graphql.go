@@ -0,0 +1,271 @@
+// Package graphql provides a GraphQL client on top of a smarthttp client.
+//
+// Queries and mutations are POSTed as JSON; the data is decoded into the supplied struct and the errors are returned
+// as Errors:
+//
+//	client := graphql.NewClient(httpClient, "https://vendor.example.com/graphql")
+//
+//	var data struct {
+//		Product struct {
+//			ID    string `json:"id"`
+//			Title string `json:"title"`
+//		} `json:"product"`
+//	}
+//
+//	err := client.Query(ctx, `query ($id: ID!) { product(id: $id) { id title } }`, map[string]interface{}{"id": id}, &data)
+//
+// GraphQL servers usually respond with 200 OK even when the operation failed, so IsRetriable classifies the errors in
+// the body for the retry middleware:
+//
+//	httpClient.Retries.IsRetriable = graphql.IsRetriable
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+// the maximum number of bytes of a response body that IsRetriable reads to classify the errors
+const maxPeekSize = 1 << 20
+
+// the error codes (in the "code" extension) that are retriable
+var retriableCodes = map[string]struct{}{
+	"INTERNAL_SERVER_ERROR": {},
+	"SERVICE_UNAVAILABLE":   {},
+	"UNAVAILABLE":           {},
+	"TIMEOUT":               {},
+	"GATEWAY_TIMEOUT":       {},
+	"DEADLINE_EXCEEDED":     {},
+}
+
+// Request is a GraphQL operation
+type Request struct {
+	// Query is the query (or mutation) document
+	Query string `json:"query"`
+
+	// Variables (optionally) are the variables of the operation
+	Variables map[string]interface{} `json:"variables,omitempty"`
+
+	// OperationName (optionally) selects the operation when the document has several
+	OperationName string `json:"operationName,omitempty"`
+}
+
+// Location is a location in the query document
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is an error reported by the GraphQL server
+type Error struct {
+	// Message is the description of the error
+	Message string `json:"message"`
+
+	// Locations (optionally) are the locations in the query document that caused the error
+	Locations []Location `json:"locations,omitempty"`
+
+	// Path (optionally) is the path of the response field that failed
+	Path []interface{} `json:"path,omitempty"`
+
+	// Extensions (optionally) are the server specific details of the error (e.g. "code")
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if code := e.Code(); code != "" {
+		return fmt.Sprintf("graphql: %s (%s)", e.Message, code)
+	}
+
+	return "graphql: " + e.Message
+}
+
+// Code returns the error code (the "code" extension, e.g. "BAD_USER_INPUT"), or "" when there is none
+func (e *Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+
+	return code
+}
+
+// Retriable returns true when the error is transient (i.e. the server reported it as an internal error, as unavailable
+// or as a timeout)
+func (e *Error) Retriable() bool {
+	_, ok := retriableCodes[strings.ToUpper(e.Code())]
+
+	return ok
+}
+
+// Errors are the errors of a response.  The data of the response (when any) is still decoded, as the errors may only
+// apply to some of the fields.
+type Errors []*Error
+
+// Error implements error
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "graphql: no errors"
+
+	case 1:
+		return e[0].Error()
+
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", e[0].Error(), len(e)-1)
+	}
+}
+
+// Retriable returns true when every one of the errors is retriable (see Error.Retriable)
+func (e Errors) Retriable() bool {
+	if len(e) == 0 {
+		return false
+	}
+
+	for _, err := range e {
+		if !err.Retriable() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Client sends GraphQL operations with a smarthttp client
+type Client struct {
+	// HTTP is the client that sends the requests
+	HTTP *smarthttp.Client
+
+	// URL is the URL of the GraphQL endpoint
+	URL string
+
+	// Header (optionally) is added to every request
+	Header http.Header
+}
+
+// NewClient returns a GraphQL client for the endpoint
+func NewClient(httpClient *smarthttp.Client, url string) *Client {
+	return &Client{
+		HTTP: httpClient,
+		URL:  url,
+	}
+}
+
+// Query sends the query and decodes its data into target (which can be nil to ignore the data).
+// Queries do not change data, so they are retried (see smarthttp.Retries) even though they are POSTs.
+func (c *Client) Query(ctx context.Context, query string, variables map[string]interface{}, target interface{}) error {
+	return c.Do(smarthttp.WithNonIdempotentRetries(ctx), &Request{Query: query, Variables: variables}, target)
+}
+
+// Mutate sends the mutation and decodes its data into target (which can be nil to ignore the data).
+// Mutations are not retried unless the context allows it (see smarthttp.WithNonIdempotentRetries).
+func (c *Client) Mutate(ctx context.Context, mutation string, variables map[string]interface{}, target interface{}) error {
+	return c.Do(ctx, &Request{Query: mutation, Variables: variables}, target)
+}
+
+// Do sends the operation and decodes its data into target (which can be nil to ignore the data).
+// Errors reported by the server are returned as Errors; non-2xx responses are returned as a *smarthttp.APIError.
+func (c *Client) Do(ctx context.Context, operation *Request, target interface{}) error {
+	payload, err := json.Marshal(operation)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range c.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := &response{}
+
+	err = c.HTTP.DoJSON(req, resp)
+	if err != nil {
+		return err
+	}
+
+	if target != nil && len(resp.Data) > 0 && !bytes.Equal(resp.Data, []byte("null")) {
+		err = json.Unmarshal(resp.Data, target)
+		if err != nil {
+			return fmt.Errorf("failed to decode data: %w", err)
+		}
+	}
+
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+
+	return nil
+}
+
+// response is the body of a GraphQL response
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
+// IsRetriable classifies the result of an attempt for the retry middleware (see smarthttp.Retries.IsRetriable).
+// Timeouts and 408, 429, 500, 503 and 504 responses are retriable (429 and 503 honor Retry-After), as are 200 responses
+// whose errors are all retriable (see Errors.Retriable).  The body of the response is left intact.
+func IsRetriable(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, smarthttp.ErrTimeout)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+
+	case http.StatusOK:
+		return peekErrors(resp).Retriable()
+
+	default:
+		return false
+	}
+}
+
+// peekErrors returns the errors of the response, restoring the body so that it can still be read by the caller
+func peekErrors(resp *http.Response) Errors {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+
+	peeked, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPeekSize))
+
+	resp.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(peeked), resp.Body),
+		Closer: resp.Body,
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	body := &struct {
+		Errors Errors `json:"errors"`
+	}{}
+
+	if json.Unmarshal(peeked, body) != nil {
+		return nil
+	}
+
+	return body.Errors
+}
+
+// peekedBody is a response body whose start has been read
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
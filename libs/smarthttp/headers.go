@@ -0,0 +1,51 @@
+package smarthttp
+
+import (
+	"net/http"
+)
+
+// Version is the version of this package (reported in the User-Agent header)
+const Version = "1.0.0"
+
+// userAgent returns the User-Agent for requests made by this client (e.g. "shop-service smarthttp/1.0.0")
+func (c *Client) userAgent() string {
+	product := "smarthttp/" + Version
+
+	if c.UserAgent == "" {
+		return product
+	}
+
+	return c.UserAgent + " " + product
+}
+
+// applyDefaultHeaders returns the request with the default headers and User-Agent applied.
+// Headers already set on the request take precedence.  The request is copied (rather than modified) when required.
+func (c *Client) applyDefaultHeaders(req *http.Request) *http.Request {
+	missing := req.Header.Get("User-Agent") == ""
+
+	for name := range c.DefaultHeaders {
+		if req.Header.Get(name) == "" {
+			missing = true
+		}
+	}
+
+	if !missing {
+		return req
+	}
+
+	req = req.Clone(req.Context())
+
+	for name, values := range c.DefaultHeaders {
+		if req.Header.Get(name) == "" {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent())
+	}
+
+	return req
+}
@@ -0,0 +1,205 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval           = 10 * time.Second
+	defaultHealthCheckTimeout            = 2 * time.Second
+	defaultHealthCheckUnhealthyThreshold = 2
+	defaultHealthCheckHealthyThreshold   = 2
+)
+
+// HealthCheck defines the active health checking of the targets of the LoadBalancer.
+// Each target is polled (with a GET of Path) every Interval; a response with a status code between 200 and 399 is a
+// success.  A target that fails UnhealthyThreshold consecutive checks is ejected (until it recovers) and an ejected
+// target (including one ejected by the passive checks of the LoadBalancer) is re-admitted once it passes
+// HealthyThreshold consecutive checks.
+type HealthCheck struct {
+	// Path is the path that is polled, e.g. "/healthz"
+	Path string
+
+	// Scheme is the scheme used to poll the targets (default: http)
+	Scheme string
+
+	// Interval is the time between checks of each target (default: 10s)
+	Interval time.Duration
+
+	// Timeout is the timeout of each check (default: 2s)
+	Timeout time.Duration
+
+	// UnhealthyThreshold is the number of consecutive failed checks that ejects a target (default: 2)
+	UnhealthyThreshold int
+
+	// HealthyThreshold is the number of consecutive successful checks that re-admits a target (default: 2)
+	HealthyThreshold int
+}
+
+func (h *HealthCheck) validate() error {
+	switch {
+	case !strings.HasPrefix(h.Path, "/"):
+		return errors.New("health check path must start with '/'")
+
+	case h.Interval < 0 || h.Timeout < 0 || h.UnhealthyThreshold < 0 || h.HealthyThreshold < 0:
+		return errors.New("health check settings cannot be negative")
+	}
+
+	return nil
+}
+
+func (h *HealthCheck) getScheme() string {
+	if h.Scheme != "" {
+		return h.Scheme
+	}
+
+	return "http"
+}
+
+func (h *HealthCheck) getInterval() time.Duration {
+	if h.Interval > 0 {
+		return h.Interval
+	}
+
+	return defaultHealthCheckInterval
+}
+
+func (h *HealthCheck) getTimeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+
+	return defaultHealthCheckTimeout
+}
+
+func (h *HealthCheck) getUnhealthyThreshold() int {
+	if h.UnhealthyThreshold > 0 {
+		return h.UnhealthyThreshold
+	}
+
+	return defaultHealthCheckUnhealthyThreshold
+}
+
+func (h *HealthCheck) getHealthyThreshold() int {
+	if h.HealthyThreshold > 0 {
+		return h.HealthyThreshold
+	}
+
+	return defaultHealthCheckHealthyThreshold
+}
+
+// check polls the target and returns an error when it is unhealthy
+func (h *HealthCheck) check(client *http.Client, host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.getTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.getScheme()+"://"+host+h.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// drain the body so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// healthCheck polls the targets in the background until the load balancer is closed
+func (l *LoadBalancer) healthCheck(client *http.Client) {
+	if l.HealthCheck == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(l.HealthCheck.getInterval())
+		defer ticker.Stop()
+
+		for {
+			l.checkTargets(client)
+
+			select {
+			case <-l.done:
+				return
+
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkTargets polls all the targets (concurrently) and records the results
+func (l *LoadBalancer) checkTargets(client *http.Client) {
+	l.mutex.Lock()
+	targets := append([]*lbTarget(nil), l.targets...)
+	l.mutex.Unlock()
+
+	wg := sync.WaitGroup{}
+
+	for _, target := range targets {
+		wg.Add(1)
+
+		go func(target *lbTarget) {
+			defer wg.Done()
+
+			l.recordCheck(target, l.HealthCheck.check(client, target.Host) == nil)
+		}(target)
+	}
+
+	wg.Wait()
+}
+
+// recordCheck records the result of a health check of the target
+func (l *LoadBalancer) recordCheck(target *lbTarget, healthy bool) {
+	l.mutex.Lock()
+
+	var changed bool
+
+	if healthy {
+		target.checkFailures = 0
+		target.checkSuccesses++
+
+		if target.ejected && target.checkSuccesses >= l.HealthCheck.getHealthyThreshold() {
+			target.ejected = false
+			target.down = false
+			target.ejectedUntil = time.Time{}
+			target.failures = 0
+			changed = true
+		}
+	} else {
+		target.checkSuccesses = 0
+		target.checkFailures++
+
+		if !target.down && target.checkFailures >= l.HealthCheck.getUnhealthyThreshold() {
+			target.down = true
+
+			if !target.ejected {
+				target.ejected = true
+				changed = true
+			}
+		}
+	}
+
+	l.mutex.Unlock()
+
+	if changed {
+		l.instrumentation.TargetHealthChange(l.name, target.Host, healthy)
+	}
+}
@@ -0,0 +1,317 @@
+package smarthttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxHedges  = 1
+	maxHedges         = 2
+	defaultHedgeDelay = 50 * time.Millisecond
+
+	// the number of recent latencies used to calculate the hedge delay percentile
+	hedgeLatencySamples = 128
+	// the minimum number of samples before the percentile is used (instead of Delay)
+	hedgeMinLatencySamples = 20
+)
+
+// Hedging defines the hedged requests configuration.
+// When a GET (or HEAD) request has not completed after the hedge delay, an identical request is sent and the first
+// successful response is returned; the other requests are cancelled.  This reduces tail latency at the cost of additional
+// load on the upstream.
+// Hedging happens inside the retries; a group of hedged requests is treated as a single attempt.  Additional requests are
+// only sent by the timer: once all the requests of the group have failed, the failure is left to the retries (and their
+// backoff).
+type Hedging struct {
+	// MaxHedges is the maximum number of additional requests sent for each request (default: 1, maximum: 2)
+	MaxHedges int
+
+	// Delay is the time to wait before sending each additional request (default: 50 ms).
+	// When Percentile is set, this is only used until enough latencies have been observed.
+	Delay time.Duration
+
+	// Percentile (optionally) calculates the delay from the latencies of recent requests (e.g. 0.95 sends an additional
+	// request once a request is slower than 95% of recent requests).
+	// Latencies are measured from the start of the original request, and include failed and cancelled requests, so that
+	// hedging does not lower the delay it is calculated from.
+	Percentile float64
+
+	maxHedges       int
+	delay           time.Duration
+	latencies       *latencyTracker
+	instrumentation Instrumentation
+}
+
+type hedgeResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+func (h *Hedging) getMaxHedges() int {
+	switch {
+	case h.MaxHedges > maxHedges:
+		h.instrumentation.InitWarning("'max hedges' setting for hedging is too high; using the maximum")
+
+		return maxHedges
+
+	case h.MaxHedges > 0:
+		return h.MaxHedges
+
+	default:
+		h.instrumentation.InitWarning("using default 'max hedges' setting for hedging")
+
+		return defaultMaxHedges
+	}
+}
+
+func (h *Hedging) getDelay() time.Duration {
+	if h.Delay > 0 {
+		return h.Delay
+	}
+
+	h.instrumentation.InitWarning("using default 'delay' setting for hedging")
+
+	return defaultHedgeDelay
+}
+
+// currentDelay returns the time to wait before sending an additional request
+func (h *Hedging) currentDelay() time.Duration {
+	if h.Percentile <= 0 || h.Percentile >= 1 {
+		return h.delay
+	}
+
+	delay, ok := h.latencies.percentile(h.Percentile)
+	if !ok {
+		return h.delay
+	}
+
+	return delay
+}
+
+// nolint: gocognit,funlen
+func (h *Hedging) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		if !canHedge(req) {
+			return doFunc(req)
+		}
+
+		start := time.Now()
+
+		results := make(chan hedgeResult, h.maxHedges+1)
+		cancels := make([]context.CancelFunc, 0, h.maxHedges+1)
+
+		send := func() error {
+			ctx, cancel := context.WithCancel(req.Context())
+			index := len(cancels)
+
+			hedgeReq := req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					cancel()
+
+					return err
+				}
+
+				hedgeReq.Body = body
+			}
+
+			cancels = append(cancels, cancel)
+
+			go func() {
+				resp, err := doFunc(hedgeReq)
+
+				results <- hedgeResult{index: index, resp: resp, err: err}
+			}()
+
+			return nil
+		}
+
+		err := send()
+		if err != nil {
+			return nil, err
+		}
+
+		sent, inFlight := 1, 1
+
+		timer := time.NewTimer(h.currentDelay())
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				if sent > h.maxHedges {
+					continue
+				}
+
+				if send() == nil {
+					h.instrumentation.HedgeSent(req, sent)
+
+					sent++
+					inFlight++
+				}
+
+				timer.Reset(h.currentDelay())
+
+			case result := <-results:
+				inFlight--
+
+				// the request took this long from the start of the original request, regardless of its outcome
+				elapsed := time.Since(start)
+				h.latencies.add(elapsed)
+
+				if isHedgeSuccess(result) || inFlight == 0 {
+					// the requests that lost the race took (at least) as long as the winner
+					for i := 0; i < inFlight; i++ {
+						h.latencies.add(elapsed)
+					}
+
+					// cancel and release the requests that lost the race
+					for index, cancel := range cancels {
+						if index != result.index {
+							cancel()
+						}
+					}
+
+					go drainHedges(results, inFlight)
+
+					return releaseOnClose(result.resp, cancels[result.index]), result.err
+				}
+
+				// the request failed while others are in flight; wait for them (or the timer)
+				discardResponse(result.resp)
+				cancels[result.index]()
+			}
+		}
+	}
+}
+
+// canHedge returns whether the request is safe to send more than once concurrently
+func canHedge(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != "" {
+		return false
+	}
+
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func isHedgeSuccess(result hedgeResult) bool {
+	return result.err == nil && result.resp.StatusCode < http.StatusInternalServerError
+}
+
+// drainHedges releases the (cancelled) requests that are still in flight
+func drainHedges(results chan hedgeResult, inFlight int) {
+	for ; inFlight > 0; inFlight-- {
+		result := <-results
+
+		discardResponse(result.resp)
+	}
+}
+
+// releaseOnClose ensures the context of the winning request is released once the caller is done with the response
+func releaseOnClose(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp == nil || resp.Body == nil {
+		cancel()
+
+		return resp
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+
+	return err
+}
+
+func (h *Hedging) addMiddleware(doFunc requestClosure) requestClosure {
+	if h == nil {
+		return doFunc
+	}
+
+	return h.buildMiddleware(doFunc)
+}
+
+func (h *Hedging) doInitOnce(instrumentation Instrumentation) {
+	if h == nil {
+		return
+	}
+
+	h.instrumentation = instrumentation
+
+	h.maxHedges = h.getMaxHedges()
+	h.delay = h.getDelay()
+	h.latencies = &latencyTracker{}
+}
+
+// latencyTracker keeps a window of recent latencies
+type latencyTracker struct {
+	mutex   sync.Mutex
+	samples [hedgeLatencySamples]time.Duration
+	next    int
+	count   int
+}
+
+func (t *latencyTracker) add(latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.samples[t.next] = latency
+	t.next = (t.next + 1) % hedgeLatencySamples
+
+	if t.count < hedgeLatencySamples {
+		t.count++
+	}
+}
+
+// percentile returns the latency at the percentile (0 < p < 1) of the recent samples
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mutex.Lock()
+
+	if t.count < hedgeMinLatencySamples {
+		t.mutex.Unlock()
+
+		return 0, false
+	}
+
+	sorted := make([]time.Duration, t.count)
+	copy(sorted, t.samples[:t.count])
+
+	t.mutex.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return sorted[int(p*float64(len(sorted)-1))], true
+}
+
+// clone returns a copy of the configuration (without the recorded latencies) for a variant of the client (see
+// Client.Clone)
+func (h *Hedging) clone() *Hedging {
+	if h == nil {
+		return nil
+	}
+
+	return &Hedging{
+		MaxHedges:  h.MaxHedges,
+		Delay:      h.Delay,
+		Percentile: h.Percentile,
+	}
+}
@@ -0,0 +1,70 @@
+package smarthttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Get issues a GET to the specified URL (see http.Client.Get).
+// It is recommended to use GetWithContext so that the request can be cancelled.
+func (c *Client) Get(url string) (*http.Response, error) {
+	return c.GetWithContext(context.Background(), url)
+}
+
+// GetWithContext issues a GET to the specified URL using the context
+func (c *Client) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+// Head issues a HEAD to the specified URL (see http.Client.Head).
+// It is recommended to use HeadWithContext so that the request can be cancelled.
+func (c *Client) Head(url string) (*http.Response, error) {
+	return c.HeadWithContext(context.Background(), url)
+}
+
+// HeadWithContext issues a HEAD to the specified URL using the context
+func (c *Client) HeadWithContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+// Post issues a POST to the specified URL (see http.Client.Post).
+// It is recommended to use PostWithContext so that the request can be cancelled.
+func (c *Client) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.PostWithContext(context.Background(), url, contentType, body)
+}
+
+// PostWithContext issues a POST to the specified URL using the context
+func (c *Client) PostWithContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return c.Do(req)
+}
+
+// PostForm issues a POST to the specified URL with the URL-encoded data as the body (see http.Client.PostForm).
+// It is recommended to use PostFormWithContext so that the request can be cancelled.
+func (c *Client) PostForm(url string, data url.Values) (*http.Response, error) {
+	return c.PostFormWithContext(context.Background(), url, data)
+}
+
+// PostFormWithContext issues a POST to the specified URL with the URL-encoded data as the body using the context
+func (c *Client) PostFormWithContext(ctx context.Context, url string, data url.Values) (*http.Response, error) {
+	return c.PostWithContext(ctx, url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
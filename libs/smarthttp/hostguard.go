@@ -0,0 +1,281 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrHostNotAllowed indicates that the request was rejected by the HostGuard
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// the networks that are always denied (unless explicitly allowed) when the HostGuard is enabled
+var defaultDeniedNetworks = []string{
+	"0.0.0.0/8",          // "this" network
+	"169.254.0.0/16",     // link-local (including the cloud metadata endpoint 169.254.169.254)
+	"100.100.100.200/32", // Alibaba Cloud metadata endpoint
+	"::/128",             // unspecified
+	"fe80::/10",          // link-local
+	"fd00:ec2::254/128",  // AWS metadata endpoint (IPv6)
+}
+
+// the networks that are denied (unless explicitly allowed) when HostGuard.DenyPrivateNetworks is set
+var privateNetworks = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+	"100.64.0.0/10", // carrier-grade NAT
+	"::1/128",
+	"fc00::/7", // unique local
+}
+
+// HostGuard defines the (SSRF protection) configuration that restricts the hosts requests can be sent to (e.g. when
+// requests are made to user supplied URLs).
+// When enabled, link-local and cloud metadata addresses are always denied unless explicitly allowed via AllowedNetworks.
+//
+// Host names are checked before the request is sent and before each redirect is followed.  IP addresses are checked
+// when connecting (i.e. after DNS resolution, so that a host name cannot be used to reach a denied address); this
+// requires the default HTTP client and transport.
+// The proxies from the environment (HTTP_PROXY, HTTPS_PROXY) are not used by a client with a HostGuard.
+// Note: when a proxy is configured (see Client.ProxyURL), the IP addresses of the proxy are checked rather than those of
+// the upstream (which is resolved by the proxy).
+type HostGuard struct {
+	// AllowedHosts (optionally) are the only hosts requests can be sent to.
+	// A leading "*." matches any sub-domain (e.g. "*.example.com" matches "api.example.com" but not "example.com")
+	AllowedHosts []string
+
+	// DeniedHosts (optionally) are hosts requests cannot be sent to (same format as AllowedHosts)
+	DeniedHosts []string
+
+	// AllowedNetworks (optionally) are the only networks (CIDRs, e.g. "203.0.113.0/24") that can be connected to
+	AllowedNetworks []string
+
+	// DeniedNetworks (optionally) are networks (CIDRs) that cannot be connected to
+	DeniedNetworks []string
+
+	// DenyPrivateNetworks also denies loopback and private networks (e.g. 10.0.0.0/8) unless explicitly allowed
+	DenyPrivateNetworks bool
+
+	allowedNetworks []*net.IPNet
+	deniedNetworks  []*net.IPNet
+	defaultDenied   []*net.IPNet
+	err             error
+}
+
+// checkHost returns an error when the host (name) of the URL is not allowed
+func (g *HostGuard) checkHost(u *url.URL) error {
+	if g.err != nil {
+		return g.err
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+
+	if matchesHost(g.DeniedHosts, host) {
+		return fmt.Errorf("%w - '%s' is denied", ErrHostNotAllowed, host)
+	}
+
+	if len(g.AllowedHosts) > 0 && !matchesHost(g.AllowedHosts, host) {
+		return fmt.Errorf("%w - '%s' is not in the allowed hosts", ErrHostNotAllowed, host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return g.checkIP(ip)
+	}
+
+	return nil
+}
+
+// checkIP returns an error when the IP address is not allowed
+func (g *HostGuard) checkIP(ip net.IP) error {
+	switch {
+	case g.err != nil:
+		return g.err
+
+	case containsIP(g.deniedNetworks, ip):
+		return fmt.Errorf("%w - '%s' is in a denied network", ErrHostNotAllowed, ip)
+
+	case len(g.allowedNetworks) > 0 && !containsIP(g.allowedNetworks, ip):
+		return fmt.Errorf("%w - '%s' is not in the allowed networks", ErrHostNotAllowed, ip)
+
+	case containsIP(g.defaultDenied, ip) && !containsIP(g.allowedNetworks, ip):
+		return fmt.Errorf("%w - '%s' is a link-local, metadata or private address", ErrHostNotAllowed, ip)
+
+	default:
+		return nil
+	}
+}
+
+// wrapDialContext returns a DialContext that resolves the address, checks the IP addresses and then connects to the
+// first allowed IP address (so that the checked address is the one that is connected to)
+func (g *HostGuard) wrapDialContext(dialContext dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := lookupIPs(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			// all addresses must be allowed, otherwise the host could be used to reach a denied address
+			err = g.checkIP(ip)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, ip := range ips {
+			var conn net.Conn
+
+			conn, err = dialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
+
+func lookupIPs(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+
+	return ips, nil
+}
+
+func matchesHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// parse parses the networks; returns an error when a network is invalid
+func (g *HostGuard) parse() error {
+	var err error
+
+	g.allowedNetworks, err = parseNetworks(g.AllowedNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid allowed network: %w", err)
+	}
+
+	g.deniedNetworks, err = parseNetworks(g.DeniedNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid denied network: %w", err)
+	}
+
+	defaultDenied := defaultDeniedNetworks
+	if g.DenyPrivateNetworks {
+		defaultDenied = append(append([]string{}, defaultDenied...), privateNetworks...)
+	}
+
+	g.defaultDenied, err = parseNetworks(defaultDenied)
+
+	return err
+}
+
+func (g *HostGuard) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		err := g.checkHost(req.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		return doFunc(req)
+	}
+}
+
+func (g *HostGuard) addMiddleware(doFunc requestClosure) requestClosure {
+	if g == nil {
+		return doFunc
+	}
+
+	return g.buildMiddleware(doFunc)
+}
+
+func (g *HostGuard) doInitOnce(instrumentation Instrumentation) {
+	if g == nil {
+		return
+	}
+
+	err := g.parse()
+	if err != nil {
+		instrumentation.InitWarning("invalid host guard config, all requests will be denied: " + err.Error())
+
+		// fail closed
+		g.err = fmt.Errorf("%w - invalid host guard config: %s", ErrHostNotAllowed, err)
+	}
+}
+
+// clone returns a copy of the configuration (without the parsed state) for a variant of the client (see Client.Clone)
+func (g *HostGuard) clone() *HostGuard {
+	if g == nil {
+		return nil
+	}
+
+	return &HostGuard{
+		AllowedHosts:        append([]string(nil), g.AllowedHosts...),
+		DeniedHosts:         append([]string(nil), g.DeniedHosts...),
+		AllowedNetworks:     append([]string(nil), g.AllowedNetworks...),
+		DeniedNetworks:      append([]string(nil), g.DeniedNetworks...),
+		DenyPrivateNetworks: g.DenyPrivateNetworks,
+	}
+}
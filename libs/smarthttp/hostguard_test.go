@@ -0,0 +1,187 @@
+package smarthttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// countingServer returns a server that responds with 200 and counts the requests it received
+func countingServer(t *testing.T, hits *int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt64(hits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// redirectServer returns a server that redirects all requests to the location
+func redirectServer(t *testing.T, location string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, location, http.StatusFound)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// localhostURL returns the URL of the server using the "localhost" host name (rather than its IP address)
+func localhostURL(t *testing.T, server *httptest.Server) string {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "http://localhost:" + u.Port() + "/"
+}
+
+func TestHostGuard(t *testing.T) {
+	tests := []struct {
+		name      string
+		guard     func() *HostGuard
+		target    func(t *testing.T, upstream *httptest.Server) string
+		wantErr   bool
+		wantHits  int64
+		redirects bool
+	}{
+		{
+			name:     "allowed host",
+			guard:    func() *HostGuard { return &HostGuard{AllowedHosts: []string{"127.0.0.1"}} },
+			target:   func(_ *testing.T, upstream *httptest.Server) string { return upstream.URL },
+			wantHits: 1,
+		},
+		{
+			name:    "host not in the allowed hosts",
+			guard:   func() *HostGuard { return &HostGuard{AllowedHosts: []string{"example.com"}} },
+			target:  func(_ *testing.T, upstream *httptest.Server) string { return upstream.URL },
+			wantErr: true,
+		},
+		{
+			name:    "redirect to a host not in the allowed hosts",
+			guard:   func() *HostGuard { return &HostGuard{AllowedHosts: []string{"127.0.0.1"}} },
+			target:  func(t *testing.T, upstream *httptest.Server) string { return localhostURL(t, upstream) },
+			wantErr: true,
+			// the original request is to the (allowed) redirect server
+			redirects: true,
+		},
+		{
+			name:      "redirect to a denied host",
+			guard:     func() *HostGuard { return &HostGuard{DeniedHosts: []string{"localhost"}} },
+			target:    func(t *testing.T, upstream *httptest.Server) string { return localhostURL(t, upstream) },
+			wantErr:   true,
+			redirects: true,
+		},
+		{
+			name:      "redirect to an allowed host",
+			guard:     func() *HostGuard { return &HostGuard{AllowedHosts: []string{"127.0.0.1", "localhost"}} },
+			target:    func(t *testing.T, upstream *httptest.Server) string { return localhostURL(t, upstream) },
+			wantHits:  1,
+			redirects: true,
+		},
+		{
+			// an allowed host name that resolves to a denied address (e.g. DNS rebinding) is rejected when connecting
+			name: "host name resolving to a denied network",
+			guard: func() *HostGuard {
+				return &HostGuard{AllowedHosts: []string{"localhost"}, DenyPrivateNetworks: true}
+			},
+			target:  func(t *testing.T, upstream *httptest.Server) string { return localhostURL(t, upstream) },
+			wantErr: true,
+		},
+		{
+			name: "host name resolving to an explicitly denied network",
+			guard: func() *HostGuard {
+				return &HostGuard{DeniedNetworks: []string{"127.0.0.0/8", "::1/128"}}
+			},
+			target:  func(t *testing.T, upstream *httptest.Server) string { return localhostURL(t, upstream) },
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			var hits int64
+
+			upstream := countingServer(t, &hits)
+
+			target := test.target(t, upstream)
+			if test.redirects {
+				target = redirectServer(t, target).URL
+			}
+
+			client := &Client{
+				Name:           "hostguard-" + test.name,
+				HostGuard:      test.guard(),
+				CircuitBreaker: CircuitBreaker{Engine: &GoBreakerEngine{}},
+			}
+
+			req, err := http.NewRequest(http.MethodGet, target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Do(req)
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+
+			switch {
+			case test.wantErr && !errors.Is(err, ErrHostNotAllowed):
+				t.Errorf("expected an error wrapping ErrHostNotAllowed, got: %v", err)
+
+			case !test.wantErr && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if got := atomic.LoadInt64(&hits); got != test.wantHits {
+				t.Errorf("expected %d requests to the upstream, got %d", test.wantHits, got)
+			}
+		})
+	}
+}
+
+func TestHostGuardIgnoresEnvironmentProxy(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *Client
+		wantProxy bool
+	}{
+		{
+			name:      "without host guard",
+			client:    &Client{Name: "hostguard-proxy-none"},
+			wantProxy: true,
+		},
+		{
+			name:   "with host guard",
+			client: &Client{Name: "hostguard-proxy-guard", HostGuard: &HostGuard{}},
+		},
+		{
+			name:      "with host guard and proxy URL",
+			client:    &Client{Name: "hostguard-proxy-url", HostGuard: &HostGuard{}, ProxyURL: "http://proxy:3128"},
+			wantProxy: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			transport, ok := test.client.getClient().Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("unexpected transport %T", test.client.getClient().Transport)
+			}
+
+			if gotProxy := transport.Proxy != nil; gotProxy != test.wantProxy {
+				t.Errorf("expected proxy: %t, got: %t", test.wantProxy, gotProxy)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package smarthttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// ErrHTTP2NotSupported indicates that the server does not support HTTP/2 (and HTTP2Forced is configured)
+var ErrHTTP2NotSupported = errors.New("server does not support HTTP/2")
+
+// HTTP2Mode defines how the default transport uses HTTP/2
+type HTTP2Mode int
+
+const (
+	// HTTP2Auto negotiates HTTP/2 with the server (via TLS ALPN) and falls back to HTTP/1.1 (default)
+	HTTP2Auto HTTP2Mode = iota
+
+	// HTTP2Disabled only uses HTTP/1.1
+	HTTP2Disabled
+
+	// HTTP2Forced only uses HTTP/2 (over TLS); requests to servers that do not support HTTP/2 fail
+	HTTP2Forced
+
+	// HTTP2Cleartext uses HTTP/2 without TLS (h2c with prior knowledge) for "http" URLs (e.g. internal gRPC-gateway style
+	// upstreams); "https" URLs are treated as per HTTP2Auto
+	HTTP2Cleartext
+)
+
+// String implements fmt.Stringer
+func (m HTTP2Mode) String() string {
+	switch m {
+	case HTTP2Auto:
+		return "auto"
+
+	case HTTP2Disabled:
+		return "disabled"
+
+	case HTTP2Forced:
+		return "forced"
+
+	case HTTP2Cleartext:
+		return "cleartext"
+
+	default:
+		return "unknown"
+	}
+}
+
+// apply returns the round tripper that implements the HTTP/2 mode on top of the transport.
+// Note: HTTP/2 only connections (i.e. HTTP2Forced and h2c) are dialed directly (i.e. the transport's Proxy is not used).
+func (m HTTP2Mode) apply(transport *http.Transport) http.RoundTripper {
+	switch m {
+	case HTTP2Disabled:
+		transport.ForceAttemptHTTP2 = false
+		// a non-nil (empty) map disables HTTP/2
+		transport.TLSNextProto = map[string]func(authority string, c *tls.Conn) http.RoundTripper{}
+
+		return transport
+
+	case HTTP2Forced:
+		return &http2.Transport{
+			TLSClientConfig:    transport.TLSClientConfig,
+			DisableCompression: transport.DisableCompression,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := transport.DialContext(context.Background(), network, addr)
+				if err != nil {
+					return nil, err
+				}
+
+				return tlsHandshake(conn, cfg, transport.TLSHandshakeTimeout)
+			},
+		}
+
+	case HTTP2Cleartext:
+		return &h2cRoundTripper{
+			h2c: &http2.Transport{
+				DisableCompression: transport.DisableCompression,
+				AllowHTTP:          true,
+				DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+					return transport.DialContext(context.Background(), network, addr)
+				},
+			},
+			transport: transport,
+		}
+
+	default:
+		return transport
+	}
+}
+
+// h2cRoundTripper sends "http" requests using h2c and all other requests using the transport
+type h2cRoundTripper struct {
+	h2c       http.RoundTripper
+	transport *http.Transport
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *h2cRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return r.h2c.RoundTrip(req)
+	}
+
+	return r.transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both transports
+func (r *h2cRoundTripper) CloseIdleConnections() {
+	r.transport.CloseIdleConnections()
+
+	if closer, ok := r.h2c.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// tlsHandshake performs the TLS handshake and verifies that HTTP/2 was negotiated
+func tlsHandshake(conn net.Conn, cfg *tls.Config, timeout time.Duration) (net.Conn, error) {
+	tlsConn := tls.Client(conn, cfg)
+
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	err := tlsConn.Handshake()
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	if protocol := tlsConn.ConnectionState().NegotiatedProtocol; protocol != http2.NextProtoTLS {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("%w - server negotiated %q", ErrHTTP2NotSupported, protocol)
+	}
+
+	return tlsConn, nil
+}
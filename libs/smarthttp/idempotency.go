@@ -0,0 +1,108 @@
+package smarthttp
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const defaultIdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKey defines the idempotency key configuration for retried writes.
+// When a request with a non-idempotent method (e.g. POST or PATCH) is allowed to be retried, a key is generated once and
+// attached to every attempt so that upstreams which support idempotency keys can deduplicate the request.
+// Requests that already carry the header keep their key.
+type IdempotencyKey struct {
+	// Header is the name of the request header that carries the key (default: Idempotency-Key)
+	Header string
+
+	// Generator (optionally) generates the key for the request (default: a random UUID)
+	Generator func(req *http.Request) string
+}
+
+// IdempotencyKeyError is returned when a request carrying a generated idempotency key has failed.
+// It allows the key to be logged so that the request can be correlated with the upstream.
+type IdempotencyKeyError struct {
+	// Key is the idempotency key sent with the request
+	Key string
+
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error
+func (e *IdempotencyKeyError) Error() string {
+	return fmt.Sprintf("%s (idempotency key: %s)", e.Err, e.Key)
+}
+
+// Unwrap returns the underlying error
+func (e *IdempotencyKeyError) Unwrap() error {
+	return e.Err
+}
+
+// IdempotencyKeyOf returns the idempotency key that was sent with the request that produced the response or error.
+// Returns an empty string when no key was generated.
+func IdempotencyKeyOf(resp *http.Response, err error) string {
+	var keyErr *IdempotencyKeyError
+	if errors.As(err, &keyErr) {
+		return keyErr.Key
+	}
+
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+
+	key, _ := resp.Request.Context().Value(ctxKeyIdempotencyKey).(string)
+
+	return key
+}
+
+func (i *IdempotencyKey) getHeader() string {
+	if i.Header != "" {
+		return i.Header
+	}
+
+	return defaultIdempotencyKeyHeader
+}
+
+func (i *IdempotencyKey) generate(req *http.Request) string {
+	if i.Generator != nil {
+		return i.Generator(req)
+	}
+
+	return newUUID()
+}
+
+// apply returns a copy of the request that carries an idempotency key (when one is required) along with the key
+func (i *IdempotencyKey) apply(req *http.Request) (*http.Request, string) {
+	if i == nil || isIdempotent(req.Method) {
+		return req, ""
+	}
+
+	header := i.getHeader()
+
+	key := req.Header.Get(header)
+	if key == "" {
+		key = i.generate(req)
+	}
+
+	// copy the request so that the caller's headers are not modified
+	req = req.Clone(context.WithValue(req.Context(), ctxKeyIdempotencyKey, key))
+	req.Header.Set(header, key)
+
+	return req, key
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+
+	_, _ = rand.Read(b[:])
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
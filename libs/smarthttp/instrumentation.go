@@ -15,6 +15,7 @@ type Instrumentation interface {
 	InitWarning(message string)
 
 	// SanitizePath sanitizes the url path that can be sent to DataDog as a tag
+	// (DefaultSanitizePath is recommended unless the paths of the upstream require custom handling)
 	SanitizePath(urlPath string) string
 
 	// DoDuration is the total time taken to complete the request (includes retries)
@@ -26,43 +27,198 @@ type Instrumentation interface {
 	// BaseDoErr is called when the underlying http.Client.Do() request returns an error
 	BaseDoErr(err error, endpointTag, errTag string)
 
+	// BaseDoErrDuration is the time taken to make a single http.Client.Do() request that returned an error, with the
+	// class of the error (so that e.g. connect timeouts and read timeouts can be told apart)
+	BaseDoErrDuration(start time.Time, class ErrorClass, endpointTag string)
+
+	// BaseDoConnTrace is called after each http.Client.Do() request with the duration of its connection phases
+	// (DNS, connect, TLS handshake and time to first byte) and whether the connection was reused
+	BaseDoConnTrace(trace ConnTrace, endpointTag string)
+
+	// DNSLookup is called for each lookup of the DNS cache (see DNSCache); cached is true when the addresses were served
+	// from the cache and err is the (possibly cached) error of the lookup
+	DNSLookup(host string, duration time.Duration, cached bool, err error)
+
+	// DebugDump is called after each attempt with the (redacted) request and response when debug dumping is enabled
+	// (see Debug)
+	DebugDump(dump Dump, endpointTag string)
+
+	// Redirect is called for each redirect followed by the default HTTP client; req is the redirected request and hop is
+	// the (one based) number of the redirect
+	Redirect(req *http.Request, hop int)
+
 	// CBCircuitOpen is called when the circuit breaker circuit is open
 	CBCircuitOpen(req *http.Request)
 
+	// CBStateChange is called when the state of the circuit changes (e.g. when the circuit opens)
+	CBStateChange(name string, from, to State)
+
 	// CBTrackedStatusCode is called when the response code is tracked by the circuit breaker as an error
 	CBTrackedStatusCode(req *http.Request, code int)
 
-	// RetryNonRetriable is called when a non-retriable HTTP status code or error has been returned
-	RetryNonRetriable(req *http.Request, code int)
+	// RetryNonRetriable is called when a non-retriable HTTP status code has been returned
+	// NOTE: attempt is the (one based) number of the attempt that returned the status code
+	RetryNonRetriable(req *http.Request, code int, attempt int)
+
+	// RetryRetriable is called when a retriable HTTP status code has been returned
+	// NOTE: attempt is the (one based) number of the attempt that returned the status code
+	RetryRetriable(req *http.Request, code int, attempt int)
+
+	// RetryNonRetriableErr is called when a non-retriable error has been returned, with the class of the error
+	// NOTE: attempt is the (one based) number of the attempt that returned the error
+	RetryNonRetriableErr(req *http.Request, class ErrorClass, attempt int)
+
+	// RetryRetriableErr is called when a retriable error has been returned, with the class of the error (see
+	// LegacyRetryInstrumentation for the status code these errors used to be reported with)
+	// NOTE: attempt is the (one based) number of the attempt that returned the error
+	RetryRetriableErr(req *http.Request, class ErrorClass, attempt int)
+
+	// ResponseRejected is called when a response is rejected by Client.ValidateResponse
+	ResponseRejected(req *http.Request, code int, err error)
+
+	// BulkheadQueued is called when a request had to wait for a bulkhead slot; wait is the time spent waiting
+	BulkheadQueued(req *http.Request, wait time.Duration)
+
+	// BulkheadRejected is called when the bulkhead rejects a request
+	BulkheadRejected(req *http.Request)
+
+	// CacheHit is called when a request is served from the response cache (including after a successful revalidation)
+	CacheHit(req *http.Request)
+
+	// CacheMiss is called when a cacheable request could not be served from the response cache
+	CacheMiss(req *http.Request)
 
-	// RetryRetriable is called when a retriable HTTP status code or error has been returned
-	// NOTE: when errors occur status code is set to 666
-	RetryRetriable(req *http.Request, code int)
+	// ConcurrencyLimitChanged is called when the adaptive concurrency limit changes
+	ConcurrencyLimitChanged(limit int)
+
+	// ConcurrencyLimitRejected is called when the adaptive concurrency limit rejects a request
+	ConcurrencyLimitRejected(req *http.Request)
+
+	// HedgeSent is called when an additional (hedged) request is sent; hedge is the (one based) number of the hedge
+	HedgeSent(req *http.Request, hedge int)
 
 	// SingleflightErr is called when singleflight returns an error
 	SingleflightErr(req *http.Request, err error)
+
+	// RateLimitErr is called when the client-side rate limiter rejects a request
+	RateLimitErr(req *http.Request, err error)
+
+	// TLSPinFailure is called when the certificates presented by the server do not match the pins (see TLS)
+	TLSPinFailure(name string)
+
+	// TargetHealthChange is called when a target of the load balancer is ejected (healthy is false) or becomes healthy
+	// again (see LoadBalancer)
+	TargetHealthChange(name, target string, healthy bool)
+
+	// FailoverSent is called when a request is sent to the failover secondary; reason is "circuitOpen" or
+	// "connectionErrors" (see Failover)
+	FailoverSent(req *http.Request, reason string)
+
+	// ResolveErr is called when the load balancer is unable to resolve the targets of the service (see Resolver)
+	ResolveErr(name, service string, err error)
+
+	// AsyncQueued is called when a worker starts sending an asynchronous request; wait is the time spent in the queue
+	AsyncQueued(req *http.Request, wait time.Duration)
+
+	// AsyncRejected is called when an asynchronous request is rejected or dropped because the queue is full
+	AsyncRejected(req *http.Request)
+
+	// OutboxDeliveryFailed is called when an attempt to deliver an outbox message fails; attempt is the (one based)
+	// number of the attempt and deadLettered is true when the message will not be attempted again (see Outbox)
+	OutboxDeliveryFailed(req *http.Request, attempt int, err error, deadLettered bool)
+
+	// OutboxStoreErr is called when the outbox store returns an error
+	OutboxStoreErr(name string, err error)
+
+	// WebhookDelivery is called with the outcome of each attempt to deliver a webhook; id is the delivery ID and
+	// statusCode is 0 when err is set (see Webhook)
+	WebhookDelivery(req *http.Request, id string, statusCode int, err error)
+
+	// LoadShed is called when the load shedder rejects a request; p99 is the latency that caused it (see LoadShedder)
+	LoadShed(req *http.Request, p99 time.Duration)
+
+	// PoolStats is called periodically with the stats of the connection pool of each host (see PoolMetrics)
+	PoolStats(name string, stats PoolStats)
 }
 
-type noopInstrumentation struct{}
+// NoopInstrumentation is an Instrumentation that does nothing.
+// It can be embedded by implementations that are only interested in some of the events.
+type NoopInstrumentation struct{}
+
+func (n *NoopInstrumentation) Init(_ string) {}
+
+func (n *NoopInstrumentation) InitWarning(_ string) {}
+
+func (n *NoopInstrumentation) SanitizePath(urlPath string) string { return DefaultSanitizePath(urlPath) }
+
+func (n *NoopInstrumentation) DoDuration(_ time.Time, _ string) {}
+
+func (n *NoopInstrumentation) BaseDoDuration(_ time.Time, _ int, _ string) {}
+
+func (n *NoopInstrumentation) BaseDoErr(_ error, _, _ string) {}
+
+func (n *NoopInstrumentation) BaseDoErrDuration(_ time.Time, _ ErrorClass, _ string) {}
+
+func (n *NoopInstrumentation) BaseDoConnTrace(_ ConnTrace, _ string) {}
+
+func (n *NoopInstrumentation) DNSLookup(_ string, _ time.Duration, _ bool, _ error) {}
+
+func (n *NoopInstrumentation) DebugDump(_ Dump, _ string) {}
+
+func (n *NoopInstrumentation) Redirect(_ *http.Request, _ int) {}
+
+func (n *NoopInstrumentation) CBCircuitOpen(_ *http.Request) {}
+
+func (n *NoopInstrumentation) CBStateChange(_ string, _, _ State) {}
+
+func (n *NoopInstrumentation) CBTrackedStatusCode(_ *http.Request, _ int) {}
+
+func (n *NoopInstrumentation) RetryNonRetriable(_ *http.Request, _ int, _ int) {}
+
+func (n *NoopInstrumentation) RetryRetriable(_ *http.Request, _ int, _ int) {}
+
+func (n *NoopInstrumentation) RetryNonRetriableErr(_ *http.Request, _ ErrorClass, _ int) {}
+
+func (n *NoopInstrumentation) RetryRetriableErr(_ *http.Request, _ ErrorClass, _ int) {}
+
+func (n *NoopInstrumentation) ResponseRejected(_ *http.Request, _ int, _ error) {}
+
+func (n *NoopInstrumentation) BulkheadQueued(_ *http.Request, _ time.Duration) {}
+
+func (n *NoopInstrumentation) BulkheadRejected(_ *http.Request) {}
+
+func (n *NoopInstrumentation) CacheHit(_ *http.Request) {}
+
+func (n *NoopInstrumentation) CacheMiss(_ *http.Request) {}
+
+func (n *NoopInstrumentation) ConcurrencyLimitChanged(_ int) {}
+
+func (n *NoopInstrumentation) ConcurrencyLimitRejected(_ *http.Request) {}
+
+func (n *NoopInstrumentation) HedgeSent(_ *http.Request, _ int) {}
+
+func (n *NoopInstrumentation) SingleflightErr(_ *http.Request, _ error) {}
+
+func (n *NoopInstrumentation) RateLimitErr(_ *http.Request, _ error) {}
 
-func (n *noopInstrumentation) Init(_ string) {}
+func (n *NoopInstrumentation) TLSPinFailure(_ string) {}
 
-func (n *noopInstrumentation) InitWarning(_ string) {}
+func (n *NoopInstrumentation) TargetHealthChange(_, _ string, _ bool) {}
 
-func (n *noopInstrumentation) SanitizePath(_ string) string { return "" }
+func (n *NoopInstrumentation) FailoverSent(_ *http.Request, _ string) {}
 
-func (n *noopInstrumentation) DoDuration(_ time.Time, _ string) {}
+func (n *NoopInstrumentation) ResolveErr(_, _ string, _ error) {}
 
-func (n *noopInstrumentation) BaseDoDuration(_ time.Time, _ int, _ string) {}
+func (n *NoopInstrumentation) AsyncQueued(_ *http.Request, _ time.Duration) {}
 
-func (n *noopInstrumentation) BaseDoErr(_ error, _, _ string) {}
+func (n *NoopInstrumentation) AsyncRejected(_ *http.Request) {}
 
-func (n *noopInstrumentation) CBCircuitOpen(_ *http.Request) {}
+func (n *NoopInstrumentation) OutboxDeliveryFailed(_ *http.Request, _ int, _ error, _ bool) {}
 
-func (n *noopInstrumentation) CBTrackedStatusCode(_ *http.Request, _ int) {}
+func (n *NoopInstrumentation) OutboxStoreErr(_ string, _ error) {}
 
-func (n *noopInstrumentation) RetryNonRetriable(_ *http.Request, _ int) {}
+func (n *NoopInstrumentation) WebhookDelivery(_ *http.Request, _ string, _ int, _ error) {}
 
-func (n *noopInstrumentation) RetryRetriable(_ *http.Request, _ int) {}
+func (n *NoopInstrumentation) LoadShed(_ *http.Request, _ time.Duration) {}
 
-func (n *noopInstrumentation) SingleflightErr(_ *http.Request, _ error) {}
+func (n *NoopInstrumentation) PoolStats(_ string, _ PoolStats) {}
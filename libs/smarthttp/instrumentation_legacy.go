@@ -0,0 +1,41 @@
+package smarthttp
+
+import (
+	"net/http"
+)
+
+// LegacyErrorStatusCode is the status code that the retriable errors used to be reported with (by RetryRetriable)
+// before the errors were reported with their class (by RetryRetriableErr and RetryNonRetriableErr).
+//
+// Deprecated: use the ErrorClass of RetryRetriableErr and RetryNonRetriableErr; see LegacyRetryInstrumentation.
+const LegacyErrorStatusCode = 666
+
+// LegacyRetryInstrumentation returns an Instrumentation that also reports the retriable errors to RetryRetriable with
+// LegacyErrorStatusCode (as they used to be, the non-retriable errors were not reported), e.g. to keep the existing
+// dashboards and alerts working while they are migrated to the error classes:
+//
+//	client, err := smarthttp.NewClient(name, smarthttp.WithInstrumentation(
+//		smarthttp.LegacyRetryInstrumentation(statssmarthttp.New(statsd))))
+//
+// Deprecated: report the retries of errors with RetryRetriableErr and RetryNonRetriableErr.
+func LegacyRetryInstrumentation(instrumentation Instrumentation) Instrumentation {
+	return &legacyRetryInstrumentation{Instrumentation: instrumentation}
+}
+
+type legacyRetryInstrumentation struct {
+	Instrumentation
+}
+
+// Flush implements Flusher (when the wrapped instrumentation does)
+func (l *legacyRetryInstrumentation) Flush() error {
+	if flusher, ok := l.Instrumentation.(Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+func (l *legacyRetryInstrumentation) RetryRetriableErr(req *http.Request, class ErrorClass, attempt int) {
+	l.Instrumentation.RetryRetriableErr(req, class, attempt)
+	l.Instrumentation.RetryRetriable(req, LegacyErrorStatusCode, attempt)
+}
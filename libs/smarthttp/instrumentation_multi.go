@@ -0,0 +1,267 @@
+package smarthttp
+
+import (
+	"net/http"
+	"time"
+)
+
+// MultiInstrumentation returns an Instrumentation that passes every event to all of the supplied instrumentations (in
+// order), e.g. to emit metrics and logs at the same time.
+// SanitizePath is delegated to the first instrumentation only (so that all instrumentations see the same endpoint tags).
+func MultiInstrumentation(instrumentations ...Instrumentation) Instrumentation {
+	if len(instrumentations) == 0 {
+		return &NoopInstrumentation{}
+	}
+
+	return multiInstrumentation(instrumentations)
+}
+
+type multiInstrumentation []Instrumentation
+
+// Flush implements Flusher; the instrumentations that implement Flusher are flushed and the first error is returned
+func (m multiInstrumentation) Flush() error {
+	var out error
+
+	for _, i := range m {
+		if flusher, ok := i.(Flusher); ok {
+			err := flusher.Flush()
+			if err != nil && out == nil {
+				out = err
+			}
+		}
+	}
+
+	return out
+}
+
+func (m multiInstrumentation) Init(name string) {
+	for _, i := range m {
+		i.Init(name)
+	}
+}
+
+func (m multiInstrumentation) InitWarning(message string) {
+	for _, i := range m {
+		i.InitWarning(message)
+	}
+}
+
+func (m multiInstrumentation) SanitizePath(urlPath string) string {
+	return m[0].SanitizePath(urlPath)
+}
+
+func (m multiInstrumentation) DoDuration(start time.Time, endpointTag string) {
+	for _, i := range m {
+		i.DoDuration(start, endpointTag)
+	}
+}
+
+func (m multiInstrumentation) BaseDoDuration(start time.Time, statusCode int, endpointTag string) {
+	for _, i := range m {
+		i.BaseDoDuration(start, statusCode, endpointTag)
+	}
+}
+
+func (m multiInstrumentation) BaseDoErr(err error, endpointTag, errTag string) {
+	for _, i := range m {
+		i.BaseDoErr(err, endpointTag, errTag)
+	}
+}
+
+func (m multiInstrumentation) BaseDoErrDuration(start time.Time, class ErrorClass, endpointTag string) {
+	for _, i := range m {
+		i.BaseDoErrDuration(start, class, endpointTag)
+	}
+}
+
+func (m multiInstrumentation) BaseDoConnTrace(trace ConnTrace, endpointTag string) {
+	for _, i := range m {
+		i.BaseDoConnTrace(trace, endpointTag)
+	}
+}
+
+func (m multiInstrumentation) DNSLookup(host string, duration time.Duration, cached bool, err error) {
+	for _, i := range m {
+		i.DNSLookup(host, duration, cached, err)
+	}
+}
+
+func (m multiInstrumentation) DebugDump(dump Dump, endpointTag string) {
+	for _, i := range m {
+		i.DebugDump(dump, endpointTag)
+	}
+}
+
+func (m multiInstrumentation) Redirect(req *http.Request, hop int) {
+	for _, i := range m {
+		i.Redirect(req, hop)
+	}
+}
+
+func (m multiInstrumentation) CBCircuitOpen(req *http.Request) {
+	for _, i := range m {
+		i.CBCircuitOpen(req)
+	}
+}
+
+func (m multiInstrumentation) CBStateChange(name string, from, to State) {
+	for _, i := range m {
+		i.CBStateChange(name, from, to)
+	}
+}
+
+func (m multiInstrumentation) CBTrackedStatusCode(req *http.Request, code int) {
+	for _, i := range m {
+		i.CBTrackedStatusCode(req, code)
+	}
+}
+
+func (m multiInstrumentation) RetryNonRetriable(req *http.Request, code int, attempt int) {
+	for _, i := range m {
+		i.RetryNonRetriable(req, code, attempt)
+	}
+}
+
+func (m multiInstrumentation) RetryRetriable(req *http.Request, code int, attempt int) {
+	for _, i := range m {
+		i.RetryRetriable(req, code, attempt)
+	}
+}
+
+func (m multiInstrumentation) RetryNonRetriableErr(req *http.Request, class ErrorClass, attempt int) {
+	for _, i := range m {
+		i.RetryNonRetriableErr(req, class, attempt)
+	}
+}
+
+func (m multiInstrumentation) RetryRetriableErr(req *http.Request, class ErrorClass, attempt int) {
+	for _, i := range m {
+		i.RetryRetriableErr(req, class, attempt)
+	}
+}
+
+func (m multiInstrumentation) ResponseRejected(req *http.Request, code int, err error) {
+	for _, i := range m {
+		i.ResponseRejected(req, code, err)
+	}
+}
+
+func (m multiInstrumentation) BulkheadQueued(req *http.Request, wait time.Duration) {
+	for _, i := range m {
+		i.BulkheadQueued(req, wait)
+	}
+}
+
+func (m multiInstrumentation) BulkheadRejected(req *http.Request) {
+	for _, i := range m {
+		i.BulkheadRejected(req)
+	}
+}
+
+func (m multiInstrumentation) CacheHit(req *http.Request) {
+	for _, i := range m {
+		i.CacheHit(req)
+	}
+}
+
+func (m multiInstrumentation) CacheMiss(req *http.Request) {
+	for _, i := range m {
+		i.CacheMiss(req)
+	}
+}
+
+func (m multiInstrumentation) ConcurrencyLimitChanged(limit int) {
+	for _, i := range m {
+		i.ConcurrencyLimitChanged(limit)
+	}
+}
+
+func (m multiInstrumentation) ConcurrencyLimitRejected(req *http.Request) {
+	for _, i := range m {
+		i.ConcurrencyLimitRejected(req)
+	}
+}
+
+func (m multiInstrumentation) HedgeSent(req *http.Request, hedge int) {
+	for _, i := range m {
+		i.HedgeSent(req, hedge)
+	}
+}
+
+func (m multiInstrumentation) SingleflightErr(req *http.Request, err error) {
+	for _, i := range m {
+		i.SingleflightErr(req, err)
+	}
+}
+
+func (m multiInstrumentation) RateLimitErr(req *http.Request, err error) {
+	for _, i := range m {
+		i.RateLimitErr(req, err)
+	}
+}
+
+func (m multiInstrumentation) TLSPinFailure(name string) {
+	for _, i := range m {
+		i.TLSPinFailure(name)
+	}
+}
+
+func (m multiInstrumentation) TargetHealthChange(name, target string, healthy bool) {
+	for _, i := range m {
+		i.TargetHealthChange(name, target, healthy)
+	}
+}
+
+func (m multiInstrumentation) FailoverSent(req *http.Request, reason string) {
+	for _, i := range m {
+		i.FailoverSent(req, reason)
+	}
+}
+
+func (m multiInstrumentation) ResolveErr(name, service string, err error) {
+	for _, i := range m {
+		i.ResolveErr(name, service, err)
+	}
+}
+
+func (m multiInstrumentation) AsyncQueued(req *http.Request, wait time.Duration) {
+	for _, i := range m {
+		i.AsyncQueued(req, wait)
+	}
+}
+
+func (m multiInstrumentation) AsyncRejected(req *http.Request) {
+	for _, i := range m {
+		i.AsyncRejected(req)
+	}
+}
+
+func (m multiInstrumentation) OutboxDeliveryFailed(req *http.Request, attempt int, err error, deadLettered bool) {
+	for _, i := range m {
+		i.OutboxDeliveryFailed(req, attempt, err, deadLettered)
+	}
+}
+
+func (m multiInstrumentation) OutboxStoreErr(name string, err error) {
+	for _, i := range m {
+		i.OutboxStoreErr(name, err)
+	}
+}
+
+func (m multiInstrumentation) WebhookDelivery(req *http.Request, id string, statusCode int, err error) {
+	for _, i := range m {
+		i.WebhookDelivery(req, id, statusCode, err)
+	}
+}
+
+func (m multiInstrumentation) LoadShed(req *http.Request, p99 time.Duration) {
+	for _, i := range m {
+		i.LoadShed(req, p99)
+	}
+}
+
+func (m multiInstrumentation) PoolStats(name string, stats PoolStats) {
+	for _, i := range m {
+		i.PoolStats(name, stats)
+	}
+}
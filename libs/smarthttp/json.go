@@ -0,0 +1,156 @@
+package smarthttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// the maximum number of bytes of an error body that is read (and kept) by the JSON helpers
+const maxErrorBodySize = 64 * 1024
+
+// APIError is returned by the JSON helpers when the upstream responds with a non-2xx status code.
+// Code and Message are populated from common JSON error formats (e.g. {"code": "...", "message": "..."} or
+// {"error": "...", "error_description": "..."}) when present.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+
+	// Code is the (application specific) error code reported by the upstream
+	Code string
+
+	// Message is the error message reported by the upstream
+	Message string
+
+	// Body is the raw response body (truncated to 64 KB)
+	Body []byte
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("upstream responded with %d: %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("upstream responded with %d", e.StatusCode)
+}
+
+// GetJSON issues a GET to the specified URL and decodes the JSON response into target.
+// Non-2xx responses are returned as an *APIError.
+func (c *Client) GetJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.DoJSON(req, target)
+}
+
+// PostJSON issues a POST of body (encoded as JSON) to the specified URL and decodes the JSON response into target.
+// Non-2xx responses are returned as an *APIError.
+func (c *Client) PostJSON(ctx context.Context, url string, body, target interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.DoJSON(req, target)
+}
+
+// DoJSON performs the request and decodes the JSON response into target (which can be nil to ignore the body).
+// Non-2xx responses are returned as an *APIError.
+func (c *Client) DoJSON(req *http.Request, target interface{}) error {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return newAPIError(resp)
+	}
+
+	if target == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(target)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+
+	payload := struct {
+		Code             interface{} `json:"code"`
+		Message          string      `json:"message"`
+		Error            interface{} `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}{}
+
+	if json.Unmarshal(body, &payload) != nil {
+		return apiErr
+	}
+
+	if payload.Code != nil {
+		apiErr.Code = fmt.Sprint(payload.Code)
+	}
+
+	apiErr.Message = payload.Message
+
+	switch value := payload.Error.(type) {
+	case string:
+		// e.g. {"error": "invalid_grant", "error_description": "..."}
+		if apiErr.Code == "" {
+			apiErr.Code = value
+		}
+
+		if apiErr.Message == "" {
+			apiErr.Message = payload.ErrorDescription
+		}
+
+		if apiErr.Message == "" {
+			apiErr.Message = value
+		}
+
+	case map[string]interface{}:
+		// e.g. {"error": {"code": "...", "message": "..."}}
+		if code, ok := value["code"]; ok && apiErr.Code == "" {
+			apiErr.Code = fmt.Sprint(code)
+		}
+
+		if message, ok := value["message"].(string); ok && apiErr.Message == "" {
+			apiErr.Message = message
+		}
+	}
+
+	return apiErr
+}
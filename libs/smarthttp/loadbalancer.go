@@ -0,0 +1,412 @@
+package smarthttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLBFailureThreshold = 5
+	defaultLBEjectionDuration = 30 * time.Second
+)
+
+// BalanceStrategy defines how the LoadBalancer picks the target of each attempt
+type BalanceStrategy int
+
+const (
+	// BalanceRoundRobin sends attempts to each target in turn (default)
+	BalanceRoundRobin BalanceStrategy = iota
+
+	// BalanceWeighted sends attempts to the targets in proportion to their weights (smooth weighted round-robin)
+	BalanceWeighted
+
+	// BalanceLeastLoaded sends each attempt to the target with the fewest attempts in-flight
+	BalanceLeastLoaded
+)
+
+// Target is an upstream host that requests can be sent to by the LoadBalancer
+type Target struct {
+	// Host is the host (and optional port) of the target, e.g. "eu.payments.example.com:8443"
+	Host string
+
+	// Weight is the relative weight of the target when using BalanceWeighted (default: 1)
+	Weight int
+}
+
+// TargetStatus is a snapshot of a target of the LoadBalancer
+type TargetStatus struct {
+	Target
+
+	// Healthy is false while the target is ejected (and until an attempt succeeds after the ejection)
+	Healthy bool
+
+	// InFlight is the number of attempts currently in-flight to the target
+	InFlight int
+}
+
+// LoadBalancer defines the client-side load balancing configuration.
+// Each attempt (including retries and hedged requests) is sent to one of the targets by replacing the host of the
+// request URL (the requests can use any host, e.g. "http://payments/v1/charges").
+//
+// The targets are either static (Targets) or discovered by a Resolver (e.g. DNSSRVResolver or KubernetesResolver).  The
+// service is resolved during initialization and then refreshed in the background (when the TTL returned by the
+// resolver expires) until the client is closed; when resolving fails, the previous targets are kept.
+//
+// The health of each target is tracked passively: a target that fails FailureThreshold consecutive attempts (with an error or a
+// 5xx response) is ejected for EjectionDuration.  After the ejection, the target is healthy again once an attempt
+// succeeds; a failure ejects it again immediately.  When all targets are ejected, the target whose ejection ends first
+// is used (rather than failing the request).  Targets can also be checked actively (see HealthCheck).
+type LoadBalancer struct {
+	// Targets are the (static) upstream hosts
+	Targets []Target
+
+	// Resolver (optionally) discovers the targets of Service (in addition to any static Targets)
+	Resolver Resolver
+
+	// Service is the name of the service resolved by the Resolver (e.g. "_http._tcp.payments.service.consul")
+	Service string
+
+	// Strategy defines how the target of each attempt is picked (default: BalanceRoundRobin)
+	Strategy BalanceStrategy
+
+	// FailureThreshold is the number of consecutive failures that ejects a target (default: 5)
+	FailureThreshold int
+
+	// EjectionDuration is how long an ejected target receives no attempts (default: 30s)
+	EjectionDuration time.Duration
+
+	// HealthCheck (optionally) enables the active health checking of the targets (see HealthCheck)
+	HealthCheck *HealthCheck
+
+	// KeepHostHeader sends the Host header of the original request (e.g. when the targets are addresses of the same
+	// virtual host).  By default the Host header is that of the target.
+	KeepHostHeader bool
+
+	name             string
+	failureThreshold int
+	ejectionDuration time.Duration
+	instrumentation  Instrumentation
+
+	mutex   sync.Mutex
+	targets []*lbTarget
+	next    int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// lbTarget is a target and its state (guarded by the mutex of the LoadBalancer)
+type lbTarget struct {
+	Target
+
+	inFlight      int
+	failures      int
+	ejected       bool
+	ejectedUntil  time.Time
+	currentWeight int
+
+	// the state of the active health checks (down targets are ejected until they pass the health checks)
+	down           bool
+	checkFailures  int
+	checkSuccesses int
+}
+
+// Status returns a snapshot of the targets
+func (l *LoadBalancer) Status() []TargetStatus {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	out := make([]TargetStatus, 0, len(l.targets))
+
+	for _, target := range l.targets {
+		out = append(out, TargetStatus{
+			Target:   target.Target,
+			Healthy:  !target.ejected,
+			InFlight: target.inFlight,
+		})
+	}
+
+	return out
+}
+
+func (l *LoadBalancer) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		// requests sent to the failover secondary keep its host
+		if isFailover(req.Context()) {
+			return doFunc(req)
+		}
+
+		target := l.pick()
+		if target == nil {
+			return nil, ErrNoTargets
+		}
+
+		originalHost := req.URL.Host
+
+		req = req.Clone(req.Context())
+		req.URL.Host = target.Host
+
+		switch {
+		case !l.KeepHostHeader:
+			req.Host = target.Host
+
+		case req.Host == "":
+			req.Host = originalHost
+		}
+
+		resp, err := doFunc(req)
+
+		// attempts cancelled by the caller (or by hedging) say nothing about the health of the target
+		cancelled := err != nil && req.Context().Err() != nil
+
+		l.record(target, cancelled, err == nil && resp.StatusCode < http.StatusInternalServerError)
+
+		return resp, err
+	}
+}
+
+// pick returns the target of the next attempt (nil when there are no targets)
+func (l *LoadBalancer) pick() *lbTarget {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+
+	candidates := make([]*lbTarget, 0, len(l.targets))
+
+	for _, target := range l.targets {
+		if !target.down && !target.ejectedUntil.After(now) {
+			candidates = append(candidates, target)
+		}
+	}
+
+	if len(candidates) == 0 {
+		// all the targets are ejected; fail open with the target whose ejection ends first
+		var earliest *lbTarget
+
+		for _, target := range l.targets {
+			if earliest == nil || target.ejectedUntil.Before(earliest.ejectedUntil) {
+				earliest = target
+			}
+		}
+
+		if earliest == nil {
+			return nil
+		}
+
+		candidates = append(candidates, earliest)
+	}
+
+	var picked *lbTarget
+
+	switch l.Strategy {
+	case BalanceWeighted:
+		picked = pickWeighted(candidates)
+
+	case BalanceLeastLoaded:
+		for _, target := range candidates {
+			if picked == nil || target.inFlight < picked.inFlight {
+				picked = target
+			}
+		}
+
+	default:
+		picked = candidates[l.next%len(candidates)]
+		l.next++
+	}
+
+	picked.inFlight++
+
+	return picked
+}
+
+// pickWeighted implements smooth weighted round-robin (the caller must hold the mutex)
+func pickWeighted(candidates []*lbTarget) *lbTarget {
+	var picked *lbTarget
+
+	total := 0
+
+	for _, target := range candidates {
+		weight := target.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		target.currentWeight += weight
+		total += weight
+
+		if picked == nil || target.currentWeight > picked.currentWeight {
+			picked = target
+		}
+	}
+
+	picked.currentWeight -= total
+
+	return picked
+}
+
+// record records the result of an attempt to the target
+func (l *LoadBalancer) record(target *lbTarget, cancelled bool, success bool) {
+	l.mutex.Lock()
+
+	target.inFlight--
+
+	var changed, healthy bool
+
+	switch {
+	case cancelled:
+		// ignored
+
+	case success:
+		target.failures = 0
+
+		// targets that are down are only re-admitted by the health checks
+		if target.ejected && !target.down {
+			target.ejected = false
+			changed, healthy = true, true
+		}
+
+	default:
+		target.failures++
+
+		// a target that fails after its ejection ended is ejected again immediately
+		if target.failures >= l.failureThreshold || target.ejected {
+			target.ejectedUntil = time.Now().Add(l.ejectionDuration)
+			target.failures = 0
+
+			// the health checks must pass again (after the ejection) to re-admit the target
+			target.checkSuccesses = 0
+
+			if !target.ejected {
+				target.ejected = true
+				changed, healthy = true, false
+			}
+		}
+	}
+
+	l.mutex.Unlock()
+
+	if changed {
+		l.instrumentation.TargetHealthChange(l.name, target.Host, healthy)
+	}
+}
+
+func (l *LoadBalancer) getFailureThreshold() int {
+	if l.FailureThreshold > 0 {
+		return l.FailureThreshold
+	}
+
+	l.instrumentation.InitWarning("using default 'failure threshold' setting for load balancer")
+
+	return defaultLBFailureThreshold
+}
+
+func (l *LoadBalancer) getEjectionDuration() time.Duration {
+	if l.EjectionDuration > 0 {
+		return l.EjectionDuration
+	}
+
+	l.instrumentation.InitWarning("using default 'ejection duration' setting for load balancer")
+
+	return defaultLBEjectionDuration
+}
+
+func (l *LoadBalancer) validate() error {
+	switch {
+	case len(l.Targets) == 0 && l.Resolver == nil:
+		return errors.New("load balancer requires at least one target or a resolver")
+
+	case l.Resolver != nil && l.Service == "":
+		return errors.New("load balancer resolver requires a service")
+
+	case l.Strategy < BalanceRoundRobin || l.Strategy > BalanceLeastLoaded:
+		return errors.New("unknown load balancer strategy")
+
+	case l.FailureThreshold < 0 || l.EjectionDuration < 0:
+		return errors.New("load balancer failure threshold and ejection duration cannot be negative")
+	}
+
+	if l.HealthCheck != nil {
+		err := l.HealthCheck.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, target := range l.Targets {
+		switch {
+		case target.Host == "":
+			return errors.New("load balancer target host is required")
+
+		case target.Weight < 0:
+			return fmt.Errorf("load balancer target '%s' weight cannot be negative", target.Host)
+		}
+	}
+
+	return nil
+}
+
+func (l *LoadBalancer) addMiddleware(doFunc requestClosure) requestClosure {
+	if l == nil {
+		return doFunc
+	}
+
+	return l.buildMiddleware(doFunc)
+}
+
+func (l *LoadBalancer) doInitOnce(instrumentation Instrumentation, name string, client *http.Client) {
+	if l == nil {
+		return
+	}
+
+	l.name = name
+	l.instrumentation = instrumentation
+
+	l.failureThreshold = l.getFailureThreshold()
+	l.ejectionDuration = l.getEjectionDuration()
+
+	l.targets = make([]*lbTarget, 0, len(l.Targets))
+
+	for _, target := range l.Targets {
+		l.targets = append(l.targets, &lbTarget{Target: target})
+	}
+
+	l.done = make(chan struct{})
+
+	l.resolve()
+
+	l.healthCheck(client)
+}
+
+// close stops refreshing the targets (see Client.Close)
+func (l *LoadBalancer) close() {
+	if l == nil || l.done == nil {
+		return
+	}
+
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// clone returns a copy of the configuration (without the state of the targets) for a variant of the client (see
+// Client.Clone)
+func (l *LoadBalancer) clone() *LoadBalancer {
+	if l == nil {
+		return nil
+	}
+
+	return &LoadBalancer{
+		Targets:          append([]Target(nil), l.Targets...),
+		Resolver:         l.Resolver,
+		Service:          l.Service,
+		Strategy:         l.Strategy,
+		FailureThreshold: l.FailureThreshold,
+		EjectionDuration: l.EjectionDuration,
+		HealthCheck:      l.HealthCheck,
+		KeepHostHeader:   l.KeepHostHeader,
+	}
+}
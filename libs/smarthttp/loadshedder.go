@@ -0,0 +1,233 @@
+package smarthttp
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoadShedderWindow      = 10 * time.Second
+	defaultLoadShedderMinSamples  = 50
+	defaultLoadShedderMaxShedRate = 0.9
+
+	// the number of latencies that are kept
+	loadShedderSamples = 1024
+
+	// how often the p99 latency is recalculated
+	loadShedderRecalcInterval = 1 * time.Second
+)
+
+// ErrLoadShed indicates that the request was rejected because the latency of the upstream is too high (see LoadShedder)
+var ErrLoadShed = errors.New("request shed due to upstream latency")
+
+// LoadShedder defines the latency-based load shedding configuration.
+// The latency of the requests is tracked and when the p99 latency exceeds the threshold (i.e. the upstream is browning
+// out), a fraction of the requests is rejected (with ErrLoadShed) before they are sent, so that the upstream can recover
+// before the circuit trips.  The fraction grows with the latency: it is the excess of the p99 latency over the threshold
+// (e.g. 0.5 when the p99 is 1.5 times the threshold), up to MaxShedRate.
+//
+// Requests are shed by priority (see WithPriority): PriorityLow requests are shed at the full rate, PriorityNormal
+// requests at half of the rate and PriorityHigh requests are never shed.
+type LoadShedder struct {
+	// LatencyThreshold is the p99 latency above which requests are shed (required)
+	LatencyThreshold time.Duration
+
+	// Window is the period over which the latency (of up to the latest 1024 requests) is tracked (default: 10 seconds)
+	Window time.Duration
+
+	// MinSamples is the minimum number of requests in the window before requests are shed (default: 50)
+	MinSamples int
+
+	// MaxShedRate is the maximum fraction of the (PriorityLow) requests that are shed (default: 0.9)
+	MaxShedRate float64
+
+	mutex      sync.Mutex
+	samples    [loadShedderSamples]latencySample
+	next       int
+	p99        time.Duration
+	calculated time.Time
+
+	window          time.Duration
+	minSamples      int
+	maxShedRate     float64
+	instrumentation Instrumentation
+}
+
+// latencySample is the latency of a request
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+func (l *LoadShedder) getWindow() time.Duration {
+	if l.Window > 0 {
+		return l.Window
+	}
+
+	l.instrumentation.InitWarning("using default 'window' setting for load shedder")
+
+	return defaultLoadShedderWindow
+}
+
+func (l *LoadShedder) getMinSamples() int {
+	if l.MinSamples > 0 {
+		return l.MinSamples
+	}
+
+	l.instrumentation.InitWarning("using default 'min samples' setting for load shedder")
+
+	return defaultLoadShedderMinSamples
+}
+
+func (l *LoadShedder) getMaxShedRate() float64 {
+	if l.MaxShedRate > 0 {
+		return l.MaxShedRate
+	}
+
+	l.instrumentation.InitWarning("using default 'max shed rate' setting for load shedder")
+
+	return defaultLoadShedderMaxShedRate
+}
+
+func (l *LoadShedder) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		p99, rate := l.shedRate(priorityOf(req))
+		if rate > 0 && rand.Float64() < rate { // nolint: gosec
+			l.instrumentation.LoadShed(req, p99)
+
+			return nil, ErrLoadShed
+		}
+
+		start := time.Now()
+
+		resp, err := doFunc(req)
+
+		// cancelled requests say nothing about the latency of the upstream
+		if req.Context().Err() == nil {
+			l.record(start)
+		}
+
+		return resp, err
+	}
+}
+
+// shedRate returns the p99 latency and the fraction of the requests of the priority that are shed
+func (l *LoadShedder) shedRate(priority Priority) (time.Duration, float64) {
+	if priority >= PriorityHigh {
+		return 0, 0
+	}
+
+	p99 := l.getP99()
+	if p99 <= l.LatencyThreshold {
+		return p99, 0
+	}
+
+	rate := float64(p99-l.LatencyThreshold) / float64(l.LatencyThreshold)
+	if rate > l.maxShedRate {
+		rate = l.maxShedRate
+	}
+
+	if priority == PriorityNormal {
+		rate /= 2
+	}
+
+	return p99, rate
+}
+
+func (l *LoadShedder) record(start time.Time) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.samples[l.next] = latencySample{at: now, latency: now.Sub(start)}
+	l.next = (l.next + 1) % loadShedderSamples
+}
+
+// getP99 returns the p99 latency of the window (recalculated at most once per interval), or 0 when there are not enough
+// samples
+func (l *LoadShedder) getP99() time.Duration {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.calculated) < loadShedderRecalcInterval {
+		return l.p99
+	}
+
+	l.calculated = now
+
+	latencies := make([]time.Duration, 0, loadShedderSamples)
+
+	for _, sample := range l.samples {
+		if !sample.at.IsZero() && now.Sub(sample.at) <= l.window {
+			latencies = append(latencies, sample.latency)
+		}
+	}
+
+	if len(latencies) < l.minSamples {
+		l.p99 = 0
+
+		return 0
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	l.p99 = latencies[(len(latencies)*99)/100]
+
+	return l.p99
+}
+
+func (l *LoadShedder) validate() error {
+	if l.LatencyThreshold <= 0 {
+		return errors.New("load shedder requires a latency threshold")
+	}
+
+	if l.MaxShedRate < 0 || l.MaxShedRate > 1 {
+		return errors.New("load shedder max shed rate must be between 0 and 1")
+	}
+
+	return nil
+}
+
+func (l *LoadShedder) addMiddleware(doFunc requestClosure) requestClosure {
+	if l == nil {
+		return doFunc
+	}
+
+	return l.buildMiddleware(doFunc)
+}
+
+func (l *LoadShedder) doInitOnce(instrumentation Instrumentation) {
+	if l == nil {
+		return
+	}
+
+	l.instrumentation = instrumentation
+
+	l.window = l.getWindow()
+	l.minSamples = l.getMinSamples()
+	l.maxShedRate = l.getMaxShedRate()
+}
+
+// clone returns a copy of the configuration (with its own latency samples) for a variant of the client (see
+// Client.Clone)
+func (l *LoadShedder) clone() *LoadShedder {
+	if l == nil {
+		return nil
+	}
+
+	return &LoadShedder{
+		LatencyThreshold: l.LatencyThreshold,
+		Window:           l.Window,
+		MinSamples:       l.MinSamples,
+		MaxShedRate:      l.MaxShedRate,
+	}
+}
@@ -0,0 +1,29 @@
+package smarthttp
+
+import (
+	"net/http"
+)
+
+// RoundTripFunc performs a single HTTP request
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps a RoundTripFunc to add behavior before and/or after the request (e.g. auth, tracing or metrics).
+// Middleware must call next (at most once per call) to continue the chain, or return a response/error to short-circuit it.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use adds middleware to the client.
+// Middleware is applied to each attempt (i.e. inside the retries, hedging and circuit breaker) so that it sees every
+// request sent to the upstream.  Middleware added first is called first.
+// Note: Use must be called before the client is used (the middleware chain is built by the first request).
+func (c *Client) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// applyMiddleware wraps the function with the user supplied middleware
+func (c *Client) applyMiddleware(doFunc requestClosure) requestClosure {
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		doFunc = requestClosure(c.middleware[i](RoundTripFunc(doFunc)))
+	}
+
+	return doFunc
+}
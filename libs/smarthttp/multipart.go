@@ -0,0 +1,282 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// MultipartPart is a part (a form field or a file) of a multipart/form-data request (see NewMultipartRequest)
+type MultipartPart struct {
+	// Name is the name of the form field
+	Name string
+
+	// FileName (optionally) is the name of the file (for file parts)
+	FileName string
+
+	// ContentType (optionally) is the Content-Type of the part (default: application/octet-stream for files and none for
+	// other fields)
+	ContentType string
+
+	// Content is the content of the part; it is streamed (rather than read into memory)
+	Content io.Reader
+
+	// Open (optionally) opens the content of the part (e.g. the file) so that it can be sent again by a retry.  It is also
+	// used for the first attempt when Content is not set.
+	Open func() (io.ReadCloser, error)
+
+	// Size (optionally) is the size of the content in bytes; when the size of every part is set, the Content-Length of
+	// the request is set
+	Size int64
+}
+
+// MultipartOptions defines how the multipart request is sent
+type MultipartOptions struct {
+	// Progress (optionally) is called as the body is sent with the number of bytes sent (by the current attempt) and the
+	// total size of the body (-1 when it is unknown)
+	Progress func(sent, total int64)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewMultipartRequest returns a POST of the parts as multipart/form-data.  The body is written as it is sent (from the
+// readers of the parts), so files are never held in memory.
+//
+// Retries (when retrying a POST is allowed, see Retries.IdempotentMethodsOnly): when every part has Open, the request
+// supplies GetBody and can be retried.  Otherwise, the body can only be retried when it fits in Retries.MaxBufferSize
+// (as the body is recorded while the first attempt sends it); larger bodies are not retried.
+func NewMultipartRequest(ctx context.Context, url string, parts []MultipartPart, opts *MultipartOptions) (*http.Request, error) {
+	if opts == nil {
+		opts = &MultipartOptions{}
+	}
+
+	for _, part := range parts {
+		if part.Content == nil && part.Open == nil {
+			return nil, fmt.Errorf("multipart part '%s' has neither content nor open", part.Name)
+		}
+	}
+
+	body := &multipartBody{
+		parts:    parts,
+		boundary: multipart.NewWriter(ioutil.Discard).Boundary(),
+		progress: opts.Progress,
+	}
+
+	body.total = body.size()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body.open(true))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+body.boundary)
+
+	if body.total >= 0 {
+		req.ContentLength = body.total
+	}
+
+	if body.replayable() {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return body.open(false), nil
+		}
+	}
+
+	return req, nil
+}
+
+// Upload sends the parts to the URL as a multipart/form-data POST (see NewMultipartRequest)
+func (c *Client) Upload(ctx context.Context, url string, parts []MultipartPart, opts *MultipartOptions) (*http.Response, error) {
+	req, err := NewMultipartRequest(ctx, url, parts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+// multipartBody writes the parts to a pipe as the request is sent
+type multipartBody struct {
+	parts    []MultipartPart
+	boundary string
+	total    int64
+	progress func(sent, total int64)
+}
+
+// open returns a new body; the first body uses the Content of the parts (when set) and the others use Open
+func (b *multipartBody) open(first bool) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	// the parts are written once the body is first read (so that a request that is never sent does not leak)
+	var body io.ReadCloser = &lazyPipeReader{
+		PipeReader: reader,
+		start: func() {
+			go func() {
+				writer.CloseWithError(b.write(writer, first))
+			}()
+		},
+	}
+
+	if b.progress != nil {
+		body = &progressReader{ReadCloser: body, total: b.total, progress: b.progress}
+	}
+
+	return body
+}
+
+func (b *multipartBody) write(w io.Writer, first bool) error {
+	mw := multipart.NewWriter(w)
+
+	err := mw.SetBoundary(b.boundary)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range b.parts {
+		partWriter, err := mw.CreatePart(part.header())
+		if err != nil {
+			return err
+		}
+
+		err = part.copyTo(partWriter, first)
+		if err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// size returns the size of the body (-1 when the size of a part is not set)
+func (b *multipartBody) size() int64 {
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+
+	if mw.SetBoundary(b.boundary) != nil {
+		return -1
+	}
+
+	var total int64
+
+	for _, part := range b.parts {
+		if part.Size <= 0 {
+			return -1
+		}
+
+		_, _ = mw.CreatePart(part.header())
+		total += part.Size
+	}
+
+	_ = mw.Close()
+
+	return total + counter.n
+}
+
+func (b *multipartBody) replayable() bool {
+	for _, part := range b.parts {
+		if part.Open == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *MultipartPart) header() textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+
+	disposition := `form-data; name="` + quoteEscaper.Replace(p.Name) + `"`
+	if p.FileName != "" {
+		disposition += `; filename="` + quoteEscaper.Replace(p.FileName) + `"`
+	}
+
+	header.Set("Content-Disposition", disposition)
+
+	switch {
+	case p.ContentType != "":
+		header.Set("Content-Type", p.ContentType)
+
+	case p.FileName != "":
+		header.Set("Content-Type", "application/octet-stream")
+	}
+
+	return header
+}
+
+func (p *MultipartPart) copyTo(w io.Writer, first bool) error {
+	if first && p.Content != nil {
+		_, err := io.Copy(w, p.Content)
+
+		return err
+	}
+
+	if p.Open == nil {
+		return errors.New("multipart part cannot be sent again")
+	}
+
+	content, err := p.Open()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = content.Close()
+	}()
+
+	_, err = io.Copy(w, content)
+
+	return err
+}
+
+// lazyPipeReader starts the writer of the pipe when it is first read
+type lazyPipeReader struct {
+	*io.PipeReader
+
+	once  sync.Once
+	start func()
+}
+
+// Read implements io.Reader
+func (r *lazyPipeReader) Read(p []byte) (int, error) {
+	r.once.Do(r.start)
+
+	return r.PipeReader.Read(p)
+}
+
+// progressReader reports the number of bytes read
+type progressReader struct {
+	io.ReadCloser
+
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+// Read implements io.Reader
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		r.progress(r.sent, r.total)
+	}
+
+	return n, err
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	n int64
+}
+
+// Write implements io.Writer
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+
+	return len(p), nil
+}
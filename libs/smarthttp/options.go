@@ -0,0 +1,547 @@
+package smarthttp
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidConfig indicates that the configuration supplied to NewClient is invalid
+var ErrInvalidConfig = errors.New("invalid smarthttp config")
+
+// Option configures a Client created by NewClient
+type Option func(c *Client)
+
+// NewClient creates and initializes a Client with the supplied options.
+// Unlike a Client created as a struct literal (which is initialized lazily on first use), the configuration is validated
+// here and an error (wrapping ErrInvalidConfig) is returned when it is invalid.
+func NewClient(name string, opts ...Option) (*Client, error) {
+	c := &Client{Name: name}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	err := c.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	return c, nil
+}
+
+// WithName sets the name of the client (e.g. of a variant created by Client.Clone)
+func WithName(name string) Option {
+	return func(c *Client) {
+		c.Name = name
+	}
+}
+
+// WithTimeout sets the total timeout of a request (see Client.Timeout)
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.Timeout = timeout
+	}
+}
+
+// WithConnectTimeout sets the timeout of the connection phase of a request (see Client.ConnectTimeout)
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.ConnectTimeout = timeout
+	}
+}
+
+// WithMinimumRemaining sets the minimum time that must remain before the deadline for a request to be attempted (see
+// Client.MinimumRemaining)
+func WithMinimumRemaining(minimum time.Duration) Option {
+	return func(c *Client) {
+		c.MinimumRemaining = minimum
+	}
+}
+
+// WithMaxConns sets the connection pool limits (see Client.MaxIdleConns, Client.MaxIdleConnsPerHost and Client.MaxConnsPerHost)
+func WithMaxConns(maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost int) Option {
+	return func(c *Client) {
+		c.MaxIdleConns = maxIdleConns
+		c.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		c.MaxConnsPerHost = maxConnsPerHost
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection remains in the pool (see Client.IdleConnTimeout)
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.IdleConnTimeout = timeout
+	}
+}
+
+// WithTLSHandshakeTimeout sets the timeout for the TLS handshake (see Client.TLSHandshakeTimeout)
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout sets the time to wait for the response headers (see Client.ResponseHeaderTimeout)
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.ResponseHeaderTimeout = timeout
+	}
+}
+
+// WithExpectContinueTimeout sets the time to wait for a "100 Continue" response (see Client.ExpectContinueTimeout)
+func WithExpectContinueTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.ExpectContinueTimeout = timeout
+	}
+}
+
+// WithMaxResponseBytes sets the limit of the size of response bodies (see Client.MaxResponseBytes)
+func WithMaxResponseBytes(maxResponseBytes int64) Option {
+	return func(c *Client) {
+		c.MaxResponseBytes = maxResponseBytes
+	}
+}
+
+// WithTLS sets the TLS configuration of the default transport (see Client.TLS)
+func WithTLS(tlsConfig *TLS) Option {
+	return func(c *Client) {
+		c.TLS = tlsConfig
+	}
+}
+
+// WithProxyURL sets the proxy used by the default transport (see Client.ProxyURL)
+func WithProxyURL(proxyURL string) Option {
+	return func(c *Client) {
+		c.ProxyURL = proxyURL
+	}
+}
+
+// WithDialOverride sets the network and address dialed by the default transport (see DialOverride)
+func WithDialOverride(override *DialOverride) Option {
+	return func(c *Client) {
+		c.DialOverride = override
+	}
+}
+
+// WithUnixSocket sends the requests of the default transport to the unix domain socket at path (see DialOverride)
+func WithUnixSocket(path string) Option {
+	return WithDialOverride(&DialOverride{Network: "unix", Address: path})
+}
+
+// WithDNSCache sets the DNS cache of the default transport (see DNSCache)
+func WithDNSCache(cache *DNSCache) Option {
+	return func(c *Client) {
+		c.DNSCache = cache
+	}
+}
+
+// WithHostGuard sets the configuration that restricts the hosts requests can be sent to (see Client.HostGuard)
+func WithHostGuard(hostGuard *HostGuard) Option {
+	return func(c *Client) {
+		c.HostGuard = hostGuard
+	}
+}
+
+// WithCookieJar adds a cookie jar to the default HTTP client (see Client.EnableCookieJar and Client.CookieJar).
+// When the jar is nil, an in-memory jar is used.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Client) {
+		c.EnableCookieJar = true
+		c.CookieJar = jar
+	}
+}
+
+// WithRedirectPolicy sets the redirect policy of the default HTTP client (see Client.Redirect)
+func WithRedirectPolicy(policy *RedirectPolicy) Option {
+	return func(c *Client) {
+		c.Redirect = policy
+	}
+}
+
+// WithHTTP2 sets how the default transport uses HTTP/2 (see Client.HTTP2)
+func WithHTTP2(mode HTTP2Mode) Option {
+	return func(c *Client) {
+		c.HTTP2 = mode
+	}
+}
+
+// WithTransport sets the transport used to make requests.
+// Note: ErrConnectTimeout is only reported by transports created with GetTransportWithCustomDialer
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithHTTPClient sets the underlying HTTP client (see Client.Client).
+// Note: the timeouts and transport options are ignored when an HTTP client is supplied
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.Client = client
+	}
+}
+
+// WithInstrumentation sets the instrumentation (see Client.Instrumentation)
+func WithInstrumentation(instrumentation Instrumentation) Option {
+	return func(c *Client) {
+		c.Instrumentation = instrumentation
+	}
+}
+
+// WithRetries sets the retry configuration (see Client.Retries)
+func WithRetries(retries *Retries) Option {
+	return func(c *Client) {
+		c.Retries = retries
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker configuration (see Client.CircuitBreaker)
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(c *Client) {
+		c.CircuitBreaker = cb
+	}
+}
+
+// WithLoadBalancer sets the client-side load balancing configuration (see LoadBalancer)
+func WithLoadBalancer(lb *LoadBalancer) Option {
+	return func(c *Client) {
+		c.LoadBalancer = lb
+	}
+}
+
+// WithFailover sets the failover configuration (see Failover)
+func WithFailover(failover *Failover) Option {
+	return func(c *Client) {
+		c.Failover = failover
+	}
+}
+
+// WithSingleflight sets the single-flight configuration (see Client.Singleflight)
+func WithSingleflight(sf *Singleflight) Option {
+	return func(c *Client) {
+		c.Singleflight = sf
+	}
+}
+
+// WithHedging sets the hedged requests configuration (see Client.Hedging)
+func WithHedging(hedging *Hedging) Option {
+	return func(c *Client) {
+		c.Hedging = hedging
+	}
+}
+
+// WithRateLimit sets the client-side rate limiting configuration (see Client.RateLimit)
+func WithRateLimit(rateLimit *RateLimit) Option {
+	return func(c *Client) {
+		c.RateLimit = rateLimit
+	}
+}
+
+// WithBulkhead sets the concurrency limiting configuration (see Client.Bulkhead)
+func WithBulkhead(bulkhead *Bulkhead) Option {
+	return func(c *Client) {
+		c.Bulkhead = bulkhead
+	}
+}
+
+// WithAdaptiveConcurrency sets the adaptive concurrency limiting configuration (see Client.AdaptiveConcurrency)
+func WithAdaptiveConcurrency(adaptive *AdaptiveConcurrency) Option {
+	return func(c *Client) {
+		c.AdaptiveConcurrency = adaptive
+	}
+}
+
+// WithCache sets the HTTP response cache configuration (see Client.Cache)
+func WithCache(cache *Cache) Option {
+	return func(c *Client) {
+		c.Cache = cache
+	}
+}
+
+// WithAsync sets the asynchronous requests configuration (see Client.Async)
+func WithAsync(async *Async) Option {
+	return func(c *Client) {
+		c.Async = async
+	}
+}
+
+// WithOutbox sets the durable outbox configuration (see Client.Outbox)
+func WithOutbox(outbox *Outbox) Option {
+	return func(c *Client) {
+		c.Outbox = outbox
+	}
+}
+
+// WithWebhook sets the webhook signing configuration (see Client.Webhook)
+func WithWebhook(webhook *Webhook) Option {
+	return func(c *Client) {
+		c.Webhook = webhook
+	}
+}
+
+// WithLoadShedder sets the latency-based load shedding configuration (see Client.LoadShedder)
+func WithLoadShedder(loadShedder *LoadShedder) Option {
+	return func(c *Client) {
+		c.LoadShedder = loadShedder
+	}
+}
+
+// WithPoolMetrics sets the connection pool metrics configuration (see Client.PoolMetrics)
+func WithPoolMetrics(poolMetrics *PoolMetrics) Option {
+	return func(c *Client) {
+		c.PoolMetrics = poolMetrics
+	}
+}
+
+// WithChaos sets the fault injection configuration (see Client.Chaos)
+func WithChaos(chaos *Chaos) Option {
+	return func(c *Client) {
+		c.Chaos = chaos
+	}
+}
+
+// WithDefaultHeaders sets the headers added to every request (see Client.DefaultHeaders)
+func WithDefaultHeaders(headers http.Header) Option {
+	return func(c *Client) {
+		c.DefaultHeaders = headers
+	}
+}
+
+// WithUserAgent sets the User-Agent of the client (see Client.UserAgent)
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithRequestIDPropagation sets the request ID propagation configuration (see Client.RequestID)
+func WithRequestIDPropagation(requestID *RequestID) Option {
+	return func(c *Client) {
+		c.RequestID = requestID
+	}
+}
+
+// WithPropagation sets the trace header propagation configuration (see Client.Propagation)
+func WithPropagation(propagation *Propagation) Option {
+	return func(c *Client) {
+		c.Propagation = propagation
+	}
+}
+
+// WithCompression sets the request and response compression configuration (see Client.Compression)
+func WithCompression(compression *Compression) Option {
+	return func(c *Client) {
+		c.Compression = compression
+	}
+}
+
+// WithDebugDump enables the dumping of all requests and responses to the Instrumentation (see Client.Debug)
+func WithDebugDump(debug *Debug) Option {
+	return func(c *Client) {
+		c.Debug = debug
+	}
+}
+
+// WithValidateResponse sets the validation of the responses (see Client.ValidateResponse)
+func WithValidateResponse(validate func(resp *http.Response) error) Option {
+	return func(c *Client) {
+		c.ValidateResponse = validate
+	}
+}
+
+// WithSigner sets the request signer (see Client.Signer)
+func WithSigner(signer Signer) Option {
+	return func(c *Client) {
+		c.Signer = signer
+	}
+}
+
+// WithMiddleware adds middleware to the client (see Client.Use)
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) {
+		c.Use(middleware...)
+	}
+}
+
+// validate returns an error describing the first invalid setting found (if any)
+// nolint: gocyclo
+func (c *Client) validate() error {
+	switch {
+	case c.Name == "":
+		return errors.New("name is required")
+
+	case c.Timeout < 0:
+		return errors.New("timeout cannot be negative")
+
+	case c.ConnectTimeout < 0:
+		return errors.New("connect timeout cannot be negative")
+
+	case c.ConnectTimeout > 0 && c.ConnectTimeout >= durationOrDefault(c.Timeout, defaultTimeout):
+		return errors.New("connect timeout must be less than timeout (otherwise connection timeouts cannot be detected)")
+
+	case c.MinimumRemaining < 0:
+		return errors.New("minimum remaining cannot be negative")
+
+	case c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0:
+		return errors.New("connection limits cannot be negative")
+
+	case c.IdleConnTimeout < 0 || c.TLSHandshakeTimeout < 0 || c.ResponseHeaderTimeout < 0 || c.ExpectContinueTimeout < 0:
+		return errors.New("transport timeouts cannot be negative")
+
+	case c.MaxResponseBytes < 0:
+		return errors.New("max response bytes cannot be negative")
+
+	case c.HTTP2 < HTTP2Auto || c.HTTP2 > HTTP2Cleartext:
+		return errors.New("unknown HTTP/2 mode")
+
+	case c.CircuitBreaker.ErrorPercentThreshold < 0 || c.CircuitBreaker.ErrorPercentThreshold > 100:
+		return errors.New("circuit breaker error percent threshold must be between 0 and 100")
+
+	case c.CircuitBreaker.ErrorPercentThreshold > 0 && c.CircuitBreaker.ErrorPercentThreshold < minErrorThreshold:
+		return fmt.Errorf("circuit breaker error percent threshold cannot be set below %d", minErrorThreshold)
+
+	case c.CircuitBreaker.MaxConcurrentRequests < 0:
+		return errors.New("circuit breaker max concurrent requests cannot be negative")
+	}
+
+	if c.HostGuard != nil {
+		err := c.HostGuard.parse()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.TLS != nil {
+		_, err := c.TLS.build(&NoopInstrumentation{}, c.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ProxyURL != "" {
+		_, err := parseProxyURL(c.ProxyURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.DialOverride != nil {
+		err := c.DialOverride.validate()
+		if err != nil {
+			return err
+		}
+
+		if c.ProxyURL != "" || c.HostGuard != nil || c.DNSCache != nil {
+			return errors.New("dial override cannot be used with a proxy URL, host guard or DNS cache")
+		}
+	}
+
+	if c.Retries != nil {
+		switch {
+		case c.Retries.MaxAttempts < 0:
+			return errors.New("retries max attempts cannot be negative")
+
+		case c.Retries.BaseDelay < 0 || c.Retries.MaxDelay < 0:
+			return errors.New("retry delays cannot be negative")
+
+		case c.Retries.MaxDelay > 0 && c.Retries.BaseDelay > c.Retries.MaxDelay:
+			return errors.New("retries base delay cannot be greater than max delay")
+		}
+	}
+
+	if c.LoadBalancer != nil {
+		err := c.LoadBalancer.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.DNSCache != nil {
+		err := c.DNSCache.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Failover != nil {
+		err := c.Failover.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Bulkhead != nil && (c.Bulkhead.MaxConcurrent < 0 || c.Bulkhead.MaxQueue < 0) {
+		return errors.New("bulkhead limits cannot be negative")
+	}
+
+	if c.AdaptiveConcurrency != nil && c.AdaptiveConcurrency.MaxLimit > 0 &&
+		c.AdaptiveConcurrency.MinLimit > c.AdaptiveConcurrency.MaxLimit {
+		return errors.New("adaptive concurrency min limit cannot be greater than max limit")
+	}
+
+	if c.AdaptiveConcurrency != nil &&
+		(c.AdaptiveConcurrency.LowPriorityHeadroom < 0 || c.AdaptiveConcurrency.LowPriorityHeadroom >= 1) {
+		return errors.New("adaptive concurrency low priority headroom must be between 0 and 1")
+	}
+
+	if c.Compression != nil && c.Compression.RequestThreshold < 0 {
+		return errors.New("compression request threshold cannot be negative")
+	}
+
+	if c.Compression != nil && (c.Compression.Level < gzip.HuffmanOnly || c.Compression.Level > gzip.BestCompression) {
+		return errors.New("invalid compression level")
+	}
+
+	if c.RateLimit != nil && c.RateLimit.Limiter == nil {
+		return errors.New("rate limit requires a limiter")
+	}
+
+	if c.Async != nil {
+		err := c.Async.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Outbox != nil {
+		err := c.Outbox.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Webhook != nil {
+		err := c.Webhook.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.LoadShedder != nil {
+		err := c.LoadShedder.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.PoolMetrics != nil {
+		err := c.PoolMetrics.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Chaos != nil {
+		err := c.Chaos.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
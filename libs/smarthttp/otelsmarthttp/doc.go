@@ -0,0 +1,14 @@
+// Package otelsmarthttp provides OpenTelemetry tracing for smarthttp clients.
+//
+// It is a separate module so that users of smarthttp who do not use OpenTelemetry do not depend on it.
+//
+// Middleware starts a client span for each attempt (i.e. each request sent to the upstream, including retries and
+// hedges) and injects the trace context (traceparent/tracestate) into the request headers:
+//
+//	client.Use(otelsmarthttp.Middleware())
+//
+// NewInstrumentation records the resilience events of a request (retries, hedges, open circuits, rejections, etc) as
+// events on the span of the caller:
+//
+//	client.Instrumentation = otelsmarthttp.NewInstrumentation(client.Instrumentation)
+package otelsmarthttp
@@ -0,0 +1,28 @@
+module github.com/karelrenaldi/storemono/libs/smarthttp/otelsmarthttp
+
+go 1.20
+
+require (
+	github.com/karelrenaldi/storemono/libs/smarthttp v0.0.0
+	go.opentelemetry.io/otel v1.19.0
+	go.opentelemetry.io/otel/trace v1.19.0
+)
+
+require (
+	github.com/afex/hystrix-go v0.0.0-20180502004556-fa1af6a1f4f5 // indirect
+	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/joho/godotenv v1.4.0 // indirect
+	github.com/karelrenaldi/storemono/libs/config v0.0.0 // indirect
+	github.com/sony/gobreaker v0.5.0 // indirect
+	go.opentelemetry.io/otel/metric v1.19.0 // indirect
+	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781 // indirect
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e // indirect
+	golang.org/x/text v0.3.6 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
+
+replace github.com/karelrenaldi/storemono/libs/smarthttp => ../
+
+replace github.com/karelrenaldi/storemono/libs/config => ../../config
@@ -0,0 +1,144 @@
+package otelsmarthttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumentation records smarthttp events as events on the span in the request's context (i.e. the span of the caller).
+// All events are also passed to the wrapped Instrumentation.
+type Instrumentation struct {
+	smarthttp.Instrumentation
+}
+
+// NewInstrumentation returns an Instrumentation that wraps the supplied Instrumentation (which may be nil)
+func NewInstrumentation(instrumentation smarthttp.Instrumentation) *Instrumentation {
+	if instrumentation == nil {
+		instrumentation = &smarthttp.NoopInstrumentation{}
+	}
+
+	return &Instrumentation{Instrumentation: instrumentation}
+}
+
+// Redirect implements smarthttp.Instrumentation
+func (i *Instrumentation) Redirect(req *http.Request, hop int) {
+	addEvent(req, "redirect", attribute.String("host", req.URL.Host), attribute.Int("hop", hop))
+
+	i.Instrumentation.Redirect(req, hop)
+}
+
+// Flush implements smarthttp.Flusher; the wrapped Instrumentation is flushed when it supports it
+func (i *Instrumentation) Flush() error {
+	if flusher, ok := i.Instrumentation.(smarthttp.Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// CBCircuitOpen implements smarthttp.Instrumentation
+func (i *Instrumentation) CBCircuitOpen(req *http.Request) {
+	addEvent(req, "circuit_open")
+
+	i.Instrumentation.CBCircuitOpen(req)
+}
+
+// RetryRetriable implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryRetriable(req *http.Request, code int, attempt int) {
+	addEvent(req, "retry", semconv.HTTPStatusCode(code), attribute.Int("attempt", attempt))
+
+	i.Instrumentation.RetryRetriable(req, code, attempt)
+}
+
+// RetryNonRetriable implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryNonRetriable(req *http.Request, code int, attempt int) {
+	addEvent(req, "retry_stopped", semconv.HTTPStatusCode(code), attribute.Int("attempt", attempt))
+
+	i.Instrumentation.RetryNonRetriable(req, code, attempt)
+}
+
+// RetryRetriableErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	addEvent(req, "retry", attribute.String("error.class", string(class)), attribute.Int("attempt", attempt))
+
+	i.Instrumentation.RetryRetriableErr(req, class, attempt)
+}
+
+// RetryNonRetriableErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryNonRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	addEvent(req, "retry_stopped", attribute.String("error.class", string(class)), attribute.Int("attempt", attempt))
+
+	i.Instrumentation.RetryNonRetriableErr(req, class, attempt)
+}
+
+// FailoverSent implements smarthttp.Instrumentation
+func (i *Instrumentation) FailoverSent(req *http.Request, reason string) {
+	addEvent(req, "failover", attribute.String("host", req.URL.Host), attribute.String("reason", reason))
+
+	i.Instrumentation.FailoverSent(req, reason)
+}
+
+// HedgeSent implements smarthttp.Instrumentation
+func (i *Instrumentation) HedgeSent(req *http.Request, hedge int) {
+	addEvent(req, "hedge_sent", attribute.Int("hedge", hedge))
+
+	i.Instrumentation.HedgeSent(req, hedge)
+}
+
+// BulkheadQueued implements smarthttp.Instrumentation
+func (i *Instrumentation) BulkheadQueued(req *http.Request, wait time.Duration) {
+	addEvent(req, "bulkhead_queued", attribute.Int64("wait_ms", wait.Milliseconds()))
+
+	i.Instrumentation.BulkheadQueued(req, wait)
+}
+
+// BulkheadRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) BulkheadRejected(req *http.Request) {
+	addEvent(req, "bulkhead_rejected")
+
+	i.Instrumentation.BulkheadRejected(req)
+}
+
+// ConcurrencyLimitRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) ConcurrencyLimitRejected(req *http.Request) {
+	addEvent(req, "concurrency_limit_rejected")
+
+	i.Instrumentation.ConcurrencyLimitRejected(req)
+}
+
+// RateLimitErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RateLimitErr(req *http.Request, err error) {
+	addEvent(req, "rate_limited", attribute.String("error", err.Error()))
+
+	i.Instrumentation.RateLimitErr(req, err)
+}
+
+// CacheHit implements smarthttp.Instrumentation
+func (i *Instrumentation) CacheHit(req *http.Request) {
+	addEvent(req, "cache_hit")
+
+	i.Instrumentation.CacheHit(req)
+}
+
+// CacheMiss implements smarthttp.Instrumentation
+func (i *Instrumentation) CacheMiss(req *http.Request) {
+	addEvent(req, "cache_miss")
+
+	i.Instrumentation.CacheMiss(req)
+}
+
+// SingleflightErr implements smarthttp.Instrumentation
+func (i *Instrumentation) SingleflightErr(req *http.Request, err error) {
+	addEvent(req, "singleflight_error", attribute.String("error", err.Error()))
+
+	i.Instrumentation.SingleflightErr(req, err)
+}
+
+func addEvent(req *http.Request, name string, attributes ...attribute.KeyValue) {
+	trace.SpanFromContext(req.Context()).AddEvent(name, trace.WithAttributes(attributes...))
+}
@@ -0,0 +1,110 @@
+package otelsmarthttp
+
+import (
+	"net/http"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the name of the tracer (i.e. the instrumentation scope)
+const tracerName = "github.com/karelrenaldi/storemono/libs/smarthttp/otelsmarthttp"
+
+// Option configures the Middleware
+type Option func(cfg *config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagators    propagation.TextMapPropagator
+	spanName       func(req *http.Request) string
+}
+
+// WithTracerProvider sets the tracer provider (default: the global tracer provider)
+func WithTracerProvider(tracerProvider trace.TracerProvider) Option {
+	return func(cfg *config) {
+		cfg.tracerProvider = tracerProvider
+	}
+}
+
+// WithPropagators sets the propagators used to inject the trace context into the request (default: the global propagators)
+func WithPropagators(propagators propagation.TextMapPropagator) Option {
+	return func(cfg *config) {
+		cfg.propagators = propagators
+	}
+}
+
+// WithSpanName sets the function that names the span of a request (default: "HTTP <method>")
+func WithSpanName(spanName func(req *http.Request) string) Option {
+	return func(cfg *config) {
+		cfg.spanName = spanName
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		propagators:    otel.GetTextMapPropagator(),
+		spanName:       defaultSpanName,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func defaultSpanName(req *http.Request) string {
+	return "HTTP " + req.Method
+}
+
+// Middleware returns smarthttp middleware that starts a client span for each attempt and injects the trace context into
+// the request headers.
+// Note: the span ends when the response headers are received (or the attempt fails); reading the body is not included.
+func Middleware(opts ...Option) smarthttp.Middleware {
+	cfg := newConfig(opts)
+
+	tracer := cfg.tracerProvider.Tracer(tracerName, trace.WithInstrumentationVersion(smarthttp.Version))
+
+	return func(next smarthttp.RoundTripFunc) smarthttp.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			ctx, span := tracer.Start(req.Context(), cfg.spanName(req),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.HTTPMethod(req.Method),
+					semconv.HTTPURL(req.URL.Redacted()),
+					semconv.NetPeerName(req.URL.Hostname()),
+				),
+			)
+			defer span.End()
+
+			if attempt := smarthttp.AttemptsFromContext(req.Context()); attempt > 1 {
+				span.SetAttributes(semconv.HTTPResendCount(attempt - 1))
+			}
+
+			// copy the request so that the caller's headers are not modified
+			req = req.Clone(ctx)
+			cfg.propagators.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+			resp, err := next(req)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+
+				return resp, err
+			}
+
+			span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+
+			if resp.StatusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			}
+
+			return resp, nil
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package smarthttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOutboxWorkers      = 4
+	defaultOutboxPollInterval = 1 * time.Second
+	defaultOutboxMaxAttempts  = 10
+	defaultOutboxBaseDelay    = 1 * time.Second
+	defaultOutboxMaxDelay     = 1 * time.Hour
+	defaultOutboxLease        = 1 * time.Minute
+
+	// the timeout of each call to the store
+	outboxStoreTimeout = 5 * time.Second
+)
+
+// ErrOutboxNotConfigured indicates that Enqueue was called on a client without Outbox
+var ErrOutboxNotConfigured = errors.New("outbox is not configured")
+
+// OutboxMessage is a request stored in the outbox (see Outbox)
+type OutboxMessage struct {
+	// ID identifies the message (a random UUID)
+	ID string `json:"id"`
+
+	// Method, URL, Header and Body define the request
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+
+	// CreatedAt is when the message was enqueued
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Attempts is the number of delivery attempts so far
+	Attempts int `json:"attempts"`
+
+	// NextAttempt is when the message is (next) due to be sent
+	NextAttempt time.Time `json:"nextAttempt"`
+
+	// LastError is the error of the last attempt
+	LastError string `json:"lastError,omitempty"`
+}
+
+// OutboxStore persists the messages of the outbox (e.g. in files, a database table or Redis).
+// It must be safe for concurrent use.
+type OutboxStore interface {
+	// Save adds or updates the message
+	Save(ctx context.Context, msg *OutboxMessage) error
+
+	// Claim returns up to limit messages that are due (i.e. NextAttempt is not after now) and sets their NextAttempt to
+	// leaseUntil, so that they are not claimed again (e.g. by another pod) while they are being sent
+	Claim(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*OutboxMessage, error)
+
+	// Delete removes the message (once it has been delivered)
+	Delete(ctx context.Context, id string) error
+
+	// DeadLetter moves the message to the dead letters (once it cannot be delivered)
+	DeadLetter(ctx context.Context, msg *OutboxMessage) error
+}
+
+// Outbox defines the durable outbox configuration: requests (typically webhooks) passed to Client.Enqueue are saved to
+// the Store and sent in the background (using Do, i.e. through the retries, the circuit breaker etc.).
+// Failed messages are sent again with an exponential backoff (across restarts) until they are delivered or have been
+// attempted MaxAttempts times, at which point they are dead-lettered.  Messages rejected by the upstream with a
+// non-retriable status (e.g. 400 or 404) are dead-lettered immediately.
+//
+// Delivery is at-least-once: a message that was sent but not yet deleted when the process stopped is sent again once
+// its lease expires, so the receivers must deduplicate the messages (e.g. using a delivery ID header).
+type Outbox struct {
+	// Store persists the messages
+	Store OutboxStore
+
+	// Workers is the number of messages that are sent concurrently (default: 4)
+	Workers int
+
+	// PollInterval is the interval between checks of the store for due messages (default: 1s)
+	PollInterval time.Duration
+
+	// MaxAttempts is the number of delivery attempts before the message is dead-lettered (default: 10)
+	MaxAttempts int
+
+	// BaseDelay and MaxDelay define the exponential backoff between delivery attempts (default: 1s and 1h)
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Lease is how long a claimed message is hidden from the other workers; it must be longer than sending the message
+	// takes, including the retries (default: 1m)
+	Lease time.Duration
+
+	name            string
+	instrumentation Instrumentation
+	doFunc          requestClosure
+	workers         int
+	pollInterval    time.Duration
+	maxAttempts     int
+	lease           time.Duration
+	backoff         *Retries
+
+	slots     chan struct{}
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	inFlight  sync.WaitGroup
+}
+
+// Enqueue saves the request to the outbox, from which it is sent in the background (see Outbox), and returns the ID
+// of the message.  The body of the request is read (and closed).
+func (c *Client) Enqueue(req *http.Request) (string, error) {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	if c.Outbox == nil {
+		return "", ErrOutboxNotConfigured
+	}
+
+	msg, err := newOutboxMessage(req)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.Outbox.Store.Save(req.Context(), msg)
+	if err != nil {
+		return "", err
+	}
+
+	c.Outbox.notify()
+
+	return msg.ID, nil
+}
+
+func newOutboxMessage(req *http.Request) (*OutboxMessage, error) {
+	var body []byte
+
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+
+	return &OutboxMessage{
+		ID:          newUUID(),
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Header:      req.Header.Clone(),
+		Body:        body,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}, nil
+}
+
+// request returns the request of the message
+func (m *OutboxMessage) request(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, m.Method, m.URL, bytes.NewReader(m.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range m.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	return req, nil
+}
+
+// notify wakes the poller (e.g. when a message has been enqueued)
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// poll claims the due messages and sends them until the outbox is closed
+func (o *Outbox) poll() {
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		o.claim()
+
+		select {
+		case <-o.done:
+			return
+
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// claim claims as many due messages as there are free workers and sends them
+func (o *Outbox) claim() {
+	free := cap(o.slots) - len(o.slots)
+	if free <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboxStoreTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	msgs, err := o.Store.Claim(ctx, now, now.Add(o.lease), free)
+	if err != nil {
+		o.instrumentation.OutboxStoreErr(o.name, err)
+
+		return
+	}
+
+	for _, msg := range msgs {
+		o.slots <- struct{}{}
+		o.inFlight.Add(1)
+
+		go func(msg *OutboxMessage) {
+			defer func() {
+				<-o.slots
+				o.inFlight.Done()
+			}()
+
+			o.deliver(msg)
+		}(msg)
+	}
+}
+
+// deliver sends the message and records the outcome in the store
+func (o *Outbox) deliver(msg *OutboxMessage) {
+	msg.Attempts++
+
+	req, err := msg.request(context.Background())
+	if err != nil {
+		// the message can never be sent
+		o.deadLetter(msg, nil, err)
+
+		return
+	}
+
+	resp, err := o.doFunc(req)
+	if err == nil {
+		if resp.StatusCode < http.StatusBadRequest {
+			discardResponse(resp)
+			o.store(func(ctx context.Context) error {
+				return o.Store.Delete(ctx, msg.ID)
+			})
+
+			return
+		}
+
+		// newAPIError reads (some of) the body
+		apiErr := newAPIError(resp)
+		discardResponse(resp)
+
+		err = apiErr
+
+		if !isRetriableDelivery(resp.StatusCode) {
+			o.deadLetter(msg, req, err)
+
+			return
+		}
+	}
+
+	if msg.Attempts >= o.maxAttempts {
+		o.deadLetter(msg, req, err)
+
+		return
+	}
+
+	o.instrumentation.OutboxDeliveryFailed(req, msg.Attempts, err, false)
+
+	msg.LastError = err.Error()
+	msg.NextAttempt = time.Now().Add(o.backoff.backoff(msg.Attempts - 1))
+
+	o.store(func(ctx context.Context) error {
+		return o.Store.Save(ctx, msg)
+	})
+}
+
+func (o *Outbox) deadLetter(msg *OutboxMessage, req *http.Request, err error) {
+	if req != nil {
+		o.instrumentation.OutboxDeliveryFailed(req, msg.Attempts, err, true)
+	}
+
+	msg.LastError = err.Error()
+
+	o.store(func(ctx context.Context) error {
+		return o.Store.DeadLetter(ctx, msg)
+	})
+}
+
+// store calls the store (with a timeout) and reports its error
+func (o *Outbox) store(call func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxStoreTimeout)
+	defer cancel()
+
+	err := call(ctx)
+	if err != nil {
+		o.instrumentation.OutboxStoreErr(o.name, err)
+	}
+}
+
+// isRetriableDelivery returns true when a message rejected with the status code can be sent again
+func isRetriableDelivery(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+
+	default:
+		return statusCode >= http.StatusInternalServerError
+	}
+}
+
+// close stops the poller and waits for the messages being sent (or the context to be done); the other messages stay
+// in the store
+func (o *Outbox) close(ctx context.Context) error {
+	if o == nil || o.done == nil {
+		return nil
+	}
+
+	o.closeOnce.Do(func() {
+		close(o.done)
+	})
+
+	done := make(chan struct{})
+
+	go func() {
+		o.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (o *Outbox) validate() error {
+	switch {
+	case o.Store == nil:
+		return errors.New("outbox requires a store")
+
+	case o.Workers < 0 || o.PollInterval < 0 || o.MaxAttempts < 0 || o.BaseDelay < 0 || o.MaxDelay < 0 || o.Lease < 0:
+		return errors.New("outbox settings cannot be negative")
+
+	case o.MaxDelay > 0 && o.BaseDelay > o.MaxDelay:
+		return errors.New("outbox base delay cannot be greater than max delay")
+	}
+
+	return nil
+}
+
+func (o *Outbox) getWorkers() int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+
+	o.instrumentation.InitWarning("using default 'workers' setting for outbox")
+
+	return defaultOutboxWorkers
+}
+
+func (o *Outbox) getPollInterval() time.Duration {
+	if o.PollInterval > 0 {
+		return o.PollInterval
+	}
+
+	o.instrumentation.InitWarning("using default 'poll interval' setting for outbox")
+
+	return defaultOutboxPollInterval
+}
+
+func (o *Outbox) getMaxAttempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+
+	o.instrumentation.InitWarning("using default 'max attempts' setting for outbox")
+
+	return defaultOutboxMaxAttempts
+}
+
+func (o *Outbox) getBaseDelay() time.Duration {
+	if o.BaseDelay > 0 {
+		return o.BaseDelay
+	}
+
+	o.instrumentation.InitWarning("using default 'base delay' setting for outbox")
+
+	return defaultOutboxBaseDelay
+}
+
+func (o *Outbox) getMaxDelay() time.Duration {
+	if o.MaxDelay > 0 {
+		return o.MaxDelay
+	}
+
+	o.instrumentation.InitWarning("using default 'max delay' setting for outbox")
+
+	return defaultOutboxMaxDelay
+}
+
+func (o *Outbox) getLease() time.Duration {
+	if o.Lease > 0 {
+		return o.Lease
+	}
+
+	o.instrumentation.InitWarning("using default 'lease' setting for outbox")
+
+	return defaultOutboxLease
+}
+
+// doInitOnce starts the poller, which sends the messages with doFunc (i.e. Client.Do)
+func (o *Outbox) doInitOnce(instrumentation Instrumentation, name string, doFunc requestClosure) {
+	if o == nil {
+		return
+	}
+
+	o.name = name
+	o.instrumentation = instrumentation
+	o.doFunc = doFunc
+
+	o.workers = o.getWorkers()
+	o.pollInterval = o.getPollInterval()
+	o.maxAttempts = o.getMaxAttempts()
+	o.lease = o.getLease()
+
+	// the backoff of the retries is reused
+	o.backoff = &Retries{baseDelay: o.getBaseDelay(), maxDelay: o.getMaxDelay()}
+
+	o.slots = make(chan struct{}, o.workers)
+	o.wake = make(chan struct{}, 1)
+	o.done = make(chan struct{})
+
+	go o.poll()
+}
+
+// clone returns a copy of the configuration (with its own workers, using the same store) for a variant of the client
+// (see Client.Clone)
+func (o *Outbox) clone() *Outbox {
+	if o == nil {
+		return nil
+	}
+
+	return &Outbox{
+		Store:        o.Store,
+		Workers:      o.Workers,
+		PollInterval: o.PollInterval,
+		MaxAttempts:  o.MaxAttempts,
+		BaseDelay:    o.BaseDelay,
+		MaxDelay:     o.MaxDelay,
+		Lease:        o.Lease,
+	}
+}
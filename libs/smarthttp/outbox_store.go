@@ -0,0 +1,247 @@
+package smarthttp
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryOutboxStore returns an in-memory OutboxStore (e.g. for tests; the messages are lost when the process stops)
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{
+		messages: map[string]OutboxMessage{},
+	}
+}
+
+// MemoryOutboxStore is an in-memory OutboxStore (see NewMemoryOutboxStore)
+type MemoryOutboxStore struct {
+	mutex       sync.Mutex
+	messages    map[string]OutboxMessage
+	deadLetters []OutboxMessage
+}
+
+// Save implements OutboxStore
+func (s *MemoryOutboxStore) Save(_ context.Context, msg *OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messages[msg.ID] = *msg
+
+	return nil
+}
+
+// Claim implements OutboxStore
+func (s *MemoryOutboxStore) Claim(_ context.Context, now, leaseUntil time.Time, limit int) ([]*OutboxMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var due []*OutboxMessage
+
+	for _, msg := range s.messages {
+		if !msg.NextAttempt.After(now) {
+			msg := msg
+			due = append(due, &msg)
+		}
+	}
+
+	due = claimDue(due, leaseUntil, limit)
+
+	for _, msg := range due {
+		s.messages[msg.ID] = *msg
+	}
+
+	return due, nil
+}
+
+// Delete implements OutboxStore
+func (s *MemoryOutboxStore) Delete(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.messages, id)
+
+	return nil
+}
+
+// DeadLetter implements OutboxStore
+func (s *MemoryOutboxStore) DeadLetter(_ context.Context, msg *OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.messages, msg.ID)
+	s.deadLetters = append(s.deadLetters, *msg)
+
+	return nil
+}
+
+// DeadLetters returns the dead-lettered messages
+func (s *MemoryOutboxStore) DeadLetters() []OutboxMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]OutboxMessage(nil), s.deadLetters...)
+}
+
+// FileOutboxStore is an OutboxStore that saves each message to a JSON file in Dir (and the dead letters in
+// Dir/dead).  The directory must not be shared by several processes (e.g. use a volume per pod).
+type FileOutboxStore struct {
+	// Dir is the directory of the messages (it is created when needed)
+	Dir string
+
+	mutex sync.Mutex
+}
+
+const (
+	outboxFileExt       = ".json"
+	outboxDeadLetterDir = "dead"
+)
+
+// Save implements OutboxStore
+func (s *FileOutboxStore) Save(_ context.Context, msg *OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.write(s.Dir, msg)
+}
+
+// Claim implements OutboxStore
+func (s *FileOutboxStore) Claim(_ context.Context, now, leaseUntil time.Time, limit int) ([]*OutboxMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var due []*OutboxMessage
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), outboxFileExt) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.Dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		msg := &OutboxMessage{}
+
+		err = json.Unmarshal(data, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !msg.NextAttempt.After(now) {
+			due = append(due, msg)
+		}
+	}
+
+	due = claimDue(due, leaseUntil, limit)
+
+	for _, msg := range due {
+		err = s.write(s.Dir, msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return due, nil
+}
+
+// Delete implements OutboxStore
+func (s *FileOutboxStore) Delete(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := os.Remove(s.path(s.Dir, id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// DeadLetter implements OutboxStore
+func (s *FileOutboxStore) DeadLetter(_ context.Context, msg *OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.write(filepath.Join(s.Dir, outboxDeadLetterDir), msg)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(s.path(s.Dir, msg.ID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *FileOutboxStore) path(dir, id string) string {
+	// the ID is generated by Enqueue but is not trusted as a file name
+	return filepath.Join(dir, filepath.Base(id)+outboxFileExt)
+}
+
+// write writes the message to a temporary file and renames it so that a partially written message is never read
+func (s *FileOutboxStore) write(dir string, msg *OutboxMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(msg.ID)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(dir, msg.ID))
+}
+
+// claimDue returns (up to limit of) the oldest due messages, leased until leaseUntil
+func claimDue(due []*OutboxMessage, leaseUntil time.Time, limit int) []*OutboxMessage {
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for _, msg := range due {
+		msg.NextAttempt = leaseUntil
+	}
+
+	return due
+}
@@ -0,0 +1,255 @@
+package smarthttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPaginateMaxPages = 1000
+
+	// the maximum size of a page
+	maxPageSize = 32 << 20
+)
+
+// ErrTooManyPages indicates that pagination stopped because MaxPages were fetched and there were more pages
+var ErrTooManyPages = errors.New("too many pages")
+
+// PaginateOptions defines how Paginate follows the pages
+type PaginateOptions struct {
+	// NextURL (optionally) returns the URL of the next page ("" when the page is the last one), e.g. from a cursor in
+	// the body.  Relative URLs are resolved against the URL of the page (default: NextLink).
+	NextURL func(page *Page) (string, error)
+
+	// MaxPages is the maximum number of pages that are fetched (default: 1000)
+	MaxPages int
+
+	// Timeout (optionally) is the maximum duration of the whole pagination
+	Timeout time.Duration
+
+	// Header (optionally) is added to the request of each page
+	Header http.Header
+}
+
+// Page is a page fetched by a Paginator
+type Page struct {
+	// Response is the response of the page (its body has been read into Body and closed)
+	Response *http.Response
+
+	// Body is the body of the response
+	Body []byte
+
+	// Number is the (one based) number of the page
+	Number int
+}
+
+// Decode decodes the JSON body of the page into target
+func (p *Page) Decode(target interface{}) error {
+	return json.Unmarshal(p.Body, target)
+}
+
+// Paginator iterates over pages (see Client.Paginate):
+//
+//	pages := client.Paginate(ctx, "https://catalog.example.com/v1/products", nil)
+//	for pages.Next() {
+//		var products []Product
+//		err := pages.Page().Decode(&products)
+//		...
+//	}
+//	if err := pages.Err(); err != nil {
+//		...
+//	}
+type Paginator struct {
+	client  *Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	opts    *PaginateOptions
+	nextURL string
+	page    *Page
+	err     error
+}
+
+// Paginate returns an iterator over the pages that starts with a GET of the URL and follows the next pages (using the
+// RFC 5988 Link header with rel="next" or opts.NextURL).  Non-2xx responses stop the iteration with an *APIError.
+func (c *Client) Paginate(ctx context.Context, url string, opts *PaginateOptions) *Paginator {
+	if opts == nil {
+		opts = &PaginateOptions{}
+	}
+
+	cancel := func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	return &Paginator{
+		client:  c,
+		ctx:     ctx,
+		cancel:  cancel,
+		opts:    opts,
+		nextURL: url,
+	}
+}
+
+// Next fetches the next page; it returns false when there are no more pages or an error occurred (see Err)
+func (p *Paginator) Next() bool {
+	if p.err != nil || p.nextURL == "" {
+		p.cancel()
+
+		return false
+	}
+
+	number := 1
+	if p.page != nil {
+		number = p.page.Number + 1
+	}
+
+	if number > p.getMaxPages() {
+		p.stop(ErrTooManyPages)
+
+		return false
+	}
+
+	page, err := p.fetch(number)
+	if err != nil {
+		p.stop(err)
+
+		return false
+	}
+
+	next, err := p.getNextURL(page)
+	if err != nil {
+		p.stop(err)
+
+		return false
+	}
+
+	p.page = page
+	p.nextURL = next
+
+	return true
+}
+
+// Page returns the current page
+func (p *Paginator) Page() *Page {
+	return p.page
+}
+
+// Err returns the error that stopped the iteration (nil when all the pages were fetched)
+func (p *Paginator) Err() error {
+	return p.err
+}
+
+func (p *Paginator) stop(err error) {
+	p.err = err
+	p.cancel()
+}
+
+func (p *Paginator) fetch(number int) (*Page, error) {
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, p.nextURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range p.opts.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newAPIError(resp)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{Response: resp, Body: body, Number: number}, nil
+}
+
+// getNextURL returns the (absolute) URL of the page after the page
+func (p *Paginator) getNextURL(page *Page) (string, error) {
+	nextURL := p.opts.NextURL
+	if nextURL == nil {
+		nextURL = NextLink
+	}
+
+	next, err := nextURL(page)
+	if err != nil || next == "" {
+		return "", err
+	}
+
+	base := page.Response.Request.URL
+
+	ref, err := url.Parse(next)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (p *Paginator) getMaxPages() int {
+	if p.opts.MaxPages > 0 {
+		return p.opts.MaxPages
+	}
+
+	return defaultPaginateMaxPages
+}
+
+// NextLink returns the URL of the Link header of the page with rel="next" (RFC 5988), or "" when there is none
+func NextLink(page *Page) (string, error) {
+	for _, header := range page.Response.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				name, value := splitLinkParam(param)
+				if name != "rel" {
+					continue
+				}
+
+				for _, rel := range strings.Fields(value) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1], nil
+					}
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// splitLinkParam splits a parameter of a link, e.g. ` rel="next"`
+func splitLinkParam(param string) (string, string) {
+	index := strings.Index(param, "=")
+	if index < 0 {
+		return strings.ToLower(strings.TrimSpace(param)), ""
+	}
+
+	name := strings.ToLower(strings.TrimSpace(param[:index]))
+	value := strings.Trim(strings.TrimSpace(param[index+1:]), `"`)
+
+	return name, value
+}
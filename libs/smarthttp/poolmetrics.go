@@ -0,0 +1,340 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultPoolMetricsInterval = 10 * time.Second
+
+// PoolStats describes the connection pool of a client for a host (see Instrumentation.PoolStats)
+type PoolStats struct {
+	// Host is the host (and port) of the connections, e.g. "api.example.com:443"
+	Host string
+
+	// InFlight is the number of requests in flight to the host (until their response body is closed)
+	InFlight int
+
+	// InUse is the number of connections used by the requests in flight
+	InUse int
+
+	// Open is the number of open connections (only tracked by the default transport, see PoolMetrics)
+	Open int
+
+	// Idle is the number of open connections that are not in use (only tracked by the default transport)
+	Idle int
+
+	// Requests is the number of requests that got a connection since the previous report
+	Requests int
+
+	// Reused is the number of requests that reused a pooled connection since the previous report
+	Reused int
+
+	// Dialed is the number of connections dialed since the previous report (only tracked by the default transport)
+	Dialed int
+}
+
+// ReuseRatio returns the fraction of the requests that reused a pooled connection since the previous report (1 when
+// there were no requests)
+func (s PoolStats) ReuseRatio() float64 {
+	if s.Requests == 0 {
+		return 1
+	}
+
+	return float64(s.Reused) / float64(s.Requests)
+}
+
+// PoolMetrics defines the connection pool metrics configuration.
+// The connections and requests of each host are tracked and reported (see Instrumentation.PoolStats) periodically, so
+// that the exhaustion of the pool (e.g. InUse reaching MaxConnsPerHost, or a drop of the reuse ratio as connections are
+// dialed during a spike) can be seen.
+//
+// The requests and the connections they use are tracked with net/http/httptrace, so they are tracked for any transport.
+// The open (and therefore the idle) connections can only be tracked when they are dialed by the default transport, i.e.
+// when the client is built without a Client or a transport; they are zero otherwise.
+// Note: the open connections are tracked by the address that is dialed, which is the proxy when one is used.
+//
+// A variant created with Client.Clone shares the pool metrics (as it shares the connection pool); the stats are reported
+// to the instrumentation of the first client until one of the clients is closed.
+type PoolMetrics struct {
+	// Interval is how often the stats are reported (default: 10 seconds)
+	Interval time.Duration
+
+	mutex sync.Mutex
+	hosts map[string]*hostPool
+
+	initOnce        sync.Once
+	closeOnce       sync.Once
+	done            chan struct{}
+	name            string
+	instrumentation Instrumentation
+}
+
+// hostPool holds the state of the connections to a host
+type hostPool struct {
+	inFlight int
+	open     int
+	requests int
+	reused   int
+	dialed   int
+
+	// the number of requests using each connection (HTTP/2 connections are used by several requests)
+	inUse map[net.Conn]int
+}
+
+// poolRequest is a request tracked by PoolMetrics
+type poolRequest struct {
+	host string
+	conn net.Conn
+	done bool
+}
+
+func (p *PoolMetrics) getInterval() time.Duration {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+
+	p.instrumentation.InitWarning("using default 'interval' setting for pool metrics")
+
+	return defaultPoolMetricsInterval
+}
+
+// track returns a copy of the request that records the connection it uses, and a function that must be called once
+// the request has completed
+func (p *PoolMetrics) track(req *http.Request) (*http.Request, func()) {
+	if p == nil {
+		return req, func() {}
+	}
+
+	tracked := &poolRequest{host: hostAddr(req.URL)}
+
+	p.update(tracked.host, func(pool *hostPool) {
+		pool.inFlight++
+	})
+
+	clientTrace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.gotConn(tracked, info)
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace))
+
+	return req, func() {
+		p.release(tracked)
+	}
+}
+
+func (p *PoolMetrics) gotConn(tracked *poolRequest, info httptrace.GotConnInfo) {
+	p.update(tracked.host, func(pool *hostPool) {
+		pool.requests++
+
+		if info.Reused {
+			pool.reused++
+		}
+
+		// the hook can be called after the request has completed (e.g. when it was cancelled while dialing)
+		if tracked.done || tracked.conn != nil {
+			return
+		}
+
+		tracked.conn = info.Conn
+		pool.inUse[info.Conn]++
+	})
+}
+
+func (p *PoolMetrics) release(tracked *poolRequest) {
+	p.update(tracked.host, func(pool *hostPool) {
+		if tracked.done {
+			return
+		}
+
+		tracked.done = true
+		pool.inFlight--
+
+		if tracked.conn == nil {
+			return
+		}
+
+		pool.inUse[tracked.conn]--
+		if pool.inUse[tracked.conn] <= 0 {
+			delete(pool.inUse, tracked.conn)
+		}
+	})
+}
+
+// releaseOnClose releases the tracked request once the body of the response has been closed
+func (p *PoolMetrics) releaseOnClose(resp *http.Response, release func()) *http.Response {
+	if p == nil {
+		return resp
+	}
+
+	return releaseOnClose(resp, context.CancelFunc(release))
+}
+
+// wrapDialContext counts the connections that are dialed and closed
+func (p *PoolMetrics) wrapDialContext(dialContext dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		p.update(addr, func(pool *hostPool) {
+			pool.open++
+			pool.dialed++
+		})
+
+		return &poolConn{Conn: conn, pool: p, host: addr}, nil
+	}
+}
+
+// poolConn is a connection dialed by the default transport
+type poolConn struct {
+	net.Conn
+
+	pool      *PoolMetrics
+	host      string
+	closeOnce sync.Once
+}
+
+// Close implements net.Conn
+func (c *poolConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pool.update(c.host, func(pool *hostPool) {
+			pool.open--
+		})
+	})
+
+	return c.Conn.Close()
+}
+
+// update changes the state of the host under the lock
+func (p *PoolMetrics) update(host string, change func(pool *hostPool)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.hosts == nil {
+		p.hosts = map[string]*hostPool{}
+	}
+
+	pool, ok := p.hosts[host]
+	if !ok {
+		pool = &hostPool{inUse: map[net.Conn]int{}}
+		p.hosts[host] = pool
+	}
+
+	change(pool)
+}
+
+// stats returns the stats of the hosts (sorted by host) and resets the counters; hosts without connections or requests
+// are forgotten once they have been reported
+func (p *PoolMetrics) stats() []PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	out := make([]PoolStats, 0, len(p.hosts))
+
+	for host, pool := range p.hosts {
+		stats := PoolStats{
+			Host:     host,
+			InFlight: pool.inFlight,
+			InUse:    len(pool.inUse),
+			Open:     pool.open,
+			Requests: pool.requests,
+			Reused:   pool.reused,
+			Dialed:   pool.dialed,
+		}
+
+		if pool.open > stats.InUse {
+			stats.Idle = pool.open - stats.InUse
+		}
+
+		out = append(out, stats)
+
+		pool.requests, pool.reused, pool.dialed = 0, 0, 0
+
+		if pool.inFlight == 0 && pool.open == 0 && len(pool.inUse) == 0 {
+			delete(p.hosts, host)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Host < out[j].Host
+	})
+
+	return out
+}
+
+// report reports the stats periodically until the client is closed
+func (p *PoolMetrics) report(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+
+		case <-ticker.C:
+			for _, stats := range p.stats() {
+				p.instrumentation.PoolStats(p.name, stats)
+			}
+		}
+	}
+}
+
+// hostAddr returns the host and port of the URL (using the default port of the scheme when it has none)
+func hostAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func (p *PoolMetrics) validate() error {
+	if p.Interval < 0 {
+		return errors.New("pool metrics interval cannot be negative")
+	}
+
+	return nil
+}
+
+// doInitOnce starts the reporting; pool metrics shared by several clients (see Client.Clone) are initialized once and
+// report to the instrumentation of the first client
+func (p *PoolMetrics) doInitOnce(instrumentation Instrumentation, name string) {
+	if p == nil {
+		return
+	}
+
+	p.initOnce.Do(func() {
+		p.name = name
+		p.instrumentation = instrumentation
+		p.done = make(chan struct{})
+
+		go p.report(p.getInterval())
+	})
+}
+
+// close stops the reporting (see Client.Close)
+func (p *PoolMetrics) close() {
+	if p == nil || p.done == nil {
+		return
+	}
+
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+}
@@ -0,0 +1,56 @@
+package smarthttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Priority is the priority of a request (see WithPriority); requests without a priority are PriorityNormal
+type Priority int
+
+const (
+	// PriorityLow is for requests that can be delayed or dropped (e.g. analytics)
+	PriorityLow Priority = -1
+
+	// PriorityNormal is the priority of requests without a priority
+	PriorityNormal Priority = 0
+
+	// PriorityHigh is for requests that must be served when possible (e.g. checkout)
+	PriorityHigh Priority = 1
+)
+
+// String implements fmt.Stringer
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+
+	case PriorityNormal:
+		return "normal"
+
+	case PriorityHigh:
+		return "high"
+
+	default:
+		return strconv.Itoa(int(p))
+	}
+}
+
+// WithPriority returns a copy of the context that sets the priority of the requests made with it (see Bulkhead,
+// AdaptiveConcurrency and LoadShedder)
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, ctxKeyPriority, priority)
+}
+
+// PriorityFromContext returns the priority of the context (PriorityNormal when it has none)
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(ctxKeyPriority).(Priority)
+
+	return priority
+}
+
+// priorityOf returns the priority of the request
+func priorityOf(req *http.Request) Priority {
+	return PriorityFromContext(req.Context())
+}
@@ -0,0 +1,91 @@
+package smarthttp
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultPropagationHeaders are the trace headers propagated by default (W3C Trace Context and Zipkin B3)
+var DefaultPropagationHeaders = []string{
+	"traceparent",
+	"tracestate",
+	"b3",
+	"x-b3-traceid",
+	"x-b3-spanid",
+	"x-b3-parentspanid",
+	"x-b3-sampled",
+	"x-b3-flags",
+}
+
+// Propagation defines the trace header propagation configuration.
+// The configured headers are copied from the inbound request (see WithInboundHeaders and InboundHeadersHandler) to
+// the outbound requests so that distributed traces are not broken by the client.
+// Requests that already carry a header keep their value.
+// Note: for full tracing (i.e. a span per outbound request) use the otelsmarthttp package instead.
+type Propagation struct {
+	// Headers are the names of the headers to propagate (default: DefaultPropagationHeaders)
+	Headers []string
+}
+
+// WithInboundHeaders returns a copy of the context that carries the headers of the inbound request.
+// Requests made with the context copy the Propagation headers from them.
+// Note: the headers must not be modified after this call.
+func WithInboundHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, ctxKeyInboundHeaders, headers)
+}
+
+// InboundHeadersHandler returns an http.Handler that adds the headers of the inbound request to its context (see
+// WithInboundHeaders) so that outbound requests made with it propagate the trace headers.
+func InboundHeadersHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithInboundHeaders(r.Context(), r.Header)))
+	})
+}
+
+func inboundHeaders(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(ctxKeyInboundHeaders).(http.Header)
+
+	return headers
+}
+
+func (p *Propagation) getHeaders() []string {
+	if len(p.Headers) > 0 {
+		return p.Headers
+	}
+
+	return DefaultPropagationHeaders
+}
+
+// apply returns a copy of the request that carries the propagated headers.  The request is copied (rather than
+// modified) when required.
+func (p *Propagation) apply(req *http.Request) *http.Request {
+	if p == nil {
+		return req
+	}
+
+	inbound := inboundHeaders(req.Context())
+	if inbound == nil {
+		return req
+	}
+
+	cloned := false
+
+	for _, header := range p.getHeaders() {
+		values := inbound.Values(header)
+		if len(values) == 0 || req.Header.Get(header) != "" {
+			continue
+		}
+
+		if !cloned {
+			// copy the request so that the caller's headers are not modified
+			req = req.Clone(req.Context())
+			cloned = true
+		}
+
+		for _, value := range values {
+			req.Header.Add(header, value)
+		}
+	}
+
+	return req
+}
@@ -0,0 +1,78 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// ErrInvalidProxyURL indicates that Client.ProxyURL could not be parsed or uses an unsupported scheme
+var ErrInvalidProxyURL = errors.New("invalid proxy URL")
+
+// parseProxyURL parses (and validates) the proxy URL
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrInvalidProxyURL, err)
+	}
+
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return parsed, nil
+
+	default:
+		return nil, fmt.Errorf("%w - unsupported scheme '%s'", ErrInvalidProxyURL, parsed.Scheme)
+	}
+}
+
+// applyProxy configures the transport to use the proxy.
+// HTTP(S) proxies are used via the transport's Proxy; SOCKS5 proxies are dialed via the transport's DialContext (so
+// that ErrConnectTimeout is still reported when the proxy cannot be reached).
+func applyProxy(transport *http.Transport, proxyURL *url.URL) error {
+	if proxyURL.Scheme == "http" || proxyURL.Scheme == "https" {
+		transport.Proxy = http.ProxyURL(proxyURL)
+
+		return nil
+	}
+
+	var auth *proxy.Auth
+
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+
+		auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, dialContextFunc(transport.DialContext))
+	if err != nil {
+		return fmt.Errorf("%w - %s", ErrInvalidProxyURL, err)
+	}
+
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return fmt.Errorf("%w - SOCKS5 dialer does not support contexts", ErrInvalidProxyURL)
+	}
+
+	transport.Proxy = nil
+	transport.DialContext = contextDialer.DialContext
+
+	return nil
+}
+
+// dialContextFunc adapts a DialContext function to proxy.Dialer (and proxy.ContextDialer)
+type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dial implements proxy.Dialer
+func (d dialContextFunc) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+// DialContext implements proxy.ContextDialer
+func (d dialContextFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
@@ -0,0 +1,78 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrRateLimited indicates that the request was rejected by the client-side rate limiter
+var ErrRateLimited = errors.New("client-side rate limit exceeded")
+
+// Limiter is a client-side rate limiter (e.g. any of the limiters in libs/ratelimit)
+type Limiter interface {
+	// Wait blocks until a request for the key may proceed or the context is done
+	Wait(ctx context.Context, key string) error
+}
+
+// RateLimit defines the client-side rate limiting configuration.
+// Requests wait for the limiter before entering the circuit breaker, so that throttled requests do not affect the circuit.
+// Requests deduplicated by singleflight only consume a single slot.
+type RateLimit struct {
+	// Limiter decides whether a request may proceed
+	Limiter Limiter
+
+	// KeyGenerator will generate the rate limiting "key" from the request.
+	// If none is provided then the client name is used (i.e. a single limit for all requests to the upstream).
+	KeyGenerator func(req *http.Request) string
+
+	name            string
+	instrumentation Instrumentation
+}
+
+// do waits for the rate limit (when configured) and performs the request
+func (r *RateLimit) do(doFunc requestClosure, req *http.Request) (*http.Response, error) {
+	if r == nil || r.Limiter == nil {
+		return doFunc(req)
+	}
+
+	key := r.name
+	if r.KeyGenerator != nil {
+		key = r.KeyGenerator(req)
+	}
+
+	err := r.Limiter.Wait(req.Context(), key)
+	if err != nil {
+		r.instrumentation.RateLimitErr(req, err)
+
+		return nil, fmt.Errorf("%w - %s", ErrRateLimited, err)
+	}
+
+	return doFunc(req)
+}
+
+func (r *RateLimit) doInitOnce(instrumentation Instrumentation, name string) {
+	if r == nil {
+		return
+	}
+
+	if r.Limiter == nil {
+		instrumentation.InitWarning("rate limit was configured without a limiter.  Rate limiting is disabled")
+	}
+
+	r.name = name
+	r.instrumentation = instrumentation
+}
+
+// clone returns a copy of the configuration (sharing the limiter) for a variant of the client (see Client.Clone)
+func (r *RateLimit) clone() *RateLimit {
+	if r == nil {
+		return nil
+	}
+
+	return &RateLimit{
+		Limiter:      r.Limiter,
+		KeyGenerator: r.KeyGenerator,
+	}
+}
@@ -0,0 +1,114 @@
+package smarthttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// the maximum number of redirects followed by default (matches http.Client)
+const defaultMaxRedirects = 10
+
+// ErrRedirectNotAllowed indicates that a redirect was not followed because it violates the RedirectPolicy
+var ErrRedirectNotAllowed = errors.New("redirect not allowed")
+
+// the headers removed from a redirected request when the host changes (see RedirectPolicy.SensitiveHeaders)
+var defaultSensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+}
+
+// RedirectPolicy defines how redirects are followed by the default HTTP client.
+// When no policy is configured, redirects are followed as per http.Client (i.e. up to 10 redirects).
+type RedirectPolicy struct {
+	// MaxRedirects is the maximum number of redirects followed (default: 10).
+	// A negative value disables redirects (i.e. the redirect response is returned to the caller).
+	MaxRedirects int
+
+	// SameHostOnly only follows redirects to the host of the original request
+	SameHostOnly bool
+
+	// AllowDowngrade allows redirects from https to http (which are refused by default)
+	AllowDowngrade bool
+
+	// SensitiveHeaders lists the headers removed from the request when it is redirected to a different host (default:
+	// Authorization, Proxy-Authorization, Cookie and X-Api-Key).
+	// Note: http.Client also removes Authorization, WWW-Authenticate and Cookie when the redirect is not to the same
+	// domain or a subdomain.
+	SensitiveHeaders []string
+}
+
+// check returns an error when the redirect (req) should not be followed
+func (p *RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	if p == nil {
+		// matches the default of http.Client
+		if len(via) >= defaultMaxRedirects {
+			return fmt.Errorf("%w - stopped after %d redirects", ErrRedirectNotAllowed, defaultMaxRedirects)
+		}
+
+		return nil
+	}
+
+	original := via[0]
+	previous := via[len(via)-1]
+
+	switch {
+	case p.MaxRedirects < 0:
+		return http.ErrUseLastResponse
+
+	case len(via) > p.getMaxRedirects():
+		return fmt.Errorf("%w - stopped after %d redirects", ErrRedirectNotAllowed, p.getMaxRedirects())
+
+	case p.SameHostOnly && req.URL.Host != original.URL.Host:
+		return fmt.Errorf("%w - redirect to a different host '%s'", ErrRedirectNotAllowed, req.URL.Host)
+
+	case !p.AllowDowngrade && previous.URL.Scheme == "https" && req.URL.Scheme == "http":
+		return fmt.Errorf("%w - redirect from https to http", ErrRedirectNotAllowed)
+	}
+
+	if req.URL.Host != original.URL.Host {
+		for _, header := range p.getSensitiveHeaders() {
+			req.Header.Del(header)
+		}
+	}
+
+	return nil
+}
+
+func (p *RedirectPolicy) getMaxRedirects() int {
+	if p.MaxRedirects > 0 {
+		return p.MaxRedirects
+	}
+
+	return defaultMaxRedirects
+}
+
+func (p *RedirectPolicy) getSensitiveHeaders() []string {
+	if p.SensitiveHeaders != nil {
+		return p.SensitiveHeaders
+	}
+
+	return defaultSensitiveHeaders
+}
+
+// checkRedirect is the CheckRedirect of the default HTTP client
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	err := c.Redirect.check(req, via)
+	if err != nil {
+		return err
+	}
+
+	// the host guard only checks the URL of the original request; each redirect must be checked too
+	if c.HostGuard != nil {
+		err = c.HostGuard.checkHost(req.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.getInstrumentation().Redirect(req, len(via))
+
+	return nil
+}
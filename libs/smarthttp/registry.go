@@ -0,0 +1,113 @@
+package smarthttp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry builds and holds the clients of a service's upstreams (one client per upstream, each with its own timeouts,
+// retries and circuit).  Clients are looked up by name; Close shuts them all down.
+type Registry struct {
+	mutex   sync.RWMutex
+	clients map[string]*Client
+}
+
+// NewRegistry builds a client (see NewClientFromConfig) for each of the upstreams; the key is used as the name of the client.
+// The (optional) options are applied to every client before the configuration of its upstream.  Each option is called
+// once per client (after the name is set), so options that must not be shared between clients (e.g. instrumentation)
+// can create a new instance for each client:
+//
+//	registry, err := smarthttp.NewRegistry(upstreams, func(c *smarthttp.Client) {
+//		c.Instrumentation = statssmarthttp.New(statsd)
+//	})
+func NewRegistry(upstreams map[string]Config, opts ...Option) (*Registry, error) {
+	registry := &Registry{clients: make(map[string]*Client, len(upstreams))}
+
+	for name, cfg := range upstreams {
+		client, err := NewClientFromConfig(name, cfg, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%w (upstream '%s')", err, name)
+		}
+
+		registry.clients[name] = client
+	}
+
+	return registry, nil
+}
+
+// Register adds a client (e.g. one that requires options that cannot be expressed in a Config) to the registry.
+// An error is returned when a client with the same name is already registered.
+func (r *Registry) Register(client *Client) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clients == nil {
+		r.clients = map[string]*Client{}
+	}
+
+	if _, exists := r.clients[client.Name]; exists {
+		return fmt.Errorf("client '%s' is already registered", client.Name)
+	}
+
+	r.clients[client.Name] = client
+
+	return nil
+}
+
+// Get returns the client of the named upstream
+func (r *Registry) Get(name string) (*Client, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	client, ok := r.clients[name]
+
+	return client, ok
+}
+
+// Names returns the (sorted) names of the registered clients
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	out := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// Close closes all of the clients concurrently (see Client.Close) and returns the first error (if any)
+func (r *Registry) Close(ctx context.Context) error {
+	r.mutex.RLock()
+
+	clients := make([]*Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+
+	r.mutex.RUnlock()
+
+	errs := make(chan error, len(clients))
+
+	for _, client := range clients {
+		go func(client *Client) {
+			errs <- client.Close(ctx)
+		}(client)
+	}
+
+	var out error
+
+	for range clients {
+		err := <-errs
+		if err != nil && out == nil {
+			out = err
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,148 @@
+package smarthttp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RuntimeConfig is the configuration that can be changed while the client is in use (see Client.UpdateConfig)
+type RuntimeConfig struct {
+	// Retries is the retry configuration (nil disables retries)
+	Retries *Retries
+
+	// RateLimit is the client-side rate limiting configuration (nil disables rate limiting)
+	RateLimit *RateLimit
+
+	// ErrorPercentThreshold, MaxConcurrentRequests, SleepWindow and RequestVolumeThreshold are the circuit breaker
+	// thresholds (see CircuitBreaker); MaxConcurrentRequests cannot be changed with the HystrixEngine
+	CircuitBreaker CircuitBreaker
+}
+
+// UpdateConfig changes the configuration of the client while it is in use (e.g. to reduce retries during an incident
+// without a deploy) without losing the connection pool or the state of the circuit.
+// The update function is called with a copy of the current configuration (Retries and RateLimit are nil when they are
+// disabled), which it should modify.  The result is validated (an error wrapping ErrInvalidConfig is returned when it
+// is invalid) and applied to subsequent requests.
+//
+//	err := client.UpdateConfig(func(cfg *smarthttp.RuntimeConfig) {
+//		if cfg.Retries != nil {
+//			cfg.Retries.MaxAttempts = 1
+//		}
+//	})
+//
+// It is safe to call UpdateConfig concurrently with requests.  Only the circuit breaker thresholds are applied; the
+// circuit breaker engine cannot be changed.  HystrixEngine cannot change the max concurrent requests of a circuit (hystrix
+// sizes its pool once); an update that changes it is rejected.
+func (c *Client) UpdateConfig(update func(cfg *RuntimeConfig)) error {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+
+	cfg := RuntimeConfig{
+		CircuitBreaker: CircuitBreaker{
+			ErrorPercentThreshold:  c.CircuitBreaker.ErrorPercentThreshold,
+			MaxConcurrentRequests:  c.CircuitBreaker.MaxConcurrentRequests,
+			SleepWindow:            c.CircuitBreaker.SleepWindow,
+			RequestVolumeThreshold: c.CircuitBreaker.RequestVolumeThreshold,
+		},
+	}
+
+	// copies so that the update does not modify the configuration used by requests in-flight
+	if c.Retries != nil {
+		retries := *c.Retries
+		cfg.Retries = &retries
+	}
+
+	if c.RateLimit != nil {
+		rateLimit := *c.RateLimit
+		cfg.RateLimit = &rateLimit
+	}
+
+	update(&cfg)
+
+	probe := &Client{
+		Name:           c.Name,
+		Retries:        cfg.Retries,
+		RateLimit:      cfg.RateLimit,
+		CircuitBreaker: cfg.CircuitBreaker,
+	}
+
+	err := probe.validate()
+	if err != nil {
+		return fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	err = c.validateEngineUpdate(cfg.CircuitBreaker)
+	if err != nil {
+		return fmt.Errorf("%w - %s", ErrInvalidConfig, err)
+	}
+
+	if cfg.Retries != nil {
+		// defaults are applied silently; the warnings are only useful during client initialization
+		cfg.Retries = cfg.Retries.forRequest(c.Instrumentation)
+		cfg.Retries.minimumRemaining = c.MinimumRemaining
+	}
+
+	cfg.RateLimit.doInitOnce(c.Instrumentation, c.Name)
+
+	// the circuit breaker is updated in place as it is used by requests in-flight; the engine keeps the circuit state
+	breaker := cfg.CircuitBreaker
+	breaker.instrumentation = &NoopInstrumentation{}
+
+	settings := breaker.settings()
+	settings.OnStateChange = c.Instrumentation.CBStateChange
+
+	c.CircuitBreaker.Engine.Configure(c.Name, settings)
+
+	c.CircuitBreaker.ErrorPercentThreshold = cfg.CircuitBreaker.ErrorPercentThreshold
+	c.CircuitBreaker.MaxConcurrentRequests = cfg.CircuitBreaker.MaxConcurrentRequests
+	c.CircuitBreaker.SleepWindow = cfg.CircuitBreaker.SleepWindow
+	c.CircuitBreaker.RequestVolumeThreshold = cfg.CircuitBreaker.RequestVolumeThreshold
+
+	c.Retries = cfg.Retries
+	c.RateLimit = cfg.RateLimit
+
+	return nil
+}
+
+// validateEngineUpdate returns an error when the circuit breaker engine cannot apply the (resolved) thresholds
+func (c *Client) validateEngineUpdate(breaker CircuitBreaker) error {
+	if _, ok := c.CircuitBreaker.Engine.(*HystrixEngine); !ok {
+		return nil
+	}
+
+	current := c.CircuitBreaker
+	current.instrumentation = &NoopInstrumentation{}
+	breaker.instrumentation = &NoopInstrumentation{}
+
+	if breaker.getMaxConcurrent() != current.getMaxConcurrent() {
+		return fmt.Errorf("max concurrent requests cannot be changed at runtime with the hystrix engine (%d)",
+			current.getMaxConcurrent())
+	}
+
+	return nil
+}
+
+// getRetries returns the retry configuration (which may be changed by UpdateConfig)
+func (c *Client) getRetries() *Retries {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	return c.Retries
+}
+
+// getRateLimit returns the rate limiting configuration (which may be changed by UpdateConfig)
+func (c *Client) getRateLimit() *RateLimit {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	return c.RateLimit
+}
+
+// addRateLimit wraps the function with the rate limiting configuration of each request (see getRateLimit)
+func (c *Client) addRateLimit(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		return c.getRateLimit().do(doFunc, req)
+	}
+}
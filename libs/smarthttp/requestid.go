@@ -0,0 +1,78 @@
+package smarthttp
+
+import (
+	"context"
+	"net/http"
+)
+
+const defaultRequestIDHeader = "X-Request-Id"
+
+// RequestID defines the request ID propagation configuration.
+// The request (or correlation) ID is taken from the context (see WithRequestID) and sent to the upstream so that the
+// logs of the caller and the upstream can be correlated.  When the context does not carry an ID, one is generated.
+// Requests that already carry the header keep their ID.
+type RequestID struct {
+	// Header is the name of the request header that carries the ID (default: X-Request-Id)
+	Header string
+
+	// Generator (optionally) generates the ID when the context does not carry one (default: a random UUID)
+	Generator func(req *http.Request) string
+}
+
+// WithRequestID returns a copy of the context that carries the request ID (e.g. the x-request-id of the inbound request).
+// Requests made with the context send the ID to the upstream when RequestID propagation is configured.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestID, id)
+}
+
+// RequestIDFromContext returns the request ID carried by the context (or an empty string)
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+
+	return id
+}
+
+func (r *RequestID) getHeader() string {
+	if r.Header != "" {
+		return r.Header
+	}
+
+	return defaultRequestIDHeader
+}
+
+func (r *RequestID) generate(req *http.Request) string {
+	if r.Generator != nil {
+		return r.Generator(req)
+	}
+
+	return newUUID()
+}
+
+// apply returns a copy of the request that carries the request ID (in both the header and the context).
+// This is done once per call to Do so that all attempts (retries, hedges) share the same ID.
+func (r *RequestID) apply(req *http.Request) *http.Request {
+	if r == nil {
+		return req
+	}
+
+	header := r.getHeader()
+
+	if id := req.Header.Get(header); id != "" {
+		if RequestIDFromContext(req.Context()) == id {
+			return req
+		}
+
+		return req.WithContext(WithRequestID(req.Context(), id))
+	}
+
+	id := RequestIDFromContext(req.Context())
+	if id == "" {
+		id = r.generate(req)
+	}
+
+	// copy the request so that the caller's headers are not modified
+	req = req.Clone(WithRequestID(req.Context(), id))
+	req.Header.Set(header, id)
+
+	return req
+}
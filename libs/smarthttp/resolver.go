@@ -0,0 +1,162 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the default refresh interval when the resolver does not return a TTL
+	defaultResolveInterval = 30 * time.Second
+
+	// the minimum refresh interval (protects the resolver from very short TTLs)
+	minResolveInterval = 1 * time.Second
+
+	// the interval between attempts when resolving fails
+	resolveRetryInterval = 5 * time.Second
+
+	// the timeout of each call to the resolver
+	resolveTimeout = 5 * time.Second
+)
+
+// ErrNoTargets indicates that the load balancer has no targets (e.g. the service has not been resolved)
+var ErrNoTargets = errors.New("no load balancer targets available")
+
+// Resolver discovers the targets of a service for the LoadBalancer (see LoadBalancer.Resolver)
+type Resolver interface {
+	// Resolve returns the (current) targets of the service and how long they can be used before the service should be
+	// resolved again (0 uses the default of 30s)
+	Resolve(ctx context.Context, service string) ([]Target, time.Duration, error)
+}
+
+// DNSSRVResolver is a Resolver that looks up the DNS SRV records of the service (e.g.
+// "_http._tcp.payments.service.consul" for a service registered with Consul).
+// Only the records with the lowest priority are used; their weights are used by BalanceWeighted.
+type DNSSRVResolver struct {
+	// Resolver (optionally) is the DNS resolver (default: net.DefaultResolver)
+	Resolver *net.Resolver
+
+	// TTL is how long the records are used before they are looked up again (default: 30s)
+	TTL time.Duration
+}
+
+// Resolve implements Resolver
+func (r *DNSSRVResolver) Resolve(ctx context.Context, service string) ([]Target, time.Duration, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, "", "", service)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// records are returned sorted by priority
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Priority < records[j].Priority
+	})
+
+	var out []Target
+
+	for _, record := range records {
+		if record.Priority != records[0].Priority {
+			break
+		}
+
+		out = append(out, Target{
+			Host:   net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))),
+			Weight: int(record.Weight),
+		})
+	}
+
+	return out, r.TTL, nil
+}
+
+// resolve resolves the service (when a resolver is configured) and refreshes the targets in the background until the
+// load balancer is closed
+func (l *LoadBalancer) resolve() {
+	if l.Resolver == nil {
+		return
+	}
+
+	interval := l.refresh()
+
+	go func() {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-l.done:
+				return
+
+			case <-timer.C:
+				timer.Reset(l.refresh())
+			}
+		}
+	}()
+}
+
+// refresh resolves the service and replaces the targets; it returns the time until the next refresh
+func (l *LoadBalancer) refresh() time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	targets, ttl, err := l.Resolver.Resolve(ctx, l.Service)
+	if err == nil && len(targets) == 0 {
+		err = ErrNoTargets
+	}
+
+	if err != nil {
+		// the previous targets are kept
+		l.instrumentation.ResolveErr(l.name, l.Service, err)
+
+		return resolveRetryInterval
+	}
+
+	// the static targets (if any) are kept
+	l.setTargets(append(append([]Target(nil), l.Targets...), targets...))
+
+	switch {
+	case ttl <= 0:
+		return defaultResolveInterval
+
+	case ttl < minResolveInterval:
+		return minResolveInterval
+
+	default:
+		return ttl
+	}
+}
+
+// setTargets replaces the targets, keeping the state (e.g. the health) of the targets that remain
+func (l *LoadBalancer) setTargets(targets []Target) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	existing := make(map[string]*lbTarget, len(l.targets))
+	for _, target := range l.targets {
+		existing[target.Host] = target
+	}
+
+	updated := make([]*lbTarget, 0, len(targets))
+
+	for _, target := range targets {
+		if current, ok := existing[target.Host]; ok {
+			current.Weight = target.Weight
+			updated = append(updated, current)
+
+			continue
+		}
+
+		updated = append(updated, &lbTarget{Target: target})
+	}
+
+	l.targets = updated
+}
@@ -0,0 +1,211 @@
+package smarthttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKubernetesAPIServer       = "https://kubernetes.default.svc"
+	defaultKubernetesServiceAccount  = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	defaultKubernetesRefreshInterval = 10 * time.Second
+)
+
+// KubernetesResolver is a Resolver that reads the (ready) addresses of a Kubernetes service from its Endpoints using
+// the API server (from inside the cluster, with the pod's service account which requires permission to get endpoints).
+// The service is the name of the Kubernetes service, optionally followed by its namespace (e.g. "payments" or
+// "payments.billing").
+//
+// Resolving the pods directly (rather than using the service's cluster IP) allows the LoadBalancer to spread the
+// requests across the pods and eject unhealthy pods.
+type KubernetesResolver struct {
+	// Namespace is the namespace of services that do not include their namespace (default: the pod's namespace)
+	Namespace string
+
+	// PortName (optionally) is the name of the port of the service to use (default: the first port)
+	PortName string
+
+	// APIServer is the URL of the API server (default: https://kubernetes.default.svc)
+	APIServer string
+
+	// TokenFile and CAFile are the service account token and the CA certificate of the API server (default: the files
+	// mounted in the pod under /var/run/secrets/kubernetes.io/serviceaccount)
+	TokenFile string
+	CAFile    string
+
+	// RefreshInterval is how long the addresses are used before they are read again (default: 10s)
+	RefreshInterval time.Duration
+
+	initOnce  sync.Once
+	initErr   error
+	client    *http.Client
+	namespace string
+}
+
+// kubernetesEndpoints is the subset of the Endpoints resource used by the resolver
+type kubernetesEndpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+// Resolve implements Resolver
+func (r *KubernetesResolver) Resolve(ctx context.Context, service string) ([]Target, time.Duration, error) {
+	r.initOnce.Do(r.doInitOnce)
+
+	if r.initErr != nil {
+		return nil, 0, r.initErr
+	}
+
+	name, namespace := service, r.namespace
+	if index := strings.Index(service, "."); index >= 0 {
+		name, namespace = service[:index], service[index+1:]
+	}
+
+	endpoints, err := r.getEndpoints(ctx, namespace, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var out []Target
+
+	for _, subset := range endpoints.Subsets {
+		port := 0
+
+		for _, candidate := range subset.Ports {
+			if r.PortName == "" || candidate.Name == r.PortName {
+				port = candidate.Port
+
+				break
+			}
+		}
+
+		if port == 0 {
+			continue
+		}
+
+		for _, address := range subset.Addresses {
+			out = append(out, Target{Host: net.JoinHostPort(address.IP, strconv.Itoa(port))})
+		}
+	}
+
+	return out, r.getRefreshInterval(), nil
+}
+
+func (r *KubernetesResolver) getEndpoints(ctx context.Context, namespace, name string) (*kubernetesEndpoints, error) {
+	// the token is read for each request as projected tokens are rotated
+	token, err := ioutil.ReadFile(r.getServiceAccountFile(r.TokenFile, "token"))
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints/%s", strings.TrimSuffix(r.getAPIServer(), "/"),
+		namespace, name)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get the endpoints of '%s.%s' (status %d)", name, namespace, resp.StatusCode)
+	}
+
+	endpoints := &kubernetesEndpoints{}
+
+	err = json.NewDecoder(resp.Body).Decode(endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+func (r *KubernetesResolver) doInitOnce() {
+	r.namespace = r.Namespace
+	if r.namespace == "" {
+		namespace, err := ioutil.ReadFile(r.getServiceAccountFile("", "namespace"))
+		if err != nil {
+			r.initErr = fmt.Errorf("unable to read the namespace of the pod: %w", err)
+
+			return
+		}
+
+		r.namespace = strings.TrimSpace(string(namespace))
+	}
+
+	caCert, err := ioutil.ReadFile(r.getServiceAccountFile(r.CAFile, "ca.crt"))
+	if err != nil {
+		r.initErr = fmt.Errorf("unable to read the CA certificate of the API server: %w", err)
+
+		return
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		r.initErr = errors.New("no certificates found in the CA certificate of the API server")
+
+		return
+	}
+
+	r.client = &http.Client{
+		Timeout: resolveTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		},
+	}
+}
+
+func (r *KubernetesResolver) getServiceAccountFile(path, name string) string {
+	if path != "" {
+		return path
+	}
+
+	return defaultKubernetesServiceAccount + name
+}
+
+func (r *KubernetesResolver) getAPIServer() string {
+	if r.APIServer != "" {
+		return r.APIServer
+	}
+
+	return defaultKubernetesAPIServer
+}
+
+func (r *KubernetesResolver) getRefreshInterval() time.Duration {
+	if r.RefreshInterval > 0 {
+		return r.RefreshInterval
+	}
+
+	return defaultKubernetesRefreshInterval
+}
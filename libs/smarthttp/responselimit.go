@@ -0,0 +1,66 @@
+package smarthttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrResponseTooLarge indicates that the response body exceeded Client.MaxResponseBytes.
+// It is returned by Client.Do when the Content-Length of the response exceeds the limit and by the Read of the response
+// body when the limit is reached while reading.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// limitResponse guards the body of the response with MaxResponseBytes (when set).
+// Responses that declare a larger Content-Length are rejected (and closed) without reading the body.
+func (c *Client) limitResponse(resp *http.Response) (*http.Response, error) {
+	if c.MaxResponseBytes <= 0 || resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, nil
+	}
+
+	if resp.ContentLength > c.MaxResponseBytes {
+		_ = resp.Body.Close()
+
+		return nil, fmt.Errorf("%w - content length of %d bytes exceeds the limit of %d bytes", ErrResponseTooLarge,
+			resp.ContentLength, c.MaxResponseBytes)
+	}
+
+	resp.Body = &limitedBody{body: resp.Body, remaining: c.MaxResponseBytes, limit: c.MaxResponseBytes}
+
+	return resp, nil
+}
+
+// limitedBody is an io.LimitReader style guard that returns ErrResponseTooLarge (rather than io.EOF) when the body
+// exceeds the limit
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+// Read implements io.Reader
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, fmt.Errorf("%w - exceeded the limit of %d bytes", ErrResponseTooLarge, b.limit)
+	}
+
+	// read one byte more than the limit so that a body of exactly the limit is not reported as too large
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+
+	if b.remaining < 0 {
+		return n + int(b.remaining), fmt.Errorf("%w - exceeded the limit of %d bytes", ErrResponseTooLarge, b.limit)
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,97 @@
+package smarthttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrInvalidResponse indicates that the response was rejected by Client.ValidateResponse
+var ErrInvalidResponse = errors.New("invalid response")
+
+// InvalidResponseError is the error of a response rejected by Client.ValidateResponse.
+// Errors returned by ValidateResponse are not retried unless they are (or wrap) an InvalidResponseError that is
+// Retriable (see RetriableResponseError).
+type InvalidResponseError struct {
+	// StatusCode is the status code of the rejected response
+	StatusCode int
+
+	// Retriable indicates that the request can be retried (see Retries); e.g. an HTML error page from a misconfigured
+	// load balancer is likely to be transient, while a response that does not match the expected schema is not
+	Retriable bool
+
+	// Err is the error returned by ValidateResponse
+	Err error
+}
+
+// Error implements error
+func (e *InvalidResponseError) Error() string {
+	return ErrInvalidResponse.Error() + " (status " + strconv.Itoa(e.StatusCode) + ") - " + e.Err.Error()
+}
+
+// Is supports errors.Is for ErrInvalidResponse
+func (e *InvalidResponseError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// Unwrap supports errors.Is and errors.As for the error returned by ValidateResponse
+func (e *InvalidResponseError) Unwrap() error {
+	return e.Err
+}
+
+// RetriableResponseError marks an error returned by ValidateResponse as retriable, e.g.
+//
+//	client.ValidateResponse = func(resp *http.Response) error {
+//		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+//			return smarthttp.RetriableResponseError(errors.New("unexpected HTML response"))
+//		}
+//
+//		return nil
+//	}
+func RetriableResponseError(err error) error {
+	return &InvalidResponseError{Retriable: true, Err: err}
+}
+
+// isRetriableResponseError returns true when the error is (or wraps) a retriable InvalidResponseError
+func isRetriableResponseError(err error) bool {
+	var invalidErr *InvalidResponseError
+
+	return errors.As(err, &invalidErr) && invalidErr.Retriable
+}
+
+// addResponseValidation wraps the function with the response validation (when configured).
+// A rejected response is closed and replaced by an error wrapping ErrInvalidResponse, so that it is seen as a failure
+// by the retries and the circuit breaker (and is not cached or shared by singleflight).
+func (c *Client) addResponseValidation(doFunc requestClosure) requestClosure {
+	if c.ValidateResponse == nil {
+		return doFunc
+	}
+
+	return func(req *http.Request) (*http.Response, error) {
+		resp, err := doFunc(req)
+		if err != nil {
+			return resp, err
+		}
+
+		err = c.ValidateResponse(resp)
+		if err == nil {
+			return resp, nil
+		}
+
+		// the error may have been marked by RetriableResponseError (it is copied as it may be shared)
+		invalidErr := InvalidResponseError{Err: err}
+
+		var marked *InvalidResponseError
+		if errors.As(err, &marked) {
+			invalidErr = *marked
+		}
+
+		invalidErr.StatusCode = resp.StatusCode
+
+		c.getInstrumentation().ResponseRejected(req, resp.StatusCode, &invalidErr)
+
+		discardResponse(resp)
+
+		return nil, &invalidErr
+	}
+}
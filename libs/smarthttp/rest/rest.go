@@ -0,0 +1,277 @@
+// Package rest builds typed clients for REST APIs on top of a smarthttp client.
+//
+// The API is declared as a struct of function fields, each tagged with the method and the path template of its endpoint
+// (see smarthttp.BuildURL):
+//
+//	type OrdersAPI struct {
+//		Get    func(ctx context.Context, params smarthttp.Params) (*Order, error)                  `rest:"GET /v1/orders/{orderID}"`
+//		List   func(ctx context.Context, query *ListOrders) ([]Order, error)                      `rest:"GET /v1/orders"`
+//		Create func(ctx context.Context, order *NewOrder) (*Order, error)                         `rest:"POST /v1/orders"`
+//		Cancel func(ctx context.Context, params smarthttp.Params, reason *CancelReason) error `rest:"POST /v1/orders/{orderID}/cancel"`
+//	}
+//
+//	orders := &OrdersAPI{}
+//	err := rest.Bind(httpClient, "https://orders.example.com", orders)
+//	...
+//	order, err := orders.Get(ctx, smarthttp.Params{"orderID": id})
+//
+// Bind implements the functions: the requests are sent with smarthttp.Client.DoJSON (so they go through the whole
+// pipeline, including retries and the circuit breaker) and are tagged with the path template in the instrumentation.
+//
+// The arguments of a function are (in order):
+//
+//   - a context.Context
+//   - (optionally) the smarthttp.Params of the placeholders of the path
+//   - for GET, HEAD, DELETE and OPTIONS: (optionally) the query (see smarthttp.EncodeQuery)
+//   - for other methods: (optionally) the body (encoded as JSON) and then (optionally) the query
+//
+// A function returns an error, or a value (decoded from the JSON response) and an error.  Non-2xx responses are
+// returned as a *smarthttp.APIError.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+// ErrInvalidAPI indicates that the API struct passed to Bind is not valid
+var ErrInvalidAPI = errors.New("invalid api")
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	paramsType  = reflect.TypeOf(smarthttp.Params{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Bind implements the tagged function fields of the API (a pointer to a struct, see the package documentation) with
+// requests to the base URL sent by the client.  Fields without a `rest` tag are left unchanged.
+func Bind(client *smarthttp.Client, baseURL string, api interface{}) error {
+	value := reflect.ValueOf(api)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w - expected a pointer to a struct, got %T", ErrInvalidAPI, api)
+	}
+
+	value = value.Elem()
+	apiType := value.Type()
+
+	for i := 0; i < apiType.NumField(); i++ {
+		field := apiType.Field(i)
+
+		tag, ok := field.Tag.Lookup("rest")
+		if !ok {
+			continue
+		}
+
+		if field.PkgPath != "" {
+			return fmt.Errorf("%w - field '%s' is not exported", ErrInvalidAPI, field.Name)
+		}
+
+		e, err := newEndpoint(client, baseURL, tag, field.Type)
+		if err != nil {
+			return fmt.Errorf("%w - field '%s': %s", ErrInvalidAPI, field.Name, err)
+		}
+
+		value.Field(i).Set(reflect.MakeFunc(field.Type, e.call))
+	}
+
+	return nil
+}
+
+// endpoint implements a function field
+type endpoint struct {
+	client   *smarthttp.Client
+	method   string
+	template string
+
+	// the index of each argument (-1 when the function does not have it)
+	paramsIndex int
+	bodyIndex   int
+	queryIndex  int
+
+	// the type of the result (nil when the function only returns an error)
+	resultType reflect.Type
+}
+
+func newEndpoint(client *smarthttp.Client, baseURL, tag string, funcType reflect.Type) (*endpoint, error) {
+	parts := strings.Fields(tag)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+		return nil, fmt.Errorf("tag '%s' is not formatted as \"<METHOD> /<path>\"", tag)
+	}
+
+	e := &endpoint{
+		client:      client,
+		method:      strings.ToUpper(parts[0]),
+		template:    strings.TrimSuffix(baseURL, "/") + parts[1],
+		paramsIndex: -1,
+		bodyIndex:   -1,
+		queryIndex:  -1,
+	}
+
+	if funcType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected a func, got %s", funcType)
+	}
+
+	err := e.parseArgs(funcType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.parseResults(funcType)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *endpoint) parseArgs(funcType reflect.Type) error {
+	if funcType.IsVariadic() || funcType.NumIn() == 0 || funcType.In(0) != contextType {
+		return errors.New("the first argument must be a context.Context")
+	}
+
+	index := 1
+
+	if index < funcType.NumIn() && funcType.In(index) == paramsType {
+		e.paramsIndex = index
+		index++
+	}
+
+	if hasBody(e.method) && index < funcType.NumIn() {
+		e.bodyIndex = index
+		index++
+	}
+
+	if index < funcType.NumIn() {
+		e.queryIndex = index
+		index++
+	}
+
+	if index < funcType.NumIn() {
+		return fmt.Errorf("unexpected argument %s", funcType.In(index))
+	}
+
+	return nil
+}
+
+func (e *endpoint) parseResults(funcType reflect.Type) error {
+	switch {
+	case funcType.NumOut() == 1 && funcType.Out(0) == errorType:
+		return nil
+
+	case funcType.NumOut() == 2 && funcType.Out(1) == errorType:
+		e.resultType = funcType.Out(0)
+
+		return nil
+
+	default:
+		return errors.New("the results must be (error) or (<value>, error)")
+	}
+}
+
+// call sends the request of the function and returns its results
+func (e *endpoint) call(args []reflect.Value) []reflect.Value {
+	result, err := e.do(args)
+
+	errValue := reflect.Zero(errorType)
+	if err != nil {
+		errValue = reflect.ValueOf(err)
+	}
+
+	if e.resultType == nil {
+		return []reflect.Value{errValue}
+	}
+
+	if err != nil || !result.IsValid() {
+		return []reflect.Value{reflect.Zero(e.resultType), errValue}
+	}
+
+	return []reflect.Value{result, errValue}
+}
+
+func (e *endpoint) do(args []reflect.Value) (reflect.Value, error) {
+	ctx, _ := args[0].Interface().(context.Context)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var params smarthttp.Params
+	if e.paramsIndex >= 0 {
+		params, _ = args[e.paramsIndex].Interface().(smarthttp.Params)
+	}
+
+	var query interface{}
+	if e.queryIndex >= 0 {
+		query = args[e.queryIndex].Interface()
+	}
+
+	var body io.Reader
+
+	if e.bodyIndex >= 0 && !isNil(args[e.bodyIndex]) {
+		payload, err := json.Marshal(args[e.bodyIndex].Interface())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := smarthttp.NewTemplateRequest(ctx, e.method, e.template, params, query, body)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if e.resultType == nil {
+		return reflect.Value{}, e.client.DoJSON(req, nil)
+	}
+
+	// decode into a new value (of the pointed to type when the result is a pointer)
+	target := reflect.New(e.resultType)
+	if e.resultType.Kind() == reflect.Ptr {
+		target = reflect.New(e.resultType.Elem())
+	}
+
+	err = e.client.DoJSON(req, target.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if e.resultType.Kind() == reflect.Ptr {
+		return target, nil
+	}
+
+	return target.Elem(), nil
+}
+
+// hasBody returns whether the requests of the method have a body
+func hasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		return false
+
+	default:
+		return true
+	}
+}
+
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return value.IsNil()
+
+	default:
+		return false
+	}
+}
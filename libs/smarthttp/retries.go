@@ -1,30 +1,26 @@
 package smarthttp
 
 import (
-	"bytes"
-	"context"
-	"errors"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
-
-	"github.com/corsc/go-commons/resilience/retry"
 )
 
 const (
 	defaultMaxAttempts    = 3
 	defaultBaseRetryDelay = 10 * time.Millisecond
 	defaultMaxRetryDelay  = 1 * time.Second
+	defaultMaxBufferSize  = 1 << 20
 )
 
+// the classes of the errors that are retried by default (see Retries.RetriableErrorClasses)
 var (
-	// This indicates that we CANNOT retry this request due to the response code
-	// This error should not be surfaced callers of this package.
-	errRetryImpossible = errors.New("cannot retry due to HTTP status code")
+	defaultRetriableErrorClasses = []ErrorClass{ErrorClassReadTimeout, ErrorClassReset}
 
-	// This indicates that we CAN retry this request due to the response code
-	// This error should not be surfaced callers of this package.
-	errRetryAllowed = errors.New("according to the HTTP status we can retry the request")
+	defaultRetriableClassSet = newErrorClassSet(defaultRetriableErrorClasses)
 )
 
 // Retries defines the retry configuration
@@ -35,10 +31,49 @@ type Retries struct {
 	// BaseDelay is the base amount of time between attempts (default: 10 ms)
 	BaseDelay time.Duration
 
-	// MaxDelay is the maximum possible delay (default: 1 second)
+	// MaxDelay is the maximum possible delay (default: 1 second).
+	// This also caps any delay requested by the upstream via the Retry-After header.
 	MaxDelay time.Duration
 
-	retrier *retry.Client
+	// RetriableStatusCodes (optionally) replaces the default list of retriable HTTP status codes
+	// (408, 500, 503, 504 and 429 when a Retry-After header is supplied).
+	// All other status codes are not retried.  Errors are retried according to RetriableErrorClasses.
+	RetriableStatusCodes []int
+
+	// RetriableErrorClasses (optionally) replaces the default list of the classes (see ClassifyError) of the errors that
+	// are retried (ErrorClassReadTimeout and ErrorClassReset, i.e. timeouts and connections that were reset or closed by
+	// the upstream, e.g. behind a flaky load balancer).  Errors of the other classes are not retried; e.g. add
+	// ErrorClassDNSTemporary and ErrorClassProxy to also retry temporary DNS failures and proxy connection failures.
+	RetriableErrorClasses []ErrorClass
+
+	// IsRetriable (optionally) replaces the default classification of the result of each attempt (including
+	// RetriableStatusCodes).  It is called with the response or the error of the attempt and should return true when the
+	// request should be retried.
+	IsRetriable func(resp *http.Response, err error) bool
+
+	// IdempotentMethodsOnly restricts retries to idempotent HTTP methods (GET, HEAD, OPTIONS, TRACE, PUT and DELETE)
+	// so that a write is never replayed against an upstream that may have already processed it (default: true).
+	// Requests for other methods can opt-in individually via WithNonIdempotentRetries.
+	IdempotentMethodsOnly *bool
+
+	// IdempotencyKey (optionally) attaches an idempotency key to non-idempotent requests that are retried.
+	IdempotencyKey *IdempotencyKey
+
+	// MaxBufferSize is the maximum number of bytes of a request body that will be buffered so that it can be replayed by a
+	// retry (default: 1 MB).  Requests that supply http.Request.GetBody are replayed without buffering.
+	// Requests with a larger body are not retried.
+	MaxBufferSize int64
+
+	maxAttempts           int
+	baseDelay             time.Duration
+	maxDelay              time.Duration
+	retriableCodes        map[int]struct{}
+	retriableClasses      map[ErrorClass]struct{}
+	idempotentMethodsOnly bool
+	maxBufferSize         int64
+
+	// see Client.MinimumRemaining
+	minimumRemaining time.Duration
 
 	instrumentation Instrumentation
 }
@@ -73,114 +108,279 @@ func (r *Retries) getMaxDelay() time.Duration {
 	return defaultMaxRetryDelay
 }
 
+func (r *Retries) getMaxBufferSize() int64 {
+	if r.MaxBufferSize > 0 {
+		return r.MaxBufferSize
+	}
+
+	r.instrumentation.InitWarning("using default 'max buffer size' setting for retries")
+
+	return defaultMaxBufferSize
+}
+
+func (r *Retries) getIdempotentMethodsOnly() bool {
+	if r.IdempotentMethodsOnly != nil {
+		return *r.IdempotentMethodsOnly
+	}
+
+	r.instrumentation.InitWarning("using default 'idempotent methods only' setting for retries")
+
+	return true
+}
+
+// do performs the request with the retries (the request is performed once when r is nil)
 // nolint: gocognit,funlen
-func (r *Retries) buildMiddleware(doFunc requestClosure) requestClosure {
-	return func(req *http.Request) (*http.Response, error) {
-		var resp *http.Response
-		var innerErr error
+func (r *Retries) do(doFunc requestClosure, req *http.Request) (*http.Response, error) {
+	if r == nil || !r.canRetry(req) {
+		return doFunc(req)
+	}
+
+	req, idempotencyKey := r.IdempotencyKey.apply(req)
+
+	body := newReplayableBody(req, r.maxBufferSize)
+	defer body.release()
+
+	attemptReq := body.first(req)
+
+	lastStatusCode := 0
 
-		reqClone, err := cloneRequest(req)
+	for attempt := 0; ; attempt++ {
+		attemptReq = withAttempt(attemptReq, attempt+1)
+
+		resp, err := doFunc(attemptReq)
+		if resp != nil {
+			lastStatusCode = resp.StatusCode
+		}
+
+		retriable, delay := r.classify(attemptReq, resp, err, attempt)
+		if !retriable || attempt+1 >= r.maxAttempts || !body.canReplay() {
+			return resp, wrapRetryErr(err, attempt+1, lastStatusCode, idempotencyKey)
+		}
+
+		// release the connection of the response we are discarding
+		discardResponse(resp)
+
+		// do not wait for a retry that cannot finish before the deadline
+		err = checkDeadline(req.Context(), r.minimumRemaining, delay)
 		if err != nil {
-			return nil, err
+			return nil, wrapRetryErr(err, attempt+1, lastStatusCode, idempotencyKey)
 		}
 
-		isFirstTry := true
-
-		//nolint:bodyclose
-		err = r.retrier.Do(req.Context(), "", func() error {
-			if isFirstTry {
-				isFirstTry = false
-			} else {
-				req = reqClone
-				reqClone, err = cloneRequest(req)
-				if err != nil {
-					return err
-				}
-			}
-
-			resp, innerErr = doFunc(req)
-			if innerErr != nil {
-				if errors.Is(innerErr, ErrTimeout) {
-					// allow timeouts to retry
-					r.instrumentation.RetryRetriable(req, 666)
-					return errRetryAllowed
-				}
-
-				return innerErr
-			}
-
-			// process HTTP response codes (and trigger retries)
-			switch resp.StatusCode {
-			case http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden,
-				http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusProxyAuthRequired,
-				http.StatusGone, http.StatusLengthRequired, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge,
-				http.StatusRequestURITooLong, http.StatusUnsupportedMediaType, http.StatusRequestedRangeNotSatisfiable,
-				http.StatusExpectationFailed, http.StatusTeapot, http.StatusMisdirectedRequest, http.StatusUnprocessableEntity,
-				http.StatusLocked, http.StatusFailedDependency, http.StatusTooEarly, http.StatusUpgradeRequired,
-				http.StatusPreconditionRequired, http.StatusTooManyRequests, http.StatusRequestHeaderFieldsTooLarge,
-				http.StatusUnavailableForLegalReasons, http.StatusNotImplemented, http.StatusBadGateway,
-				http.StatusHTTPVersionNotSupported, http.StatusVariantAlsoNegotiates, http.StatusInsufficientStorage,
-				http.StatusLoopDetected, http.StatusNotExtended, http.StatusNetworkAuthenticationRequired:
-				// non-retriable status codes
-
-				r.instrumentation.RetryNonRetriable(req, resp.StatusCode)
-
-				return errRetryImpossible
-
-			case http.StatusRequestTimeout,
-				http.StatusInternalServerError,
-				http.StatusServiceUnavailable,
-				http.StatusGatewayTimeout:
-				// retriable errors
-
-				r.instrumentation.RetryRetriable(req, resp.StatusCode)
-
-				return errRetryAllowed
-
-			default:
-				// happy path - do nothing
-				return nil
-			}
-		})
-
-		switch {
-		case errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded):
-			// return nil response to avoid data race between retrier goroutine and this one.
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+			// try again
+
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return nil, wrapRetryErr(req.Context().Err(), attempt+1, lastStatusCode, idempotencyKey)
+		}
+
+		attemptReq, err = body.replay(req)
+		if err != nil {
 			return nil, err
+		}
+	}
+}
+
+// wrapRetryErr decorates the final error of the retry middleware with the details of the attempts
+func wrapRetryErr(err error, attempts, statusCode int, idempotencyKey string) error {
+	if err == nil {
+		return nil
+	}
+
+	err = &AttemptsError{Attempts: attempts, StatusCode: statusCode, Err: err}
+
+	if idempotencyKey != "" {
+		err = &IdempotencyKeyError{Key: idempotencyKey, Err: err}
+	}
+
+	return err
+}
+
+// canRetry returns whether the request may be attempted more than once
+func (r *Retries) canRetry(req *http.Request) bool {
+	if !r.idempotentMethodsOnly || isIdempotent(req.Method) {
+		return true
+	}
+
+	return nonIdempotentRetriesAllowed(req.Context())
+}
+
+// isIdempotent returns whether the method is idempotent (as defined by RFC 7231)
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// classify returns whether the result of the attempt can be retried and if so, how long to wait before doing so
+func (r *Retries) classify(req *http.Request, resp *http.Response, err error, attempt int) (bool, time.Duration) {
+	switch {
+	case r.IsRetriable != nil:
+		return r.classifyCustom(req, resp, err, attempt, r.IsRetriable(resp, err))
+
+	case r.retriableCodes != nil && err == nil:
+		_, retriable := r.retriableCodes[resp.StatusCode]
+
+		return r.classifyCustom(req, resp, err, attempt, retriable)
+	}
+
+	if err != nil {
+		// allow transient errors (e.g. timeouts, connection resets and responses rejected as retriable) to retry
+		class := ClassifyError(err)
+		if _, retriable := r.retriableClasses[class]; retriable || isRetriableResponseError(err) {
+			r.instrumentation.RetryRetriableErr(req, class, attempt+1)
+
+			return true, r.backoff(attempt)
+		}
+
+		r.instrumentation.RetryNonRetriableErr(req, class, attempt+1)
+
+		return false, 0
+	}
+
+	// process HTTP response codes (and trigger retries)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		// only retriable when the upstream tells us when
+		delay, ok := r.retryAfter(resp)
+		if !ok {
+			r.instrumentation.RetryNonRetriable(req, resp.StatusCode, attempt+1)
+
+			return false, 0
+		}
+
+		r.instrumentation.RetryRetriable(req, resp.StatusCode, attempt+1)
+
+		return true, delay
 
-		case errors.Is(err, errRetryImpossible), errors.Is(err, errRetryAllowed), errors.Is(err, retry.ErrAttemptsExceeded):
-			return resp, innerErr
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden,
+		http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusProxyAuthRequired,
+		http.StatusGone, http.StatusLengthRequired, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge,
+		http.StatusRequestURITooLong, http.StatusUnsupportedMediaType, http.StatusRequestedRangeNotSatisfiable,
+		http.StatusExpectationFailed, http.StatusTeapot, http.StatusMisdirectedRequest, http.StatusUnprocessableEntity,
+		http.StatusLocked, http.StatusFailedDependency, http.StatusTooEarly, http.StatusUpgradeRequired,
+		http.StatusPreconditionRequired, http.StatusRequestHeaderFieldsTooLarge,
+		http.StatusUnavailableForLegalReasons, http.StatusNotImplemented, http.StatusBadGateway,
+		http.StatusHTTPVersionNotSupported, http.StatusVariantAlsoNegotiates, http.StatusInsufficientStorage,
+		http.StatusLoopDetected, http.StatusNotExtended, http.StatusNetworkAuthenticationRequired:
+		// non-retriable status codes
 
-		default:
-			return resp, err
+		r.instrumentation.RetryNonRetriable(req, resp.StatusCode, attempt+1)
+
+		return false, 0
+
+	case http.StatusRequestTimeout,
+		http.StatusInternalServerError,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		// retriable errors
+
+		r.instrumentation.RetryRetriable(req, resp.StatusCode, attempt+1)
+
+		if delay, ok := r.retryAfter(resp); ok {
+			return true, delay
 		}
+
+		return true, r.backoff(attempt)
+
+	default:
+		// happy path - do nothing
+		return false, 0
 	}
 }
 
-func cloneRequest(req *http.Request) (*http.Request, error) {
-	reqClone := req.Clone(req.Context())
+// classifyCustom reports the outcome of a user supplied classification
+func (r *Retries) classifyCustom(req *http.Request, resp *http.Response, err error, attempt int, retriable bool) (bool, time.Duration) {
+	if err != nil {
+		if !retriable {
+			r.instrumentation.RetryNonRetriableErr(req, ClassifyError(err), attempt+1)
 
-	if req.Body != nil {
-		var b bytes.Buffer
+			return false, 0
+		}
 
-		_, err := b.ReadFrom(req.Body)
-		if err != nil {
-			return nil, err
+		r.instrumentation.RetryRetriableErr(req, ClassifyError(err), attempt+1)
+
+		return true, r.backoff(attempt)
+	}
+
+	if !retriable {
+		if resp.StatusCode >= http.StatusBadRequest {
+			r.instrumentation.RetryNonRetriable(req, resp.StatusCode, attempt+1)
 		}
 
-		req.Body = ioutil.NopCloser(&b)
-		reqClone.Body = ioutil.NopCloser(bytes.NewReader(b.Bytes()))
+		return false, 0
 	}
 
-	return reqClone, nil
+	r.instrumentation.RetryRetriable(req, resp.StatusCode, attempt+1)
+
+	if delay, ok := r.retryAfter(resp); ok {
+		return true, delay
+	}
+
+	return true, r.backoff(attempt)
 }
 
-func (r *Retries) addMiddleware(doFunc requestClosure) requestClosure {
-	if r == nil {
-		return doFunc
+// backoff returns the exponential (with jitter) delay before the next attempt (attempt is zero based)
+func (r *Retries) backoff(attempt int) time.Duration {
+	delay := r.baseDelay << uint(attempt)
+	if delay <= 0 || delay > r.maxDelay {
+		// (also protects against overflow)
+		delay = r.maxDelay
+	}
+
+	// "equal jitter"; somewhere between half and all of the delay
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+
+	return time.Duration(half + rand.Int63n(half)) // nolint: gosec
+}
+
+// retryAfter parses the Retry-After header (either delay-seconds or an HTTP-date), capped at MaxDelay
+func (r *Retries) retryAfter(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		delay = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	if delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+
+	return delay, true
+}
+
+// discardResponse drains and closes the body so that the connection can be reused
+func discardResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
 	}
 
-	return r.buildMiddleware(doFunc)
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
 }
 
 func (r *Retries) doInitOnce(instrumentation Instrumentation) {
@@ -190,12 +390,80 @@ func (r *Retries) doInitOnce(instrumentation Instrumentation) {
 
 	r.instrumentation = instrumentation
 
-	r.retrier = &retry.Client{
-		MaxAttempts: r.getMaxAttempts(),
-		BaseDelay:   r.getBaseDelay(),
-		MaxDelay:    r.getMaxDelay(),
-		CanRetry: func(err error) bool {
-			return errors.Is(err, errRetryAllowed)
-		},
+	r.applySettings()
+}
+
+// forRequest returns an initialized copy of a retry policy supplied with a request (see WithRetryPolicy)
+func (r *Retries) forRequest(instrumentation Instrumentation) *Retries {
+	clone := *r
+
+	// defaults are applied silently; the warnings are only useful during client initialization
+	clone.instrumentation = &NoopInstrumentation{}
+	clone.applySettings()
+
+	clone.instrumentation = instrumentation
+
+	return &clone
+}
+
+func (r *Retries) applySettings() {
+	r.maxAttempts = r.getMaxAttempts()
+	r.baseDelay = r.getBaseDelay()
+	r.maxDelay = r.getMaxDelay()
+	r.idempotentMethodsOnly = r.getIdempotentMethodsOnly()
+	r.maxBufferSize = r.getMaxBufferSize()
+
+	r.retriableCodes = nil
+	if r.RetriableStatusCodes != nil {
+		r.retriableCodes = make(map[int]struct{}, len(r.RetriableStatusCodes))
+
+		for _, code := range r.RetriableStatusCodes {
+			r.retriableCodes[code] = struct{}{}
+		}
+	}
+
+	classes := r.RetriableErrorClasses
+	if classes == nil {
+		classes = defaultRetriableErrorClasses
 	}
+
+	r.retriableClasses = newErrorClassSet(classes)
+}
+
+func newErrorClassSet(classes []ErrorClass) map[ErrorClass]struct{} {
+	set := make(map[ErrorClass]struct{}, len(classes))
+	for _, class := range classes {
+		set[class] = struct{}{}
+	}
+
+	return set
+}
+
+// clone returns a copy of the configuration (without the resolved settings) for a variant of the client (see
+// Client.Clone)
+func (r *Retries) clone() *Retries {
+	if r == nil {
+		return nil
+	}
+
+	out := &Retries{
+		MaxAttempts:           r.MaxAttempts,
+		BaseDelay:             r.BaseDelay,
+		MaxDelay:              r.MaxDelay,
+		IsRetriable:           r.IsRetriable,
+		IdempotentMethodsOnly: r.IdempotentMethodsOnly,
+		IdempotencyKey:        r.IdempotencyKey,
+		MaxBufferSize:         r.MaxBufferSize,
+	}
+
+	// an empty list (nothing is retried) must not become nil (the default list)
+	if r.RetriableStatusCodes != nil {
+		out.RetriableStatusCodes = append(make([]int, 0, len(r.RetriableStatusCodes)), r.RetriableStatusCodes...)
+	}
+
+	if r.RetriableErrorClasses != nil {
+		out.RetriableErrorClasses = append(make([]ErrorClass, 0, len(r.RetriableErrorClasses)), r.RetriableErrorClasses...)
+	}
+
+	return out
 }
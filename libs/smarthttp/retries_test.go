@@ -0,0 +1,109 @@
+package smarthttp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetries_ErrorInstrumentation(t *testing.T) {
+	tests := []struct {
+		name             string
+		retriableClasses []ErrorClass
+		// the calls expected by the instrumentation (wrapped by LegacyRetryInstrumentation)
+		want retryErrorCalls
+	}{
+		{
+			name: "non-retriable error",
+			want: retryErrorCalls{nonRetriableErr: 1},
+		},
+		{
+			// retriable errors are also reported with LegacyErrorStatusCode
+			name:             "retriable error",
+			retriableClasses: []ErrorClass{ErrorClassOther},
+			want:             retryErrorCalls{retriableErr: 3, retriable: 3},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			instrumentation := &retryErrorInstrumentation{}
+
+			client := &Client{
+				Name: "retries-errors-" + test.name,
+				Client: &http.Client{Transport: roundTripper(func(_ *http.Request) (*http.Response, error) {
+					return nil, errors.New("upstream failure")
+				})},
+				Retries: &Retries{
+					MaxAttempts:           3,
+					BaseDelay:             time.Millisecond,
+					RetriableErrorClasses: test.retriableClasses,
+				},
+				Instrumentation: LegacyRetryInstrumentation(instrumentation),
+				CircuitBreaker:  CircuitBreaker{Engine: &GoBreakerEngine{}},
+			}
+
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/orders", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Do(req)
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if instrumentation.calls != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, instrumentation.calls)
+			}
+		})
+	}
+}
+
+// roundTripper is a function that implements http.RoundTripper
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r(req)
+}
+
+type retryErrorCalls struct {
+	retriable       int
+	nonRetriable    int
+	retriableErr    int
+	nonRetriableErr int
+}
+
+type retryErrorInstrumentation struct {
+	NoopInstrumentation
+
+	calls retryErrorCalls
+}
+
+func (r *retryErrorInstrumentation) RetryRetriable(_ *http.Request, code int, _ int) {
+	if code == LegacyErrorStatusCode {
+		r.calls.retriable++
+	}
+}
+
+func (r *retryErrorInstrumentation) RetryNonRetriable(_ *http.Request, code int, _ int) {
+	if code == LegacyErrorStatusCode {
+		r.calls.nonRetriable++
+	}
+}
+
+func (r *retryErrorInstrumentation) RetryRetriableErr(_ *http.Request, _ ErrorClass, _ int) {
+	r.calls.retriableErr++
+}
+
+func (r *retryErrorInstrumentation) RetryNonRetriableErr(_ *http.Request, _ ErrorClass, _ int) {
+	r.calls.nonRetriableErr++
+}
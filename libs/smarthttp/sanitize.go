@@ -0,0 +1,88 @@
+package smarthttp
+
+import (
+	"strings"
+)
+
+const (
+	// the placeholder that replaces IDs in sanitized paths
+	sanitizedIDPlaceholder = "{id}"
+
+	// the minimum length of a hex segment (e.g. a hash or token) to be treated as an ID
+	minHexIDLength = 16
+)
+
+// DefaultSanitizePath collapses the IDs in the url path (numbers, UUIDs and long hex tokens) into a placeholder so that
+// the path can be used as a metric tag without unbounded cardinality (e.g. "/orders/123/items" becomes
+// "/orders/{id}/items").
+// It is used by NoopInstrumentation and as such by Instrumentation implementations that embed it.
+func DefaultSanitizePath(urlPath string) string {
+	segments := strings.Split(urlPath, "/")
+
+	for i, segment := range segments {
+		if isIDSegment(segment) {
+			segments[i] = sanitizedIDPlaceholder
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func isIDSegment(segment string) bool {
+	switch {
+	case segment == "":
+		return false
+
+	case isDigits(segment), isUUID(segment):
+		return true
+
+	case len(segment) >= minHexIDLength && isHex(segment):
+		return true
+
+	default:
+		return false
+	}
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHex(value string) bool {
+	for _, r := range value {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isUUID returns true when the value is formatted as a UUID (i.e. 8-4-4-4-12 hex digits)
+func isUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+
+	for i, r := range value {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+
+		default:
+			if !isHex(string(r)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+package smarthttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrSigning indicates that the request could not be signed
+var ErrSigning = errors.New("unable to sign request")
+
+// Signer signs requests (e.g. HMAC or AWS SigV4 style signatures).
+// The signer is called for each attempt (i.e. each retry and hedge is signed separately, so timestamps and nonces are
+// fresh) after all other changes to the request (including middleware), immediately before the request is sent.
+type Signer interface {
+	// Sign signs the request (typically by adding headers).
+	// The request is a copy that can be modified.  When the signature covers the body, it should be read via req.GetBody
+	// (when set) so that the body is not consumed.
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is a function that implements Signer
+type SignerFunc func(req *http.Request) error
+
+// Sign implements Signer
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// addSigner wraps the function with the signer (when configured)
+func (c *Client) addSigner(doFunc requestClosure) requestClosure {
+	if c.Signer == nil {
+		return doFunc
+	}
+
+	return func(req *http.Request) (*http.Response, error) {
+		// copy the request so that the signature of one attempt does not leak into the next
+		req = req.Clone(req.Context())
+
+		err := c.Signer.Sign(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w - %s", ErrSigning, err)
+		}
+
+		return doFunc(req)
+	}
+}
@@ -1,20 +1,60 @@
 package smarthttp
 
 import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/singleflight"
 )
 
+const (
+	// the prefix of the keys of the results shared via Singleflight.Store (so that a store can be shared with the Cache)
+	sfStoreKeyPrefix = "sf:"
+
+	// the default maximum number of results kept for the Singleflight TTL
+	defaultSFMaxRecent = 1000
+)
+
 // Singleflight defines the Singleflight configuration
 type Singleflight struct {
 	// KeyGenerator will generate a unique "key" from the request.
-	// This key will be used to deduplicate requests.
+	// This key will be used to deduplicate requests; an empty key sends the request individually.
 	// If none is provided then DefaultSFKeyGenerator is used.
 	KeyGenerator func(req *http.Request) string
 
+	// MaxBodySize is the maximum size of a response body that will be buffered and shared between the coalesced requests
+	// (default: 1 MB).  When the body is larger, the other requests are sent to the upstream individually.
+	MaxBodySize int64
+
+	// TTL (optionally) keeps the result of a request for the supplied duration so that identical requests that arrive
+	// shortly after (rather than during) the original request also share its result.
+	// Only successful (non 5xx) responses that fit within MaxBodySize are kept.
+	TTL time.Duration
+
+	// MaxRecent is the maximum number of results kept for the TTL (default: 1000); the oldest results are removed first
+	MaxRecent int
+
+	// Store (optionally) shares the results kept for the TTL between instances (e.g. the pods of a service) so that
+	// identical requests made by different instances are also deduplicated (e.g. the Redis store from libs/cache).
+	Store CacheStore
+
+	recent             *sfRecent
+	requests           int64
+	shared             int64
 	group              *singleflight.Group
+	maxBodySize        int64
 	actualKeyGenerator func(req *http.Request) string
 
 	instrumentation Instrumentation
@@ -24,6 +64,34 @@ type Singleflight struct {
 	trackedKeys []string
 }
 
+// sfResult is the result shared between the coalesced requests
+type sfResult struct {
+	resp *http.Response
+	body []byte
+
+	// tooLarge indicates that the body exceeded MaxBodySize and could not be shared
+	tooLarge bool
+}
+
+func (s *Singleflight) getMaxBodySize() int64 {
+	if s.MaxBodySize > 0 {
+		return s.MaxBodySize
+	}
+
+	s.instrumentation.InitWarning("using default 'max body size' setting for singleflight")
+
+	return defaultMaxBufferSize
+}
+
+func (s *Singleflight) getMaxRecent() int {
+	if s.MaxRecent > 0 {
+		return s.MaxRecent
+	}
+
+	return defaultSFMaxRecent
+}
+
+//nolint:bodyclose
 func (s *Singleflight) buildMiddleware(doFunc requestClosure) requestClosure {
 	return func(req *http.Request) (*http.Response, error) {
 		// disable singleflight for non-GET requests when a custom key generator was not supplied
@@ -34,26 +102,258 @@ func (s *Singleflight) buildMiddleware(doFunc requestClosure) requestClosure {
 		key := s.actualKeyGenerator(req)
 		s.trackKey(s, key)
 
+		if key == "" {
+			return doFunc(req)
+		}
+
+		atomic.AddInt64(&s.requests, 1)
+
+		if recent := s.recent.get(req.Context(), key); recent != nil {
+			atomic.AddInt64(&s.shared, 1)
+
+			return recent.copyResponse(), nil
+		}
+
 		var innerErr error
 
-		//nolint:bodyclose
+		leader := false
+
 		result, err, _ := s.group.Do(key, func() (interface{}, error) {
-			var resp interface{}
+			leader = true
+
+			var resp *http.Response
+
 			resp, innerErr = doFunc(req)
+			if innerErr != nil {
+				// a response returned with the error is shared too; its body is buffered (and closed) like any other
+				shared, err := s.bufferBody(resp)
+				if err != nil {
+					return nil, innerErr
+				}
+
+				return shared, innerErr
+			}
 
-			return resp, innerErr
+			shared, err := s.bufferBody(resp)
+			if err == nil {
+				s.recent.put(req.Context(), key, shared)
+			}
+
+			return shared, err
 		})
 
 		if err != nil && innerErr == nil {
 			s.instrumentation.SingleflightErr(req, err)
 		}
 
-		if result != nil {
-			return result.(*http.Response), err
+		shared, _ := result.(*sfResult)
+
+		switch {
+		case shared == nil:
+			return nil, err
+
+		case shared.tooLarge && leader:
+			// only the leader can read the rest of the body
+			return shared.resp, err
+
+		case shared.tooLarge:
+			return doFunc(req)
+
+		default:
+			if !leader {
+				atomic.AddInt64(&s.shared, 1)
+			}
+
+			return shared.copyResponse(), err
 		}
+	}
+}
+
+// stats returns a snapshot of the deduplication of the requests (see Client.Stats)
+func (s *Singleflight) stats() *SingleflightStats {
+	if s == nil {
+		return nil
+	}
+
+	requests := atomic.LoadInt64(&s.requests)
+	shared := atomic.LoadInt64(&s.shared)
+
+	return &SingleflightStats{Requests: requests, Shared: shared, DedupRatio: ratio(shared, requests)}
+}
+
+// bufferBody reads the body (up to MaxBodySize) so that it can be shared
+func (s *Singleflight) bufferBody(resp *http.Response) (*sfResult, error) {
+	if resp == nil || resp.Body == nil {
+		return &sfResult{resp: resp}, nil
+	}
+
+	limit := s.maxBodySize + 1
+
+	body, err := readAll(io.LimitReader(resp.Body, limit), sizeHint(resp.ContentLength, limit))
+	if err != nil {
+		_ = resp.Body.Close()
 
 		return nil, err
 	}
+
+	if int64(len(body)) > s.maxBodySize {
+		// return the body we have read along with the remainder
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+
+		return &sfResult{resp: resp, tooLarge: true}, nil
+	}
+
+	_ = resp.Body.Close()
+
+	return &sfResult{resp: resp, body: body}, nil
+}
+
+// sfRecent keeps recent results for the Singleflight TTL
+type sfRecent struct {
+	ttl        time.Duration
+	maxEntries int
+	store      CacheStore
+
+	mutex   sync.Mutex
+	results map[string]*list.Element
+
+	// order holds the results from the newest to the oldest; as they share the TTL, the oldest expires first
+	order *list.List
+}
+
+type sfRecentResult struct {
+	key     string
+	result  *sfResult
+	expires time.Time
+}
+
+func (r *sfRecent) get(ctx context.Context, key string) *sfResult {
+	if r == nil {
+		return nil
+	}
+
+	result := r.getLocal(key)
+	if result != nil || r.store == nil {
+		return result
+	}
+
+	data, err := r.store.Get(ctx, sfStoreKeyPrefix+key)
+	if err != nil || data == nil {
+		return nil
+	}
+
+	entry := &cacheEntry{}
+
+	err = json.Unmarshal(data, entry)
+	if err != nil || time.Now().After(entry.Expires) {
+		return nil
+	}
+
+	return &sfResult{
+		resp: &http.Response{
+			Status:     strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+			StatusCode: entry.StatusCode,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     entry.Header,
+			Body:       http.NoBody,
+		},
+		body: entry.Body,
+	}
+}
+
+func (r *sfRecent) getLocal(key string) *sfResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	element, ok := r.results[key]
+	if !ok {
+		return nil
+	}
+
+	recent := element.Value.(*sfRecentResult)
+	if time.Now().After(recent.expires) {
+		r.remove(element)
+
+		return nil
+	}
+
+	return recent.result
+}
+
+func (r *sfRecent) put(ctx context.Context, key string, result *sfResult) {
+	if r == nil || result.tooLarge || result.resp == nil || result.resp.StatusCode >= http.StatusInternalServerError {
+		return
+	}
+
+	r.putLocal(key, result)
+
+	if r.store == nil {
+		return
+	}
+
+	data, err := json.Marshal(&cacheEntry{
+		StatusCode: result.resp.StatusCode,
+		Header:     result.resp.Header,
+		Body:       result.body,
+		Expires:    time.Now().Add(r.ttl),
+	})
+	if err != nil {
+		return
+	}
+
+	// failing to share the result should not fail the request
+	_ = r.store.Set(ctx, sfStoreKeyPrefix+key, data, r.ttl)
+}
+
+func (r *sfRecent) putLocal(key string, result *sfResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	if element, ok := r.results[key]; ok {
+		r.remove(element)
+	}
+
+	r.results[key] = r.order.PushFront(&sfRecentResult{key: key, result: result, expires: now.Add(r.ttl)})
+
+	// remove the oldest results while they are expired or over the limit (each result is removed once)
+	for oldest := r.order.Back(); oldest != nil; oldest = r.order.Back() {
+		if r.order.Len() <= r.maxEntries && !now.After(oldest.Value.(*sfRecentResult).expires) {
+			break
+		}
+
+		r.remove(oldest)
+	}
+}
+
+func (r *sfRecent) remove(element *list.Element) {
+	r.order.Remove(element)
+	delete(r.results, element.Value.(*sfRecentResult).key)
+}
+
+// copyResponse returns an independent copy of the response (i.e. each caller can read and close the body)
+func (r *sfResult) copyResponse() *http.Response {
+	if r.resp == nil {
+		return nil
+	}
+
+	resp := *r.resp
+	resp.Header = r.resp.Header.Clone()
+
+	if r.resp.Body != nil {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(r.body))
+	}
+
+	return &resp
 }
 
 func (s *Singleflight) addMiddleware(doFunc requestClosure) requestClosure {
@@ -74,6 +374,17 @@ func (s *Singleflight) doInitOnce(instrumentation Instrumentation) {
 	s.instrumentation = instrumentation
 
 	s.group = &singleflight.Group{}
+	s.maxBodySize = s.getMaxBodySize()
+
+	if s.TTL > 0 {
+		s.recent = &sfRecent{
+			ttl:        s.TTL,
+			maxEntries: s.getMaxRecent(),
+			store:      s.Store,
+			results:    map[string]*list.Element{},
+			order:      list.New(),
+		}
+	}
 
 	if s.KeyGenerator != nil {
 		s.actualKeyGenerator = s.KeyGenerator
@@ -99,3 +410,104 @@ func DefaultSFKeyGenerator(req *http.Request) string {
 
 	return builder.String()
 }
+
+// HeadersSFKeyGenerator returns a key generator that extends DefaultSFKeyGenerator with the values of the supplied headers
+// (e.g. Authorization or Accept-Language) so that requests that differ by these headers are never coalesced.
+// Header values are hashed so that credentials are not kept in the key.
+func HeadersSFKeyGenerator(headers ...string) func(req *http.Request) string {
+	return func(req *http.Request) string {
+		builder := strings.Builder{}
+
+		_, _ = builder.WriteString(DefaultSFKeyGenerator(req))
+
+		for _, header := range headers {
+			hash := sha256.New()
+
+			for _, value := range req.Header.Values(header) {
+				_, _ = hash.Write([]byte(value))
+				_, _ = hash.Write([]byte{0})
+			}
+
+			_, _ = builder.Write([]byte(`||`))
+			_, _ = builder.WriteString(http.CanonicalHeaderKey(header))
+			_, _ = builder.Write([]byte(`=`))
+			_, _ = builder.WriteString(hex.EncodeToString(hash.Sum(nil)))
+		}
+
+		return builder.String()
+	}
+}
+
+// BodyHashSFKeyGenerator extends DefaultSFKeyGenerator with a hash of the request body (e.g. for POST based queries).
+// When the body cannot be read, the key is empty (i.e. the request is not coalesced).
+// NOTE: when the request does not supply GetBody, the body is read into memory (and replaced) to calculate the hash
+func BodyHashSFKeyGenerator(req *http.Request) string {
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return ""
+	}
+
+	builder := strings.Builder{}
+
+	_, _ = builder.WriteString(DefaultSFKeyGenerator(req))
+	_, _ = builder.Write([]byte(`||`))
+	_, _ = builder.WriteString(bodyHash)
+
+	return builder.String()
+}
+
+// hashBody returns the (hex encoded) hash of the request body, leaving the body intact.
+// When the body cannot be read, the replaced body returns the part that was read followed by the read error (so that
+// a truncated body is not sent).
+func hashBody(req *http.Request) (string, error) {
+	hash := sha256.New()
+
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		// empty body
+
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.Copy(hash, body)
+		_ = body.Close()
+
+		if err != nil {
+			return "", err
+		}
+
+	default:
+		body, err := readAll(req.Body, req.ContentLength)
+		_ = req.Body.Close()
+
+		if err != nil {
+			req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), &errReader{err: err}))
+
+			return "", err
+		}
+
+		_, _ = hash.Write(body)
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// clone returns a copy of the configuration (sharing the store) for a variant of the client (see Client.Clone)
+func (s *Singleflight) clone() *Singleflight {
+	if s == nil {
+		return nil
+	}
+
+	return &Singleflight{
+		KeyGenerator: s.KeyGenerator,
+		MaxBodySize:  s.MaxBodySize,
+		TTL:          s.TTL,
+		MaxRecent:    s.MaxRecent,
+		Store:        s.Store,
+	}
+}
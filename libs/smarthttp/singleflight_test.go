@@ -0,0 +1,92 @@
+package smarthttp
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyHashSFKeyGenerator(t *testing.T) {
+	errRead := errors.New("connection reset")
+
+	tests := []struct {
+		name    string
+		body    io.Reader
+		wantKey bool
+		// wantErr is the error of reading the body after the key was generated
+		wantErr error
+	}{
+		{
+			name:    "readable body",
+			body:    strings.NewReader(`{"query":"orders"}`),
+			wantKey: true,
+		},
+		{
+			// the key disables coalescing and the body returns the read error rather than a truncated body
+			name:    "body read error",
+			body:    io.MultiReader(strings.NewReader(`{"query":`), &errReader{err: errRead}),
+			wantErr: errRead,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/search", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a body without GetBody is read to calculate the hash
+			req.Body = ioutil.NopCloser(test.body)
+
+			key := BodyHashSFKeyGenerator(req)
+			if (key != "") != test.wantKey {
+				t.Errorf("unexpected key %q", key)
+			}
+
+			_, err = ioutil.ReadAll(req.Body)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("expected the body read error %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSFRecent_PutLocal(t *testing.T) {
+	singleflight := &Singleflight{TTL: time.Hour, MaxRecent: 2}
+	singleflight.doInitOnce(&NoopInstrumentation{})
+
+	recent := singleflight.recent
+	result := &sfResult{resp: &http.Response{StatusCode: http.StatusOK}}
+
+	recent.putLocal("a", result)
+	recent.putLocal("b", result)
+
+	// putting an existing key makes it the newest
+	recent.putLocal("a", result)
+	recent.putLocal("c", result)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if got := recent.getLocal(key) != nil; got != want {
+			t.Errorf("expected %q kept: %t, got: %t", key, want, got)
+		}
+	}
+
+	// expired results are removed by the next put
+	recent.ttl = time.Millisecond
+	recent.putLocal("d", result)
+	recent.putLocal("e", result)
+
+	time.Sleep(2 * time.Millisecond)
+	recent.putLocal("f", result)
+
+	if len(recent.results) != 1 || recent.order.Len() != 1 {
+		t.Errorf("expected only the last result to be kept, got %d", len(recent.results))
+	}
+}
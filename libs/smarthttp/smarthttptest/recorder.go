@@ -0,0 +1,306 @@
+package smarthttptest
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+// Event is an event recorded by the Recorder.  Only the fields that apply to the event are set.
+type Event struct {
+	// Name is the name of the method of smarthttp.Instrumentation (e.g. "RetryRetriable")
+	Name string
+
+	// Request is the request of the event
+	Request *http.Request
+
+	// EndpointTag is the endpoint tag of the event (e.g. "GET::/v1/orders/{id}")
+	EndpointTag string
+
+	// StatusCode is the status code of the event
+	StatusCode int
+
+	// Number is the attempt, hedge, redirect hop, concurrency limit or connections in use of the event
+	Number int
+
+	// Duration is the duration (or wait) of the event
+	Duration time.Duration
+
+	// Err is the error of the event
+	Err error
+
+	// Detail is the other detail of the event (e.g. the warning, host, reason, error class or circuit state)
+	Detail string
+}
+
+// Recorder is a smarthttp.Instrumentation that records the events of a client for assertions.
+// It is safe for concurrent use.
+type Recorder struct {
+	smarthttp.NoopInstrumentation
+
+	mutex  sync.Mutex
+	events []Event
+}
+
+// NewRecorder returns a Recorder without events
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Events returns the recorded events with the name (or all of them when name is "")
+func (r *Recorder) Events(name string) []Event {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var events []Event
+
+	for _, event := range r.events {
+		if name == "" || event.Name == name {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// Count returns the number of the recorded events with the name
+func (r *Recorder) Count(name string) int {
+	return len(r.Events(name))
+}
+
+// AssertCount fails the test when the number of the recorded events with the name is not n
+func (r *Recorder) AssertCount(tb testing.TB, name string, n int) {
+	tb.Helper()
+
+	count := r.Count(name)
+	if count != n {
+		tb.Errorf("expected %d %s events, got %d", n, name, count)
+	}
+}
+
+// AssertRecorded fails the test when no event with the name was recorded
+func (r *Recorder) AssertRecorded(tb testing.TB, name string) {
+	tb.Helper()
+
+	if r.Count(name) == 0 {
+		tb.Errorf("expected %s events, got none", name)
+	}
+}
+
+// AssertNotRecorded fails the test when an event with the name was recorded
+func (r *Recorder) AssertNotRecorded(tb testing.TB, name string) {
+	tb.Helper()
+
+	r.AssertCount(tb, name, 0)
+}
+
+// Reset removes the recorded events
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events = nil
+}
+
+func (r *Recorder) record(event Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+// Init implements smarthttp.Instrumentation
+func (r *Recorder) Init(name string) {
+	r.record(Event{Name: "Init", Detail: name})
+}
+
+// InitWarning implements smarthttp.Instrumentation
+func (r *Recorder) InitWarning(message string) {
+	r.record(Event{Name: "InitWarning", Detail: message})
+}
+
+// DoDuration implements smarthttp.Instrumentation
+func (r *Recorder) DoDuration(start time.Time, endpointTag string) {
+	r.record(Event{Name: "DoDuration", EndpointTag: endpointTag, Duration: time.Since(start)})
+}
+
+// BaseDoDuration implements smarthttp.Instrumentation
+func (r *Recorder) BaseDoDuration(start time.Time, statusCode int, endpointTag string) {
+	r.record(Event{Name: "BaseDoDuration", EndpointTag: endpointTag, StatusCode: statusCode, Duration: time.Since(start)})
+}
+
+// BaseDoErr implements smarthttp.Instrumentation
+func (r *Recorder) BaseDoErr(err error, endpointTag, errTag string) {
+	r.record(Event{Name: "BaseDoErr", EndpointTag: endpointTag, Err: err, Detail: errTag})
+}
+
+// BaseDoErrDuration implements smarthttp.Instrumentation
+func (r *Recorder) BaseDoErrDuration(start time.Time, class smarthttp.ErrorClass, endpointTag string) {
+	r.record(Event{Name: "BaseDoErrDuration", EndpointTag: endpointTag, Duration: time.Since(start), Detail: string(class)})
+}
+
+// BaseDoConnTrace implements smarthttp.Instrumentation
+func (r *Recorder) BaseDoConnTrace(trace smarthttp.ConnTrace, endpointTag string) {
+	r.record(Event{Name: "BaseDoConnTrace", EndpointTag: endpointTag, Duration: trace.TimeToFirstByte,
+		Detail: trace.Protocol})
+}
+
+// DNSLookup implements smarthttp.Instrumentation
+func (r *Recorder) DNSLookup(host string, duration time.Duration, cached bool, err error) {
+	r.record(Event{Name: "DNSLookup", Duration: duration, Err: err, Detail: host + " cached:" + strconv.FormatBool(cached)})
+}
+
+// DebugDump implements smarthttp.Instrumentation
+func (r *Recorder) DebugDump(dump smarthttp.Dump, endpointTag string) {
+	r.record(Event{Name: "DebugDump", EndpointTag: endpointTag, StatusCode: dump.StatusCode, Detail: dump.URL})
+}
+
+// Redirect implements smarthttp.Instrumentation
+func (r *Recorder) Redirect(req *http.Request, hop int) {
+	r.record(Event{Name: "Redirect", Request: req, Number: hop})
+}
+
+// CBCircuitOpen implements smarthttp.Instrumentation
+func (r *Recorder) CBCircuitOpen(req *http.Request) {
+	r.record(Event{Name: "CBCircuitOpen", Request: req})
+}
+
+// CBStateChange implements smarthttp.Instrumentation
+func (r *Recorder) CBStateChange(name string, from, to smarthttp.State) {
+	r.record(Event{Name: "CBStateChange", Detail: name + ": " + from.String() + " -> " + to.String()})
+}
+
+// CBTrackedStatusCode implements smarthttp.Instrumentation
+func (r *Recorder) CBTrackedStatusCode(req *http.Request, code int) {
+	r.record(Event{Name: "CBTrackedStatusCode", Request: req, StatusCode: code})
+}
+
+// RetryNonRetriable implements smarthttp.Instrumentation
+func (r *Recorder) RetryNonRetriable(req *http.Request, code int, attempt int) {
+	r.record(Event{Name: "RetryNonRetriable", Request: req, StatusCode: code, Number: attempt})
+}
+
+// RetryRetriable implements smarthttp.Instrumentation
+func (r *Recorder) RetryRetriable(req *http.Request, code int, attempt int) {
+	r.record(Event{Name: "RetryRetriable", Request: req, StatusCode: code, Number: attempt})
+}
+
+// RetryNonRetriableErr implements smarthttp.Instrumentation
+func (r *Recorder) RetryNonRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	r.record(Event{Name: "RetryNonRetriableErr", Request: req, Number: attempt, Detail: string(class)})
+}
+
+// RetryRetriableErr implements smarthttp.Instrumentation
+func (r *Recorder) RetryRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	r.record(Event{Name: "RetryRetriableErr", Request: req, Number: attempt, Detail: string(class)})
+}
+
+// ResponseRejected implements smarthttp.Instrumentation
+func (r *Recorder) ResponseRejected(req *http.Request, code int, err error) {
+	r.record(Event{Name: "ResponseRejected", Request: req, StatusCode: code, Err: err})
+}
+
+// BulkheadQueued implements smarthttp.Instrumentation
+func (r *Recorder) BulkheadQueued(req *http.Request, wait time.Duration) {
+	r.record(Event{Name: "BulkheadQueued", Request: req, Duration: wait})
+}
+
+// BulkheadRejected implements smarthttp.Instrumentation
+func (r *Recorder) BulkheadRejected(req *http.Request) {
+	r.record(Event{Name: "BulkheadRejected", Request: req})
+}
+
+// CacheHit implements smarthttp.Instrumentation
+func (r *Recorder) CacheHit(req *http.Request) {
+	r.record(Event{Name: "CacheHit", Request: req})
+}
+
+// CacheMiss implements smarthttp.Instrumentation
+func (r *Recorder) CacheMiss(req *http.Request) {
+	r.record(Event{Name: "CacheMiss", Request: req})
+}
+
+// ConcurrencyLimitChanged implements smarthttp.Instrumentation
+func (r *Recorder) ConcurrencyLimitChanged(limit int) {
+	r.record(Event{Name: "ConcurrencyLimitChanged", Number: limit})
+}
+
+// ConcurrencyLimitRejected implements smarthttp.Instrumentation
+func (r *Recorder) ConcurrencyLimitRejected(req *http.Request) {
+	r.record(Event{Name: "ConcurrencyLimitRejected", Request: req})
+}
+
+// HedgeSent implements smarthttp.Instrumentation
+func (r *Recorder) HedgeSent(req *http.Request, hedge int) {
+	r.record(Event{Name: "HedgeSent", Request: req, Number: hedge})
+}
+
+// SingleflightErr implements smarthttp.Instrumentation
+func (r *Recorder) SingleflightErr(req *http.Request, err error) {
+	r.record(Event{Name: "SingleflightErr", Request: req, Err: err})
+}
+
+// RateLimitErr implements smarthttp.Instrumentation
+func (r *Recorder) RateLimitErr(req *http.Request, err error) {
+	r.record(Event{Name: "RateLimitErr", Request: req, Err: err})
+}
+
+// TLSPinFailure implements smarthttp.Instrumentation
+func (r *Recorder) TLSPinFailure(name string) {
+	r.record(Event{Name: "TLSPinFailure", Detail: name})
+}
+
+// TargetHealthChange implements smarthttp.Instrumentation
+func (r *Recorder) TargetHealthChange(name, target string, healthy bool) {
+	r.record(Event{Name: "TargetHealthChange", Detail: target + " healthy:" + strconv.FormatBool(healthy)})
+}
+
+// FailoverSent implements smarthttp.Instrumentation
+func (r *Recorder) FailoverSent(req *http.Request, reason string) {
+	r.record(Event{Name: "FailoverSent", Request: req, Detail: reason})
+}
+
+// ResolveErr implements smarthttp.Instrumentation
+func (r *Recorder) ResolveErr(name, service string, err error) {
+	r.record(Event{Name: "ResolveErr", Err: err, Detail: service})
+}
+
+// AsyncQueued implements smarthttp.Instrumentation
+func (r *Recorder) AsyncQueued(req *http.Request, wait time.Duration) {
+	r.record(Event{Name: "AsyncQueued", Request: req, Duration: wait})
+}
+
+// AsyncRejected implements smarthttp.Instrumentation
+func (r *Recorder) AsyncRejected(req *http.Request) {
+	r.record(Event{Name: "AsyncRejected", Request: req})
+}
+
+// OutboxDeliveryFailed implements smarthttp.Instrumentation
+func (r *Recorder) OutboxDeliveryFailed(req *http.Request, attempt int, err error, deadLettered bool) {
+	r.record(Event{Name: "OutboxDeliveryFailed", Request: req, Number: attempt, Err: err,
+		Detail: "deadLettered:" + strconv.FormatBool(deadLettered)})
+}
+
+// OutboxStoreErr implements smarthttp.Instrumentation
+func (r *Recorder) OutboxStoreErr(name string, err error) {
+	r.record(Event{Name: "OutboxStoreErr", Err: err})
+}
+
+// WebhookDelivery implements smarthttp.Instrumentation
+func (r *Recorder) WebhookDelivery(req *http.Request, id string, statusCode int, err error) {
+	r.record(Event{Name: "WebhookDelivery", Request: req, StatusCode: statusCode, Err: err, Detail: id})
+}
+
+// LoadShed implements smarthttp.Instrumentation
+func (r *Recorder) LoadShed(req *http.Request, p99 time.Duration) {
+	r.record(Event{Name: "LoadShed", Request: req, Duration: p99})
+}
+
+// PoolStats implements smarthttp.Instrumentation
+func (r *Recorder) PoolStats(name string, stats smarthttp.PoolStats) {
+	r.record(Event{Name: "PoolStats", Number: stats.InUse, Detail: stats.Host})
+}
@@ -0,0 +1,76 @@
+package smarthttptest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// NewServer returns a started server that responds to the requests with the stubs of the transport (see Transport.On),
+// e.g. to test the dialing and timeout settings of a client.  The caller must close the server.
+func NewServer(t *Transport) *httptest.Server {
+	return httptest.NewServer(t.Handler())
+}
+
+// Handler returns an http.Handler that responds to the requests with the stubs of the transport and captures them (the
+// Attempt of the captured requests is 0).  Requests that do not match a stub receive 501 Not Implemented.
+// Stubs that fail (see Stub.Fail) close the connection without a response and timeouts (see Stub.Timeout) hang until
+// the client gives up.
+func (t *Transport) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured, err := capture(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		step, ok := t.next(captured)
+		if !ok {
+			http.Error(w, ErrNoStub.Error(), http.StatusNotImplemented)
+
+			return
+		}
+
+		var timeout *timeoutError
+		if errors.As(step.err, &timeout) {
+			<-r.Context().Done()
+
+			return
+		}
+
+		resp, err := step.respond(r)
+		if err != nil {
+			closeConnection(w)
+
+			return
+		}
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	})
+}
+
+// closeConnection closes the connection of the request without writing a response
+func closeConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	_ = conn.Close()
+}
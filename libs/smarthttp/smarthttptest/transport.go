@@ -0,0 +1,371 @@
+// Package smarthttptest provides test doubles for code that uses smarthttp clients: a programmable fake transport (or
+// server) with request capture and assertions, an Instrumentation that records the events of a client and a VCR that
+// records the interactions with an upstream and replays them.
+//
+//	transport := smarthttptest.NewTransport()
+//	transport.On(http.MethodGet, "/v1/orders/*").
+//		Respond(http.StatusServiceUnavailable, "").Times(2).
+//		RespondJSON(http.StatusOK, order)
+//
+//	recorder := smarthttptest.NewRecorder()
+//	client, _ := smarthttp.NewClient("orders", smarthttp.WithTransport(transport), smarthttp.WithInstrumentation(recorder))
+//
+//	... // exercise the code under test
+//
+//	transport.AssertCalled(t, http.MethodGet, "/v1/orders/*", 3)
+//	recorder.AssertCount(t, "RetryRetriable", 2)
+package smarthttptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+// ErrNoStub is returned by the Transport for a request that does not match any of its stubs
+var ErrNoStub = errors.New("no stub matches the request")
+
+// Request is a request captured by the Transport (or Server)
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+
+	// Attempt is the (one based) number of the attempt (0 when the request was not made with retries enabled)
+	Attempt int
+}
+
+// Transport is a fake http.RoundTripper that responds to the requests with the stubs (see On) and captures them.
+// It is safe for concurrent use.
+type Transport struct {
+	mutex    sync.Mutex
+	stubs    []*Stub
+	requests []*Request
+}
+
+// NewTransport returns a Transport without stubs
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+// On returns a new stub for the requests with the method (or any method when it is "" or "*") and the path (an exact
+// path, or a prefix when it ends with "*").  The stubs are matched in the order they were added.
+func (t *Transport) On(method, path string) *Stub {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stub := &Stub{method: method, path: path}
+	t.stubs = append(t.stubs, stub)
+
+	return stub
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	captured, err := capture(req)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := t.next(captured)
+	if !ok {
+		return nil, fmt.Errorf("%w - %s %s", ErrNoStub, req.Method, req.URL.Path)
+	}
+
+	return step.respond(req)
+}
+
+// Requests returns the captured requests (in the order they were received)
+func (t *Transport) Requests() []*Request {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]*Request(nil), t.requests...)
+}
+
+// Calls returns the number of the requests that match the method and the path (see On)
+func (t *Transport) Calls(method, path string) int {
+	matcher := &Stub{method: method, path: path}
+	calls := 0
+
+	for _, req := range t.Requests() {
+		if matcher.matches(req) {
+			calls++
+		}
+	}
+
+	return calls
+}
+
+// AssertCalled fails the test when the number of the requests that match the method and the path (see On) is not
+// times
+func (t *Transport) AssertCalled(tb testing.TB, method, path string, times int) {
+	tb.Helper()
+
+	calls := t.Calls(method, path)
+	if calls != times {
+		tb.Errorf("expected %d calls to %s %s, got %d", times, method, path, calls)
+	}
+}
+
+// AssertNotCalled fails the test when a request matches the method and the path (see On)
+func (t *Transport) AssertNotCalled(tb testing.TB, method, path string) {
+	tb.Helper()
+
+	t.AssertCalled(tb, method, path, 0)
+}
+
+// Reset removes the stubs and the captured requests
+func (t *Transport) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.stubs = nil
+	t.requests = nil
+}
+
+// next captures the request and returns the step of the first stub that matches it
+func (t *Transport) next(req *Request) (*step, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.requests = append(t.requests, req)
+
+	for _, stub := range t.stubs {
+		if stub.matches(req) {
+			return stub.next(), true
+		}
+	}
+
+	return nil, false
+}
+
+// capture reads the body of the request (and closes it, as a RoundTripper must)
+func capture(req *http.Request) (*Request, error) {
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Request{
+		Method:  req.Method,
+		URL:     req.URL,
+		Header:  req.Header.Clone(),
+		Body:    body,
+		Attempt: smarthttp.AttemptsFromContext(req.Context()),
+	}, nil
+}
+
+// Stub defines the responses to the requests that match it (see Transport.On).  The responses are returned in order and
+// the last one is repeated.  The methods of Stub must not be called concurrently with requests.
+type Stub struct {
+	method string
+	path   string
+	steps  []*step
+	cursor int
+}
+
+// Respond adds a response with the status code and the body
+func (s *Stub) Respond(statusCode int, body string) *Stub {
+	s.steps = append(s.steps, &step{statusCode: statusCode, header: http.Header{}, body: []byte(body)})
+
+	return s
+}
+
+// RespondJSON adds a response with the status code and the value encoded as JSON
+func (s *Stub) RespondJSON(statusCode int, value interface{}) *Stub {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return s.Fail(err)
+	}
+
+	s.Respond(statusCode, string(body))
+	s.last().header.Set("Content-Type", "application/json")
+
+	return s
+}
+
+// RespondWith adds a response produced by the function
+func (s *Stub) RespondWith(respond func(req *http.Request) (*http.Response, error)) *Stub {
+	s.steps = append(s.steps, &step{handler: respond})
+
+	return s
+}
+
+// Fail adds a response that fails with the error (e.g. a connection reset)
+func (s *Stub) Fail(err error) *Stub {
+	s.steps = append(s.steps, &step{err: err})
+
+	return s
+}
+
+// Timeout adds a response that fails with a timeout (which the client reports as smarthttp.ErrTimeout)
+func (s *Stub) Timeout() *Stub {
+	return s.Fail(&timeoutError{})
+}
+
+// Hang adds a response that blocks until the context of the request is done
+func (s *Stub) Hang() *Stub {
+	s.steps = append(s.steps, &step{hang: true})
+
+	return s
+}
+
+// WithHeader sets a header of the last response
+func (s *Stub) WithHeader(key, value string) *Stub {
+	if last := s.last(); last.header != nil {
+		last.header.Set(key, value)
+	}
+
+	return s
+}
+
+// Delay delays the last response
+func (s *Stub) Delay(delay time.Duration) *Stub {
+	s.last().delay = delay
+
+	return s
+}
+
+// Times repeats the last response so that it is returned n times in total
+func (s *Stub) Times(n int) *Stub {
+	last := s.last()
+
+	for i := 1; i < n; i++ {
+		s.steps = append(s.steps, last)
+	}
+
+	return s
+}
+
+func (s *Stub) last() *step {
+	if len(s.steps) == 0 {
+		s.Respond(http.StatusOK, "")
+	}
+
+	return s.steps[len(s.steps)-1]
+}
+
+func (s *Stub) matches(req *Request) bool {
+	if s.method != "" && s.method != "*" && !strings.EqualFold(s.method, req.Method) {
+		return false
+	}
+
+	if strings.HasSuffix(s.path, "*") {
+		return strings.HasPrefix(req.URL.Path, strings.TrimSuffix(s.path, "*"))
+	}
+
+	return s.path == req.URL.Path
+}
+
+// next returns the step for the next request (the caller holds the lock of the transport)
+func (s *Stub) next() *step {
+	if len(s.steps) == 0 {
+		return &step{statusCode: http.StatusOK, header: http.Header{}}
+	}
+
+	index := s.cursor
+	if index < len(s.steps)-1 {
+		s.cursor++
+	}
+
+	return s.steps[index]
+}
+
+// step is a response of a stub
+type step struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	err        error
+	hang       bool
+	delay      time.Duration
+	handler    func(req *http.Request) (*http.Response, error)
+}
+
+func (s *step) respond(req *http.Request) (*http.Response, error) {
+	err := s.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case s.handler != nil:
+		return s.handler(req)
+
+	case s.err != nil:
+		return nil, s.err
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(s.statusCode) + " " + http.StatusText(s.statusCode),
+		StatusCode:    s.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        s.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(s.body)),
+		ContentLength: int64(len(s.body)),
+		Request:       req,
+	}, nil
+}
+
+// wait waits for the delay (or forever when the step hangs) unless the context is done first
+func (s *step) wait(ctx context.Context) error {
+	if s.hang {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	if s.delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(s.delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// timeoutError is a net.Error that reports a timeout
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string {
+	return "i/o timeout"
+}
+
+func (e *timeoutError) Timeout() bool {
+	return true
+}
+
+func (e *timeoutError) Temporary() bool {
+	return true
+}
@@ -0,0 +1,436 @@
+package smarthttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// VCRMode is the mode of a VCR
+type VCRMode int
+
+const (
+	// VCRReplay replays the interactions of the fixture (and fails the requests that do not match one)
+	VCRReplay VCRMode = iota
+
+	// VCRRecord sends the requests to the upstream and records the interactions to the fixture (replacing it)
+	VCRRecord
+
+	// VCRAuto replays the fixture when it exists and records it otherwise
+	VCRAuto
+)
+
+// the placeholder of scrubbed values
+const scrubbed = "[SCRUBBED]"
+
+// ErrNoInteraction is returned by a replaying VCR for a request that does not match an (unused) recorded interaction
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+// the headers that are scrubbed by default
+var defaultScrubHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// VCR is an http.RoundTripper that records the interactions with an upstream to a fixture file (e.g. when run against
+// a partner's sandbox) and replays them (e.g. in CI):
+//
+//	vcr := &smarthttptest.VCR{Path: "testdata/orders.json", Mode: smarthttptest.VCRAuto, ScrubQuery: []string{"api_key"}}
+//	client, _ := smarthttp.NewClient("orders", smarthttp.WithTransport(vcr))
+//
+// Secrets are scrubbed from the recorded interactions (see ScrubHeaders, ScrubQuery and Scrub); the live requests are
+// scrubbed in the same way before they are matched, so the fixtures never hold the secrets.  Each recorded interaction is
+// replayed once (in order), so retries can be replayed too.
+type VCR struct {
+	// Path is the path of the fixture file
+	Path string
+
+	// Mode is the mode of the VCR (default: VCRReplay)
+	Mode VCRMode
+
+	// Transport (optionally) sends the requests when recording (default: http.DefaultTransport)
+	Transport http.RoundTripper
+
+	// Matchers (optionally) match the live requests to the recorded ones; all of them must match
+	// (default: MatchMethod, MatchURL and MatchBody)
+	Matchers []Matcher
+
+	// ScrubHeaders (optionally) replaces the headers (of the requests and the responses) that are scrubbed
+	// (default: Authorization, Proxy-Authorization, Cookie, Set-Cookie and X-Api-Key)
+	ScrubHeaders []string
+
+	// ScrubQuery (optionally) are the query parameters that are scrubbed (e.g. "api_key")
+	ScrubQuery []string
+
+	// Scrub (optionally) scrubs the other secrets of the interactions (e.g. the tokens in the bodies)
+	Scrub func(interaction *Interaction)
+
+	initOnce     sync.Once
+	initErr      error
+	recording    bool
+	mutex        sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  InteractionRequest  `json:"request"`
+	Response InteractionResponse `json:"response"`
+}
+
+// InteractionRequest is a recorded request
+type InteractionRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// InteractionResponse is a recorded response
+type InteractionResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is a recorded body; it is saved as a string when it is valid UTF-8 and as base64 otherwise
+type Body []byte
+
+// MarshalJSON implements json.Marshaler
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*b = Body(text)
+
+		return nil
+	}
+
+	encoded := struct {
+		Base64 string `json:"base64"`
+	}{}
+
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return err
+	}
+
+	*b, err = base64.StdEncoding.DecodeString(encoded.Base64)
+
+	return err
+}
+
+// Matcher returns true when the live request (scrubbed) matches the recorded request
+type Matcher func(live, recorded *InteractionRequest) bool
+
+// MatchMethod matches the methods of the requests
+func MatchMethod(live, recorded *InteractionRequest) bool {
+	return live.Method == recorded.Method
+}
+
+// MatchURL matches the URLs of the requests (the order of the query parameters is ignored)
+func MatchURL(live, recorded *InteractionRequest) bool {
+	liveURL, err := url.Parse(live.URL)
+	if err != nil {
+		return false
+	}
+
+	recordedURL, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+
+	return liveURL.Scheme == recordedURL.Scheme && liveURL.Host == recordedURL.Host &&
+		liveURL.Path == recordedURL.Path && reflect.DeepEqual(liveURL.Query(), recordedURL.Query())
+}
+
+// MatchBody matches the bodies of the requests byte for byte
+func MatchBody(live, recorded *InteractionRequest) bool {
+	return bytes.Equal(live.Body, recorded.Body)
+}
+
+// MatchJSONBody matches the bodies of the requests as JSON (i.e. ignoring the formatting and the order of the keys)
+func MatchJSONBody(live, recorded *InteractionRequest) bool {
+	if len(live.Body) == 0 || len(recorded.Body) == 0 {
+		return len(live.Body) == len(recorded.Body)
+	}
+
+	var liveValue, recordedValue interface{}
+
+	if json.Unmarshal(live.Body, &liveValue) != nil || json.Unmarshal(recorded.Body, &recordedValue) != nil {
+		return MatchBody(live, recorded)
+	}
+
+	return reflect.DeepEqual(liveValue, recordedValue)
+}
+
+// MatchHeaders returns a Matcher that matches the values of the headers of the requests
+func MatchHeaders(names ...string) Matcher {
+	return func(live, recorded *InteractionRequest) bool {
+		for _, name := range names {
+			if !reflect.DeepEqual(live.Header.Values(name), recorded.Header.Values(name)) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (v *VCR) RoundTrip(req *http.Request) (*http.Response, error) {
+	v.initOnce.Do(v.doInitOnce)
+
+	if v.initErr != nil {
+		return nil, v.initErr
+	}
+
+	live, body, err := v.capture(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.recording {
+		return v.record(req, live, body)
+	}
+
+	return v.replay(req, live)
+}
+
+func (v *VCR) doInitOnce() {
+	v.recording = v.Mode == VCRRecord
+
+	if v.Mode == VCRAuto {
+		_, err := os.Stat(v.Path)
+		v.recording = os.IsNotExist(err)
+	}
+
+	if v.recording {
+		return
+	}
+
+	data, err := ioutil.ReadFile(v.Path)
+	if err != nil {
+		v.initErr = fmt.Errorf("unable to read fixture: %w", err)
+
+		return
+	}
+
+	err = json.Unmarshal(data, &v.interactions)
+	if err != nil {
+		v.initErr = fmt.Errorf("unable to decode fixture '%s': %w", v.Path, err)
+
+		return
+	}
+
+	v.used = make([]bool, len(v.interactions))
+}
+
+// capture returns the (scrubbed) interaction request of the live request and its (unscrubbed) body
+func (v *VCR) capture(req *http.Request) (*InteractionRequest, []byte, error) {
+	var body []byte
+
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	interaction := &Interaction{
+		Request: InteractionRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+			Body:   body,
+		},
+	}
+
+	v.scrub(interaction)
+
+	return &interaction.Request, body, nil
+}
+
+func (v *VCR) record(req *http.Request, live *InteractionRequest, reqBody []byte) (*http.Response, error) {
+	transport := v.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// the body of the request has been read by capture
+	out := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		out.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	interaction := &Interaction{
+		Request: *live,
+		Response: InteractionResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       body,
+		},
+	}
+
+	v.scrub(interaction)
+
+	err = v.save(interaction)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (v *VCR) replay(req *http.Request, live *InteractionRequest) (*http.Response, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for i, interaction := range v.interactions {
+		if v.used[i] || !v.matches(live, &interaction.Request) {
+			continue
+		}
+
+		v.used[i] = true
+
+		recorded := interaction.Response
+
+		return &http.Response{
+			Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+			StatusCode:    recorded.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        recorded.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w - %s %s", ErrNoInteraction, live.Method, live.URL)
+}
+
+func (v *VCR) matches(live, recorded *InteractionRequest) bool {
+	matchers := v.Matchers
+	if len(matchers) == 0 {
+		matchers = []Matcher{MatchMethod, MatchURL, MatchBody}
+	}
+
+	for _, match := range matchers {
+		if !match(live, recorded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// save appends the interaction to the fixture (which is rewritten so that it is complete even when the test fails)
+func (v *VCR) save(interaction *Interaction) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.interactions = append(v.interactions, interaction)
+
+	data := &bytes.Buffer{}
+
+	// the fixtures are reviewed, so the URLs are not escaped for HTML
+	encoder := json.NewEncoder(data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(v.interactions)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(v.Path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(v.Path, data.Bytes(), 0644)
+}
+
+// scrub removes the secrets from the interaction
+func (v *VCR) scrub(interaction *Interaction) {
+	headers := v.ScrubHeaders
+	if headers == nil {
+		headers = defaultScrubHeaders
+	}
+
+	for _, name := range headers {
+		scrubHeader(interaction.Request.Header, name)
+		scrubHeader(interaction.Response.Header, name)
+	}
+
+	if len(v.ScrubQuery) > 0 {
+		interaction.Request.URL = scrubQuery(interaction.Request.URL, v.ScrubQuery)
+	}
+
+	if v.Scrub != nil {
+		v.Scrub(interaction)
+	}
+}
+
+func scrubHeader(header http.Header, name string) {
+	if _, ok := header[http.CanonicalHeaderKey(name)]; ok {
+		header.Set(name, scrubbed)
+	}
+}
+
+func scrubQuery(rawURL string, names []string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := parsed.Query()
+
+	for _, name := range names {
+		if _, ok := query[name]; ok {
+			query.Set(name, scrubbed)
+		}
+	}
+
+	parsed.RawQuery = query.Encode()
+
+	return strings.TrimSuffix(parsed.String(), "?")
+}
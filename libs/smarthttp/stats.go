@@ -0,0 +1,194 @@
+package smarthttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// statsRegistry holds the clients of this process by name (see StatsHandler); a client replaces an earlier client with
+// the same name and is removed when it is closed
+var statsRegistry = struct {
+	sync.RWMutex
+	clients map[string]*Client
+}{
+	clients: map[string]*Client{},
+}
+
+// ClientStats is a snapshot of the counters of a client (since it was created) for incident triage (see StatsHandler)
+type ClientStats struct {
+	// Name is the name of the client
+	Name string `json:"name"`
+
+	// Requests is the number of calls to Do (including the helpers built on it)
+	Requests int64 `json:"requests"`
+
+	// Errors is the number of calls to Do that returned an error
+	Errors int64 `json:"errors"`
+
+	// InFlight is the number of calls to Do in progress
+	InFlight int64 `json:"inFlight"`
+
+	// Attempts is the number of requests sent to the upstream (including retries and hedged requests)
+	Attempts int64 `json:"attempts"`
+
+	// Retries is the number of requests sent to the upstream by a retry
+	Retries int64 `json:"retries"`
+
+	// Circuit is the state and statistics of the circuit of the client
+	Circuit *CircuitStats `json:"circuit,omitempty"`
+
+	// Singleflight is the deduplication of the requests (nil when the client has no singleflight)
+	Singleflight *SingleflightStats `json:"singleflight,omitempty"`
+
+	// Cache is the hit rate of the cache (nil when the client has no cache)
+	Cache *CacheStats `json:"cache,omitempty"`
+
+	// BulkheadQueued is the number of requests waiting for a slot of the bulkhead
+	BulkheadQueued int `json:"bulkheadQueued"`
+
+	// AsyncQueued is the number of asynchronous requests waiting to be sent (see DoAsync)
+	AsyncQueued int `json:"asyncQueued"`
+}
+
+// SingleflightStats is a snapshot of the deduplication of the requests by Singleflight
+type SingleflightStats struct {
+	// Requests is the number of requests that were eligible for deduplication
+	Requests int64 `json:"requests"`
+
+	// Shared is the number of requests that were served the response of another request
+	Shared int64 `json:"shared"`
+
+	// DedupRatio is the fraction of the requests that were served the response of another request
+	DedupRatio float64 `json:"dedupRatio"`
+}
+
+// CacheStats is a snapshot of the hit rate of a Cache
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+
+	// HitRate is the fraction of the lookups that were served from the cache
+	HitRate float64 `json:"hitRate"`
+}
+
+// clientCounters counts the calls of a client
+type clientCounters struct {
+	requests int64
+	errors   int64
+	inFlight int64
+	attempts int64
+	retries  int64
+}
+
+// begin counts the start of a call to Do
+func (c *clientCounters) begin() {
+	atomic.AddInt64(&c.requests, 1)
+	atomic.AddInt64(&c.inFlight, 1)
+}
+
+// end counts the end of a call to Do
+func (c *clientCounters) end(err error) {
+	atomic.AddInt64(&c.inFlight, -1)
+
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+}
+
+// attempt counts a request sent to the upstream
+func (c *clientCounters) attempt(req *http.Request) {
+	atomic.AddInt64(&c.attempts, 1)
+
+	if AttemptsFromContext(req.Context()) > 1 {
+		atomic.AddInt64(&c.retries, 1)
+	}
+}
+
+// Stats returns a snapshot of the counters of the client
+func (c *Client) Stats() ClientStats {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	out := ClientStats{
+		Name:     c.Name,
+		Requests: atomic.LoadInt64(&c.counters.requests),
+		Errors:   atomic.LoadInt64(&c.counters.errors),
+		InFlight: atomic.LoadInt64(&c.counters.inFlight),
+		Attempts: atomic.LoadInt64(&c.counters.attempts),
+		Retries:  atomic.LoadInt64(&c.counters.retries),
+
+		Singleflight:   c.Singleflight.stats(),
+		Cache:          c.Cache.stats(),
+		BulkheadQueued: c.Bulkhead.queueDepth(),
+		AsyncQueued:    c.Async.queueDepth(),
+	}
+
+	if c.CircuitBreaker.Engine != nil {
+		circuit := c.CircuitBreaker.Engine.Stats(c.Name)
+		out.Circuit = &circuit
+	}
+
+	return out
+}
+
+// StatsHandler returns a handler that reports the stats (see Client.Stats) of every client of this process as JSON,
+// e.g. to be mounted on the debug mux of a service for incident triage:
+//
+//	mux.Handle("/debug/smarthttp", smarthttp.StatsHandler())
+//
+// The clients are sorted by name; a client is reported from its first request until it is closed.
+func StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		statsRegistry.RLock()
+
+		clients := make([]*Client, 0, len(statsRegistry.clients))
+		for _, client := range statsRegistry.clients {
+			clients = append(clients, client)
+		}
+
+		statsRegistry.RUnlock()
+
+		out := make([]ClientStats, 0, len(clients))
+		for _, client := range clients {
+			out = append(out, client.Stats())
+		}
+
+		sort.Slice(out, func(i, j int) bool {
+			return out[i].Name < out[j].Name
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		_ = encoder.Encode(out)
+	})
+}
+
+func registerStats(client *Client) {
+	statsRegistry.Lock()
+	defer statsRegistry.Unlock()
+
+	statsRegistry.clients[client.Name] = client
+}
+
+func unregisterStats(client *Client) {
+	statsRegistry.Lock()
+	defer statsRegistry.Unlock()
+
+	if statsRegistry.clients[client.Name] == client {
+		delete(statsRegistry.clients, client.Name)
+	}
+}
+
+// ratio returns part/total (0 when total is 0)
+func ratio(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(part) / float64(total)
+}
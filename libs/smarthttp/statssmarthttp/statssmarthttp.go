@@ -0,0 +1,355 @@
+// Package statssmarthttp provides a statsd (e.g. DataDog) backed implementation of smarthttp.Instrumentation.
+//
+// All metrics are tagged with the name of the client and (where available) the endpoint (i.e. method and path
+// template or sanitized path, see smarthttp.WithPathTemplate).
+// Timings are sampled (see WithSampleRate); counts are not.
+package statssmarthttp
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+)
+
+const (
+	defaultPrefix     = "smarthttp."
+	defaultSampleRate = 1.0
+)
+
+// Statsd is the subset of the statsd client used by this package.
+// It is satisfied by the DataDog client (github.com/DataDog/datadog-go/statsd).
+type Statsd interface {
+	Incr(name string, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+}
+
+// Option configures the Instrumentation
+type Option func(i *Instrumentation)
+
+// WithPrefix sets the prefix of the metric names (default: "smarthttp.")
+func WithPrefix(prefix string) Option {
+	return func(i *Instrumentation) {
+		i.prefix = prefix
+	}
+}
+
+// WithSampleRate sets the sample rate of the timings (default: 1)
+func WithSampleRate(rate float64) Option {
+	return func(i *Instrumentation) {
+		i.sampleRate = rate
+	}
+}
+
+// WithTags adds tags to all metrics (e.g. "team:payments")
+func WithTags(tags ...string) Option {
+	return func(i *Instrumentation) {
+		i.tags = append(i.tags, tags...)
+	}
+}
+
+// WithSanitizePath sets the function that sanitizes the url path before it is used as a tag
+// (default: smarthttp.DefaultSanitizePath, which replaces IDs to avoid unbounded tag cardinality).
+func WithSanitizePath(sanitizePath func(urlPath string) string) Option {
+	return func(i *Instrumentation) {
+		i.sanitizePath = sanitizePath
+	}
+}
+
+// Instrumentation is a statsd backed smarthttp.Instrumentation.
+// A separate instance should be created for each client.
+type Instrumentation struct {
+	statsd       Statsd
+	prefix       string
+	sampleRate   float64
+	tags         []string
+	sanitizePath func(urlPath string) string
+}
+
+// New returns a statsd backed smarthttp.Instrumentation
+func New(statsd Statsd, opts ...Option) *Instrumentation {
+	i := &Instrumentation{
+		statsd:       statsd,
+		prefix:       defaultPrefix,
+		sampleRate:   defaultSampleRate,
+		sanitizePath: smarthttp.DefaultSanitizePath,
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Init implements smarthttp.Instrumentation
+func (i *Instrumentation) Init(name string) {
+	i.tags = append(i.tags, "client:"+name)
+}
+
+// InitWarning implements smarthttp.Instrumentation
+func (i *Instrumentation) InitWarning(message string) {
+	log.Printf("smarthttp: %s", message)
+}
+
+// Flush implements smarthttp.Flusher; the statsd client is flushed when it supports it (e.g. the DataDog client)
+func (i *Instrumentation) Flush() error {
+	if flusher, ok := i.statsd.(smarthttp.Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// SanitizePath implements smarthttp.Instrumentation
+func (i *Instrumentation) SanitizePath(urlPath string) string {
+	return i.sanitizePath(urlPath)
+}
+
+// DoDuration implements smarthttp.Instrumentation
+func (i *Instrumentation) DoDuration(start time.Time, endpointTag string) {
+	i.timing("do.duration", time.Since(start), "endpoint:"+endpointTag)
+}
+
+// BaseDoDuration implements smarthttp.Instrumentation
+func (i *Instrumentation) BaseDoDuration(start time.Time, statusCode int, endpointTag string) {
+	statusClass := smarthttp.StatusClass(statusCode)
+	if statusClass == "" {
+		statusClass = "error"
+	}
+
+	i.timing("base_do.duration", time.Since(start), "endpoint:"+endpointTag, "status:"+strconv.Itoa(statusCode),
+		"status_class:"+statusClass)
+}
+
+// BaseDoErrDuration implements smarthttp.Instrumentation
+func (i *Instrumentation) BaseDoErrDuration(start time.Time, class smarthttp.ErrorClass, endpointTag string) {
+	i.timing("base_do.error_duration", time.Since(start), "endpoint:"+endpointTag, "error_class:"+string(class))
+}
+
+// BaseDoErr implements smarthttp.Instrumentation
+func (i *Instrumentation) BaseDoErr(_ error, endpointTag, errTag string) {
+	i.incr("base_do.error", "endpoint:"+endpointTag, "error:"+errTag)
+}
+
+// BaseDoConnTrace implements smarthttp.Instrumentation
+func (i *Instrumentation) BaseDoConnTrace(trace smarthttp.ConnTrace, endpointTag string) {
+	tag := "endpoint:" + endpointTag
+
+	i.incr("conn", tag, "reused:"+strconv.FormatBool(trace.Reused), "protocol:"+trace.Protocol)
+
+	// phases that did not occur are not reported
+	phases := []struct {
+		name  string
+		value time.Duration
+	}{
+		{name: "conn.dns", value: trace.DNS},
+		{name: "conn.connect", value: trace.Connect},
+		{name: "conn.tls_handshake", value: trace.TLSHandshake},
+		{name: "ttfb", value: trace.TimeToFirstByte},
+	}
+
+	for _, phase := range phases {
+		if phase.value > 0 {
+			i.timing(phase.name, phase.value, tag)
+		}
+	}
+}
+
+// DNSLookup implements smarthttp.Instrumentation
+func (i *Instrumentation) DNSLookup(host string, duration time.Duration, cached bool, err error) {
+	tags := []string{"host:" + host, "cached:" + strconv.FormatBool(cached), "success:" + strconv.FormatBool(err == nil)}
+
+	i.incr("dns.lookup", tags...)
+
+	// cache hits take no time worth reporting
+	if !cached {
+		i.timing("dns.lookup.duration", duration, tags...)
+	}
+}
+
+// DebugDump implements smarthttp.Instrumentation (dumps are not reported as stats)
+func (i *Instrumentation) DebugDump(_ smarthttp.Dump, _ string) {}
+
+// Redirect implements smarthttp.Instrumentation
+func (i *Instrumentation) Redirect(req *http.Request, _ int) {
+	i.incr("redirect", i.endpointTag(req))
+}
+
+// CBCircuitOpen implements smarthttp.Instrumentation
+func (i *Instrumentation) CBCircuitOpen(req *http.Request) {
+	i.incr("cb.circuit_open", i.endpointTag(req))
+}
+
+// CBStateChange implements smarthttp.Instrumentation
+func (i *Instrumentation) CBStateChange(name string, from, to smarthttp.State) {
+	i.incr("cb.state_change", "circuit:"+name, "from:"+from.String(), "to:"+to.String())
+}
+
+// CBTrackedStatusCode implements smarthttp.Instrumentation
+func (i *Instrumentation) CBTrackedStatusCode(req *http.Request, code int) {
+	i.incr("cb.tracked_status_code", i.endpointTag(req), "status:"+strconv.Itoa(code))
+}
+
+// RetryNonRetriable implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryNonRetriable(req *http.Request, code int, attempt int) {
+	i.incr("retry.non_retriable", i.endpointTag(req), "status:"+strconv.Itoa(code), "attempt:"+strconv.Itoa(attempt))
+}
+
+// RetryRetriable implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryRetriable(req *http.Request, code int, attempt int) {
+	i.incr("retry.retriable", i.endpointTag(req), "status:"+strconv.Itoa(code), "attempt:"+strconv.Itoa(attempt))
+}
+
+// RetryNonRetriableErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryNonRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	i.incr("retry.non_retriable", i.endpointTag(req), "error_class:"+string(class), "attempt:"+strconv.Itoa(attempt))
+}
+
+// RetryRetriableErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	i.incr("retry.retriable", i.endpointTag(req), "error_class:"+string(class), "attempt:"+strconv.Itoa(attempt))
+}
+
+// ResponseRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) ResponseRejected(req *http.Request, code int, err error) {
+	i.incr("response.rejected", i.endpointTag(req), "status:"+strconv.Itoa(code),
+		"retriable:"+strconv.FormatBool(smarthttp.IsRetryable(err)))
+}
+
+// BulkheadQueued implements smarthttp.Instrumentation
+func (i *Instrumentation) BulkheadQueued(req *http.Request, wait time.Duration) {
+	i.timing("bulkhead.queued", wait, i.endpointTag(req))
+}
+
+// BulkheadRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) BulkheadRejected(req *http.Request) {
+	i.incr("bulkhead.rejected", i.endpointTag(req))
+}
+
+// CacheHit implements smarthttp.Instrumentation
+func (i *Instrumentation) CacheHit(req *http.Request) {
+	i.incr("cache.hit", i.endpointTag(req))
+}
+
+// CacheMiss implements smarthttp.Instrumentation
+func (i *Instrumentation) CacheMiss(req *http.Request) {
+	i.incr("cache.miss", i.endpointTag(req))
+}
+
+// ConcurrencyLimitChanged implements smarthttp.Instrumentation
+func (i *Instrumentation) ConcurrencyLimitChanged(limit int) {
+	_ = i.statsd.Gauge(i.prefix+"concurrency.limit", float64(limit), i.tags, 1)
+}
+
+// ConcurrencyLimitRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) ConcurrencyLimitRejected(req *http.Request) {
+	i.incr("concurrency.rejected", i.endpointTag(req))
+}
+
+// HedgeSent implements smarthttp.Instrumentation
+func (i *Instrumentation) HedgeSent(req *http.Request, _ int) {
+	i.incr("hedge.sent", i.endpointTag(req))
+}
+
+// SingleflightErr implements smarthttp.Instrumentation
+func (i *Instrumentation) SingleflightErr(req *http.Request, _ error) {
+	i.incr("singleflight.error", i.endpointTag(req))
+}
+
+// RateLimitErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RateLimitErr(req *http.Request, _ error) {
+	i.incr("ratelimit.rejected", i.endpointTag(req))
+}
+
+// TLSPinFailure implements smarthttp.Instrumentation
+func (i *Instrumentation) TLSPinFailure(_ string) {
+	i.incr("tls.pin_failure")
+}
+
+// TargetHealthChange implements smarthttp.Instrumentation
+func (i *Instrumentation) TargetHealthChange(_, target string, healthy bool) {
+	i.incr("lb.health_change", "target:"+target, "healthy:"+strconv.FormatBool(healthy))
+}
+
+// FailoverSent implements smarthttp.Instrumentation
+func (i *Instrumentation) FailoverSent(req *http.Request, reason string) {
+	i.incr("failover.sent", i.endpointTag(req), "reason:"+reason)
+}
+
+// ResolveErr implements smarthttp.Instrumentation
+func (i *Instrumentation) ResolveErr(_, service string, _ error) {
+	i.incr("lb.resolve_error", "service:"+service)
+}
+
+// AsyncQueued implements smarthttp.Instrumentation
+func (i *Instrumentation) AsyncQueued(req *http.Request, wait time.Duration) {
+	i.timing("async.queued", wait, i.endpointTag(req))
+}
+
+// AsyncRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) AsyncRejected(req *http.Request) {
+	i.incr("async.rejected", i.endpointTag(req))
+}
+
+// OutboxDeliveryFailed implements smarthttp.Instrumentation
+func (i *Instrumentation) OutboxDeliveryFailed(req *http.Request, _ int, _ error, deadLettered bool) {
+	i.incr("outbox.delivery_failed", i.endpointTag(req), "dead_lettered:"+strconv.FormatBool(deadLettered))
+}
+
+// OutboxStoreErr implements smarthttp.Instrumentation
+func (i *Instrumentation) OutboxStoreErr(_ string, _ error) {
+	i.incr("outbox.store_error")
+}
+
+// WebhookDelivery implements smarthttp.Instrumentation
+func (i *Instrumentation) WebhookDelivery(req *http.Request, _ string, statusCode int, err error) {
+	delivered := err == nil && statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+
+	i.incr("webhook.delivery", i.endpointTag(req), "status:"+strconv.Itoa(statusCode),
+		"delivered:"+strconv.FormatBool(delivered))
+}
+
+// LoadShed implements smarthttp.Instrumentation
+func (i *Instrumentation) LoadShed(req *http.Request, _ time.Duration) {
+	i.incr("load_shed", i.endpointTag(req), "priority:"+smarthttp.PriorityFromContext(req.Context()).String())
+}
+
+// PoolStats implements smarthttp.Instrumentation
+func (i *Instrumentation) PoolStats(_ string, stats smarthttp.PoolStats) {
+	tags := i.withTags([]string{"host:" + stats.Host})
+
+	_ = i.statsd.Gauge(i.prefix+"pool.in_flight", float64(stats.InFlight), tags, 1)
+	_ = i.statsd.Gauge(i.prefix+"pool.in_use", float64(stats.InUse), tags, 1)
+	_ = i.statsd.Gauge(i.prefix+"pool.open", float64(stats.Open), tags, 1)
+	_ = i.statsd.Gauge(i.prefix+"pool.idle", float64(stats.Idle), tags, 1)
+	_ = i.statsd.Gauge(i.prefix+"pool.reuse_ratio", stats.ReuseRatio(), tags, 1)
+}
+
+// endpointTag returns the endpoint tag of the request (matches the endpointTag passed to DoDuration)
+func (i *Instrumentation) endpointTag(req *http.Request) string {
+	if template := smarthttp.PathTemplate(req); template != "" {
+		return "endpoint:" + req.Method + "::" + template
+	}
+
+	return "endpoint:" + req.Method + "::" + i.sanitizePath(req.URL.Path)
+}
+
+func (i *Instrumentation) incr(name string, tags ...string) {
+	// failing to send stats should not fail the request
+	_ = i.statsd.Incr(i.prefix+name, i.withTags(tags), 1)
+}
+
+func (i *Instrumentation) timing(name string, value time.Duration, tags ...string) {
+	_ = i.statsd.Timing(i.prefix+name, value, i.withTags(tags), i.sampleRate)
+}
+
+func (i *Instrumentation) withTags(tags []string) []string {
+	all := make([]string, 0, len(i.tags)+len(tags))
+	all = append(all, i.tags...)
+
+	return append(all, tags...)
+}
@@ -0,0 +1,154 @@
+package smarthttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// ErrCertificatePinMismatch indicates that none of the certificates presented by the server matched the pins (see
+// TLS.PinnedPublicKeys and TLS.PinnedCertificates)
+var ErrCertificatePinMismatch = errors.New("server certificate does not match the pinned certificates or public keys")
+
+// ErrInvalidTLSConfig indicates that the TLS configuration could not be loaded (e.g. a missing certificate file)
+var ErrInvalidTLSConfig = errors.New("invalid TLS config")
+
+// TLS defines the TLS configuration of the default transport (e.g. for mutual TLS)
+type TLS struct {
+	// CertFile and KeyFile (optionally) are the paths of the PEM encoded client certificate and key (for mutual TLS)
+	CertFile string
+	KeyFile  string
+
+	// Certificates (optionally) are the client certificates (for mutual TLS); used in addition to CertFile and KeyFile
+	Certificates []tls.Certificate
+
+	// CAFile (optionally) is the path of the PEM encoded CA certificates used to verify the server
+	CAFile string
+
+	// RootCAs (optionally) are the CA certificates used to verify the server; CAFile is added to them (i.e. the pool is modified).
+	// When neither RootCAs nor CAFile are set, the system CA certificates are used.
+	RootCAs *x509.CertPool
+
+	// MinVersion is the minimum TLS version (default: tls.VersionTLS12)
+	MinVersion uint16
+
+	// ServerName (optionally) overrides the name used to verify the server certificate (and sent via SNI)
+	ServerName string
+
+	// PinnedPublicKeys (optionally) are the base64 encoded SHA-256 hashes of the public keys (SPKI) that are trusted.
+	// When pins are configured, connections are rejected unless a certificate in the chain presented by the server matches
+	// one of the pinned public keys or certificates (in addition to the standard verification).
+	// The hash of a certificate can be calculated with:
+	//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+	PinnedPublicKeys []string
+
+	// PinnedCertificates (optionally) are the base64 encoded SHA-256 hashes of the (DER encoded) certificates that are
+	// trusted (see PinnedPublicKeys)
+	PinnedCertificates []string
+
+	// VerifyPeerCertificate (optionally) performs additional verification of the server certificates (see tls.Config).
+	// It is called after the standard verification and the pin validation.
+	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+}
+
+// build creates the tls.Config
+func (t *TLS) build(instrumentation Instrumentation, name string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.ServerName,
+		RootCAs:    t.RootCAs,
+	}
+
+	if t.MinVersion != 0 {
+		cfg.MinVersion = t.MinVersion
+	}
+
+	cfg.Certificates = append(cfg.Certificates, t.Certificates...)
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w - unable to load client certificate: %s", ErrInvalidTLSConfig, err)
+		}
+
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w - unable to read CA file: %s", ErrInvalidTLSConfig, err)
+		}
+
+		if cfg.RootCAs == nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w - no certificates found in CA file '%s'", ErrInvalidTLSConfig, t.CAFile)
+		}
+	}
+
+	if len(t.PinnedPublicKeys) > 0 || len(t.PinnedCertificates) > 0 || t.VerifyPeerCertificate != nil {
+		cfg.VerifyPeerCertificate = t.buildVerifyPeerCertificate(instrumentation, name)
+	}
+
+	return cfg, nil
+}
+
+func (t *TLS) buildVerifyPeerCertificate(instrumentation Instrumentation, name string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(t.PinnedPublicKeys) > 0 || len(t.PinnedCertificates) > 0 {
+			err := t.verifyPins(rawCerts)
+			if err != nil {
+				instrumentation.TLSPinFailure(name)
+
+				return err
+			}
+		}
+
+		if t.VerifyPeerCertificate != nil {
+			return t.VerifyPeerCertificate(rawCerts, verifiedChains)
+		}
+
+		return nil
+	}
+}
+
+// verifyPins returns nil when any of the certificates presented by the server match a pin
+func (t *TLS) verifyPins(rawCerts [][]byte) error {
+	for _, rawCert := range rawCerts {
+		certHash := sha256.Sum256(rawCert)
+		if containsHash(t.PinnedCertificates, certHash[:]) {
+			return nil
+		}
+
+		cert, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			continue
+		}
+
+		keyHash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if containsHash(t.PinnedPublicKeys, keyHash[:]) {
+			return nil
+		}
+	}
+
+	return ErrCertificatePinMismatch
+}
+
+func containsHash(pins []string, hash []byte) bool {
+	encoded := base64.StdEncoding.EncodeToString(hash)
+
+	for _, pin := range pins {
+		if pin == encoded {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package smarthttp
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLS_Pins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cert := server.Certificate()
+
+	certHash := sha256.Sum256(cert.Raw)
+	keyHash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	otherHash := sha256.Sum256([]byte("another key"))
+
+	certPin := base64.StdEncoding.EncodeToString(certHash[:])
+	keyPin := base64.StdEncoding.EncodeToString(keyHash[:])
+	otherPin := base64.StdEncoding.EncodeToString(otherHash[:])
+
+	tests := []struct {
+		name     string
+		tls      TLS
+		wantErr  bool
+		wantPins int
+	}{
+		{
+			name: "no pins",
+			tls:  TLS{},
+		},
+		{
+			name: "matching public key pin",
+			tls:  TLS{PinnedPublicKeys: []string{otherPin, keyPin}},
+		},
+		{
+			name: "matching certificate pin",
+			tls:  TLS{PinnedCertificates: []string{certPin}},
+		},
+		{
+			name:     "public key pin mismatch",
+			tls:      TLS{PinnedPublicKeys: []string{otherPin}},
+			wantErr:  true,
+			wantPins: 1,
+		},
+		{
+			name:     "certificate pin mismatch",
+			tls:      TLS{PinnedCertificates: []string{otherPin}},
+			wantErr:  true,
+			wantPins: 1,
+		},
+		{
+			// the hash of the certificate is not the hash of its public key
+			name:     "certificate hash used as a public key pin",
+			tls:      TLS{PinnedPublicKeys: []string{certPin}},
+			wantErr:  true,
+			wantPins: 1,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			pool := x509.NewCertPool()
+			pool.AddCert(cert)
+
+			tlsConfig := test.tls
+			tlsConfig.RootCAs = pool
+
+			instrumentation := &pinFailureInstrumentation{}
+
+			client := &Client{
+				Name:            "tls-pins-" + test.name,
+				TLS:             &tlsConfig,
+				Instrumentation: instrumentation,
+				CircuitBreaker:  CircuitBreaker{Engine: &GoBreakerEngine{}},
+			}
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Do(req)
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+
+			switch {
+			case test.wantErr && !errors.Is(err, ErrCertificatePinMismatch):
+				t.Errorf("expected an error wrapping ErrCertificatePinMismatch, got: %v", err)
+
+			case !test.wantErr && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if instrumentation.pinFailures != test.wantPins {
+				t.Errorf("expected %d pin failures, got %d", test.wantPins, instrumentation.pinFailures)
+			}
+		})
+	}
+}
+
+type pinFailureInstrumentation struct {
+	NoopInstrumentation
+
+	pinFailures int
+}
+
+func (p *pinFailureInstrumentation) TLSPinFailure(_ string) {
+	p.pinFailures++
+}
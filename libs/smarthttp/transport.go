@@ -0,0 +1,108 @@
+package smarthttp
+
+import (
+	"net/http"
+)
+
+// buildTransport builds the default transport (i.e. when neither a Client nor a transport is supplied) applying the
+// transport settings of the client.  Settings that are not set keep the defaults of the transport.
+func (c *Client) buildTransport() http.RoundTripper {
+	transport := GetTransportWithCustomDialer(c.ConnectTimeout)
+
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+
+	if c.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+
+	if c.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+
+	if c.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+
+	if c.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	}
+
+	if c.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = c.ExpectContinueTimeout
+	}
+
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.build(c.Instrumentation, c.Name)
+		if err != nil {
+			c.Instrumentation.InitWarning("unable to load the TLS config, all requests will fail: " + err.Error())
+
+			// requests must not be sent without the configured TLS
+			return &errRoundTripper{err: err}
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if c.ProxyURL != "" {
+		err := c.applyProxy(transport)
+		if err != nil {
+			c.Instrumentation.InitWarning("unable to use the proxy URL, all requests will fail: " + err.Error())
+
+			// requests must not bypass a configured proxy
+			return &errRoundTripper{err: err}
+		}
+	}
+
+	if c.DialOverride != nil {
+		// the requests must not be sent to a proxy from the environment
+		transport.Proxy = nil
+		transport.DialContext = c.DialOverride.wrapDialContext(transport.DialContext, c.ConnectTimeout)
+	}
+
+	if c.HostGuard != nil {
+		if c.ProxyURL == "" {
+			// a proxy from the environment would connect to the upstream on our behalf, bypassing the IP checks
+			transport.Proxy = nil
+		}
+
+		transport.DialContext = c.HostGuard.wrapDialContext(transport.DialContext)
+	}
+
+	// the DNS cache is outside the host guard so that the guard checks the (cached) addresses
+	if c.DNSCache != nil {
+		c.DNSCache.doInitOnce(c.Instrumentation)
+		transport.DialContext = c.DNSCache.wrapDialContext(transport.DialContext)
+	}
+
+	// the pool metrics are outermost so that they count the connections (rather than each address that is dialed)
+	if c.PoolMetrics != nil {
+		transport.DialContext = c.PoolMetrics.wrapDialContext(transport.DialContext)
+	}
+
+	return c.HTTP2.apply(transport)
+}
+
+func (c *Client) applyProxy(transport *http.Transport) error {
+	proxyURL, err := parseProxyURL(c.ProxyURL)
+	if err != nil {
+		return err
+	}
+
+	return applyProxy(transport, proxyURL)
+}
+
+// errRoundTripper fails all requests with the error (i.e. when the transport could not be built)
+type errRoundTripper struct {
+	err error
+}
+
+// RoundTrip implements http.RoundTripper
+func (e *errRoundTripper) RoundTrip(_ *http.Request) (*http.Response, error) {
+	return nil, e.err
+}
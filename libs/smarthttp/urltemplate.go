@@ -0,0 +1,357 @@
+package smarthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrURLTemplate indicates that a URL could not be built from its template
+var ErrURLTemplate = errors.New("invalid url template")
+
+// Params are the values of the placeholders of a URL template (see BuildURL).  Values are formatted like query values
+// (see EncodeQuery).
+type Params map[string]interface{}
+
+// BuildURL expands the placeholders of the template (e.g. "https://api.example.com/v1/orders/{orderID}") with the
+// (path escaped) params and appends the query (see EncodeQuery; it can be nil).  Every placeholder must have a param
+// and every param must be used.
+func BuildURL(template string, params Params, query interface{}) (string, error) {
+	var builder strings.Builder
+
+	used := make(map[string]struct{}, len(params))
+	rest := template
+
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("%w - unclosed placeholder in '%s'", ErrURLTemplate, template)
+		}
+
+		name := rest[start+1 : start+end]
+
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("%w - missing param '%s' for '%s'", ErrURLTemplate, name, template)
+		}
+
+		formatted, ok := formatValue(reflect.ValueOf(value))
+		if !ok {
+			return "", fmt.Errorf("%w - unsupported type %T of param '%s'", ErrURLTemplate, value, name)
+		}
+
+		if formatted == "" {
+			return "", fmt.Errorf("%w - empty param '%s' for '%s'", ErrURLTemplate, name, template)
+		}
+
+		used[name] = struct{}{}
+
+		builder.WriteString(rest[:start])
+		builder.WriteString(url.PathEscape(formatted))
+
+		rest = rest[start+end+1:]
+	}
+
+	builder.WriteString(rest)
+
+	for _, name := range params.sortedKeys() {
+		if _, ok := used[name]; !ok {
+			return "", fmt.Errorf("%w - unused param '%s' for '%s'", ErrURLTemplate, name, template)
+		}
+	}
+
+	values, err := EncodeQuery(query)
+	if err != nil {
+		return "", err
+	}
+
+	if len(values) == 0 {
+		return builder.String(), nil
+	}
+
+	separator := "?"
+	if strings.Contains(template, "?") {
+		separator = "&"
+	}
+
+	return builder.String() + separator + values.Encode(), nil
+}
+
+// NewTemplateRequest returns a request for the URL built from the template (see BuildURL).  The path of the template
+// (e.g. "/v1/orders/{orderID}") is used as the endpoint of the request in the instrumentation (see PathTemplate), so
+// that the metrics are tagged with the template rather than the expanded path.
+func NewTemplateRequest(ctx context.Context, method, template string, params Params, query interface{}, body io.Reader) (*http.Request, error) {
+	rawURL, err := BuildURL(template, params, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.NewRequestWithContext(WithPathTemplate(ctx, templatePath(template)), method, rawURL, body)
+}
+
+// WithPathTemplate returns a copy of the context that sets the path template (e.g. "/v1/orders/{orderID}") of the
+// requests made with it; the template replaces the (sanitized) path of the request in the instrumentation.
+func WithPathTemplate(ctx context.Context, template string) context.Context {
+	return context.WithValue(ctx, ctxKeyPathTemplate, template)
+}
+
+// PathTemplate returns the path template of the request (see WithPathTemplate), or "" when it has none
+func PathTemplate(req *http.Request) string {
+	template, _ := req.Context().Value(ctxKeyPathTemplate).(string)
+
+	return template
+}
+
+// endpointPath returns the path of the endpoint tag of the request (i.e. the template or else the sanitized path)
+func (c *Client) endpointPath(req *http.Request) string {
+	if template := PathTemplate(req); template != "" {
+		return template
+	}
+
+	return c.getInstrumentation().SanitizePath(req.URL.Path)
+}
+
+// templatePath returns the path of the URL template (i.e. without the scheme, host, query and fragment)
+func templatePath(template string) string {
+	path := template
+
+	if index := strings.Index(path, "://"); index >= 0 {
+		path = path[index+len("://"):]
+
+		index = strings.IndexAny(path, "/?#")
+		if index < 0 {
+			return "/"
+		}
+
+		path = path[index:]
+	}
+
+	if index := strings.IndexAny(path, "?#"); index >= 0 {
+		path = path[:index]
+	}
+
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
+
+// EncodeQuery encodes the query parameters supplied as url.Values, a map[string]string or a struct (or a pointer to a
+// struct).  The names of the fields of a struct are set by the `url` tag (e.g. `url:"page_size,omitempty"`; "-" skips
+// the field), otherwise the field name is used.  Strings, booleans, numbers, time.Time (RFC 3339), fmt.Stringer
+// (e.g. time.Duration) and pointers to them are supported; slices are encoded as repeated parameters.
+func EncodeQuery(query interface{}) (url.Values, error) {
+	switch query := query.(type) {
+	case nil:
+		return url.Values{}, nil
+
+	case url.Values:
+		return query, nil
+
+	case map[string]string:
+		values := make(url.Values, len(query))
+		for key, value := range query {
+			values.Set(key, value)
+		}
+
+		return values, nil
+	}
+
+	value := reflect.ValueOf(query)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return url.Values{}, nil
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w - unsupported query type %T", ErrURLTemplate, query)
+	}
+
+	values := url.Values{}
+
+	err := encodeStruct(values, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func encodeStruct(values url.Values, value reflect.Value) error {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name, omitEmpty := parseQueryTag(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+
+		if field.Anonymous && name == "" && fieldValue.Kind() == reflect.Struct {
+			err := encodeStruct(values, fieldValue)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if omitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+
+		err := encodeField(values, name, fieldValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeField(values url.Values, name string, value reflect.Value) error {
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		for i := 0; i < value.Len(); i++ {
+			formatted, ok := formatValue(value.Index(i))
+			if !ok {
+				return fmt.Errorf("%w - unsupported type %s of query field '%s'", ErrURLTemplate, value.Type(), name)
+			}
+
+			values.Add(name, formatted)
+		}
+
+		return nil
+	}
+
+	formatted, ok := formatValue(value)
+	if !ok {
+		return fmt.Errorf("%w - unsupported type %s of query field '%s'", ErrURLTemplate, value.Type(), name)
+	}
+
+	values.Add(name, formatted)
+
+	return nil
+}
+
+// parseQueryTag returns the name and the omitempty option of the `url` tag of the field
+func parseQueryTag(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("url"), ",")
+
+	omitEmpty := false
+
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+
+	return parts[0], omitEmpty
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// formatValue formats a param or query value; ok is false when its type is not supported
+func formatValue(value reflect.Value) (string, bool) {
+	if !value.IsValid() {
+		return "", true
+	}
+
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", true
+		}
+
+		value = value.Elem()
+	}
+
+	switch {
+	case value.Type() == timeType:
+		return value.Interface().(time.Time).Format(time.RFC3339), true
+
+	case value.Type().Implements(stringerType):
+		return value.Interface().(fmt.Stringer).String(), true
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), true
+
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), true
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), true
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits()), true
+
+	default:
+		return "", false
+	}
+}
+
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+
+	case reflect.Struct:
+		if value.Type() == timeType {
+			return value.Interface().(time.Time).IsZero()
+		}
+
+		return false
+
+	default:
+		return value.IsZero()
+	}
+}
+
+// sortedKeys returns the keys of the params in order (so that errors are deterministic)
+func (p Params) sortedKeys() []string {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
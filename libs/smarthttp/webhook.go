@@ -0,0 +1,273 @@
+package smarthttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookIDHeader        = "Webhook-Id"
+	defaultWebhookTimestampHeader = "Webhook-Timestamp"
+	defaultWebhookSignatureHeader = "Webhook-Signature"
+
+	// the version prefix of each signature
+	webhookSignatureVersion = "v1"
+)
+
+// ErrWebhookNotConfigured indicates that SendWebhook (or EnqueueWebhook) was called on a client without Webhook
+var ErrWebhookNotConfigured = errors.New("webhook is not configured")
+
+// Webhook defines the webhook signing configuration (see Client.SendWebhook).
+// The delivery headers follow the Standard Webhooks format: each delivery has an ID (which is the same for every attempt
+// so that the receivers can deduplicate the deliveries), each attempt has a timestamp (unix seconds) and is signed
+// with HMAC-SHA256 over "<id>.<timestamp>.<body>":
+//
+//	Webhook-Id: 5b0f4c8e-...
+//	Webhook-Timestamp: 1700000000
+//	Webhook-Signature: v1,<base64 signature> v1,<base64 signature>
+//
+// Each attempt is signed with every one of the Secrets, so that a secret can be rotated without failing deliveries:
+// add the new secret, let the receivers switch to it and then remove the old secret.
+type Webhook struct {
+	// Secrets are the signing secrets (at least one)
+	Secrets [][]byte
+
+	// IDHeader, TimestampHeader and SignatureHeader (optionally) override the names of the headers
+	// (default: Webhook-Id, Webhook-Timestamp and Webhook-Signature)
+	IDHeader        string
+	TimestampHeader string
+	SignatureHeader string
+
+	instrumentation Instrumentation
+
+	// used for testing only
+	now func() time.Time
+}
+
+// SendWebhook sends the payload (a []byte or a value that is encoded as JSON) to the URL as a signed webhook (see
+// Webhook) and returns the delivery ID.  The attempts are retried (see Retries) even though the method is POST.
+// Non-2xx responses are returned as an *APIError.
+func (c *Client) SendWebhook(ctx context.Context, url string, payload interface{}) (string, error) {
+	req, id, err := c.newWebhookRequest(ctx, url, payload)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return id, err
+	}
+
+	defer discardResponse(resp)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return id, newAPIError(resp)
+	}
+
+	return id, nil
+}
+
+// EnqueueWebhook saves the webhook to the outbox (see Outbox) and returns the delivery ID.  Each attempt is signed when
+// it is sent (so that its timestamp is fresh).
+func (c *Client) EnqueueWebhook(ctx context.Context, url string, payload interface{}) (string, error) {
+	req, id, err := c.newWebhookRequest(ctx, url, payload)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = c.Enqueue(req)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// newWebhookRequest returns the (unsigned) request of the webhook with its delivery ID
+func (c *Client) newWebhookRequest(ctx context.Context, url string, payload interface{}) (*http.Request, string, error) {
+	c.clientInitOnce.Do(c.doInitOnce)
+
+	if c.Webhook == nil {
+		return nil, "", ErrWebhookNotConfigured
+	}
+
+	body, ok := payload.([]byte)
+	if !ok {
+		var err error
+
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// the receivers deduplicate the deliveries by ID so the attempts can be retried
+	req, err := http.NewRequestWithContext(WithNonIdempotentRetries(ctx), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := newUUID()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(c.Webhook.getIDHeader(), id)
+
+	return req, id, nil
+}
+
+// buildMiddleware returns the middleware that signs (and reports) each attempt of the webhooks, i.e. of the requests
+// that carry the ID header
+func (w *Webhook) buildMiddleware(doFunc requestClosure) requestClosure {
+	return func(req *http.Request) (*http.Response, error) {
+		id := req.Header.Get(w.getIDHeader())
+		if id == "" {
+			return doFunc(req)
+		}
+
+		// copy the request so that the signature of one attempt does not leak into the next
+		req = req.Clone(req.Context())
+
+		err := w.sign(req, id)
+		if err != nil {
+			return nil, fmt.Errorf("%w - %s", ErrSigning, err)
+		}
+
+		resp, err := doFunc(req)
+
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+
+		w.instrumentation.WebhookDelivery(req, id, statusCode, err)
+
+		return resp, err
+	}
+}
+
+// sign adds the timestamp and the signatures to the request
+func (w *Webhook) sign(req *http.Request, id string) error {
+	var body []byte
+
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+
+		body, err = ioutil.ReadAll(reader)
+		_ = reader.Close()
+
+		if err != nil {
+			return err
+		}
+	} else if req.Body != nil && req.Body != http.NoBody {
+		return errors.New("webhook body cannot be read again")
+	}
+
+	timestamp := strconv.FormatInt(w.getNow().Unix(), 10)
+
+	content := []byte(id + "." + timestamp + ".")
+	content = append(content, body...)
+
+	signatures := make([]string, 0, len(w.Secrets))
+
+	for _, secret := range w.Secrets {
+		mac := hmac.New(sha256.New, secret)
+		_, _ = mac.Write(content)
+
+		signatures = append(signatures, webhookSignatureVersion+","+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+
+	req.Header.Set(w.getTimestampHeader(), timestamp)
+	req.Header.Set(w.getSignatureHeader(), strings.Join(signatures, " "))
+
+	return nil
+}
+
+func (w *Webhook) getNow() time.Time {
+	if w.now != nil {
+		return w.now()
+	}
+
+	return time.Now()
+}
+
+func (w *Webhook) getIDHeader() string {
+	if w.IDHeader != "" {
+		return w.IDHeader
+	}
+
+	return defaultWebhookIDHeader
+}
+
+func (w *Webhook) getTimestampHeader() string {
+	if w.TimestampHeader != "" {
+		return w.TimestampHeader
+	}
+
+	return defaultWebhookTimestampHeader
+}
+
+func (w *Webhook) getSignatureHeader() string {
+	if w.SignatureHeader != "" {
+		return w.SignatureHeader
+	}
+
+	return defaultWebhookSignatureHeader
+}
+
+func (w *Webhook) validate() error {
+	if len(w.Secrets) == 0 {
+		return errors.New("webhook requires at least one secret")
+	}
+
+	for _, secret := range w.Secrets {
+		if len(secret) == 0 {
+			return errors.New("webhook secrets cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+func (w *Webhook) addMiddleware(doFunc requestClosure) requestClosure {
+	if w == nil {
+		return doFunc
+	}
+
+	return w.buildMiddleware(doFunc)
+}
+
+func (w *Webhook) doInitOnce(instrumentation Instrumentation) {
+	if w == nil {
+		return
+	}
+
+	w.instrumentation = instrumentation
+}
+
+// clone returns a copy of the configuration for a variant of the client (see Client.Clone)
+func (w *Webhook) clone() *Webhook {
+	if w == nil {
+		return nil
+	}
+
+	return &Webhook{
+		Secrets:         append([][]byte(nil), w.Secrets...),
+		IDHeader:        w.IDHeader,
+		TimestampHeader: w.TimestampHeader,
+		SignatureHeader: w.SignatureHeader,
+	}
+}
@@ -0,0 +1,145 @@
+package smarthttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the test vector of the Standard Webhooks specification
+const (
+	webhookTestSecret    = "MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	webhookTestID        = "msg_p5jXN8AQM9LWM0D4loKWxJek"
+	webhookTestTimestamp = 1614265330
+	webhookTestBody      = `{"test": 2432232314}`
+)
+
+func decodeWebhookSecret(t *testing.T, secret string) []byte {
+	t.Helper()
+
+	decoded, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded
+}
+
+func TestWebhook_Sign(t *testing.T) {
+	tests := []struct {
+		name          string
+		secrets       func(t *testing.T) [][]byte
+		wantSignature string
+	}{
+		{
+			name: "single secret",
+			secrets: func(t *testing.T) [][]byte {
+				return [][]byte{decodeWebhookSecret(t, webhookTestSecret)}
+			},
+			wantSignature: "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=",
+		},
+		{
+			// during a rotation each attempt carries a signature for each secret (in order)
+			name: "rotation",
+			secrets: func(t *testing.T) [][]byte {
+				return [][]byte{decodeWebhookSecret(t, webhookTestSecret), []byte("second-secret")}
+			},
+			wantSignature: "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE= v1,hDnkdt2sD4BOfUrhQNp8OhOL6cLjzM4EIWhiL6aKIMU=",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			webhook := &Webhook{
+				Secrets: test.secrets(t),
+				now: func() time.Time {
+					return time.Unix(webhookTestTimestamp, 0)
+				},
+			}
+
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/webhooks", strings.NewReader(webhookTestBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = webhook.sign(req, webhookTestID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := req.Header.Get("Webhook-Timestamp"); got != "1614265330" {
+				t.Errorf("unexpected timestamp %q", got)
+			}
+
+			if got := req.Header.Get("Webhook-Signature"); got != test.wantSignature {
+				t.Errorf("expected signature %q, got %q", test.wantSignature, got)
+			}
+
+			// the body is still available to be sent
+			body, _ := ioutil.ReadAll(req.Body)
+			if string(body) != webhookTestBody {
+				t.Errorf("unexpected body %q", body)
+			}
+		})
+	}
+}
+
+func TestClient_SendWebhook(t *testing.T) {
+	secret := []byte("whsec-test")
+
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		received <- req
+		receivedBody <- body
+
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		Name:           "webhook-send",
+		Webhook:        &Webhook{Secrets: [][]byte{secret}},
+		CircuitBreaker: CircuitBreaker{Engine: &GoBreakerEngine{}},
+	}
+
+	id, err := client.SendWebhook(context.Background(), server.URL, map[string]string{"type": "order.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, body := <-received, <-receivedBody
+
+	if got := req.Header.Get("Webhook-Id"); got != id || id == "" {
+		t.Errorf("expected the delivery ID %q, got %q", id, got)
+	}
+
+	// verify the delivery as a receiver would
+	content := []byte(id + "." + req.Header.Get("Webhook-Timestamp") + ".")
+	content = append(content, body...)
+
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(content)
+
+	want := "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get("Webhook-Signature"); got != want {
+		t.Errorf("expected signature %q, got %q", want, got)
+	}
+
+	if !bytes.Equal(body, []byte(`{"type":"order.created"}`)) {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/karelrenaldi/storemono/libs/smarthttp/zapsmarthttp
+
+go 1.16
+
+require (
+	github.com/karelrenaldi/storemono/libs/smarthttp v0.0.0
+	go.uber.org/zap v1.21.0
+)
+
+replace github.com/karelrenaldi/storemono/libs/smarthttp => ../
+
+replace github.com/karelrenaldi/storemono/libs/config => ../../config
@@ -0,0 +1,303 @@
+// Package zapsmarthttp provides a log (zap) backed implementation of smarthttp.Instrumentation for teams that want
+// structured logs of retries, circuit breaker events and errors but no metrics.
+//
+// It is a separate module so that users of smarthttp do not depend on zap.
+//
+//	client.Instrumentation = zapsmarthttp.New(log)
+//
+// where log is the *logger.Logger from libs/logger (so that log lines carry the request ID) or a *zap.Logger.
+package zapsmarthttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+	"go.uber.org/zap"
+)
+
+// Logger is the subset of the logger used by this package.
+// It is satisfied by both *logger.Logger (libs/logger) and *zap.Logger.
+type Logger interface {
+	Debug(msg string, fields ...zap.Field)
+	Info(msg string, fields ...zap.Field)
+	Warn(msg string, fields ...zap.Field)
+	Error(msg string, fields ...zap.Field)
+}
+
+// Instrumentation is a log backed smarthttp.Instrumentation.
+// Timings and cache events are not logged; debug dumps (see smarthttp.Debug) are logged at debug level.
+// A separate instance should be created for each client.
+type Instrumentation struct {
+	smarthttp.NoopInstrumentation
+
+	log  Logger
+	name string
+}
+
+// New returns a log backed smarthttp.Instrumentation
+func New(log Logger) *Instrumentation {
+	return &Instrumentation{log: log}
+}
+
+// Init implements smarthttp.Instrumentation
+func (i *Instrumentation) Init(name string) {
+	i.name = name
+}
+
+// InitWarning implements smarthttp.Instrumentation
+func (i *Instrumentation) InitWarning(message string) {
+	i.log.Warn("smarthttp: "+message, zap.String("client", i.name))
+}
+
+// Flush implements smarthttp.Flusher; the logger is synced when it supports it (e.g. *zap.Logger)
+func (i *Instrumentation) Flush() error {
+	if syncer, ok := i.log.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+// SanitizePath implements smarthttp.Instrumentation
+func (i *Instrumentation) SanitizePath(urlPath string) string {
+	return urlPath
+}
+
+// BaseDoErr implements smarthttp.Instrumentation
+func (i *Instrumentation) BaseDoErr(err error, endpointTag, errTag string) {
+	i.log.Warn("smarthttp: request failed", zap.String("client", i.name), zap.String("endpoint", endpointTag),
+		zap.String("errTag", errTag), zap.Error(err))
+}
+
+// DNSLookup implements smarthttp.Instrumentation
+func (i *Instrumentation) DNSLookup(host string, duration time.Duration, cached bool, err error) {
+	fields := []zap.Field{zap.String("client", i.name), zap.String("host", host), zap.Duration("duration", duration),
+		zap.Bool("cached", cached)}
+
+	if err != nil && !cached {
+		i.log.Warn("smarthttp: DNS lookup failed", append(fields, zap.Error(err))...)
+
+		return
+	}
+
+	i.log.Debug("smarthttp: DNS lookup", fields...)
+}
+
+// DebugDump implements smarthttp.Instrumentation
+func (i *Instrumentation) DebugDump(dump smarthttp.Dump, endpointTag string) {
+	fields := []zap.Field{
+		zap.String("client", i.name),
+		zap.String("endpoint", endpointTag),
+		zap.String("method", dump.Method),
+		zap.String("url", dump.URL),
+		zap.Any("requestHeader", dump.RequestHeader),
+		zap.Int("statusCode", dump.StatusCode),
+		zap.Any("responseHeader", dump.ResponseHeader),
+		zap.Duration("duration", dump.Duration),
+	}
+
+	if dump.RequestBody != nil {
+		fields = append(fields, zap.ByteString("requestBody", dump.RequestBody))
+	}
+
+	if dump.ResponseBody != nil {
+		fields = append(fields, zap.ByteString("responseBody", dump.ResponseBody))
+	}
+
+	if dump.Err != nil {
+		fields = append(fields, zap.Error(dump.Err))
+	}
+
+	i.log.Debug("smarthttp: debug dump", fields...)
+}
+
+// Redirect implements smarthttp.Instrumentation
+func (i *Instrumentation) Redirect(req *http.Request, hop int) {
+	i.log.Debug("smarthttp: following redirect", append(i.requestFields(req),
+		zap.String("host", req.URL.Host), zap.Int("hop", hop))...)
+}
+
+// CBCircuitOpen implements smarthttp.Instrumentation
+func (i *Instrumentation) CBCircuitOpen(req *http.Request) {
+	i.log.Warn("smarthttp: request rejected by open circuit", i.requestFields(req)...)
+}
+
+// CBStateChange implements smarthttp.Instrumentation
+func (i *Instrumentation) CBStateChange(name string, from, to smarthttp.State) {
+	fields := []zap.Field{zap.String("client", i.name), zap.String("circuit", name),
+		zap.Stringer("from", from), zap.Stringer("to", to)}
+
+	if to == smarthttp.StateOpen {
+		i.log.Error("smarthttp: circuit opened", fields...)
+
+		return
+	}
+
+	i.log.Info("smarthttp: circuit state changed", fields...)
+}
+
+// RetryNonRetriable implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryNonRetriable(req *http.Request, code int, attempt int) {
+	i.log.Debug("smarthttp: not retrying request", append(i.requestFields(req),
+		zap.Int("statusCode", code), zap.Int("attempt", attempt))...)
+}
+
+// RetryRetriable implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryRetriable(req *http.Request, code int, attempt int) {
+	i.log.Info("smarthttp: retrying request", append(i.requestFields(req),
+		zap.Int("statusCode", code), zap.Int("attempt", attempt))...)
+}
+
+// RetryNonRetriableErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryNonRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	i.log.Debug("smarthttp: not retrying request", append(i.requestFields(req),
+		zap.String("errorClass", string(class)), zap.Int("attempt", attempt))...)
+}
+
+// RetryRetriableErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RetryRetriableErr(req *http.Request, class smarthttp.ErrorClass, attempt int) {
+	i.log.Info("smarthttp: retrying request", append(i.requestFields(req),
+		zap.String("errorClass", string(class)), zap.Int("attempt", attempt))...)
+}
+
+// ResponseRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) ResponseRejected(req *http.Request, code int, err error) {
+	i.log.Warn("smarthttp: response rejected", append(i.requestFields(req),
+		zap.Int("statusCode", code), zap.Error(err))...)
+}
+
+// BulkheadQueued implements smarthttp.Instrumentation
+func (i *Instrumentation) BulkheadQueued(req *http.Request, wait time.Duration) {
+	i.log.Debug("smarthttp: request queued by bulkhead", append(i.requestFields(req), zap.Duration("wait", wait))...)
+}
+
+// BulkheadRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) BulkheadRejected(req *http.Request) {
+	i.log.Warn("smarthttp: request rejected by bulkhead", i.requestFields(req)...)
+}
+
+// ConcurrencyLimitChanged implements smarthttp.Instrumentation
+func (i *Instrumentation) ConcurrencyLimitChanged(limit int) {
+	i.log.Debug("smarthttp: concurrency limit changed", zap.String("client", i.name), zap.Int("limit", limit))
+}
+
+// ConcurrencyLimitRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) ConcurrencyLimitRejected(req *http.Request) {
+	i.log.Warn("smarthttp: request rejected by concurrency limit", i.requestFields(req)...)
+}
+
+// HedgeSent implements smarthttp.Instrumentation
+func (i *Instrumentation) HedgeSent(req *http.Request, hedge int) {
+	i.log.Debug("smarthttp: hedged request sent", append(i.requestFields(req), zap.Int("hedge", hedge))...)
+}
+
+// SingleflightErr implements smarthttp.Instrumentation
+func (i *Instrumentation) SingleflightErr(req *http.Request, err error) {
+	i.log.Warn("smarthttp: singleflight error", append(i.requestFields(req), zap.Error(err))...)
+}
+
+// RateLimitErr implements smarthttp.Instrumentation
+func (i *Instrumentation) RateLimitErr(req *http.Request, err error) {
+	i.log.Warn("smarthttp: request rejected by rate limit", append(i.requestFields(req), zap.Error(err))...)
+}
+
+// TLSPinFailure implements smarthttp.Instrumentation
+func (i *Instrumentation) TLSPinFailure(name string) {
+	i.log.Error("smarthttp: server certificate does not match the pins", zap.String("client", name))
+}
+
+// TargetHealthChange implements smarthttp.Instrumentation
+func (i *Instrumentation) TargetHealthChange(name, target string, healthy bool) {
+	fields := []zap.Field{zap.String("client", name), zap.String("target", target)}
+
+	if !healthy {
+		i.log.Warn("smarthttp: load balancer target ejected", fields...)
+
+		return
+	}
+
+	i.log.Info("smarthttp: load balancer target healthy again", fields...)
+}
+
+// FailoverSent implements smarthttp.Instrumentation
+func (i *Instrumentation) FailoverSent(req *http.Request, reason string) {
+	i.log.Warn("smarthttp: request sent to the failover secondary", append(i.requestFields(req),
+		zap.String("host", req.URL.Host), zap.String("reason", reason))...)
+}
+
+// ResolveErr implements smarthttp.Instrumentation
+func (i *Instrumentation) ResolveErr(name, service string, err error) {
+	i.log.Warn("smarthttp: unable to resolve the load balancer targets", zap.String("client", name),
+		zap.String("service", service), zap.Error(err))
+}
+
+// AsyncQueued implements smarthttp.Instrumentation
+func (i *Instrumentation) AsyncQueued(req *http.Request, wait time.Duration) {
+	i.log.Debug("smarthttp: async request dequeued", append(i.requestFields(req), zap.Duration("wait", wait))...)
+}
+
+// AsyncRejected implements smarthttp.Instrumentation
+func (i *Instrumentation) AsyncRejected(req *http.Request) {
+	i.log.Warn("smarthttp: async request rejected, the queue is full", i.requestFields(req)...)
+}
+
+// OutboxDeliveryFailed implements smarthttp.Instrumentation
+func (i *Instrumentation) OutboxDeliveryFailed(req *http.Request, attempt int, err error, deadLettered bool) {
+	fields := append(i.requestFields(req), zap.Int("attempt", attempt), zap.Error(err))
+
+	if deadLettered {
+		i.log.Error("smarthttp: outbox message dead-lettered", fields...)
+
+		return
+	}
+
+	i.log.Warn("smarthttp: outbox delivery failed", fields...)
+}
+
+// OutboxStoreErr implements smarthttp.Instrumentation
+func (i *Instrumentation) OutboxStoreErr(name string, err error) {
+	i.log.Error("smarthttp: outbox store error", zap.String("client", name), zap.Error(err))
+}
+
+// WebhookDelivery implements smarthttp.Instrumentation
+func (i *Instrumentation) WebhookDelivery(req *http.Request, id string, statusCode int, err error) {
+	fields := append(i.requestFields(req), zap.String("host", req.URL.Host), zap.String("deliveryID", id),
+		zap.Int("statusCode", statusCode))
+
+	if err != nil || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		i.log.Warn("smarthttp: webhook delivery failed", append(fields, zap.Error(err))...)
+
+		return
+	}
+
+	i.log.Debug("smarthttp: webhook delivered", fields...)
+}
+
+// LoadShed implements smarthttp.Instrumentation
+func (i *Instrumentation) LoadShed(req *http.Request, p99 time.Duration) {
+	i.log.Warn("smarthttp: request shed due to upstream latency", append(i.requestFields(req),
+		zap.Stringer("priority", smarthttp.PriorityFromContext(req.Context())), zap.Duration("p99", p99))...)
+}
+
+// PoolStats implements smarthttp.Instrumentation
+func (i *Instrumentation) PoolStats(name string, stats smarthttp.PoolStats) {
+	i.log.Debug("smarthttp: connection pool stats", zap.String("client", name), zap.String("host", stats.Host),
+		zap.Int("inFlight", stats.InFlight), zap.Int("inUse", stats.InUse), zap.Int("open", stats.Open),
+		zap.Int("idle", stats.Idle), zap.Int("requests", stats.Requests), zap.Int("reused", stats.Reused),
+		zap.Int("dialed", stats.Dialed))
+}
+
+func (i *Instrumentation) requestFields(req *http.Request) []zap.Field {
+	fields := []zap.Field{
+		zap.String("client", i.name),
+		zap.String("method", req.Method),
+		zap.String("path", req.URL.Path),
+	}
+
+	if template := smarthttp.PathTemplate(req); template != "" {
+		fields = append(fields, zap.String("pathTemplate", template))
+	}
+
+	return fields
+}
@@ -3,17 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
+	libconfig "github.com/karelrenaldi/storemono/libs/config"
 	"github.com/karelrenaldi/storemono/libs/smarthttp"
 	server "github.com/karelrenaldi/storemono/services/shop-service"
 	"github.com/karelrenaldi/storemono/services/shop-service/internal/config"
 	"github.com/karelrenaldi/storemono/services/shop-service/internal/constant"
+	"go.uber.org/zap"
 )
 
 const (
@@ -21,11 +21,13 @@ const (
 )
 
 func main() {
-	err := godotenv.Load()
+	envFiles, err := libconfig.LoadEnvFiles(".")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load env with err: %s\n", err)
 	}
 
+	fmt.Fprintf(os.Stderr, "loaded env files %v for env '%s'\n", envFiles, libconfig.AppEnv())
+
 	fmt.Fprintf(os.Stderr, "before config.New()\n")
 
 	cfg, err := config.New()
@@ -34,6 +36,8 @@ func main() {
 		return
 	}
 
+	cfg.Logger().Info("effective configuration", zap.Any("config", cfg.DumpSanitized()))
+
 	fmt.Fprintf(os.Stderr, "before newAppContext()\n")
 
 	ctx, err := newAppContext(cfg)
@@ -73,19 +77,9 @@ func newAppContext(cfg *config.AppConfig) (ctx context.Context, err error) {
 	ctx = context.Background()
 	ctx = context.WithValue(ctx, constant.AppConfig, cfg)
 
-	cli := &smarthttp.Client{
-		Name: "smarthttp",
-		Client: &http.Client{
-			Timeout: cfg.HTTPClientTimeout(),
-		},
-		CircuitBreaker: smarthttp.CircuitBreaker{
-			MaxConcurrentRequests: cfg.HTTPMaxConcurrency(),
-		},
-		Retries: &smarthttp.Retries{
-			MaxAttempts: cfg.HTTPRetryAttempts(),
-			BaseDelay:   cfg.HTTPRetryDelay(),
-			MaxDelay:    cfg.HTTPRetryMaxDelay(),
-		},
+	cli, err := smarthttp.NewClientFromConfig("smarthttp", cfg.HTTPClient())
+	if err != nil {
+		return nil, err
 	}
 
 	ctx = context.WithValue(ctx, constant.HTTPClient, cli)
@@ -4,13 +4,20 @@ go 1.16
 
 require (
 	github.com/gorilla/mux v1.8.0
-	github.com/joho/godotenv v1.4.0
+	github.com/jinzhu/gorm v1.9.16
+	github.com/joho/godotenv v1.4.0 // indirect
+	github.com/karelrenaldi/storemono/libs/config v0.0.0
+	github.com/karelrenaldi/storemono/libs/healthcheck v0.0.0
 	github.com/karelrenaldi/storemono/libs/http-utils v0.0.0
 	github.com/karelrenaldi/storemono/libs/logger v0.0.0
 	github.com/karelrenaldi/storemono/libs/smarthttp v0.0.0
 	go.uber.org/zap v1.21.0
 )
 
+replace github.com/karelrenaldi/storemono/libs/config v0.0.0 => ../../libs/config
+
+replace github.com/karelrenaldi/storemono/libs/healthcheck v0.0.0 => ../../libs/healthcheck
+
 replace github.com/karelrenaldi/storemono/libs/logger v0.0.0 => ../../libs/logger
 
 replace github.com/karelrenaldi/storemono/libs/http-utils v0.0.0 => ../../libs/http-utils
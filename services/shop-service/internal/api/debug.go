@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Debug exposes internal information that is useful when debugging a running instance
+type Debug struct {
+	Config DebugConfig
+}
+
+// AddRoutes adds the routers for this API to the provided router (or subrouter)
+func (d *Debug) AddRoutes(router *mux.Router) {
+	router.HandleFunc("/debug/config", d.configHandler).Methods("GET")
+}
+
+func (d *Debug) configHandler(resp http.ResponseWriter, _ *http.Request) {
+	resp.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(resp).Encode(d.Config.DumpSanitized())
+}
+
+// DebugConfig is the configuration required by the Debug API
+type DebugConfig interface {
+	// DumpSanitized returns the effective configuration with secrets masked
+	DumpSanitized() map[string]interface{}
+}
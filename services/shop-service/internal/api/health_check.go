@@ -1,19 +1,18 @@
 package api
 
 import (
-	"net/http"
-
 	"github.com/gorilla/mux"
+	"github.com/karelrenaldi/storemono/libs/healthcheck"
 )
 
-// HealthCheck is a standard, simple health check
-type HealthCheck struct{}
+// HealthCheck exposes the standard liveness, readiness and detailed health endpoints
+type HealthCheck struct {
+	Health *healthcheck.Health
+}
 
 // AddRoutes adds the routers for this API to the provided router (or subrouter)
 func (h *HealthCheck) AddRoutes(router *mux.Router) {
-	router.HandleFunc("/health", h.handler).Methods("GET")
-}
-
-func (h *HealthCheck) handler(resp http.ResponseWriter, _ *http.Request) {
-	_, _ = resp.Write([]byte(`OK`))
+	router.Handle("/live", h.Health.LiveHandler()).Methods("GET")
+	router.Handle("/ready", h.Health.ReadyHandler()).Methods("GET")
+	router.Handle("/health", h.Health.HealthHandler()).Methods("GET")
 }
@@ -1,127 +1,191 @@
 package config
 
 import (
-	"errors"
-	"os"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	libconfig "github.com/karelrenaldi/storemono/libs/config"
 	"github.com/karelrenaldi/storemono/libs/logger"
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
 	"go.uber.org/zap"
 )
 
-const (
-	readTimeoutDefault        = 2 * time.Second
-	writeTimeoutDefault       = 10 * time.Second
-	httpClientTimeoutDefault  = 5 * time.Second
-	httpRetryAttemptsDefault  = 3
-	httpRetryDelayDefault     = 10 * time.Millisecond
-	httpRetryMaxDelayDefault  = 1 * time.Second
-	httpMaxConcurrencyDefault = 10
-)
+// environment defines the environment variables used to configure the service (see libconfig.Load for the tags)
+type environment struct {
+	ApplicationHost string `env:"APPLICATION_HOST" required:"true"`
+	ApplicationPort string `env:"APPLICATION_PORT" required:"true"`
 
-func New() (*AppConfig, error) {
-	serverAddress, err := getServerAddress()
-	if err != nil {
-		return nil, err
+	// durations (e.g. "2s"); bare integers are still accepted as seconds (see parseServerTimeout)
+	ReadTimeout  string `env:"SERVER_READ_TIMEOUT" default:"2s"`
+	WriteTimeout string `env:"SERVER_WRITE_TIMEOUT" default:"10s"`
+
+	// the admin listener (debug endpoints) is disabled unless ADMIN_PORT is set; it must not be reachable publicly
+	AdminHost string `env:"ADMIN_HOST" default:"127.0.0.1"`
+	AdminPort string `env:"ADMIN_PORT"`
+
+	DB dbEnvironment
+
+	Legacy legacyEnvironment
+}
+
+// the prefix of the environment variables that configure the smarthttp client (see smarthttp.Config for the names)
+const httpClientEnvPrefix = "HTTP_CLIENT_"
+
+// legacyEnvironment defines the names of the variables before they were renamed (the smarthttp client variables moved
+// under the HTTP_CLIENT_ prefix and were named after the smarthttp.Config fields; durations no longer carry their unit
+// in the name):
+//
+//	HTTP_CLIENT_TIMEOUT_MS       -> HTTP_CLIENT_TIMEOUT
+//	HTTP_RETRY_DELAY_MS          -> HTTP_CLIENT_RETRY_BASE_DELAY
+//	HTTP_RETRY_MAX_DELAY_MS      -> HTTP_CLIENT_RETRY_MAX_DELAY
+//	HTTP_RETRY_ATTEMPTS          -> HTTP_CLIENT_RETRY_MAX_ATTEMPTS
+//	HTTP_CLIENT_MAX_CONCURRENCY  -> HTTP_CLIENT_CB_MAX_CONCURRENT_REQUESTS
+//	DB_CONN_MAX_LIFETIME_SEC     -> DB_CONN_MAX_LIFETIME
+//
+// The legacy names are still honoured in their original units (a warning is logged); when both names are set, the new
+// one is used.
+type legacyEnvironment struct {
+	HTTPClientTimeoutMS  int `env:"HTTP_CLIENT_TIMEOUT_MS"`
+	RetryDelayMS         int `env:"HTTP_RETRY_DELAY_MS"`
+	RetryMaxDelayMS      int `env:"HTTP_RETRY_MAX_DELAY_MS"`
+	RetryAttempts        int `env:"HTTP_RETRY_ATTEMPTS"`
+	MaxConcurrency       int `env:"HTTP_CLIENT_MAX_CONCURRENCY"`
+	DBConnMaxLifetimeSec int `env:"DB_CONN_MAX_LIFETIME_SEC"`
+}
+
+// apply overrides the configuration with the legacy variables that are set and returns their names
+func (l legacyEnvironment) apply(cfg *smarthttp.Config, db *dbEnvironment) []string {
+	var used []string
+
+	if l.HTTPClientTimeoutMS != 0 {
+		cfg.Timeout = time.Duration(l.HTTPClientTimeoutMS) * time.Millisecond
+		used = append(used, "HTTP_CLIENT_TIMEOUT_MS")
 	}
 
-	zapLogger, err := zap.NewProduction()
-	if err != nil {
-		return nil, err
+	if l.RetryDelayMS != 0 {
+		cfg.RetryBaseDelay = time.Duration(l.RetryDelayMS) * time.Millisecond
+		used = append(used, "HTTP_RETRY_DELAY_MS")
 	}
 
-	readTimeout, writeTimeout := getServerTimeout()
-	cliTimeout, retryDelay, retryMaxDelay, retryAttempts, concurrency := getHTTPClientConfig()
+	if l.RetryMaxDelayMS != 0 {
+		cfg.RetryMaxDelay = time.Duration(l.RetryMaxDelayMS) * time.Millisecond
+		used = append(used, "HTTP_RETRY_MAX_DELAY_MS")
+	}
 
-	return &AppConfig{
-		serverAddress:      serverAddress,
-		logger:             logger.NewLogger(zapLogger),
-		readTimeout:        readTimeout,
-		writeTimeout:       writeTimeout,
-		dbConfig:           getDBConfig(),
-		httpClientTimeout:  cliTimeout,
-		httpRetryDelay:     retryDelay,
-		httpRetryMaxDelay:  retryMaxDelay,
-		httpRetryAttempts:  retryAttempts,
-		httpMaxConcurrency: concurrency,
-	}, nil
+	if l.RetryAttempts != 0 {
+		cfg.RetryMaxAttempts = l.RetryAttempts
+		used = append(used, "HTTP_RETRY_ATTEMPTS")
+	}
+
+	if l.MaxConcurrency != 0 {
+		cfg.CBMaxConcurrentRequests = l.MaxConcurrency
+		used = append(used, "HTTP_CLIENT_MAX_CONCURRENCY")
+	}
+
+	if l.DBConnMaxLifetimeSec != 0 {
+		if db.ConnMaxLifetime == 0 {
+			db.ConnMaxLifetime = time.Duration(l.DBConnMaxLifetimeSec) * time.Second
+		}
+
+		used = append(used, "DB_CONN_MAX_LIFETIME_SEC")
+	}
+
+	return used
 }
 
-func getServerAddress() (string, error) {
-	applicationHost := os.Getenv("APPLICATION_HOST")
-	applicationPort := os.Getenv("APPLICATION_PORT")
+// parseServerTimeout parses the value of a server timeout variable; bare integers are seconds (the format used before
+// durations were supported)
+func parseServerTimeout(name, value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
 
-	if applicationHost == "" || applicationPort == "" {
-		return "", errors.New("application host or port is empty")
+	timeout, err := libconfig.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid environment variables: %s (%s)", name, err)
 	}
 
-	return os.Getenv("APPLICATION_HOST") + ":" + os.Getenv("APPLICATION_PORT"), nil
+	return timeout, nil
 }
 
-func getServerTimeout() (readTimeout, writeTimeout time.Duration) {
-	readTimeout = readTimeoutDefault
+// the defaults of the smarthttp client configuration (overridden by the environment variables)
+var defaultHTTPClient = smarthttp.Config{
+	Timeout:                 5 * time.Second,
+	RetryMaxAttempts:        3,
+	RetryBaseDelay:          10 * time.Millisecond,
+	RetryMaxDelay:           1 * time.Second,
+	CBMaxConcurrentRequests: 10,
+}
 
-	if os.Getenv("SERVER_READ_TIMEOUT") != "" {
-		convertedReadTimeout, err := strconv.Atoi(os.Getenv("SERVER_READ_TIMEOUT"))
-		if err == nil {
-			readTimeout = time.Duration(convertedReadTimeout) * time.Second
-		}
+func New() (*AppConfig, error) {
+	env := &environment{}
+
+	err := libconfig.Load(env)
+	if err != nil {
+		return nil, err
 	}
 
-	writeTimeout = writeTimeoutDefault
+	readTimeout, err := parseServerTimeout("SERVER_READ_TIMEOUT", env.ReadTimeout)
+	if err != nil {
+		return nil, err
+	}
 
-	if os.Getenv("SERVER_WRITE_TIMEOUT") != "" {
-		convertedWriteTimeout, err := strconv.Atoi(os.Getenv("SERVER_WRITE_TIMEOUT"))
-		if err == nil {
-			writeTimeout = time.Duration(convertedWriteTimeout) * time.Second
-		}
+	writeTimeout, err := parseServerTimeout("SERVER_WRITE_TIMEOUT", env.WriteTimeout)
+	if err != nil {
+		return nil, err
 	}
 
-	return
-}
+	httpClient := defaultHTTPClient
 
-func getHTTPClientConfig() (cliTimeout, retryDelay, retryMaxDelay time.Duration, retryAttempts, concurrency int) {
-	cliTimeout = httpClientTimeoutDefault
-	retryDelay = httpRetryDelayDefault
-	retryMaxDelay = httpRetryMaxDelayDefault
-	retryAttempts = httpRetryAttemptsDefault
-	concurrency = httpMaxConcurrencyDefault
+	// the legacy names override the defaults and the current names override both
+	legacyVariables := env.Legacy.apply(&httpClient, &env.DB)
 
-	if v, err := strconv.Atoi(os.Getenv("HTTP_CLIENT_TIMEOUT_MS")); err == nil {
-		cliTimeout = time.Duration(v) * time.Millisecond
+	err = httpClient.LoadEnv(httpClientEnvPrefix)
+	if err != nil {
+		return nil, err
 	}
 
-	if v, err := strconv.Atoi(os.Getenv("HTTP_RETRY_DELAY_MS")); err == nil {
-		retryDelay = time.Duration(v) * time.Millisecond
+	err = httpClient.Validate()
+	if err != nil {
+		return nil, err
 	}
 
-	if v, err := strconv.Atoi(os.Getenv("HTTP_RETRY_MAX_DELAY_MS")); err == nil {
-		retryMaxDelay = time.Duration(v) * time.Millisecond
+	zapLogger, err := zap.NewProduction()
+	if err != nil {
+		return nil, err
 	}
 
-	if v, err := strconv.Atoi(os.Getenv("HTTP_RETRY_ATTEMPTS")); err == nil {
-		retryAttempts = v
+	if len(legacyVariables) > 0 {
+		zapLogger.Warn("deprecated environment variables are set, see the renamed variables",
+			zap.Strings("variables", legacyVariables))
 	}
 
-	if v, err := strconv.Atoi(os.Getenv("HTTP_CLIENT_MAX_CONCURRENCY")); err == nil {
-		concurrency = v
+	adminAddress := ""
+	if env.AdminPort != "" {
+		adminAddress = env.AdminHost + ":" + env.AdminPort
 	}
 
-	return
+	return &AppConfig{
+		serverAddress: env.ApplicationHost + ":" + env.ApplicationPort,
+		adminAddress:  adminAddress,
+		logger:        logger.NewLogger(zapLogger),
+		readTimeout:   readTimeout,
+		writeTimeout:  writeTimeout,
+		dbConfig:      newDBConfig(env.DB),
+		httpClient:    httpClient,
+	}, nil
 }
 
 type AppConfig struct {
-	serverAddress      string
-	logger             *logger.Logger
-	readTimeout        time.Duration
-	writeTimeout       time.Duration
-	dbConfig           *DBConfig
-	httpClientTimeout  time.Duration
-	httpRetryDelay     time.Duration
-	httpRetryMaxDelay  time.Duration
-	httpRetryAttempts  int
-	httpMaxConcurrency int
+	serverAddress string
+	adminAddress  string
+	logger        *logger.Logger
+	readTimeout   time.Duration
+	writeTimeout  time.Duration
+	dbConfig      *DBConfig
+	httpClient    smarthttp.Config
 }
 
 // ServerAddress returns the server listening address
@@ -129,6 +193,11 @@ func (cfg *AppConfig) ServerAddress() string {
 	return cfg.serverAddress
 }
 
+// AdminAddress returns the listening address of the admin server (empty when it is disabled)
+func (cfg *AppConfig) AdminAddress() string {
+	return cfg.adminAddress
+}
+
 // Logger returns the logging client
 func (cfg *AppConfig) Logger() *logger.Logger {
 	return cfg.logger
@@ -149,27 +218,36 @@ func (cfg *AppConfig) DBConfig() *DBConfig {
 	return cfg.dbConfig
 }
 
-// HTTPClientTimeout returns the timeout for the smarthttp client
-func (cfg *AppConfig) HTTPClientTimeout() time.Duration {
-	return cfg.httpClientTimeout
+// HTTPClient returns the (validated) configuration of the smarthttp client
+func (cfg *AppConfig) HTTPClient() smarthttp.Config {
+	return cfg.httpClient
 }
 
-// HTTPRetryAttempts returns the max attempts for the smarthttp client
-func (cfg *AppConfig) HTTPRetryAttempts() int {
-	return cfg.httpRetryAttempts
-}
-
-// HTTPRetryDelay returns the base delay for the smarthttp client
-func (cfg *AppConfig) HTTPRetryDelay() time.Duration {
-	return cfg.httpRetryDelay
-}
-
-// HTTPRetryMaxDelay returns the max delay for the smarthttp client
-func (cfg *AppConfig) HTTPRetryMaxDelay() time.Duration {
-	return cfg.httpRetryMaxDelay
-}
-
-// HTTPMaxConcurrency returns the max concurrency for the smarthttp client
-func (cfg *AppConfig) HTTPMaxConcurrency() int {
-	return cfg.httpMaxConcurrency
+// DumpSanitized returns the effective configuration (after defaults are applied) with all secrets masked.
+// It is intended for logging and debugging only.
+func (cfg *AppConfig) DumpSanitized() map[string]interface{} {
+	return map[string]interface{}{
+		"serverAddress": cfg.serverAddress,
+		"adminAddress":  cfg.adminAddress,
+		"readTimeout":   cfg.readTimeout.String(),
+		"writeTimeout":  cfg.writeTimeout.String(),
+		"db": map[string]interface{}{
+			"connStringMaster":  libconfig.MaskDSN(cfg.dbConfig.connStringMaster),
+			"connStringSlave":   libconfig.MaskDSN(cfg.dbConfig.connStringSlave),
+			"dialect":           cfg.dbConfig.dialect,
+			"enableLog":         cfg.dbConfig.enableLog,
+			"enableAutoMigrate": cfg.dbConfig.enableAutoMigrate,
+			"maxIdleConn":       cfg.dbConfig.maxIdleConn,
+			"maxOpenConn":       cfg.dbConfig.maxOpenConn,
+			"connMaxLifetime":   cfg.dbConfig.connMaxLifetime.String(),
+		},
+		"httpClient": map[string]interface{}{
+			"timeout":          cfg.httpClient.Timeout.String(),
+			"connectTimeout":   cfg.httpClient.ConnectTimeout.String(),
+			"retryMaxAttempts": cfg.httpClient.RetryMaxAttempts,
+			"retryBaseDelay":   cfg.httpClient.RetryBaseDelay.String(),
+			"retryMaxDelay":    cfg.httpClient.RetryMaxDelay.String(),
+			"maxConcurrency":   cfg.httpClient.CBMaxConcurrentRequests,
+		},
+	}
 }
@@ -1,27 +1,32 @@
 package config
 
 import (
-	"os"
-	"strconv"
 	"time"
 )
 
-func getDBConfig() *DBConfig {
-	enableLog, _ := strconv.ParseBool(os.Getenv("DB_ENABLE_LOG"))
-	enableAutoMigrate, _ := strconv.ParseBool(os.Getenv("DB_ENABLE_AUTO_MIGRATE"))
-	maxIdleConn, _ := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONN"))
-	maxOpenConn, _ := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONN"))
-	connMaxLifetimeSec, _ := strconv.Atoi(os.Getenv("DB_CONN_MAX_LIFETIME_SEC"))
+// dbEnvironment defines the environment variables used to configure the DB client.
+// Connection strings contain credentials and as such can also be supplied as secret files (e.g. DB_CONN_MASTER_FILE).
+type dbEnvironment struct {
+	ConnStringMaster  string        `env:"DB_CONN_MASTER" required:"true"`
+	ConnStringSlave   string        `env:"DB_CONN_SLAVE"`
+	Dialect           string        `env:"DB_DIALECT"`
+	EnableLog         bool          `env:"DB_ENABLE_LOG"`
+	EnableAutoMigrate bool          `env:"DB_ENABLE_AUTO_MIGRATE"`
+	MaxIdleConn       int           `env:"DB_MAX_IDLE_CONN"`
+	MaxOpenConn       int           `env:"DB_MAX_OPEN_CONN"`
+	ConnMaxLifetime   time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+}
 
+func newDBConfig(env dbEnvironment) *DBConfig {
 	return &DBConfig{
-		os.Getenv("DB_CONN_MASTER"),
-		os.Getenv("DB_CONN_SLAVE"),
-		os.Getenv("DB_DIALECT"),
-		enableLog,
-		enableAutoMigrate,
-		maxIdleConn,
-		maxOpenConn,
-		time.Duration(connMaxLifetimeSec) * time.Second,
+		env.ConnStringMaster,
+		env.ConnStringSlave,
+		env.Dialect,
+		env.EnableLog,
+		env.EnableAutoMigrate,
+		env.MaxIdleConn,
+		env.MaxOpenConn,
+		env.ConnMaxLifetime,
 	}
 }
 
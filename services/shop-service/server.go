@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/karelrenaldi/storemono/libs/healthcheck"
 	"github.com/karelrenaldi/storemono/libs/logger"
+	"github.com/karelrenaldi/storemono/libs/smarthttp"
+	"github.com/karelrenaldi/storemono/services/shop-service/internal/api"
 	"github.com/karelrenaldi/storemono/services/shop-service/internal/constant"
 	"go.uber.org/zap"
 )
@@ -23,7 +26,16 @@ func NewServer(ctx context.Context) (*Server, error) {
 		return nil, errors.New("no config in ctx")
 	}
 
-	return &Server{
+	health := &healthcheck.Health{}
+
+	if cli, ok := ctx.Value(constant.HTTPClient).(*smarthttp.Client); ok {
+		// an open circuit indicates a failing upstream, this instance can still serve other requests
+		health.Register(cli.Name, healthcheck.CircuitBreaker(cli), healthcheck.Config{NonCritical: true})
+	}
+
+	(&api.HealthCheck{Health: health}).AddRoutes(router)
+
+	server := &Server{
 		logger: cfg.Logger(),
 		server: &http.Server{
 			Addr:         cfg.ServerAddress(),
@@ -31,11 +43,28 @@ func NewServer(ctx context.Context) (*Server, error) {
 			ReadTimeout:  cfg.ReadTimeout(),
 			WriteTimeout: cfg.WriteTimeout(),
 		},
-	}, nil
+	}
+
+	// the debug endpoints expose internal information, they are only served by the (internal) admin listener
+	if cfg.AdminAddress() != "" {
+		adminRouter := mux.NewRouter()
+
+		(&api.Debug{Config: cfg}).AddRoutes(adminRouter)
+
+		server.admin = &http.Server{
+			Addr:         cfg.AdminAddress(),
+			Handler:      adminRouter,
+			ReadTimeout:  cfg.ReadTimeout(),
+			WriteTimeout: cfg.WriteTimeout(),
+		}
+	}
+
+	return server, nil
 }
 
 type Server struct {
 	server *http.Server
+	admin  *http.Server
 	logger *logger.Logger
 }
 
@@ -48,19 +77,39 @@ func (s *Server) Listen() {
 
 	s.logger.Info("starting server", zap.String("address", s.Address()))
 
+	if s.admin != nil {
+		s.logger.Info("starting admin server", zap.String("address", s.admin.Addr))
+
+		go func() {
+			err := s.admin.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("admin server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	s.server.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.admin != nil {
+		_ = s.admin.Shutdown(ctx)
+	}
+
 	return s.server.Shutdown(ctx)
 }
 
 type ServerConfig interface {
 	ServerAddress() string
 
+	// AdminAddress is the listening address of the admin server (empty when it is disabled)
+	AdminAddress() string
+
 	Logger() *logger.Logger
 
 	ReadTimeout() time.Duration
 
 	WriteTimeout() time.Duration
+
+	DumpSanitized() map[string]interface{}
 }